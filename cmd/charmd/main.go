@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/juju/loggo"
 	"gopkg.in/errgo.v1"
@@ -19,6 +20,7 @@ import (
 	"gopkg.in/juju/charmstore.v4/config"
 	"gopkg.in/juju/charmstore.v4/internal/debug"
 	"gopkg.in/juju/charmstore.v4/internal/elasticsearch"
+	"gopkg.in/juju/charmstore.v4/params"
 )
 
 var (
@@ -72,9 +74,25 @@ func serve(confPath string) error {
 
 	logger.Infof("setting up the API server")
 	cfg := charmstore.ServerParams{
-		AuthUsername:     conf.AuthUsername,
-		AuthPassword:     conf.AuthPassword,
-		IdentityLocation: conf.IdentityLocation,
+		AuthUsername:             conf.AuthUsername,
+		AuthPassword:             conf.AuthPassword,
+		IdentityLocation:         conf.IdentityLocation,
+		GroupsFile:               conf.GroupsFile,
+		IdentityAPIURL:           conf.IdentityAPIURL,
+		IdentityAPITimeout:       time.Duration(conf.IdentityAPITimeout) * time.Second,
+		ACLPruneInterval:         time.Duration(conf.ACLPruneInterval) * time.Second,
+		PublishScheduledInterval: time.Duration(conf.PublishScheduledInterval) * time.Second,
+		RetentionInterval:        time.Duration(conf.RetentionInterval) * time.Second,
+		StorageQuota:             conf.StorageQuota,
+	}
+	if len(conf.RateLimits) > 0 {
+		cfg.RateLimits = make(map[string]params.RateLimit)
+		for class, limit := range conf.RateLimits {
+			cfg.RateLimits[class] = params.RateLimit{
+				Rate:  limit.Rate,
+				Burst: limit.Burst,
+			}
+		}
 	}
 	var identityPublicKey bakery.PublicKey
 	err = identityPublicKey.UnmarshalText([]byte(conf.IdentityPublicKey))
@@ -88,6 +106,7 @@ func serve(confPath string) error {
 	if err != nil {
 		return errgo.Notef(err, "cannot create new server at %q", conf.APIAddr)
 	}
+	defer server.Close()
 
 	logger.Infof("starting the API server")
 	return http.ListenAndServe(conf.APIAddr, debug.Handler("", server))
@@ -24,6 +24,40 @@ type Config struct {
 	ESAddr            string `yaml:"elasticsearch-addr"` // elasticsearch is optional
 	IdentityPublicKey string `yaml:"identity-public-key"`
 	IdentityLocation  string `yaml:"identity-location"`
+	GroupsFile        string `yaml:"groups-file"`      // groups-file is optional
+	IdentityAPIURL    string `yaml:"identity-api-url"` // identity-api-url is optional
+
+	// IdentityAPITimeout holds the maximum duration in seconds of
+	// the requests to the identity service API. It is optional.
+	IdentityAPITimeout int `yaml:"identity-api-timeout"`
+
+	// RateLimits holds the request rate limits of each class of
+	// endpoints (download, upload, search or meta). It is optional.
+	RateLimits map[string]RateLimit `yaml:"rate-limits"`
+
+	// StorageQuota holds the default maximum total size in bytes
+	// of the archives in a user namespace. It is optional.
+	StorageQuota int64 `yaml:"storage-quota"`
+
+	// ACLPruneInterval, PublishScheduledInterval and
+	// RetentionInterval hold the intervals in seconds between
+	// runs of the background jobs that remove expired
+	// permissions, publish embargoed entities whose publication
+	// time has been reached and apply the retention policies.
+	// They are optional; a job whose interval is zero never runs.
+	ACLPruneInterval         int `yaml:"acl-prune-interval"`
+	PublishScheduledInterval int `yaml:"publish-scheduled-interval"`
+	RetentionInterval        int `yaml:"retention-interval"`
+}
+
+// RateLimit holds the maximum rate of the requests that a client
+// can make to a class of endpoints.
+type RateLimit struct {
+	// Rate holds the number of requests per second allowed on average.
+	Rate float64 `yaml:"rate"`
+
+	// Burst holds the number of requests allowed at once.
+	Burst int `yaml:"burst"`
 }
 
 func (c *Config) validate() error {
@@ -34,6 +34,13 @@ auth-username: myuser
 auth-password: mypasswd
 identity-location: localhost:18082
 identity-public-key: 0000
+groups-file: /etc/charmstore/groups.yaml
+identity-api-timeout: 10
+rate-limits:
+  search: {rate: 5, burst: 20}
+storage-quota: 1000000
+acl-prune-interval: 3600
+publish-scheduled-interval: 60
 `
 
 func (s *ConfigSuite) readConfig(c *gc.C, content string) (*config.Config, error) {
@@ -50,12 +57,20 @@ func (s *ConfigSuite) TestRead(c *gc.C) {
 	conf, err := s.readConfig(c, testConfig)
 	c.Assert(err, gc.IsNil)
 	c.Assert(conf, jc.DeepEquals, &config.Config{
-		MongoURL:          "localhost:23456",
-		APIAddr:           "blah:2324",
-		AuthUsername:      "myuser",
-		AuthPassword:      "mypasswd",
-		IdentityLocation:  "localhost:18082",
-		IdentityPublicKey: "0000",
+		MongoURL:           "localhost:23456",
+		APIAddr:            "blah:2324",
+		AuthUsername:       "myuser",
+		AuthPassword:       "mypasswd",
+		IdentityLocation:   "localhost:18082",
+		IdentityPublicKey:  "0000",
+		GroupsFile:         "/etc/charmstore/groups.yaml",
+		IdentityAPITimeout: 10,
+		RateLimits: map[string]config.RateLimit{
+			"search": {Rate: 5, Burst: 20},
+		},
+		StorageQuota:             1000000,
+		ACLPruneInterval:         3600,
+		PublishScheduledInterval: 60,
 	})
 }
 
@@ -20,6 +20,7 @@ import (
 	"gopkg.in/errgo.v1"
 	"gopkg.in/juju/charm.v5-unstable"
 	"gopkg.in/macaroon-bakery.v0/httpbakery"
+	"gopkg.in/macaroon.v1"
 
 	"gopkg.in/juju/charmstore.v4/params"
 )
@@ -52,6 +53,10 @@ type Params struct {
 	User     string
 	Password string
 
+	// Token holds an API token used to authenticate the client
+	// as bearer credentials. It is ignored if User is set.
+	Token string
+
 	// HTTPClient holds the HTTP client to use when making
 	// requests to the store. If nil, httpbakery.NewHTTPClient will
 	// be used.
@@ -217,6 +222,33 @@ func (c *Client) PutExtraInfo(id *charm.Reference, info map[string]interface{})
 	return nil
 }
 
+// Publish publishes the charm or bundle revision with the given id
+// to the given channels, and returns all the channels it is now
+// published to. The id must include the series and revision.
+func (c *Client) Publish(id *charm.Reference, channels []params.Channel) ([]params.Channel, error) {
+	data, err := json.Marshal(params.PublishRequest{
+		Channels: channels,
+	})
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot marshal publish request")
+	}
+	req, err := http.NewRequest("POST", "", nil)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot make new request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.DoWithBody(req, "/"+id.Path()+"/publish", httpbakery.SeekerBody(bytes.NewReader(data)))
+	if err != nil {
+		return nil, errgo.NoteMask(err, "cannot publish "+id.String(), errgo.Any)
+	}
+	defer resp.Body.Close()
+	var result params.PublishResponse
+	if err := parseResponseBody(resp.Body, &result); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return result.Channels, nil
+}
+
 // Meta fetches metadata on the charm or bundle with the
 // given id. The result value provides a value
 // to be filled in with the result, which must be
@@ -388,6 +420,8 @@ func (c *Client) DoWithBody(req *http.Request, path string, getBody httpbakery.B
 		userPass := c.params.User + ":" + c.params.Password
 		authBasic := base64.StdEncoding.EncodeToString([]byte(userPass))
 		req.Header.Set("Authorization", "Basic "+authBasic)
+	} else if c.params.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.params.Token)
 	}
 
 	// Prepare the request.
@@ -491,3 +525,38 @@ func (cs *Client) Log(typ params.LogType, level params.LogLevel, message string,
 	resp.Body.Close()
 	return nil
 }
+
+// Macaroon returns a discharged macaroon that can be used to make
+// requests to the charm store, for instance by handing it to a CI job
+// that cannot authenticate interactively. Each field specified in p
+// adds a first-party caveat restricting the macaroon before it is
+// discharged. Any interaction required to discharge the macaroon is
+// performed using the VisitWebPage function in the client parameters.
+//
+// The returned macaroons can be sent to the charm store as a cookie,
+// for instance using httpbakery.NewCookie.
+func (c *Client) Macaroon(p params.MacaroonRequest) (macaroon.Slice, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot marshal macaroon request")
+	}
+	req, err := http.NewRequest("POST", "", nil)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot make new request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.DoWithBody(req, "/macaroon", httpbakery.SeekerBody(bytes.NewReader(data)))
+	if err != nil {
+		return nil, errgo.NoteMask(err, "cannot get macaroon", errgo.Any)
+	}
+	defer resp.Body.Close()
+	var m macaroon.Macaroon
+	if err := parseResponseBody(resp.Body, &m); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	ms, err := httpbakery.DischargeAll(&m, c.params.HTTPClient, c.params.VisitWebPage)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot discharge macaroon")
+	}
+	return ms, nil
+}
@@ -15,6 +15,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -24,11 +25,13 @@ import (
 	"gopkg.in/macaroon-bakery.v0/bakerytest"
 	"gopkg.in/macaroon-bakery.v0/httpbakery"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	"gopkg.in/juju/charmstore.v4"
 	"gopkg.in/juju/charmstore.v4/csclient"
 	"gopkg.in/juju/charmstore.v4/internal/blobstore"
 	internalCharmstore "gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
 	"gopkg.in/juju/charmstore.v4/internal/storetesting"
 	"gopkg.in/juju/charmstore.v4/params"
 )
@@ -953,6 +956,35 @@ func (s *suite) TestPutExtraInfoWithError(c *gc.C) {
 	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
 }
 
+func (s *suite) TestPutExtraInfoWithAPIToken(c *gc.C) {
+	url := charm.MustParseReference("~bob/utopic/wordpress-42")
+	err := s.store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	token, err := s.store.AddAPIToken(&mongodoc.APIToken{
+		User:       "bob",
+		Operations: []string{params.TokenMetaWrite},
+		Expires:    time.Now().Add(time.Hour),
+	})
+	c.Assert(err, gc.IsNil)
+
+	// The token is sent as bearer credentials.
+	client := csclient.New(csclient.Params{
+		URL:   s.srv.URL,
+		Token: token,
+	})
+	err = client.PutExtraInfo(url, map[string]interface{}{"attr": "val"})
+	c.Assert(err, gc.IsNil)
+
+	// An invalid token is rejected.
+	client = csclient.New(csclient.Params{
+		URL:   s.srv.URL,
+		Token: token + "-bad",
+	})
+	err = client.PutExtraInfo(url, map[string]interface{}{"attr": "val"})
+	c.Assert(err, gc.ErrorMatches, "invalid API token")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrUnauthorized)
+}
+
 type errorReader struct {
 	error string
 }
@@ -978,6 +1010,27 @@ func mustMarshalJSON(x interface{}) []byte {
 	return data
 }
 
+func (s *suite) TestPublish(c *gc.C) {
+	ch := storetesting.Charms.CharmDir("wordpress")
+	url := charm.MustParseReference("~charmers/utopic/wordpress-42")
+	err := s.store.AddCharmWithArchive(url, nil, ch)
+	c.Assert(err, gc.IsNil)
+
+	channels, err := s.client.Publish(url, []params.Channel{params.DevelopmentChannel, params.CandidateChannel})
+	c.Assert(err, gc.IsNil)
+	c.Assert(channels, jc.DeepEquals, []params.Channel{
+		params.StableChannel,
+		params.CandidateChannel,
+		params.DevelopmentChannel,
+	})
+}
+
+func (s *suite) TestPublishWithError(c *gc.C) {
+	_, err := s.client.Publish(charm.MustParseReference("~charmers/utopic/wordpress-42"), []params.Channel{params.StableChannel})
+	c.Assert(err, gc.ErrorMatches, `cannot publish cs:~charmers/utopic/wordpress-42: entity not found`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+}
+
 func (s *suite) TestLog(c *gc.C) {
 	logs := []struct {
 		typ     params.LogType
@@ -1075,3 +1128,58 @@ func (s *suite) TestMacaroonAuthorization(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, `cannot get "/utopic/wordpress-42/meta/any\?include=id-revision": cannot get discharge from ".*": cannot start interactive session: stopping interaction`)
 	c.Assert(result.IdRevision.Revision, gc.Equals, curl.Revision)
 }
+
+func (s *suite) TestMacaroon(c *gc.C) {
+	id := charm.MustParseReference("~bob/utopic/wordpress-42")
+	err := s.store.AddCharmWithArchive(id, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	err = s.store.DB.BaseEntities().UpdateId(charm.MustParseReference("~bob/wordpress"), bson.D{{"$set",
+		bson.D{{"acls.read", []string{"bob"}}},
+	}})
+	c.Assert(err, gc.IsNil)
+
+	// Retrieve a read only macaroon.
+	s.discharge = func(cond, arg string) ([]checkers.Caveat, error) {
+		return []checkers.Caveat{checkers.DeclaredCaveat("username", "bob")}, nil
+	}
+	client := csclient.New(csclient.Params{
+		URL: s.srv.URL,
+	})
+	ms, err := client.Macaroon(params.MacaroonRequest{
+		Operations: []string{params.OperationRead},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(ms, gc.HasLen, 2)
+	found := false
+	for _, cav := range ms[0].Caveats() {
+		if cav.Id == "operation read" {
+			found = true
+		}
+	}
+	c.Assert(found, gc.Equals, true)
+
+	// Hand the macaroon to a client that cannot authenticate.
+	s.discharge = func(cond, arg string) ([]checkers.Caveat, error) {
+		return nil, fmt.Errorf("no discharge")
+	}
+	cookie, err := httpbakery.NewCookie(ms)
+	c.Assert(err, gc.IsNil)
+	httpClient := httpbakery.NewHTTPClient()
+	srvURL, err := url.Parse(s.srv.URL)
+	c.Assert(err, gc.IsNil)
+	httpClient.Jar.SetCookies(srvURL, []*http.Cookie{cookie})
+	client = csclient.New(csclient.Params{
+		URL:        s.srv.URL,
+		HTTPClient: httpClient,
+	})
+
+	// The macaroon can be used to read the entity.
+	var result struct{ IdRevision struct{ Revision int } }
+	_, err = client.Meta(id, &result)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.IdRevision.Revision, gc.Equals, id.Revision)
+
+	// The macaroon cannot be used to modify the entity.
+	err = client.PutExtraInfo(id, map[string]interface{}{"attr": "val"})
+	c.Assert(err, gc.ErrorMatches, `cannot get discharge from ".*": cannot discharge: no discharge`)
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// PruneExpiredACLs removes from the permissions of all charms and
+// bundles the time-limited entries that have expired at the given
+// time, and updates the search index accordingly. Each removal is
+// logged. It returns the number of removed entries.
+//
+// Each entry is removed with its own update, conditioned on the entry
+// still being expired, so that concurrent changes to the permissions
+// are not lost.
+func (s *Store) PruneExpiredACLs(now time.Time) (int, error) {
+	var baseEntities []*mongodoc.BaseEntity
+	if err := s.DB.BaseEntities().Find(bson.D{{
+		"acls.expiries.expires", bson.D{{"$lte", now}},
+	}}).Select(bson.D{{"_id", 1}, {"acls", 1}}).All(&baseEntities); err != nil {
+		return 0, errgo.Notef(err, "cannot retrieve base entities")
+	}
+	removed := 0
+	for _, e := range baseEntities {
+		for _, expiry := range e.ACLs.Expiries {
+			if now.Before(expiry.Expires) || e.ACLs.Perm(expiry.Perm) == nil {
+				continue
+			}
+			ok, err := s.pruneExpiredACL(e.URL, expiry, now)
+			if err != nil {
+				return removed, errgo.Notef(err, "cannot update base entity %q", e.URL)
+			}
+			if ok {
+				logger.Infof("removed expired %s permission for %q from %s", expiry.Perm, expiry.Name, e.URL)
+				removed++
+			}
+		}
+		if err := s.updateSearchBase(e.URL); err != nil {
+			return removed, errgo.Notef(err, "cannot update search index for %q", e.URL)
+		}
+	}
+	return removed, nil
+}
+
+// pruneExpiredACL removes the given expired entry from the permissions
+// of the base entity with the given id, if the entry has not been
+// changed in the meantime. It reports whether the entry was removed.
+func (s *Store) pruneExpiredACL(id *charm.Reference, expiry mongodoc.ACLExpiry, now time.Time) (bool, error) {
+	expired := bson.D{
+		{"perm", expiry.Perm},
+		{"name", expiry.Name},
+		{"expires", bson.D{{"$lte", now}}},
+	}
+	err := s.DB.BaseEntities().Update(bson.D{
+		{"_id", id},
+		{"acls.expiries", bson.D{{"$elemMatch", expired}}},
+	}, bson.D{{"$pull", bson.D{
+		{"acls." + expiry.Perm, expiry.Name},
+		{"acls.expiries", expired},
+	}}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	if expiry.Perm == "read" && expiry.Name == params.Everyone {
+		err := s.DB.BaseEntities().Update(bson.D{
+			{"_id", id},
+			{"acls.read", bson.D{{"$ne", params.Everyone}}},
+		}, bson.D{{"$set", bson.D{{"public", false}}}})
+		if err != nil && err != mgo.ErrNotFound {
+			return false, errgo.Mask(err)
+		}
+	}
+	return true, nil
+}
+
+// pruneExpiredACLsLoop calls PruneExpiredACLs every interval
+// until closed is closed.
+func (s *Store) pruneExpiredACLsLoop(interval time.Duration, closed <-chan struct{}) {
+	runEvery(interval, closed, func(now time.Time) {
+		if _, err := s.PruneExpiredACLs(now); err != nil {
+			logger.Errorf("cannot prune expired permissions: %v", err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestPruneExpiredACLs(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	for _, id := range []string{"~bob/trusty/wordpress-0", "~bob/trusty/mysql-0"} {
+		url := charm.MustParseReference(id)
+		err := store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir(url.Name))
+		c.Assert(err, gc.IsNil)
+	}
+	now := time.Now()
+	later := now.Add(time.Hour).Truncate(time.Millisecond).UTC()
+	err = store.UpdateBaseEntity(charm.MustParseReference("~bob/wordpress"), bson.D{{"$set", bson.D{{
+		"acls", mongodoc.ACL{
+			Read:  []string{params.Everyone, "bob", "alice"},
+			Write: []string{"bob", "alice", "ci"},
+			Expiries: []mongodoc.ACLExpiry{{
+				Perm:    "read",
+				Name:    params.Everyone,
+				Expires: now.Add(-time.Minute),
+			}, {
+				Perm:    "write",
+				Name:    "alice",
+				Expires: now.Add(-time.Hour),
+			}, {
+				Perm:    "write",
+				Name:    "ci",
+				Expires: later,
+			}},
+		},
+	}}}})
+	c.Assert(err, gc.IsNil)
+
+	removed, err := store.PruneExpiredACLs(now)
+	c.Assert(err, gc.IsNil)
+	c.Assert(removed, gc.Equals, 2)
+	baseEntity, err := store.FindBaseEntity(charm.MustParseReference("~bob/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, mongodoc.ACL{
+		Read:  []string{"bob", "alice"},
+		Write: []string{"bob", "ci"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "write",
+			Name:    "ci",
+			Expires: later,
+		}},
+	})
+	c.Assert(baseEntity.Public, jc.IsFalse)
+
+	// Entities without expired entries are not changed.
+	baseEntity, err = store.FindBaseEntity(charm.MustParseReference("~bob/mysql"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, DefaultACLs("bob"))
+
+	// Nothing is left to remove.
+	removed, err = store.PruneExpiredACLs(now)
+	c.Assert(err, gc.IsNil)
+	c.Assert(removed, gc.Equals, 0)
+}
+
+func (s *StoreSuite) TestPruneExpiredACLsKeepsChangedEntries(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	url := charm.MustParseReference("~bob/trusty/wordpress-0")
+	err = store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir(url.Name))
+	c.Assert(err, gc.IsNil)
+	now := time.Now()
+	later := now.Add(time.Hour).Truncate(time.Millisecond).UTC()
+	acls := mongodoc.ACL{
+		Read: []string{params.Everyone, "bob", "alice"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "read",
+			Name:    "alice",
+			Expires: later,
+		}},
+	}
+	err = store.UpdateBaseEntity(url, bson.D{{"$set", bson.D{{"acls", acls}}}})
+	c.Assert(err, gc.IsNil)
+
+	// The permission of alice has been extended since
+	// it was found to be expired, so it is not removed.
+	removed, err := store.pruneExpiredACL(baseURL(url), mongodoc.ACLExpiry{
+		Perm:    "read",
+		Name:    "alice",
+		Expires: now.Add(-time.Minute),
+	}, now)
+	c.Assert(err, gc.IsNil)
+	c.Assert(removed, jc.IsFalse)
+	baseEntity, err := store.FindBaseEntity(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, acls)
+}
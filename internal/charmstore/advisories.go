@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// Advisories returns the mongo collection where security
+// advisories are stored.
+func (s StoreDatabase) Advisories() *mgo.Collection {
+	return s.C("advisories")
+}
+
+// AddAdvisory adds the given security advisory and updates the search
+// records of the affected charm or bundle. If the advisory time is not
+// set, the current time is used. It returns an error with a
+// params.ErrForbidden cause if an advisory with the same id already
+// exists for the same charm or bundle.
+func (s *Store) AddAdvisory(a *mongodoc.Advisory) error {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	// Mongo stores times with millisecond precision: truncate the
+	// time so that the given advisory matches the stored one.
+	a.Time = a.Time.UTC().Truncate(time.Millisecond)
+	if err := s.DB.Advisories().Insert(a); err != nil {
+		if mgo.IsDup(err) {
+			return errgo.WithCausef(nil, params.ErrForbidden, "advisory %q already exists for %s", a.Id, a.BaseURL)
+		}
+		return errgo.Notef(err, "cannot insert advisory %q", a.Id)
+	}
+	if err := s.updateSearchBase(a.BaseURL); err != nil {
+		return errgo.Notef(err, "cannot update search index for %q", a.BaseURL)
+	}
+	return nil
+}
+
+// EntityAdvisories returns the security advisories affecting the
+// entity with the given id, most recent first. It returns an error
+// with a params.ErrNotFound cause if the entity does not exist.
+func (s *Store) EntityAdvisories(id *charm.Reference) ([]*mongodoc.Advisory, error) {
+	entity, err := s.FindEntity(id, "_id", "baseurl")
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	return s.entityAdvisories(entity)
+}
+
+// entityAdvisories returns the security advisories affecting the
+// given entity, which must hold at least its id and base URL.
+func (s *Store) entityAdvisories(entity *mongodoc.Entity) ([]*mongodoc.Advisory, error) {
+	advisories, err := s.FindAdvisories(AdvisoryQuery{
+		BaseURL: entity.BaseURL,
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	affecting := advisories[:0]
+	for _, a := range advisories {
+		if a.Affects(entity.URL) {
+			affecting = append(affecting, a)
+		}
+	}
+	return affecting, nil
+}
+
+// AdvisoryQuery holds the criteria used to select security advisories.
+// Zero valued fields are ignored.
+type AdvisoryQuery struct {
+	// BaseURL holds the base URL of the affected charm or bundle.
+	BaseURL *charm.Reference
+
+	// Severity holds the severity of the advisories.
+	Severity string
+
+	// After holds the time after which the advisories were created.
+	After time.Time
+
+	// Skip and Limit hold the number of advisories to skip and
+	// the maximum number of advisories to return.
+	Skip, Limit int
+}
+
+// FindAdvisories returns the security advisories matching the given
+// query, most recent first.
+func (s *Store) FindAdvisories(q AdvisoryQuery) ([]*mongodoc.Advisory, error) {
+	query := make(bson.D, 0, 3)
+	if q.BaseURL != nil {
+		query = append(query, bson.DocElem{"baseurl", q.BaseURL})
+	}
+	if q.Severity != "" {
+		query = append(query, bson.DocElem{"severity", q.Severity})
+	}
+	if !q.After.IsZero() {
+		query = append(query, bson.DocElem{"time", bson.D{{"$gt", q.After.UTC()}}})
+	}
+	var advisories []*mongodoc.Advisory
+	if err := s.DB.Advisories().Find(query).Sort("-time", "id").Skip(q.Skip).Limit(q.Limit).All(&advisories); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve advisories")
+	}
+	for _, a := range advisories {
+		a.Time = a.Time.UTC()
+	}
+	return advisories, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestAdvisories(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url0 := charm.MustParseReference("~charmers/trusty/wordpress-0")
+	url1 := charm.MustParseReference("~charmers/trusty/wordpress-1")
+	for _, url := range []*charm.Reference{url0, url1} {
+		err := store.AddCharmWithArchive(url, nil, wordpress)
+		c.Assert(err, gc.IsNil)
+	}
+	baseURL := charm.MustParseReference("cs:~charmers/wordpress")
+	t0 := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := &mongodoc.Advisory{
+		Id:          "CVE-2015-0001",
+		BaseURL:     baseURL,
+		Severity:    params.SeverityLow,
+		Description: "old issue",
+		Affected:    []params.RevisionRange{{From: 0, To: 1}},
+		Fixed:       charm.MustParseReference("cs:~charmers/trusty/wordpress-2"),
+		Time:        t0,
+	}
+	err = store.AddAdvisory(old)
+	c.Assert(err, gc.IsNil)
+	recent := &mongodoc.Advisory{
+		Id:          "CVE-2015-0002",
+		BaseURL:     baseURL,
+		Severity:    params.SeverityHigh,
+		Description: "recent issue",
+		Affected:    []params.RevisionRange{{Series: "trusty", From: 1, To: 1}},
+		Time:        t0.Add(time.Hour),
+	}
+	err = store.AddAdvisory(recent)
+	c.Assert(err, gc.IsNil)
+
+	// Advisory ids are unique for each charm or bundle.
+	err = store.AddAdvisory(&mongodoc.Advisory{
+		Id:      "CVE-2015-0001",
+		BaseURL: baseURL,
+	})
+	c.Assert(err, gc.ErrorMatches, `advisory "CVE-2015-0001" already exists for cs:~charmers/wordpress`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+
+	// The same vulnerability can affect other charms.
+	otherBaseURL := charm.MustParseReference("cs:~bob/wordpress")
+	other := &mongodoc.Advisory{
+		Id:          "CVE-2015-0001",
+		BaseURL:     otherBaseURL,
+		Severity:    params.SeverityMedium,
+		Description: "old issue",
+		Affected:    []params.RevisionRange{{From: 0, To: 3}},
+		Time:        t0.Add(-time.Hour),
+	}
+	err = store.AddAdvisory(other)
+	c.Assert(err, gc.IsNil)
+	advisories, err := store.FindAdvisories(AdvisoryQuery{
+		BaseURL: otherBaseURL,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, jc.DeepEquals, []*mongodoc.Advisory{other})
+
+	// Only the advisories affecting a revision are returned for it.
+	advisories, err = store.EntityAdvisories(url0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, jc.DeepEquals, []*mongodoc.Advisory{old})
+	advisories, err = store.EntityAdvisories(url1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, jc.DeepEquals, []*mongodoc.Advisory{recent, old})
+	_, err = store.EntityAdvisories(charm.MustParseReference("~charmers/trusty/wordpress-2"))
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+
+	// Advisories can be queried.
+	advisories, err = store.FindAdvisories(AdvisoryQuery{
+		Severity: params.SeverityLow,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, jc.DeepEquals, []*mongodoc.Advisory{old})
+	advisories, err = store.FindAdvisories(AdvisoryQuery{
+		After: t0,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, jc.DeepEquals, []*mongodoc.Advisory{recent})
+	advisories, err = store.FindAdvisories(AdvisoryQuery{
+		BaseURL: charm.MustParseReference("cs:~charmers/mysql"),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, gc.HasLen, 0)
+}
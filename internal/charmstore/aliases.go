@@ -0,0 +1,83 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// FindAlias returns the given URL with its name replaced by the name of
+// the charm or bundle having the URL name as an alias. If the URL has a
+// user, only the charms and bundles of that user are considered,
+// otherwise only the promulgated ones are. It returns an error with a
+// params.ErrNotFound cause if there is no such charm or bundle.
+func (s *Store) FindAlias(url *charm.Reference) (*charm.Reference, error) {
+	q := bson.D{{"aliases", url.Name}}
+	if url.User != "" {
+		q = append(q, bson.DocElem{"user", url.User})
+	} else {
+		q = append(q, bson.DocElem{"promulgated", 1})
+	}
+	var baseEntity mongodoc.BaseEntity
+	if err := s.DB.BaseEntities().Find(q).Select(bson.D{{"name", 1}}).Sort("_id").One(&baseEntity); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, errgo.WithCausef(nil, params.ErrNotFound, "no alias %q", url.Name)
+		}
+		return nil, errgo.Notef(err, "cannot retrieve alias %q", url.Name)
+	}
+	aliased := *url
+	aliased.Name = baseEntity.Name
+	return &aliased, nil
+}
+
+// CheckAliases checks that the given names can be used as aliases of the
+// charm or bundle with the given id. It returns an error with a
+// params.ErrBadRequest cause if a name is not valid, or with a
+// params.ErrForbidden cause if a name is already used by another charm
+// or bundle in the same namespace or, if the charm or bundle is
+// promulgated, by another promulgated charm or bundle.
+func (s *Store) CheckAliases(id *charm.Reference, aliases []string) error {
+	baseEntity, err := s.FindBaseEntity(baseURL(id), "_id", "promulgated")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	// The aliases of a promulgated entity are followed by
+	// promulgated ids too, so they must not be in use there.
+	namespaces := []bson.D{{{"user", baseEntity.URL.User}}}
+	if baseEntity.Promulgated {
+		namespaces = append(namespaces, bson.D{{"promulgated", 1}})
+	}
+	for _, alias := range aliases {
+		ref, err := charm.ParseReference("cs:" + alias)
+		if err != nil || ref.Name != alias || ref.Series != "" || ref.Revision != -1 {
+			return errgo.WithCausef(nil, params.ErrBadRequest, "invalid alias %q", alias)
+		}
+		if alias == id.Name {
+			return errgo.WithCausef(nil, params.ErrBadRequest, "alias %q is the name of %s", alias, baseEntity.URL)
+		}
+		n, err := s.DB.BaseEntities().Find(bson.D{
+			{"_id", bson.D{{"$ne", baseEntity.URL}}},
+			{"$and", []bson.D{
+				{{"$or", namespaces}},
+				{{"$or", []bson.D{
+					{{"name", alias}},
+					{{"aliases", alias}},
+				}}},
+			}},
+		}).Count()
+		if err != nil {
+			return errgo.Notef(err, "cannot check alias %q", alias)
+		}
+		if n > 0 {
+			return errgo.WithCausef(nil, params.ErrForbidden, "alias %q already in use", alias)
+		}
+	}
+	return nil
+}
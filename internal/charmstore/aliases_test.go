@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestAliases(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url := charm.MustParseReference("~charmers/trusty/wordpress-1")
+	err = store.AddCharmWithArchive(url, charm.MustParseReference("trusty/wordpress-0"), wordpress)
+	c.Assert(err, gc.IsNil)
+	err = store.AddCharmWithArchive(charm.MustParseReference("~charmers/trusty/mysql-0"), nil, wordpress)
+	c.Assert(err, gc.IsNil)
+
+	// Aliases must be valid names not used in the namespace.
+	for _, test := range []struct {
+		alias       string
+		expectError string
+		expectCause error
+	}{{
+		alias:       "bad/alias",
+		expectError: `invalid alias "bad/alias"`,
+		expectCause: params.ErrBadRequest,
+	}, {
+		alias:       "wordpress",
+		expectError: `alias "wordpress" is the name of cs:~charmers/wordpress`,
+		expectCause: params.ErrBadRequest,
+	}, {
+		alias:       "mysql",
+		expectError: `alias "mysql" already in use`,
+		expectCause: params.ErrForbidden,
+	}} {
+		err := store.CheckAliases(url, []string{test.alias})
+		c.Assert(err, gc.ErrorMatches, test.expectError)
+		c.Assert(errgo.Cause(err), gc.Equals, test.expectCause)
+	}
+	err = store.CheckAliases(url, []string{"wp", "blog"})
+	c.Assert(err, gc.IsNil)
+	err = store.UpdateBaseEntity(url, bson.D{{"$set", bson.D{{"aliases", []string{"wp", "blog"}}}}})
+	c.Assert(err, gc.IsNil)
+
+	// Aliases are followed by both user owned and promulgated ids.
+	for _, id := range []string{"~charmers/wp", "~charmers/trusty/blog", "wp"} {
+		c.Logf("id %s", id)
+		entity, err := store.FindBestEntity(charm.MustParseReference(id), params.NoChannel, "_id")
+		c.Assert(err, gc.IsNil)
+		c.Assert(entity.URL, gc.DeepEquals, url)
+	}
+	aliased, err := store.FindAlias(charm.MustParseReference("trusty/wp"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(aliased.String(), gc.Equals, "cs:trusty/wordpress")
+
+	// Ids with a revision and other namespaces are not affected.
+	for _, id := range []string{"~charmers/trusty/wp-1", "~bob/wp"} {
+		c.Logf("id %s", id)
+		_, err := store.FindBestEntity(charm.MustParseReference(id), params.NoChannel, "_id")
+		c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	}
+	_, err = store.FindAlias(charm.MustParseReference("~bob/wp"))
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+
+	// The aliases of an entity are not available to other entities.
+	err = store.CheckAliases(charm.MustParseReference("~charmers/mysql"), []string{"wp"})
+	c.Assert(err, gc.ErrorMatches, `alias "wp" already in use`)
+}
+
+func (s *StoreSuite) TestAliasesPromulgated(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url := charm.MustParseReference("~charmers/trusty/wordpress-1")
+	err = store.AddCharmWithArchive(url, charm.MustParseReference("trusty/wordpress-0"), wordpress)
+	c.Assert(err, gc.IsNil)
+	mysql := charm.MustParseReference("~bob/trusty/mysql-0")
+	err = store.AddCharmWithArchive(mysql, charm.MustParseReference("trusty/mysql-0"), wordpress)
+	c.Assert(err, gc.IsNil)
+	err = store.UpdateBaseEntity(mysql, bson.D{{"$set", bson.D{{"aliases", []string{"db"}}}}})
+	c.Assert(err, gc.IsNil)
+
+	// The aliases of promulgated entities cannot shadow the names
+	// or aliases of other promulgated entities.
+	for _, alias := range []string{"mysql", "db"} {
+		err := store.CheckAliases(url, []string{alias})
+		c.Assert(err, gc.ErrorMatches, `alias "`+alias+`" already in use`)
+		c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+	}
+
+	// Entities that are not promulgated only share their namespace.
+	err = store.AddCharmWithArchive(charm.MustParseReference("~charmers/trusty/blog-0"), nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	err = store.CheckAliases(charm.MustParseReference("~charmers/blog"), []string{"mysql", "db"})
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+const (
+	// apiTokenIdSize and apiTokenSecretSize hold the number of
+	// random bytes used for the public and secret parts of API tokens.
+	apiTokenIdSize     = 8
+	apiTokenSecretSize = 24
+)
+
+func (s StoreDatabase) APITokens() *mgo.Collection {
+	return s.C("apitokens")
+}
+
+// AddAPIToken stores the given API token and returns the token
+// that clients must send as bearer credentials. The Id, Hash and
+// Created fields of the token are filled out by AddAPIToken.
+// Only a hash of the secret part of the token is stored.
+func (s *Store) AddAPIToken(t *mongodoc.APIToken) (string, error) {
+	id, err := randomHex(apiTokenIdSize)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot generate token id")
+	}
+	secret, err := randomHex(apiTokenSecretSize)
+	if err != nil {
+		return "", errgo.Notef(err, "cannot generate token secret")
+	}
+	t.Id = id
+	t.Hash = hashAPITokenSecret(secret)
+	t.Created = time.Now().UTC()
+	if err := s.DB.APITokens().Insert(t); err != nil {
+		return "", errgo.Notef(err, "cannot insert API token")
+	}
+	return id + "." + secret, nil
+}
+
+// CheckAPIToken returns the API token corresponding to the given
+// token, as sent by a client. An error with a params.ErrUnauthorized
+// cause is returned if the token is not valid or has expired.
+func (s *Store) CheckAPIToken(token string) (*mongodoc.APIToken, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid API token")
+	}
+	var t mongodoc.APIToken
+	if err := s.DB.APITokens().FindId(parts[0]).One(&t); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid API token")
+		}
+		return nil, errgo.Notef(err, "cannot retrieve API token")
+	}
+	hash := hashAPITokenSecret(parts[1])
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(t.Hash)) != 1 {
+		return nil, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid API token")
+	}
+	if !time.Now().Before(t.Expires) {
+		return nil, errgo.WithCausef(nil, params.ErrUnauthorized, "API token expired")
+	}
+	return &t, nil
+}
+
+// APITokens returns all the API tokens owned by the given user,
+// sorted by creation time.
+func (s *Store) APITokens(user string) ([]*mongodoc.APIToken, error) {
+	var tokens []*mongodoc.APIToken
+	if err := s.DB.APITokens().Find(bson.D{{"user", user}}).Sort("created").All(&tokens); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve API tokens")
+	}
+	return tokens, nil
+}
+
+// RemoveAPIToken revokes the API token with the given id
+// owned by the given user.
+func (s *Store) RemoveAPIToken(user, id string) error {
+	if err := s.DB.APITokens().Remove(bson.D{{"_id", id}, {"user", user}}); err != nil {
+		if err == mgo.ErrNotFound {
+			return errgo.WithCausef(nil, params.ErrNotFound, "API token %q not found", id)
+		}
+		return errgo.Notef(err, "cannot remove API token")
+	}
+	return nil
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errgo.Mask(err)
+	}
+	return fmt.Sprintf("%x", buf), nil
+}
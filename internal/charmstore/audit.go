@@ -0,0 +1,96 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+)
+
+// Audit returns the mongo collection where the records
+// of write operations are stored.
+func (s StoreDatabase) Audit() *mgo.Collection {
+	return s.C("audit")
+}
+
+// AddAudit records the given write operation. If the entry time is
+// not set, the current time is used.
+func (s *Store) AddAudit(entry *mongodoc.AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	if entry.Entity != nil {
+		entry.BaseURL = baseURL(entry.Entity)
+	}
+	if err := s.DB.Audit().Insert(entry); err != nil {
+		return errgo.Notef(err, "cannot insert audit entry")
+	}
+	return nil
+}
+
+// AuditQuery holds the criteria used to select audit entries.
+// Zero valued fields are ignored.
+type AuditQuery struct {
+	// User holds the name of the user performing the operations.
+	User string
+
+	// Operation holds the performed operation.
+	Operation string
+
+	// Entity holds the id of the affected charm or bundle. If the id
+	// has no series and revision, it refers to all the entities with
+	// that base URL.
+	Entity *charm.Reference
+
+	// After and Before restrict the time range of the operations.
+	After, Before time.Time
+
+	// Skip and Limit hold the number of entries to skip and
+	// the maximum number of entries to return.
+	Skip, Limit int
+}
+
+// AuditEntries returns the audit entries matching the given query,
+// most recent first.
+func (s *Store) AuditEntries(q AuditQuery) ([]*mongodoc.AuditEntry, error) {
+	query := make(bson.D, 0, 4)
+	if q.User != "" {
+		query = append(query, bson.DocElem{"user", q.User})
+	}
+	if q.Operation != "" {
+		query = append(query, bson.DocElem{"operation", q.Operation})
+	}
+	if q.Entity != nil {
+		if q.Entity.Series == "" && q.Entity.Revision == -1 {
+			query = append(query, bson.DocElem{"baseurl", q.Entity})
+		} else {
+			query = append(query, bson.DocElem{"entity", q.Entity})
+		}
+	}
+	timeRange := make(bson.D, 0, 2)
+	if !q.After.IsZero() {
+		timeRange = append(timeRange, bson.DocElem{"$gte", q.After.UTC()})
+	}
+	if !q.Before.IsZero() {
+		timeRange = append(timeRange, bson.DocElem{"$lte", q.Before.UTC()})
+	}
+	if len(timeRange) > 0 {
+		query = append(query, bson.DocElem{"time", timeRange})
+	}
+	var entries []*mongodoc.AuditEntry
+	if err := s.DB.Audit().Find(query).Sort("-time", "-_id").Skip(q.Skip).Limit(q.Limit).All(&entries); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve audit entries")
+	}
+	for _, e := range entries {
+		e.Time = e.Time.UTC()
+	}
+	return entries, nil
+}
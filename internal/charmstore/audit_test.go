@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestAuditEntries(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	t0 := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	entries := []*mongodoc.AuditEntry{{
+		Time:      t0,
+		User:      "bob",
+		Operation: params.AuditUpload,
+		Entity:    charm.MustParseReference("cs:~bob/trusty/wordpress-0"),
+	}, {
+		Time:      t0.Add(time.Hour),
+		User:      "alice",
+		Operation: params.AuditSetPerm,
+		Entity:    charm.MustParseReference("cs:~bob/trusty/wordpress-0"),
+		Old:       []byte(`{"Read":["bob"]}`),
+		New:       []byte(`{"Read":["bob","alice"]}`),
+	}, {
+		Time:      t0.Add(2 * time.Hour),
+		User:      "bob",
+		Operation: params.AuditSetNamespacePerm,
+		Namespace: "bob",
+	}, {
+		Time:      t0.Add(3 * time.Hour),
+		User:      "bob",
+		Operation: params.AuditUpload,
+		Entity:    charm.MustParseReference("cs:~bob/utopic/mysql-0"),
+	}}
+	for _, e := range entries {
+		err := store.AddAudit(e)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(entries[0].BaseURL, jc.DeepEquals, charm.MustParseReference("cs:~bob/wordpress"))
+
+	for i, test := range []struct {
+		about  string
+		query  AuditQuery
+		expect []int
+	}{{
+		about:  "all entries",
+		expect: []int{3, 2, 1, 0},
+	}, {
+		about:  "by user",
+		query:  AuditQuery{User: "bob"},
+		expect: []int{3, 2, 0},
+	}, {
+		about:  "by operation",
+		query:  AuditQuery{Operation: params.AuditUpload},
+		expect: []int{3, 0},
+	}, {
+		about:  "by base URL",
+		query:  AuditQuery{Entity: charm.MustParseReference("cs:~bob/wordpress")},
+		expect: []int{1, 0},
+	}, {
+		about:  "by entity",
+		query:  AuditQuery{Entity: charm.MustParseReference("cs:~bob/utopic/mysql-0")},
+		expect: []int{3},
+	}, {
+		about:  "by time range",
+		query:  AuditQuery{After: t0.Add(time.Hour), Before: t0.Add(2 * time.Hour)},
+		expect: []int{2, 1},
+	}, {
+		about:  "skip and limit",
+		query:  AuditQuery{Skip: 1, Limit: 2},
+		expect: []int{2, 1},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		obtained, err := store.AuditEntries(test.query)
+		c.Assert(err, gc.IsNil)
+		expect := make([]*mongodoc.AuditEntry, len(test.expect))
+		for i, index := range test.expect {
+			expect[i] = entries[index]
+		}
+		c.Assert(obtained, jc.DeepEquals, expect)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"sort"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+)
+
+// BundleCharmStatus holds the status of a charm
+// referenced by a bundle.
+type BundleCharmStatus struct {
+	// Id holds the charm reference as found in the bundle.
+	Id *charm.Reference
+
+	// Resolves holds whether the reference currently
+	// resolves to a charm in the store.
+	Resolves bool
+
+	// Latest maps each series the charm is available in
+	// to the latest revision in that series. When the reference
+	// has no user, promulgated revisions are reported.
+	Latest map[string]int
+
+	// Stale holds whether the reference no longer resolves,
+	// or is pinned to a revision older than the latest one
+	// available in its series.
+	Stale bool
+}
+
+// BundleCharmStatus returns the status of each of the given
+// charm references, as found in the BundleCharms field
+// of a bundle entity. The results are sorted by reference.
+func (s *Store) BundleCharmStatus(refs []*charm.Reference) ([]BundleCharmStatus, error) {
+	statuses := make([]BundleCharmStatus, len(refs))
+	for i, ref := range refs {
+		status, err := s.bundleCharmStatus(ref)
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot get status of %q", ref)
+		}
+		statuses[i] = *status
+	}
+	sort.Sort(statusesById(statuses))
+	return statuses, nil
+}
+
+type statusesById []BundleCharmStatus
+
+func (s statusesById) Len() int      { return len(s) }
+func (s statusesById) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s statusesById) Less(i, j int) bool {
+	return s[i].Id.String() < s[j].Id.String()
+}
+
+func (s *Store) bundleCharmStatus(ref *charm.Reference) (*BundleCharmStatus, error) {
+	baseRef := *ref
+	baseRef.Series = ""
+	baseRef.Revision = -1
+	entities, err := s.FindEntities(&baseRef, "_id", "promulgated-url", "series", "revision", "promulgated-revision", "embargo", "published")
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	status := &BundleCharmStatus{
+		Id:     ref,
+		Latest: make(map[string]int),
+	}
+	// Record the series of the entities matching the reference,
+	// so that we can check whether a later revision is available.
+	matchingSeries := make(map[string]bool)
+	for _, e := range entities {
+		if e.URL.Series == "bundle" {
+			continue
+		}
+		if e.Embargo != nil || len(e.Published) == 0 {
+			// Embargoed and unpublished revisions are not
+			// available to the users of the bundle.
+			continue
+		}
+		rev := e.URL.Revision
+		if ref.User == "" {
+			rev = e.PromulgatedRevision
+		}
+		if latest, ok := status.Latest[e.URL.Series]; !ok || rev > latest {
+			status.Latest[e.URL.Series] = rev
+		}
+		if (ref.Series == "" || ref.Series == e.URL.Series) &&
+			(ref.Revision == -1 || ref.Revision == rev) {
+			status.Resolves = true
+			matchingSeries[e.URL.Series] = true
+		}
+	}
+	if !status.Resolves {
+		status.Stale = true
+		return status, nil
+	}
+	if ref.Revision == -1 {
+		// An unpinned reference always resolves to
+		// the latest revision.
+		return status, nil
+	}
+	for series := range matchingSeries {
+		if status.Latest[series] > ref.Revision {
+			status.Stale = true
+		}
+	}
+	return status, nil
+}
+
+// bundleIsStale reports whether any of the charms
+// referenced by the given bundle entity is stale.
+func (s *Store) bundleIsStale(e *mongodoc.Entity) (bool, error) {
+	statuses, err := s.BundleCharmStatus(e.BundleCharms)
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	for _, status := range statuses {
+		if status.Stale {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// updateBundlesSearch updates the search records for all bundles
+// referencing the charm with the given id, so that their
+// staleness status reflects the current state of the store.
+// The update is done in the background, and errors are logged
+// rather than returned, as the charm itself has already been
+// successfully indexed.
+func (s *Store) updateBundlesSearch(id *charm.Reference) {
+	if s.ES == nil || s.ES.Database == nil {
+		return
+	}
+	go func() {
+		if err := s.updateBundlesSearchSync(id); err != nil {
+			logger.Errorf("cannot update search records of bundles containing %s: %v", id, err)
+		}
+	}()
+}
+
+// updateBundlesSearchSync is the synchronous version of
+// updateBundlesSearch.
+func (s *Store) updateBundlesSearchSync(id *charm.Reference) error {
+	// The BundleCharms field of bundles always includes the base
+	// URLs of the charm references, so only the base URLs the charm
+	// may be referred to by need to be queried. Querying the
+	// promulgated one too even if the charm is not promulgated
+	// only means that a few more bundles are indexed again.
+	refs := []*charm.Reference{
+		baseURL(id),
+		&charm.Reference{Schema: "cs", Name: id.Name, Revision: -1},
+	}
+	var bundles []mongodoc.Entity
+	if err := s.DB.Entities().
+		Find(bson.D{{"bundlecharms", bson.D{{"$in", refs}}}}).
+		Select(bson.D{{"_id", 1}}).
+		All(&bundles); err != nil {
+		return errgo.Notef(err, "cannot retrieve bundles")
+	}
+	updated := make(map[string]bool)
+	for _, b := range bundles {
+		base := *b.URL
+		base.Revision = -1
+		if updated[base.String()] {
+			continue
+		}
+		updated[base.String()] = true
+		if err := s.UpdateSearch(b.URL); err != nil {
+			logger.Errorf("cannot update search record for %s: %v", b.URL, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// resolveChannel returns the given channel, or the stable
+// channel if no channel is specified.
+func resolveChannel(c params.Channel) params.Channel {
+	if c == params.NoChannel {
+		return params.StableChannel
+	}
+	return c
+}
+
+// CheckChannels checks that the given channels are all valid. It
+// returns an error with a params.ErrBadRequest cause if they are not.
+func CheckChannels(channels []params.Channel) error {
+	for _, c := range channels {
+		if !params.ValidChannel(c) {
+			return errgo.WithCausef(nil, params.ErrBadRequest, "invalid channel %q", c)
+		}
+	}
+	return nil
+}
+
+// publishedChannels returns the published field of an entity
+// published to the given channels at the given time. The entity
+// is published to the stable channel if no channel is specified.
+func publishedChannels(channels []params.Channel, t time.Time) map[params.Channel]time.Time {
+	if len(channels) == 0 {
+		channels = []params.Channel{params.StableChannel}
+	}
+	published := make(map[params.Channel]time.Time, len(channels))
+	for _, c := range channels {
+		published[c] = t
+	}
+	return published
+}
+
+// channelQuery returns the query selecting the entities
+// published to the given channel.
+func channelQuery(c params.Channel) bson.D {
+	return bson.D{{"published." + string(resolveChannel(c)), bson.D{{"$exists", true}}}}
+}
+
+// ChannelTimeField returns the name of the entity field holding the
+// time the entity was published to the given channel.
+func ChannelTimeField(c params.Channel) string {
+	return "published." + string(resolveChannel(c))
+}
+
+// Publish publishes the entity with the given id to the given channels,
+// in addition to the channels it is already published to, and updates
+// the search index accordingly. Publishing an embargoed entity lifts
+// its embargo. It returns the updated entity.
+func (s *Store) Publish(id *charm.Reference, channels []params.Channel) (*mongodoc.Entity, error) {
+	if len(channels) == 0 {
+		return nil, errgo.WithCausef(nil, params.ErrBadRequest, "no channels specified")
+	}
+	if err := CheckChannels(channels); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	entity, err := s.FindEntity(id, "_id", "published", "embargo")
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	now := time.Now()
+	update := make(bson.D, 0, len(channels))
+	for _, c := range channels {
+		if entity.InChannel(c) {
+			// Keep the time the entity was first published.
+			continue
+		}
+		update = append(update, bson.DocElem{ChannelTimeField(c), now})
+		if entity.Published == nil {
+			entity.Published = make(map[params.Channel]time.Time)
+		}
+		entity.Published[c] = now
+	}
+	// Always lift the embargo in the same update, so that it cannot
+	// be left in place by a concurrent change to the entity.
+	change := bson.D{{"$unset", bson.D{{"embargo", nil}}}}
+	if len(update) > 0 {
+		change = append(change, bson.DocElem{"$set", update})
+	}
+	entity.Embargo = nil
+	if err := s.DB.Entities().UpdateId(entity.URL, change); err != nil {
+		return nil, errgo.Notef(err, "cannot publish %s", entity.URL)
+	}
+	if err := s.UpdateSearch(entity.URL); err != nil {
+		return nil, errgo.Notef(err, "cannot update search index")
+	}
+	if entity.URL.Series != "bundle" {
+		s.updateBundlesSearch(entity.URL)
+	}
+	return entity, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestPublish(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url0 := charm.MustParseReference("~charmers/trusty/wordpress-0")
+	url1 := charm.MustParseReference("~charmers/trusty/wordpress-1")
+	err = store.AddCharmWithArchive(url0, nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	addCharmToChannels(c, store, url1, wordpress, params.DevelopmentChannel)
+
+	id := charm.MustParseReference("~charmers/wordpress")
+	assertBest := func(channel params.Channel, expect *charm.Reference) {
+		entity, err := store.FindBestEntity(id, channel, "_id")
+		if expect == nil {
+			c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+			return
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(entity.URL, jc.DeepEquals, expect)
+	}
+	assertBest(params.NoChannel, url0)
+	assertBest(params.StableChannel, url0)
+	assertBest(params.DevelopmentChannel, url1)
+	assertBest(params.CandidateChannel, nil)
+
+	entity, err := store.Publish(url1, []params.Channel{params.StableChannel})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.URL, jc.DeepEquals, url1)
+	c.Assert(entity.PublishedChannels(), jc.DeepEquals, []params.Channel{
+		params.StableChannel,
+		params.DevelopmentChannel,
+	})
+	assertBest(params.NoChannel, url1)
+	assertBest(params.StableChannel, url1)
+
+	// Publishing to a channel again keeps the original publish time.
+	before, err := store.FindEntity(url1, "published")
+	c.Assert(err, gc.IsNil)
+	_, err = store.Publish(url1, []params.Channel{params.DevelopmentChannel, params.StableChannel})
+	c.Assert(err, gc.IsNil)
+	after, err := store.FindEntity(url1, "published")
+	c.Assert(err, gc.IsNil)
+	c.Assert(after.Published, jc.DeepEquals, before.Published)
+}
+
+func (s *StoreSuite) TestPublishErrors(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	url := charm.MustParseReference("~charmers/trusty/wordpress-0")
+	err = store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+
+	_, err = store.Publish(url, nil)
+	c.Assert(err, gc.ErrorMatches, "no channels specified")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrBadRequest)
+
+	_, err = store.Publish(url, []params.Channel{"beta"})
+	c.Assert(err, gc.ErrorMatches, `invalid channel "beta"`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrBadRequest)
+
+	_, err = store.Publish(charm.MustParseReference("~charmers/trusty/wordpress-1"), []params.Channel{params.StableChannel})
+	c.Assert(err, gc.ErrorMatches, "entity not found")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+}
+
+// addCharmToChannels adds the given charm to the store with the
+// given id, publishing it to the given channels only.
+func addCharmToChannels(c *gc.C, store *Store, url *charm.Reference, ch charm.Charm, channels ...params.Channel) {
+	addCharmWithParams(c, store, ch, AddParams{
+		URL:                 url,
+		PromulgatedRevision: -1,
+		Channels:            channels,
+	})
+}
+
+// addCharmWithParams adds the given charm to the store with the
+// given parameters, filling in the blob details.
+func addCharmWithParams(c *gc.C, store *Store, ch charm.Charm, p AddParams) {
+	var err error
+	p.BlobName, p.BlobHash, p.BlobHash256, p.BlobSize, err = store.uploadCharmOrBundle(ch)
+	c.Assert(err, gc.IsNil)
+	err = store.AddCharm(ch, p)
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// Deprecation returns the deprecation of the entity with the given id,
+// falling back to the deprecation of its base entity. It returns nil if
+// the entity is not deprecated. It returns an error with a
+// params.ErrNotFound cause if the entity does not exist.
+func (s *Store) Deprecation(id *charm.Reference) (*mongodoc.Deprecation, error) {
+	entity, err := s.FindEntity(id, "baseurl", "deprecated")
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if entity.Deprecated != nil {
+		return entity.Deprecated, nil
+	}
+	baseEntity, err := s.FindBaseEntity(entity.BaseURL, "deprecated")
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	return baseEntity.Deprecated, nil
+}
+
+// DeprecationWarning returns a message describing the deprecation d of
+// the entity with the given id.
+func DeprecationWarning(id *charm.Reference, d *mongodoc.Deprecation) string {
+	msg := id.String() + " is deprecated: " + d.Reason
+	if d.Successor != nil {
+		msg += "; use " + d.Successor.String() + " instead"
+	}
+	return msg
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestDeprecation(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url0 := charm.MustParseReference("~charmers/trusty/wordpress-0")
+	url1 := charm.MustParseReference("~charmers/trusty/wordpress-1")
+	for _, url := range []*charm.Reference{url0, url1} {
+		err := store.AddCharmWithArchive(url, nil, wordpress)
+		c.Assert(err, gc.IsNil)
+	}
+	d, err := store.Deprecation(url1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d, gc.IsNil)
+
+	// The base entity deprecation applies to all revisions.
+	all := &mongodoc.Deprecation{Reason: "unmaintained"}
+	err = store.UpdateBaseEntity(url0, bson.D{{"$set", bson.D{{"deprecated", all}}}})
+	c.Assert(err, gc.IsNil)
+	d, err = store.Deprecation(url1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d.Reason, gc.Equals, "unmaintained")
+
+	// The entity deprecation takes precedence.
+	one := &mongodoc.Deprecation{
+		Reason:    "broken",
+		Successor: url1,
+	}
+	err = store.UpdateEntity(url0, bson.D{{"$set", bson.D{{"deprecated", one}}}})
+	c.Assert(err, gc.IsNil)
+	d, err = store.Deprecation(url0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d.Reason, gc.Equals, "broken")
+	c.Assert(d.Successor, jc.DeepEquals, url1)
+	c.Assert(DeprecationWarning(url0, d), gc.Equals,
+		"cs:~charmers/trusty/wordpress-0 is deprecated: broken; use cs:~charmers/trusty/wordpress-1 instead")
+
+	_, err = store.Deprecation(charm.MustParseReference("~charmers/trusty/wordpress-2"))
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+}
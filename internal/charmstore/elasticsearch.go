@@ -10,7 +10,7 @@ var (
 	esMapping = mustParseJSON(esMappingJSON)
 )
 
-const esSettingsVersion = 5
+const esSettingsVersion = 11
 
 func mustParseJSON(s string) interface{} {
 	var j json.RawMessage
@@ -328,6 +328,42 @@ const esMappingJSON = `
         "index": "not_analyzed",
         "omit_norms" : true,
         "index_options" : "docs"
+      },
+      "ReadACLExpiries" : {
+        "type" : "string",
+        "index": "not_analyzed",
+        "omit_norms" : true,
+        "index_options" : "docs"
+      },
+      "Stale": {
+        "type": "boolean",
+        "index" : "not_analyzed",
+        "omit_norms" : true,
+        "index_options" : "docs"
+      },
+      "Aliases" : {
+        "type" : "string",
+        "index": "not_analyzed",
+        "omit_norms" : true,
+        "index_options" : "docs"
+      },
+      "Deprecated": {
+        "type": "boolean",
+        "index" : "not_analyzed",
+        "omit_norms" : true,
+        "index_options" : "docs"
+      },
+      "Channel": {
+        "type" : "string",
+        "index": "not_analyzed",
+        "omit_norms" : true,
+        "index_options" : "docs"
+      },
+      "Advisories" : {
+        "type" : "string",
+        "index": "not_analyzed",
+        "omit_norms" : true,
+        "index_options" : "docs"
       }
     }
   }
@@ -0,0 +1,106 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// publication returns the published channels and the embargo of
+// an entity added at the given time with the given parameters. The
+// entity is embargoed if it is to be published after that time.
+func publication(p AddParams, now time.Time) (map[params.Channel]time.Time, *mongodoc.Embargo) {
+	if !p.PublishAt.After(now) {
+		return publishedChannels(p.Channels, now), nil
+	}
+	channels := p.Channels
+	if len(channels) == 0 {
+		channels = []params.Channel{params.StableChannel}
+	}
+	return nil, &mongodoc.Embargo{
+		PublishAt: p.PublishAt,
+		Channels:  channels,
+	}
+}
+
+// Embargoed reports whether the entity with the given fully
+// qualified id is embargoed, in which case only the users allowed
+// to write to it can read it.
+func (s *Store) Embargoed(id *charm.Reference) (bool, error) {
+	entity, err := s.FindEntity(id, "embargo")
+	if err != nil {
+		return false, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	return entity.Embargo != nil, nil
+}
+
+// PublishScheduled publishes all the embargoed entities whose
+// publication time is not after the given time to their channels,
+// as of their publication time, and updates the search index
+// accordingly. Each publication is logged and recorded in the
+// audit log. It returns the number of published entities.
+func (s *Store) PublishScheduled(now time.Time) (int, error) {
+	var entities []*mongodoc.Entity
+	if err := s.DB.Entities().Find(bson.D{{
+		"embargo.publishat", bson.D{{"$lte", now}},
+	}}).Select(bson.D{{"_id", 1}, {"embargo", 1}}).All(&entities); err != nil {
+		return 0, errgo.Notef(err, "cannot retrieve embargoed entities")
+	}
+	published := 0
+	for _, e := range entities {
+		update := make(bson.D, 0, len(e.Embargo.Channels))
+		for _, c := range e.Embargo.Channels {
+			update = append(update, bson.DocElem{ChannelTimeField(c), e.Embargo.PublishAt})
+		}
+		if err := s.DB.Entities().Update(bson.D{
+			{"_id", e.URL},
+			{"embargo", bson.D{{"$exists", true}}},
+		}, bson.D{
+			{"$set", update},
+			{"$unset", bson.D{{"embargo", nil}}},
+		}); err != nil {
+			if err == mgo.ErrNotFound {
+				// The entity has been published concurrently.
+				continue
+			}
+			return published, errgo.Notef(err, "cannot publish %s", e.URL)
+		}
+		published++
+		logger.Infof("published embargoed %s to %v", e.URL, e.Embargo.Channels)
+		channels, _ := json.Marshal(e.Embargo.Channels)
+		if err := s.AddAudit(&mongodoc.AuditEntry{
+			Operation: params.AuditPublish,
+			Entity:    e.URL,
+			New:       channels,
+		}); err != nil {
+			logger.Errorf("cannot record publication of %s: %v", e.URL, err)
+		}
+		if err := s.UpdateSearch(e.URL); err != nil {
+			return published, errgo.Notef(err, "cannot update search index for %q", e.URL)
+		}
+		if e.URL.Series != "bundle" {
+			s.updateBundlesSearch(e.URL)
+		}
+	}
+	return published, nil
+}
+
+// publishScheduledLoop calls PublishScheduled every interval
+// until closed is closed.
+func (s *Store) publishScheduledLoop(interval time.Duration, closed <-chan struct{}) {
+	runEvery(interval, closed, func(now time.Time) {
+		if _, err := s.PublishScheduled(now); err != nil {
+			logger.Errorf("cannot publish scheduled entities: %v", err)
+		}
+	})
+}
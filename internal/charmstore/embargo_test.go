@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestPublishScheduled(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url0 := charm.MustParseReference("~charmers/trusty/wordpress-0")
+	url1 := charm.MustParseReference("~charmers/trusty/wordpress-1")
+	err = store.AddCharmWithArchive(url0, nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	now := time.Now()
+	publishAt := now.Add(time.Hour).Truncate(time.Millisecond)
+	addCharmWithParams(c, store, wordpress, AddParams{
+		URL:                 url1,
+		PromulgatedRevision: -1,
+		Channels:            []params.Channel{params.CandidateChannel, params.StableChannel},
+		PublishAt:           publishAt,
+	})
+
+	// The embargoed revision is not published until its publication time.
+	embargoed, err := store.Embargoed(url1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(embargoed, jc.IsTrue)
+	entity, err := store.FindBestEntity(charm.MustParseReference("~charmers/wordpress"), params.NoChannel, "_id")
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.URL, jc.DeepEquals, url0)
+	n, err := store.PublishScheduled(now)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+
+	// Once the publication time is reached, the revision is published
+	// to its channels as of that time.
+	n, err = store.PublishScheduled(publishAt)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 1)
+	embargoed, err = store.Embargoed(url1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(embargoed, jc.IsFalse)
+	entity, err = store.FindBestEntity(charm.MustParseReference("~charmers/wordpress"), params.NoChannel, "_id", "published")
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.URL, jc.DeepEquals, url1)
+	c.Assert(entity.PublishedChannels(), jc.DeepEquals, []params.Channel{
+		params.StableChannel,
+		params.CandidateChannel,
+	})
+	c.Assert(entity.Published[params.StableChannel].Equal(publishAt), jc.IsTrue)
+
+	// The publication is recorded in the audit log.
+	entries, err := store.AuditEntries(AuditQuery{
+		Operation: params.AuditPublish,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].Entity, jc.DeepEquals, url1)
+	c.Assert(string(entries[0].New), gc.Equals, `["candidate","stable"]`)
+
+	// Published revisions are not published again.
+	n, err = store.PublishScheduled(publishAt.Add(time.Hour))
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+}
+
+func (s *StoreSuite) TestPublishLiftsEmbargo(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	url := charm.MustParseReference("~charmers/trusty/wordpress-0")
+	addCharmWithParams(c, store, storetesting.Charms.CharmDir("wordpress"), AddParams{
+		URL:                 url,
+		PromulgatedRevision: -1,
+		PublishAt:           time.Now().Add(time.Hour),
+	})
+	embargoed, err := store.Embargoed(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(embargoed, jc.IsTrue)
+
+	_, err = store.Publish(url, []params.Channel{params.DevelopmentChannel})
+	c.Assert(err, gc.IsNil)
+	embargoed, err = store.Embargoed(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(embargoed, jc.IsFalse)
+	n, err := store.PublishScheduled(time.Now().Add(2 * time.Hour))
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+
+	// The embargo is lifted even when the revision is already
+	// published to the given channels.
+	err = store.DB.Entities().UpdateId(url, bson.D{{"$set", bson.D{
+		{"embargo", mongodoc.Embargo{
+			PublishAt: time.Now().Add(time.Hour),
+			Channels:  []params.Channel{params.StableChannel},
+		}},
+	}}})
+	c.Assert(err, gc.IsNil)
+	_, err = store.Publish(url, []params.Channel{params.DevelopmentChannel})
+	c.Assert(err, gc.IsNil)
+	embargoed, err = store.Embargoed(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(embargoed, jc.IsFalse)
+}
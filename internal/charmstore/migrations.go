@@ -31,6 +31,12 @@ var migrations = []migration{{
 }, {
 	name:    "write acl creation",
 	migrate: populateWriteACL,
+}, {
+	name:    "fine grained acl creation",
+	migrate: populateFineGrainedACLs,
+}, {
+	name:    "stable channel publication",
+	migrate: publishToStableChannel,
 }}
 
 // migration holds a migration function with its corresponding name.
@@ -222,3 +228,72 @@ func populateWriteACL(db StoreDatabase) error {
 	logger.Infof("%d base entities updated", counter)
 	return nil
 }
+
+// populateFineGrainedACLs adds the upload, delete, admin and promulgate
+// ACLs to base entities not having them. The new ACLs are populated
+// with the write ACL, which previously granted all those permissions.
+func populateFineGrainedACLs(db StoreDatabase) error {
+	baseEntities := db.BaseEntities()
+	var entity mongodoc.BaseEntity
+	iter := baseEntities.Find(bson.D{{
+		"acls.upload", bson.D{{"$exists", false}},
+	}}).Select(bson.D{{"_id", 1}, {"acls", 1}}).Iter()
+
+	defer iter.Close()
+
+	counter := 0
+	for iter.Next(&entity) {
+		writePerm := entity.ACLs.Write
+		// Reset the ACLs so that they are not carried over
+		// to base entities without a write ACL.
+		entity.ACLs = mongodoc.ACL{}
+		if writePerm == nil {
+			writePerm = []string{}
+		}
+		if err := baseEntities.UpdateId(entity.URL, bson.D{{
+			"$set", bson.D{
+				{"acls.upload", writePerm},
+				{"acls.delete", writePerm},
+				{"acls.admin", writePerm},
+				{"acls.promulgate", writePerm},
+			},
+		}}); err != nil {
+			return errgo.Notef(err, "cannot populate fine grained ACLs for base entity %s", entity.URL)
+		}
+		counter++
+	}
+	if err := iter.Close(); err != nil {
+		return errgo.Notef(err, "cannot iterate base entities")
+	}
+	logger.Infof("%d base entities updated", counter)
+	return nil
+}
+
+// publishToStableChannel publishes the entities not published to any
+// channel to the stable channel, at their upload time. Before channels
+// were introduced, all entities were available as if they were
+// published to the stable channel.
+func publishToStableChannel(db StoreDatabase) error {
+	entities := db.Entities()
+	var entity mongodoc.Entity
+	iter := entities.Find(bson.D{{
+		"published", bson.D{{"$exists", false}},
+	}}).Select(bson.D{{"_id", 1}, {"uploadtime", 1}}).Iter()
+
+	defer iter.Close()
+
+	counter := 0
+	for iter.Next(&entity) {
+		if err := entities.UpdateId(entity.URL, bson.D{{
+			"$set", bson.D{{ChannelTimeField(params.StableChannel), entity.UploadTime}},
+		}}); err != nil {
+			return errgo.Notef(err, "cannot publish entity %s", entity.URL)
+		}
+		counter++
+	}
+	if err := iter.Close(); err != nil {
+		return errgo.Notef(err, "cannot iterate entities")
+	}
+	logger.Infof("%d entities updated", counter)
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"sort"
 	"sync"
+	"time"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -186,6 +187,8 @@ func (s *migrationsSuite) TestMigrateMigrationList(c *gc.C) {
 		"base entities creation",
 		"read acl creation",
 		"write acl creation",
+		"fine grained acl creation",
+		"stable channel publication",
 	}
 	for i, name := range existing {
 		m := migrations[i]
@@ -222,25 +225,28 @@ func (s *migrationsSuite) TestMigrateParallelMigration(c *gc.C) {
 		c.Assert(err, gc.IsNil)
 	}
 
-	// Ensure entities have been updated correctly by denormalizeEntityIds.
+	// Ensure entities have been updated correctly by denormalizeEntityIds
+	// and publishToStableChannel.
 	s.checkCount(c, s.db.Entities(), 2)
 	s.checkEntity(c, &mongodoc.Entity{
-		URL:      id1,
-		BaseURL:  baseURL(id1),
-		User:     "",
-		Name:     "django",
-		Revision: 42,
-		Series:   "trusty",
-		Size:     12,
+		URL:       id1,
+		BaseURL:   baseURL(id1),
+		User:      "",
+		Name:      "django",
+		Revision:  42,
+		Series:    "trusty",
+		Size:      12,
+		Published: map[params.Channel]time.Time{params.StableChannel: {}},
 	})
 	s.checkEntity(c, &mongodoc.Entity{
-		URL:      id2,
-		BaseURL:  baseURL(id2),
-		User:     "who",
-		Name:     "rails",
-		Revision: 47,
-		Series:   "utopic",
-		Size:     13,
+		URL:       id2,
+		BaseURL:   baseURL(id2),
+		User:      "who",
+		Name:      "rails",
+		Revision:  47,
+		Series:    "utopic",
+		Size:      13,
+		Published: map[params.Channel]time.Time{params.StableChannel: {}},
 	})
 }
 
@@ -793,6 +799,111 @@ func (s *migrationsSuite) TestPopulateWriteACLSomeUpdates(c *gc.C) {
 	})
 }
 
+func (s *migrationsSuite) TestPopulateFineGrainedACLs(c *gc.C) {
+	s.patchMigrations(c, getMigrations("fine grained acl creation"))
+	// Store base entities without the fine grained permissions.
+	id1 := charm.MustParseReference("~who/django")
+	id2 := charm.MustParseReference("~dalek/rails")
+	id3 := charm.MustParseReference("~jean-luc/postgres")
+	s.insertBaseEntity(c, id1, &mongodoc.ACL{
+		Read:  []string{"everyone", "who"},
+		Write: []string{"who", "charmers"},
+	})
+	s.insertBaseEntity(c, id2, nil)
+	s.insertBaseEntity(c, id3, &mongodoc.ACL{
+		Read:       []string{"jean-luc"},
+		Write:      []string{"jean-luc"},
+		Upload:     []string{"benjamin"},
+		Delete:     []string{},
+		Admin:      []string{"jean-luc"},
+		Promulgate: []string{},
+	})
+	for _, id := range []*charm.Reference{id1, id2} {
+		err := s.db.BaseEntities().UpdateId(id, bson.D{{"$unset", bson.D{
+			{"acls.upload", true},
+			{"acls.delete", true},
+			{"acls.admin", true},
+			{"acls.promulgate", true},
+		}}})
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Start the server.
+	err := s.newServer(c)
+	c.Assert(err, gc.IsNil)
+
+	// Ensure the new permissions have been populated from the write ACL.
+	s.checkCount(c, s.db.BaseEntities(), 3)
+	s.checkBaseEntity(c, &mongodoc.BaseEntity{
+		URL:    id1,
+		User:   "who",
+		Name:   "django",
+		Public: true,
+		ACLs: mongodoc.ACL{
+			Read:       []string{"everyone", "who"},
+			Write:      []string{"who", "charmers"},
+			Upload:     []string{"who", "charmers"},
+			Delete:     []string{"who", "charmers"},
+			Admin:      []string{"who", "charmers"},
+			Promulgate: []string{"who", "charmers"},
+		},
+	})
+	s.checkBaseEntity(c, &mongodoc.BaseEntity{
+		URL:    id2,
+		User:   "dalek",
+		Name:   "rails",
+		Public: true,
+	})
+
+	// Existing fine grained permissions are left untouched.
+	s.checkBaseEntity(c, &mongodoc.BaseEntity{
+		URL:    id3,
+		User:   "jean-luc",
+		Name:   "postgres",
+		Public: true,
+		ACLs: mongodoc.ACL{
+			Read:       []string{"jean-luc"},
+			Write:      []string{"jean-luc"},
+			Upload:     []string{"benjamin"},
+			Delete:     []string{},
+			Admin:      []string{"jean-luc"},
+			Promulgate: []string{},
+		},
+	})
+}
+
+func (s *migrationsSuite) TestPublishToStableChannel(c *gc.C) {
+	s.patchMigrations(c, getMigrations("stable channel publication"))
+	uploadTime := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	publishTime := time.Date(2015, 7, 1, 12, 0, 0, 0, time.UTC)
+	id1 := charm.MustParseReference("~who/trusty/django-42")
+	id2 := charm.MustParseReference("~who/trusty/django-43")
+	for _, id := range []*charm.Reference{id1, id2} {
+		s.insertEntity(c, id, "django", 12)
+		err := s.db.Entities().UpdateId(id, bson.D{{"$set", bson.D{{"uploadtime", uploadTime}}}})
+		c.Assert(err, gc.IsNil)
+	}
+	err := s.db.Entities().UpdateId(id2, bson.D{{"$set", bson.D{{"published.development", publishTime}}}})
+	c.Assert(err, gc.IsNil)
+
+	// Start the server.
+	err = s.newServer(c)
+	c.Assert(err, gc.IsNil)
+
+	// Entities not yet published are published to the stable channel.
+	var entity mongodoc.Entity
+	err = s.db.Entities().FindId(id1).One(&entity)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.PublishedChannels(), jc.DeepEquals, []params.Channel{params.StableChannel})
+	c.Assert(entity.Published[params.StableChannel].Equal(uploadTime), jc.IsTrue)
+
+	// Entities already published are left untouched.
+	entity = mongodoc.Entity{}
+	err = s.db.Entities().FindId(id2).One(&entity)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.PublishedChannels(), jc.DeepEquals, []params.Channel{params.DevelopmentChannel})
+}
+
 func (s *migrationsSuite) checkEntity(c *gc.C, expectEntity *mongodoc.Entity) {
 	var entity mongodoc.Entity
 	err := s.db.Entities().FindId(expectEntity.URL).One(&entity)
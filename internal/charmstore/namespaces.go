@@ -0,0 +1,203 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// Namespaces returns the mongo collection where namespace
+// defaults are stored.
+func (s StoreDatabase) Namespaces() *mgo.Collection {
+	return s.C("namespaces")
+}
+
+// DefaultACLs returns the permissions given to new charms and bundles
+// owned by the given user when no defaults are stored for the user
+// namespace: everyone can read them, and the owner is granted all
+// the other permissions.
+func DefaultACLs(user string) mongodoc.ACL {
+	ownerPerm := []string{user}
+	return mongodoc.ACL{
+		Read:       []string{params.Everyone, user},
+		Write:      ownerPerm,
+		Upload:     ownerPerm,
+		Delete:     ownerPerm,
+		Admin:      ownerPerm,
+		Promulgate: ownerPerm,
+	}
+}
+
+// Namespace returns the defaults stored for the namespace of the given
+// user, group or organisation. If nothing has been stored, the namespace
+// holds the default ACLs as returned by DefaultACLs, or by OrgDefaultACLs
+// for organisations. Permissions not stored in the namespace also take
+// their default value.
+func (s *Store) Namespace(name string) (*mongodoc.Namespace, error) {
+	var ns mongodoc.Namespace
+	if err := s.DB.Namespaces().FindId(name).One(&ns); err != nil {
+		if err != mgo.ErrNotFound {
+			return nil, errgo.Notef(err, "cannot retrieve namespace %q", name)
+		}
+		ns.Name = name
+	}
+	defaults := DefaultACLs(name)
+	if _, err := s.Org(name); err == nil {
+		defaults = OrgDefaultACLs(name)
+	} else if errgo.Cause(err) != params.ErrNotFound {
+		return nil, errgo.Mask(err)
+	}
+	for _, p := range []struct {
+		perm *[]string
+		def  []string
+	}{
+		{&ns.ACLs.Read, defaults.Read},
+		{&ns.ACLs.Write, defaults.Write},
+		{&ns.ACLs.Upload, defaults.Upload},
+		{&ns.ACLs.Delete, defaults.Delete},
+		{&ns.ACLs.Admin, defaults.Admin},
+		{&ns.ACLs.Promulgate, defaults.Promulgate},
+	} {
+		if *p.perm == nil {
+			*p.perm = p.def
+		}
+	}
+	return &ns, nil
+}
+
+// SetNamespaceACLs stores the given ACLs as the permissions given to
+// new charms and bundles in the namespace of the given user or group.
+// Existing entities are not changed: see ApplyNamespaceACLs.
+func (s *Store) SetNamespaceACLs(name string, acls mongodoc.ACL) error {
+	if _, err := s.DB.Namespaces().UpsertId(name, bson.D{{
+		"$set", bson.D{{"acls", acls}},
+	}}); err != nil {
+		return errgo.Notef(err, "cannot update namespace %q", name)
+	}
+	return nil
+}
+
+// SetNamespaceExtraInfo stores the given extra-info as the extra
+// metadata given to new revisions of charms and bundles in the
+// namespace of the given user or group.
+func (s *Store) SetNamespaceExtraInfo(name string, extraInfo map[string][]byte) error {
+	if _, err := s.DB.Namespaces().UpsertId(name, bson.D{{
+		"$set", bson.D{{"extrainfo", extraInfo}},
+	}}); err != nil {
+		return errgo.Notef(err, "cannot update namespace %q", name)
+	}
+	return nil
+}
+
+// SetNamespaceStorageQuota stores the given maximum total size in
+// bytes of the archives in the namespace of the given user or group.
+// If quota is nil, the server default quota is used for the namespace.
+func (s *Store) SetNamespaceStorageQuota(name string, quota *int64) error {
+	update := bson.D{{"$unset", bson.D{{"storagequota", nil}}}}
+	if quota != nil {
+		update = bson.D{{"$set", bson.D{{"storagequota", *quota}}}}
+	}
+	if _, err := s.DB.Namespaces().UpsertId(name, update); err != nil {
+		return errgo.Notef(err, "cannot update namespace %q", name)
+	}
+	return nil
+}
+
+// SetNamespaceRetention stores the given revision retention policy
+// for the namespace of the given user or group. If policy is nil or
+// keeps no revision count, the policy is removed.
+func (s *Store) SetNamespaceRetention(name string, policy *params.RetentionPolicy) error {
+	update := bson.D{{"$unset", bson.D{{"retention", nil}}}}
+	if policy != nil && policy.KeepRevisions > 0 {
+		update = bson.D{{"$set", bson.D{{"retention", policy}}}}
+	}
+	if _, err := s.DB.Namespaces().UpsertId(name, update); err != nil {
+		return errgo.Notef(err, "cannot update namespace %q", name)
+	}
+	return nil
+}
+
+// NamespaceStorageUsed returns the total size in bytes of the
+// archives of all the charms and bundles in the namespace of the
+// given user or group.
+func (s *Store) NamespaceStorageUsed(name string) (int64, error) {
+	var result struct {
+		Size int64
+	}
+	err := s.DB.Entities().Pipe([]bson.D{
+		{{"$match", bson.D{{"user", name}}}},
+		{{"$group", bson.D{{"_id", nil}, {"size", bson.D{{"$sum", "$size"}}}}}},
+	}).One(&result)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, errgo.Notef(err, "cannot compute storage used by namespace %q", name)
+	}
+	return result.Size, nil
+}
+
+// ApplyNamespaceACLs sets the permissions of all the existing charms and
+// bundles in the namespace of the given user or group to the namespace
+// ACLs, and updates the search index accordingly. It returns the base
+// URLs of the updated entities.
+func (s *Store) ApplyNamespaceACLs(name string) ([]*charm.Reference, error) {
+	ns, err := s.Namespace(name)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	var ids []*charm.Reference
+	var baseEntity mongodoc.BaseEntity
+	iter := s.DB.BaseEntities().Find(bson.D{{"user", name}}).Select(bson.D{{"_id", 1}}).Iter()
+	defer iter.Close()
+	for iter.Next(&baseEntity) {
+		ids = append(ids, baseEntity.URL)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errgo.Notef(err, "cannot iterate base entities")
+	}
+	for _, id := range ids {
+		if err := s.UpdateBaseEntity(id, bson.D{{"$set", bson.D{
+			{"acls", ns.ACLs},
+			{"public", isPublic(ns.ACLs.Read)},
+		}}}); err != nil {
+			return nil, errgo.Notef(err, "cannot update base entity %q", id)
+		}
+		if err := s.updateSearchBase(id); err != nil {
+			return nil, errgo.Notef(err, "cannot update search index for %q", id)
+		}
+	}
+	return ids, nil
+}
+
+// updateSearchBase updates the search records for all the entities
+// with the given base URL.
+func (s *Store) updateSearchBase(id *charm.Reference) error {
+	var series []string
+	if err := s.DB.Entities().Find(bson.D{{"baseurl", id}}).Distinct("series", &series); err != nil {
+		return errgo.Notef(err, "cannot retrieve series")
+	}
+	for _, series := range series {
+		url := *id
+		url.Series = series
+		if err := s.UpdateSearch(&url); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// isPublic reports whether the given read ACL grants
+// access to everyone.
+func isPublic(read []string) bool {
+	for _, name := range read {
+		if name == params.Everyone {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestNamespaceDefaults(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+
+	// With nothing stored, the namespace holds the default ACLs.
+	ns, err := store.Namespace("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns, jc.DeepEquals, &mongodoc.Namespace{
+		Name: "bob",
+		ACLs: DefaultACLs("bob"),
+	})
+
+	// Permissions not stored take their default value.
+	err = store.SetNamespaceACLs("bob", mongodoc.ACL{
+		Read:   []string{"bob", "openstack"},
+		Upload: []string{"bob", "ci"},
+	})
+	c.Assert(err, gc.IsNil)
+	err = store.SetNamespaceExtraInfo("bob", map[string][]byte{
+		"bugs-url": []byte(`"https://bugs.example.com"`),
+	})
+	c.Assert(err, gc.IsNil)
+	expectACLs := mongodoc.ACL{
+		Read:       []string{"bob", "openstack"},
+		Write:      []string{"bob"},
+		Upload:     []string{"bob", "ci"},
+		Delete:     []string{"bob"},
+		Admin:      []string{"bob"},
+		Promulgate: []string{"bob"},
+	}
+	ns, err = store.Namespace("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns, jc.DeepEquals, &mongodoc.Namespace{
+		Name: "bob",
+		ACLs: expectACLs,
+		ExtraInfo: map[string][]byte{
+			"bugs-url": []byte(`"https://bugs.example.com"`),
+		},
+	})
+
+	// New entities inherit the namespace defaults.
+	url := charm.MustParseReference("~bob/trusty/wordpress-0")
+	err = store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	baseEntity, err := store.FindBaseEntity(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, expectACLs)
+	c.Assert(baseEntity.Public, jc.IsFalse)
+	entity, err := store.FindEntity(url, "extrainfo")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(entity.ExtraInfo["bugs-url"]), gc.Equals, `"https://bugs.example.com"`)
+
+	// Other namespaces are not affected.
+	url = charm.MustParseReference("~alice/trusty/wordpress-0")
+	err = store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	baseEntity, err = store.FindBaseEntity(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, DefaultACLs("alice"))
+	c.Assert(baseEntity.Public, jc.IsTrue)
+}
+
+func (s *StoreSuite) TestApplyNamespaceACLs(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	for _, id := range []string{"~bob/trusty/wordpress-0", "~bob/utopic/mysql-1", "~alice/trusty/wordpress-0"} {
+		url := charm.MustParseReference(id)
+		err := store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir(url.Name))
+		c.Assert(err, gc.IsNil)
+	}
+	acls := mongodoc.ACL{
+		Read:       []string{params.Everyone, "bob"},
+		Write:      []string{"bob", "charmers"},
+		Upload:     []string{"bob"},
+		Delete:     []string{},
+		Admin:      []string{"bob"},
+		Promulgate: []string{},
+	}
+	err = store.SetNamespaceACLs("bob", acls)
+	c.Assert(err, gc.IsNil)
+
+	ids, err := store.ApplyNamespaceACLs("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ids, gc.HasLen, 2)
+	for _, id := range []string{"~bob/wordpress", "~bob/mysql"} {
+		baseEntity, err := store.FindBaseEntity(charm.MustParseReference(id))
+		c.Assert(err, gc.IsNil)
+		c.Assert(baseEntity.ACLs, jc.DeepEquals, acls)
+		c.Assert(baseEntity.Public, jc.IsTrue)
+	}
+	baseEntity, err := store.FindBaseEntity(charm.MustParseReference("~alice/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, DefaultACLs("alice"))
+}
+
+func (s *StoreSuite) TestNamespaceStorageQuota(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+
+	used, err := store.NamespaceStorageUsed("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(used, gc.Equals, int64(0))
+
+	var expectUsed int64
+	for _, id := range []string{"~bob/trusty/wordpress-0", "~bob/trusty/wordpress-1", "~bob/precise/mysql-0"} {
+		url := charm.MustParseReference(id)
+		err = store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir(url.Name))
+		c.Assert(err, gc.IsNil)
+		entity, err := store.FindEntity(url, "size")
+		c.Assert(err, gc.IsNil)
+		expectUsed += entity.Size
+	}
+	err = store.AddCharmWithArchive(charm.MustParseReference("~alice/trusty/wordpress-0"), nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	used, err = store.NamespaceStorageUsed("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(used, gc.Equals, expectUsed)
+
+	quota := int64(1000)
+	err = store.SetNamespaceStorageQuota("bob", &quota)
+	c.Assert(err, gc.IsNil)
+	ns, err := store.Namespace("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns.StorageQuota, gc.NotNil)
+	c.Assert(*ns.StorageQuota, gc.Equals, int64(1000))
+
+	err = store.SetNamespaceStorageQuota("bob", nil)
+	c.Assert(err, gc.IsNil)
+	ns, err = store.Namespace("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns.StorageQuota, gc.IsNil)
+}
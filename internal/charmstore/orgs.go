@@ -0,0 +1,168 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"gopkg.in/errgo.v1"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// Orgs returns the mongo collection where organisations are stored.
+func (s StoreDatabase) Orgs() *mgo.Collection {
+	return s.C("orgs")
+}
+
+// OrgDefaultACLs returns the permissions given to new charms and
+// bundles owned by the given organisation when no defaults are stored
+// for its namespace: everyone can read them, members can also upload
+// and change them, and owners are granted all the other permissions.
+func OrgDefaultACLs(org string) mongodoc.ACL {
+	ownerPerm := []string{params.OrgGroup(org, params.OrgOwner)}
+	writePerm := []string{
+		params.OrgGroup(org, params.OrgOwner),
+		params.OrgGroup(org, params.OrgMember),
+	}
+	return mongodoc.ACL{
+		Read:       []string{params.Everyone, params.OrgGroup(org, "")},
+		Write:      writePerm,
+		Upload:     writePerm,
+		Delete:     ownerPerm,
+		Admin:      ownerPerm,
+		Promulgate: ownerPerm,
+	}
+}
+
+// AddOrg creates a new organisation with the given name, owned by the
+// given user. It returns an error with a params.ErrForbidden cause if
+// the name is already in use by another organisation, by existing
+// charms and bundles or namespace settings, or by the permissions of
+// any charm, bundle or namespace.
+func (s *Store) AddOrg(name, owner string) error {
+	if name == owner {
+		return errgo.WithCausef(nil, params.ErrForbidden, "namespace %q already in use", name)
+	}
+	inUse, err := s.nameInUse(name)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if inUse {
+		return errgo.WithCausef(nil, params.ErrForbidden, "namespace %q already in use", name)
+	}
+	err = s.DB.Orgs().Insert(&mongodoc.Org{
+		Name: name,
+		Members: []mongodoc.OrgMember{{
+			User: owner,
+			Role: params.OrgOwner,
+		}},
+	})
+	if mgo.IsDup(err) {
+		return errgo.WithCausef(nil, params.ErrForbidden, "namespace %q already in use", name)
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot insert organisation %q", name)
+	}
+	return nil
+}
+
+// nameInUse reports whether the given user or group name owns charms,
+// bundles or namespace settings, or appears in the permissions of any
+// charm, bundle or namespace.
+func (s *Store) nameInUse(name string) (bool, error) {
+	var inACLs []bson.D
+	for _, perm := range []string{"read", "write", "upload", "delete", "admin", "promulgate"} {
+		inACLs = append(inACLs, bson.D{{"acls." + perm, name}})
+	}
+	n, err := s.DB.BaseEntities().Find(bson.D{{"$or", append(inACLs, bson.D{{"user", name}})}}).Count()
+	if err != nil {
+		return false, errgo.Notef(err, "cannot count entities using %q", name)
+	}
+	if n > 0 {
+		return true, nil
+	}
+	n, err = s.DB.Namespaces().Find(bson.D{{"$or", append(inACLs, bson.D{{"_id", name}})}}).Count()
+	if err != nil {
+		return false, errgo.Notef(err, "cannot count namespaces using %q", name)
+	}
+	return n > 0, nil
+}
+
+// Org returns the organisation with the given name. It returns an
+// error with a params.ErrNotFound cause if there is no such
+// organisation.
+func (s *Store) Org(name string) (*mongodoc.Org, error) {
+	var org mongodoc.Org
+	if err := s.DB.Orgs().FindId(name).One(&org); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, errgo.WithCausef(nil, params.ErrNotFound, "organisation %q not found", name)
+		}
+		return nil, errgo.Notef(err, "cannot retrieve organisation %q", name)
+	}
+	return &org, nil
+}
+
+// SetOrgMember adds the given user to the given organisation with the
+// given role, or changes the role of the user if already a member.
+func (s *Store) SetOrgMember(org, user, role string) error {
+	err := s.DB.Orgs().Update(bson.D{
+		{"_id", org},
+		{"members.user", user},
+	}, bson.D{{"$set", bson.D{{"members.$.role", role}}}})
+	if err == nil {
+		return nil
+	}
+	if err != mgo.ErrNotFound {
+		return errgo.Notef(err, "cannot update organisation %q", org)
+	}
+	err = s.DB.Orgs().Update(bson.D{
+		{"_id", org},
+		{"members.user", bson.D{{"$ne", user}}},
+	}, bson.D{{"$push", bson.D{{"members", mongodoc.OrgMember{
+		User: user,
+		Role: role,
+	}}}}})
+	if err == mgo.ErrNotFound {
+		return errgo.WithCausef(nil, params.ErrNotFound, "organisation %q not found", org)
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot update organisation %q", org)
+	}
+	return nil
+}
+
+// RemoveOrgMember removes the given user from the members of the
+// given organisation.
+func (s *Store) RemoveOrgMember(org, user string) error {
+	err := s.DB.Orgs().UpdateId(org, bson.D{{"$pull", bson.D{{"members", bson.D{{"user", user}}}}}})
+	if err == mgo.ErrNotFound {
+		return errgo.WithCausef(nil, params.ErrNotFound, "organisation %q not found", org)
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot update organisation %q", org)
+	}
+	return nil
+}
+
+// OrgGroups returns the groups the given user belongs to as a member
+// of organisations: for each organisation, the group of all its
+// members and the group of the members with the same role as the user
+// (see params.OrgGroup).
+func (s *Store) OrgGroups(user string) ([]string, error) {
+	var orgs []mongodoc.Org
+	if err := s.DB.Orgs().Find(bson.D{{"members.user", user}}).All(&orgs); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve organisations of user %q", user)
+	}
+	var groups []string
+	for _, org := range orgs {
+		for _, m := range org.Members {
+			if m.User == user {
+				groups = append(groups, params.OrgGroup(org.Name, ""), params.OrgGroup(org.Name, m.Role))
+			}
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestOrgs(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+
+	_, err = store.Org("acme")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+
+	err = store.AddOrg("acme", "alice")
+	c.Assert(err, gc.IsNil)
+	org, err := store.Org("acme")
+	c.Assert(err, gc.IsNil)
+	c.Assert(org, jc.DeepEquals, &mongodoc.Org{
+		Name: "acme",
+		Members: []mongodoc.OrgMember{{
+			User: "alice",
+			Role: params.OrgOwner,
+		}},
+	})
+
+	// Namespaces already in use cannot be used by new organisations.
+	err = store.AddOrg("acme", "bob")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+	err = store.AddCharmWithArchive(charm.MustParseReference("~bob/trusty/wordpress-0"), nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	err = store.AddOrg("bob", "alice")
+	c.Assert(err, gc.ErrorMatches, `namespace "bob" already in use`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+
+	// Names used in permissions cannot be used either, so that
+	// organisations cannot take over existing groups.
+	err = store.UpdateBaseEntity(charm.MustParseReference("~bob/wordpress"), bson.D{{"$set", bson.D{
+		{"acls.write", []string{"bob", "charmers"}},
+	}}})
+	c.Assert(err, gc.IsNil)
+	err = store.AddOrg("charmers", "alice")
+	c.Assert(err, gc.ErrorMatches, `namespace "charmers" already in use`)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+	err = store.SetNamespaceExtraInfo("dave", map[string][]byte{"key": []byte(`"value"`)})
+	c.Assert(err, gc.IsNil)
+	err = store.AddOrg("dave", "alice")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+
+	// Members can be added, changed and removed.
+	err = store.SetOrgMember("acme", "bob", params.OrgMember)
+	c.Assert(err, gc.IsNil)
+	err = store.SetOrgMember("acme", "carol", params.OrgMember)
+	c.Assert(err, gc.IsNil)
+	err = store.SetOrgMember("acme", "carol", params.OrgReader)
+	c.Assert(err, gc.IsNil)
+	err = store.SetOrgMember("other", "carol", params.OrgReader)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	org, err = store.Org("acme")
+	c.Assert(err, gc.IsNil)
+	c.Assert(org.Members, jc.DeepEquals, []mongodoc.OrgMember{
+		{User: "alice", Role: params.OrgOwner},
+		{User: "bob", Role: params.OrgMember},
+		{User: "carol", Role: params.OrgReader},
+	})
+	groups, err := store.OrgGroups("carol")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, jc.DeepEquals, []string{"org:acme", "org:acme/reader"})
+
+	err = store.RemoveOrgMember("acme", "carol")
+	c.Assert(err, gc.IsNil)
+	groups, err = store.OrgGroups("carol")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.HasLen, 0)
+
+	// The organisation namespace defaults take the member roles
+	// into account.
+	ns, err := store.Namespace("acme")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns.ACLs, jc.DeepEquals, OrgDefaultACLs("acme"))
+	c.Assert(ns.ACLs, jc.DeepEquals, mongodoc.ACL{
+		Read:       []string{params.Everyone, "org:acme"},
+		Write:      []string{"org:acme/owner", "org:acme/member"},
+		Upload:     []string{"org:acme/owner", "org:acme/member"},
+		Delete:     []string{"org:acme/owner"},
+		Admin:      []string{"org:acme/owner"},
+		Promulgate: []string{"org:acme/owner"},
+	})
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// PrunableRevisions returns the ids of the revisions in the namespace
+// of the given user or group that the given retention policy allows to
+// delete: all the revisions in each series of each charm or bundle but
+// the policy.KeepRevisions most recent ones. Whatever the policy,
+// promulgated and embargoed revisions, the latest revision published
+// to each channel, and the charm revisions referenced by a bundle
+// are never pruned.
+func (s *Store) PrunableRevisions(name string, policy *params.RetentionPolicy) ([]*charm.Reference, error) {
+	if policy == nil || policy.KeepRevisions <= 0 {
+		return nil, nil
+	}
+	iter := s.DB.Entities().Find(bson.D{{"user", name}}).
+		Select(bson.D{{"_id", 1}, {"promulgated-url", 1}, {"published", 1}, {"embargo", 1}}).
+		Sort("name", "series", "-revision").
+		Iter()
+	var prunable []*charm.Reference
+	var series string
+	var kept int
+	var current map[params.Channel]bool
+	var entity mongodoc.Entity
+	for iter.Next(&entity) {
+		e := entity
+		// Make sure the fields of the previous entity
+		// are not retained.
+		entity = mongodoc.Entity{}
+		if key := e.URL.Name + "/" + e.URL.Series; key != series {
+			series, kept = key, 0
+			current = make(map[params.Channel]bool)
+		}
+		kept++
+		isCurrent := false
+		for c := range e.Published {
+			if !current[c] {
+				current[c] = true
+				isCurrent = true
+			}
+		}
+		if kept <= policy.KeepRevisions || isCurrent || e.PromulgatedURL != nil || e.Embargo != nil {
+			continue
+		}
+		referenced, err := s.referencedByBundle(e.URL)
+		if err != nil {
+			iter.Close()
+			return nil, errgo.Mask(err)
+		}
+		if !referenced {
+			prunable = append(prunable, e.URL)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve entities in namespace %q", name)
+	}
+	return prunable, nil
+}
+
+// referencedByBundle reports whether any bundle references the exact
+// revision of the charm with the given id.
+func (s *Store) referencedByBundle(id *charm.Reference) (bool, error) {
+	if id.Series == "bundle" {
+		return false, nil
+	}
+	noSeries := *id
+	noSeries.Series = ""
+	n, err := s.DB.Entities().Find(bson.D{{
+		"bundlecharms", bson.D{{"$in", []*charm.Reference{id, &noSeries}}},
+	}}).Count()
+	if err != nil {
+		return false, errgo.Notef(err, "cannot retrieve the bundles referencing %s", id)
+	}
+	return n > 0, nil
+}
+
+// ApplyRetentionPolicy applies the retention policy of the namespace
+// of the given user or group, if any, and returns the ids of the
+// prunable revisions (see PrunableRevisions). The revisions are
+// deleted, each deletion being recorded in the audit log, unless the
+// policy only reports them, in which case a single audit entry records
+// them all.
+func (s *Store) ApplyRetentionPolicy(name string) ([]*charm.Reference, error) {
+	ns, err := s.Namespace(name)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	ids, err := s.PrunableRevisions(name, ns.Retention)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if ns.Retention.ReportOnly {
+		logger.Infof("retention policy of namespace %q would prune %d revisions", name, len(ids))
+		data, _ := json.Marshal(ids)
+		if err := s.AddAudit(&mongodoc.AuditEntry{
+			Operation: params.AuditPruneReport,
+			Namespace: name,
+			New:       data,
+		}); err != nil {
+			logger.Errorf("cannot record pruning report of namespace %q: %v", name, err)
+		}
+		return ids, nil
+	}
+	for i, id := range ids {
+		if err := s.DeleteEntity(id); err != nil {
+			if errgo.Cause(err) == params.ErrNotFound {
+				// The revision has been deleted concurrently.
+				continue
+			}
+			return ids[:i], errgo.Notef(err, "cannot prune %s", id)
+		}
+		logger.Infof("pruned %s", id)
+		if err := s.AddAudit(&mongodoc.AuditEntry{
+			Operation: params.AuditPrune,
+			Entity:    id,
+		}); err != nil {
+			logger.Errorf("cannot record pruning of %s: %v", id, err)
+		}
+	}
+	return ids, nil
+}
+
+// ApplyRetentionPolicies applies the retention policies of all the
+// namespaces having one (see ApplyRetentionPolicy). Failures are
+// logged, so that a namespace does not prevent the policies of the
+// others from being applied. It returns the number of pruned or
+// reported revisions.
+func (s *Store) ApplyRetentionPolicies() (int, error) {
+	var names []string
+	if err := s.DB.Namespaces().Find(bson.D{{
+		"retention", bson.D{{"$exists", true}},
+	}}).Distinct("_id", &names); err != nil {
+		return 0, errgo.Notef(err, "cannot retrieve namespaces")
+	}
+	n := 0
+	for _, name := range names {
+		ids, err := s.ApplyRetentionPolicy(name)
+		n += len(ids)
+		if err != nil {
+			logger.Errorf("cannot apply retention policy of namespace %q: %v", name, err)
+		}
+	}
+	return n, nil
+}
+
+// applyRetentionPoliciesLoop calls ApplyRetentionPolicies every
+// interval until closed is closed.
+func (s *Store) applyRetentionPoliciesLoop(interval time.Duration, closed <-chan struct{}) {
+	runEvery(interval, closed, func(time.Time) {
+		if _, err := s.ApplyRetentionPolicies(); err != nil {
+			logger.Errorf("cannot apply retention policies: %v", err)
+		}
+	})
+}
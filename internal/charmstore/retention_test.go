@@ -0,0 +1,166 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestPrunableRevisions(c *gc.C) {
+	store := s.newRetentionStore(c)
+
+	ids, err := store.PrunableRevisions("bob", nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ids, gc.HasLen, 0)
+
+	ids, err = store.PrunableRevisions("bob", &params.RetentionPolicy{KeepRevisions: 1})
+	c.Assert(err, gc.IsNil)
+	c.Assert(ids, jc.DeepEquals, []*charm.Reference{
+		charm.MustParseReference("~bob/trusty/wordpress-4"),
+		charm.MustParseReference("~bob/trusty/wordpress-2"),
+	})
+
+	ids, err = store.PrunableRevisions("bob", &params.RetentionPolicy{KeepRevisions: 4})
+	c.Assert(err, gc.IsNil)
+	c.Assert(ids, jc.DeepEquals, []*charm.Reference{
+		charm.MustParseReference("~bob/trusty/wordpress-2"),
+	})
+}
+
+func (s *StoreSuite) TestApplyRetentionPolicies(c *gc.C) {
+	store := s.newRetentionStore(c)
+	pruned := []*charm.Reference{
+		charm.MustParseReference("~bob/trusty/wordpress-4"),
+		charm.MustParseReference("~bob/trusty/wordpress-2"),
+	}
+
+	// Namespaces without a retention policy are left alone.
+	n, err := store.ApplyRetentionPolicies()
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+
+	// In report-only mode, the prunable revisions are recorded
+	// in the audit log but not deleted.
+	err = store.SetNamespaceRetention("bob", &params.RetentionPolicy{
+		KeepRevisions: 1,
+		ReportOnly:    true,
+	})
+	c.Assert(err, gc.IsNil)
+	n, err = store.ApplyRetentionPolicies()
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 2)
+	for _, id := range pruned {
+		_, err := store.FindEntity(id)
+		c.Assert(err, gc.IsNil)
+	}
+	entries, err := store.AuditEntries(AuditQuery{
+		Operation: params.AuditPruneReport,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].Namespace, gc.Equals, "bob")
+	c.Assert(string(entries[0].New), gc.Equals, `["cs:~bob/trusty/wordpress-4","cs:~bob/trusty/wordpress-2"]`)
+
+	// Otherwise the prunable revisions are deleted.
+	err = store.SetNamespaceRetention("bob", &params.RetentionPolicy{
+		KeepRevisions: 1,
+	})
+	c.Assert(err, gc.IsNil)
+	n, err = store.ApplyRetentionPolicies()
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 2)
+	for _, id := range pruned {
+		_, err := store.FindEntity(id)
+		c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	}
+	entries, err = store.AuditEntries(AuditQuery{
+		Operation: params.AuditPrune,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 2)
+	for _, e := range entries {
+		c.Assert(e.Entity.String(), gc.Matches, `cs:~bob/trusty/wordpress-[24]`)
+	}
+
+	// The remaining revisions are kept.
+	n, err = store.ApplyRetentionPolicies()
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+	for _, id := range []string{
+		"~bob/trusty/wordpress-0",
+		"~bob/trusty/wordpress-1",
+		"~bob/trusty/wordpress-3",
+		"~bob/trusty/wordpress-5",
+		"~bob/trusty/wordpress-6",
+		"~bob/precise/wordpress-0",
+		"~bob/bundle/wordpress-simple-0",
+	} {
+		_, err := store.FindEntity(charm.MustParseReference(id))
+		c.Assert(err, gc.IsNil, gc.Commentf("%s", id))
+	}
+}
+
+// newRetentionStore returns a store holding revisions of charms
+// in the namespace of bob, only wordpress-2 and wordpress-4 of
+// which can be pruned when keeping a single revision:
+//
+//	~bob/trusty/wordpress-0 is promulgated;
+//	~bob/trusty/wordpress-1 is referenced by a bundle;
+//	~bob/trusty/wordpress-3 is the latest development revision;
+//	~bob/trusty/wordpress-5 is the latest stable revision;
+//	~bob/trusty/wordpress-6 is embargoed;
+//	~bob/precise/wordpress-0 is the only revision in its series.
+func (s *StoreSuite) newRetentionStore(c *gc.C) *Store {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	err = store.AddCharmWithArchive(
+		charm.MustParseReference("~bob/trusty/wordpress-0"),
+		charm.MustParseReference("trusty/wordpress-0"),
+		wordpress,
+	)
+	c.Assert(err, gc.IsNil)
+	for _, id := range []string{
+		"~bob/trusty/wordpress-1",
+		"~bob/trusty/wordpress-2",
+		"~bob/trusty/wordpress-4",
+		"~bob/trusty/wordpress-5",
+		"~bob/precise/wordpress-0",
+	} {
+		err := store.AddCharmWithArchive(charm.MustParseReference(id), nil, wordpress)
+		c.Assert(err, gc.IsNil)
+	}
+	addCharmToChannels(c, store, charm.MustParseReference("~bob/trusty/wordpress-3"), wordpress, params.DevelopmentChannel)
+	addCharmWithParams(c, store, wordpress, AddParams{
+		URL:                 charm.MustParseReference("~bob/trusty/wordpress-6"),
+		PromulgatedRevision: -1,
+		PublishAt:           time.Now().Add(time.Hour),
+	})
+	err = store.AddBundle(&testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"wordpress": {
+					Charm:    "cs:~bob/trusty/wordpress-1",
+					NumUnits: 1,
+				},
+			},
+		},
+	}, AddParams{
+		URL:                 charm.MustParseReference("~bob/bundle/wordpress-simple-0"),
+		BlobName:            "blobName",
+		BlobHash:            fakeBlobHash,
+		BlobSize:            fakeBlobSize,
+		PromulgatedRevision: -1,
+	})
+	c.Assert(err, gc.IsNil)
+	return store
+}
@@ -55,6 +55,26 @@ type SearchDoc struct {
 	*mongodoc.Entity
 	TotalDownloads int64
 	ReadACLs       []string
+	// ReadACLExpiries holds the time-limited entries of the read
+	// ACL, each one combined with its expiry time by aclExpiryTerm.
+	// Those entries are not included in ReadACLs.
+	ReadACLExpiries []string `json:",omitempty"`
+	// Stale holds whether a bundle references charms that
+	// are out of date or no longer available.
+	Stale bool
+	// Aliases holds the other names of the charm or bundle.
+	Aliases []string `json:",omitempty"`
+	// Deprecated holds whether the entity or its base entity
+	// is deprecated. It hides the deprecation details of the
+	// entity, which are not indexed.
+	Deprecated bool
+	// Channel holds the channel the record is for. Each
+	// channel has its own record, holding the latest revision
+	// published to that channel.
+	Channel params.Channel
+	// Advisories holds the ids of the security advisories
+	// affecting the entity.
+	Advisories []string `json:",omitempty"`
 }
 
 // UpdateSearchAsync will update the search record for the entity
@@ -67,9 +87,10 @@ func (s *Store) UpdateSearchAsync(r *charm.Reference) {
 	}()
 }
 
-// UpdateSearch updates the search record for the entity reference r.
-// The search index only includes the latest revision of each entity so
-// the latest revision of the charm specified by r will be indexed.
+// UpdateSearch updates the search records for the entity reference r.
+// The search index only includes the latest revision of each entity in
+// each channel so the latest revision of the charm specified by r
+// published to each channel will be indexed.
 func (s *Store) UpdateSearch(r *charm.Reference) error {
 	if s.ES == nil || s.ES.Database == nil {
 		return nil
@@ -77,37 +98,64 @@ func (s *Store) UpdateSearch(r *charm.Reference) error {
 	if deprecatedSeries[r.Series] {
 		return nil
 	}
-	var query *mgo.Query
+	var q bson.D
+	var sort string
 	if r.User == "" {
-		query = s.DB.Entities().Find(bson.D{
+		q = bson.D{
 			{"name", r.Name},
 			{"series", r.Series},
 			{"promulgated-url", bson.D{{"$exists", true}}},
-		}).Sort("-promulgated-revision")
+		}
+		sort = "-promulgated-revision"
 	} else {
-		query = s.DB.Entities().Find(bson.D{
+		q = bson.D{
 			{"user", r.User},
 			{"name", r.Name},
 			{"series", r.Series},
-		}).Sort("-revision")
+		}
+		sort = "-revision"
+	}
+	var baseEntity *mongodoc.BaseEntity
+	for _, c := range params.OrderedChannels {
+		var entity mongodoc.Entity
+		cq := append(q[:len(q):len(q)], channelQuery(c)...)
+		cq = append(cq, bson.DocElem{"embargo", bson.D{{"$exists", false}}})
+		if err := s.DB.Entities().Find(cq).Sort(sort).One(&entity); err != nil {
+			if err == mgo.ErrNotFound {
+				// No revision can be found by searches of the
+				// channel, for instance because the last one
+				// has been deleted.
+				if err := s.ES.deleteChannel(r, c); err != nil {
+					return errgo.Notef(err, "cannot update search index")
+				}
+				continue
+			}
+			return errgo.Notef(err, "cannot get %s", r)
+		}
+		if baseEntity == nil {
+			var err error
+			baseEntity, err = s.FindBaseEntity(entity.BaseURL, "acls", "aliases", "deprecated")
+			if err != nil {
+				return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+			}
+		}
+		doc, err := s.searchDocFromEntity(&entity, baseEntity)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		doc.Channel = c
+		if err := s.ES.update(doc); err != nil {
+			return errgo.Notef(err, "cannot update search index")
+		}
 	}
-	var entity mongodoc.Entity
-	if err := query.One(&entity); err != nil {
-		if err == mgo.ErrNotFound {
+	if baseEntity == nil {
+		n, err := s.DB.Entities().Find(q).Count()
+		if err != nil {
+			return errgo.Notef(err, "cannot get %s", r)
+		}
+		if n == 0 {
 			return errgo.WithCausef(nil, params.ErrNotFound, "entity not found %s", r)
 		}
-		return errgo.Notef(err, "cannot get %s", r)
-	}
-	baseEntity, err := s.FindBaseEntity(entity.BaseURL, "acls")
-	if err != nil {
-		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
-	}
-	doc, err := s.searchDocFromEntity(&entity, baseEntity)
-	if err != nil {
-		return errgo.Mask(err)
-	}
-	if err := s.ES.update(doc); err != nil {
-		return errgo.Notef(err, "cannot update search index")
 	}
 	return nil
 }
@@ -137,16 +185,84 @@ func (s *Store) UpdateSearchFields(r *charm.Reference, fields map[string]interfa
 // searchDocFromEntity performs the processing required to convert a mongodoc.Entity
 // to an esDoc for indexing.
 func (s *Store) searchDocFromEntity(e *mongodoc.Entity, be *mongodoc.BaseEntity) (*SearchDoc, error) {
-	doc := SearchDoc{Entity: e}
-	doc.ReadACLs = be.ACLs.Read
+	doc := SearchDoc{
+		Entity:     e,
+		Aliases:    be.Aliases,
+		Deprecated: e.Deprecated != nil || be.Deprecated != nil,
+	}
+	doc.ReadACLs, doc.ReadACLExpiries = searchReadACLs(be.ACLs, time.Now())
+	advisories, err := s.entityAdvisories(e)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for _, a := range advisories {
+		doc.Advisories = append(doc.Advisories, a.Id)
+	}
 	_, allRevisions, err := s.ArchiveDownloadCounts(e.URL)
 	if err != nil {
 		return nil, errgo.Mask(err)
 	}
 	doc.TotalDownloads = allRevisions.Total
+	if e.URL.Series == "bundle" {
+		doc.Stale, err = s.bundleIsStale(e)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
 	return &doc, nil
 }
 
+// searchReadACLs returns the entries of the read ACL to be indexed.
+// Entries that never expire are returned in permanent, while the
+// time-limited entries not yet expired at the given time are returned
+// in expiring, combined with their expiry time.
+func searchReadACLs(acls mongodoc.ACL, now time.Time) (permanent, expiring []string) {
+	if len(acls.Expiries) == 0 {
+		return acls.Read, nil
+	}
+	expiries := make(map[string]time.Time)
+	for _, e := range acls.Expiries {
+		if e.Perm == "read" {
+			expiries[e.Name] = e.Expires
+		}
+	}
+	permanent = make([]string, 0, len(acls.Read))
+	for _, name := range acls.Read {
+		expires, ok := expiries[name]
+		switch {
+		case !ok:
+			permanent = append(permanent, name)
+		case now.Before(expires):
+			expiring = append(expiring, aclExpiryTerm(name, expires))
+		}
+	}
+	return permanent, expiring
+}
+
+// aclExpiryFormat holds the format of the expiry times in indexed
+// time-limited ACL entries. Times in this format compare lexically
+// in chronological order.
+const aclExpiryFormat = "20060102T150405Z"
+
+// aclExpiryTerm returns the indexed term for a time-limited ACL entry
+// for the given user or group expiring at the given time.
+func aclExpiryTerm(name string, expires time.Time) string {
+	return name + ":" + expires.UTC().Format(aclExpiryFormat)
+}
+
+// aclExpiryFilter returns a filter matching documents in which the
+// given user or group holds a time-limited read entry not yet expired
+// at the given time. The range upper bound uses ";", the character
+// following ":" in ASCII order, so that only terms for the given
+// name match.
+func aclExpiryFilter(name string, now time.Time) elasticsearch.Filter {
+	return elasticsearch.RangeFilter{
+		Field: "ReadACLExpiries",
+		GT:    aclExpiryTerm(name, now),
+		LT:    name + ";",
+	}
+}
+
 // update inserts an entity into elasticsearch if elasticsearch
 // is configured. The entity with id r is extracted from mongodb
 // and written into elasticsearch.
@@ -157,7 +273,7 @@ func (si *SearchIndex) update(doc *SearchDoc) error {
 	err := si.PutDocumentVersionWithType(
 		si.Index,
 		typeName,
-		si.getID(doc.URL),
+		si.channelID(doc.URL, doc.Channel),
 		int64(doc.URL.Revision),
 		elasticsearch.ExternalGTE,
 		doc)
@@ -167,6 +283,32 @@ func (si *SearchIndex) update(doc *SearchDoc) error {
 	return nil
 }
 
+// delete removes the search records for the entity reference r in all
+// channels, if elasticsearch is configured. It is not an error if there
+// is no such record.
+func (si *SearchIndex) delete(r *charm.Reference) error {
+	for _, c := range params.OrderedChannels {
+		if err := si.deleteChannel(r, c); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// deleteChannel removes the search record for the entity reference r
+// in the given channel, if elasticsearch is configured. It is not an
+// error if there is no such record.
+func (si *SearchIndex) deleteChannel(r *charm.Reference, c params.Channel) error {
+	if si == nil || si.Database == nil {
+		return nil
+	}
+	err := si.DeleteDocument(si.Index, typeName, si.channelID(r, c))
+	if err != nil && err != elasticsearch.ErrNotFound {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
 // getID returns an ID for the elasticsearch document based on the contents of the
 // mongoDB document. This is to allow elasticsearch documents to be replaced with
 // updated versions when charm data is changed.
@@ -179,6 +321,21 @@ func (si *SearchIndex) getID(r *charm.Reference) string {
 	return strings.TrimRight(s, "=")
 }
 
+// channelID returns the ID of the elasticsearch document for the
+// given channel. The stable channel documents use the same IDs as
+// the documents indexed before channels were introduced.
+func (si *SearchIndex) channelID(r *charm.Reference, c params.Channel) string {
+	c = resolveChannel(c)
+	if c == params.StableChannel {
+		return si.getID(r)
+	}
+	ref := *r
+	ref.Revision = -1
+	b := sha1.Sum([]byte(ref.String() + "@" + string(c)))
+	s := base64.URLEncoding.EncodeToString(b[:])
+	return strings.TrimRight(s, "=")
+}
+
 // Search searches for matching entities in the configured elasticsearch index.
 // If there is no elasticsearch index configured then it will return an empty
 // SearchResult, as if no results were found.
@@ -377,6 +534,9 @@ type SearchParams struct {
 	// Admin searches will not filter on the ACL and will show results for all matching
 	// charms.
 	Admin bool
+	// Channel holds the channel to search within. The stable
+	// channel is searched if no channel is specified.
+	Channel params.Channel
 	// Sort the returned items.
 	sort []sortParam
 }
@@ -440,6 +600,7 @@ func queryFields(sp SearchParams) map[string]float64 {
 		"CharmRequiredInterfaces": 3,
 		"CharmMeta.Description":   1,
 		"BundleReadMe":            1,
+		"Aliases":                 10,
 	}
 	if sp.AutoComplete {
 		fields["CharmMeta.Name.ngrams"] = 10
@@ -491,6 +652,10 @@ func createSearchDSL(sp SearchParams) elasticsearch.QueryDSL {
 			Filter:      ownerFilter(""),
 			BoostFactor: 1.25,
 		},
+		elasticsearch.BoostFactorFunction{
+			Filter:      deprecatedFilter("1"),
+			BoostFactor: 0.5,
+		},
 	}
 	for k, v := range seriesBoost {
 		f = append(f, elasticsearch.BoostFactorFunction{
@@ -506,7 +671,7 @@ func createSearchDSL(sp SearchParams) elasticsearch.QueryDSL {
 	// Filters
 	qdsl.Query = elasticsearch.FilteredQuery{
 		Query:  q,
-		Filter: createFilters(sp.Filters, sp.Admin, sp.Groups),
+		Filter: createFilters(sp.Filters, sp.Channel, sp.Admin, sp.Groups),
 	}
 
 	// Sorting
@@ -524,9 +689,14 @@ func createSearchDSL(sp SearchParams) elasticsearch.QueryDSL {
 // filter is created that matches any one of the set of values specified for
 // that key. The created filter will only match when at least one of the
 // requested values matches for all of the requested keys. Any filter names
-// that are not defined in the filters map will be silently skipped.
-func createFilters(f map[string][]string, admin bool, groups []string) elasticsearch.Filter {
-	af := make(elasticsearch.AndFilter, 0, len(f)+1)
+// that are not defined in the filters map will be silently skipped. Only
+// the records for the given channel are matched.
+func createFilters(f map[string][]string, channel params.Channel, admin bool, groups []string) elasticsearch.Filter {
+	af := make(elasticsearch.AndFilter, 0, len(f)+2)
+	af = append(af, elasticsearch.TermFilter{
+		Field: "Channel",
+		Value: string(resolveChannel(channel)),
+	})
 	for k, vals := range f {
 		filter, ok := filters[k]
 		if !ok {
@@ -541,16 +711,15 @@ func createFilters(f map[string][]string, admin bool, groups []string) elasticse
 	if admin {
 		return af
 	}
-	gf := make(elasticsearch.OrFilter, 0, len(groups)+1)
-	gf = append(gf, elasticsearch.TermFilter{
-		Field: "ReadACLs",
-		Value: params.Everyone,
-	})
-	for _, g := range groups {
+	// Time-limited read entries are matched only until they
+	// expire, even if they have not been pruned yet.
+	now := time.Now()
+	gf := make(elasticsearch.OrFilter, 0, 2*len(groups)+2)
+	for _, g := range append([]string{params.Everyone}, groups...) {
 		gf = append(gf, elasticsearch.TermFilter{
 			Field: "ReadACLs",
 			Value: g,
-		})
+		}, aclExpiryFilter(g, now))
 	}
 	af = append(af, gf)
 	return af
@@ -560,17 +729,45 @@ func createFilters(f map[string][]string, admin bool, groups []string) elasticse
 // function that will generate an elasticsearch query DSL filter for the
 // given value.
 var filters = map[string]func(string) elasticsearch.Filter{
+	"advisories":  advisoriesFilter,
+	"deprecated":  deprecatedFilter,
 	"description": descriptionFilter,
 	"name":        nameFilter,
 	"owner":       ownerFilter,
 	"provides":    termFilter("CharmProvidedInterfaces"),
 	"requires":    termFilter("CharmRequiredInterfaces"),
 	"series":      seriesFilter,
+	"stale":       staleFilter,
 	"summary":     summaryFilter,
 	"tags":        tagsFilter,
 	"type":        typeFilter,
 }
 
+// advisoriesFilter generates a filter that will match against the
+// security advisories affecting the charm or bundle: "1" matches the
+// affected ones, any other value the others.
+func advisoriesFilter(value string) elasticsearch.Filter {
+	f := elasticsearch.ExistsFilter("Advisories")
+	if value == "1" {
+		return f
+	}
+	return elasticsearch.NotFilter{f}
+}
+
+// deprecatedFilter generates a filter that will match against the
+// deprecated status of the charm or bundle: "1" matches the deprecated
+// ones, any other value the others.
+func deprecatedFilter(value string) elasticsearch.Filter {
+	f := elasticsearch.TermFilter{
+		Field: "Deprecated",
+		Value: "true",
+	}
+	if value == "1" {
+		return f
+	}
+	return elasticsearch.NotFilter{f}
+}
+
 // descriptionFilter generates a filter that will match against the
 // description field of the charm data.
 func descriptionFilter(value string) elasticsearch.Filter {
@@ -584,13 +781,19 @@ func descriptionFilter(value string) elasticsearch.Filter {
 }
 
 // nameFilter generates a filter that will match against the
-// name of the charm or bundle.
+// name or the aliases of the charm or bundle.
 func nameFilter(value string) elasticsearch.Filter {
-	return elasticsearch.QueryFilter{
-		Query: elasticsearch.MatchQuery{
-			Field: "Name",
-			Query: value,
-			Type:  "phrase",
+	return elasticsearch.OrFilter{
+		elasticsearch.QueryFilter{
+			Query: elasticsearch.MatchQuery{
+				Field: "Name",
+				Query: value,
+				Type:  "phrase",
+			},
+		},
+		elasticsearch.TermFilter{
+			Field: "Aliases",
+			Value: value,
 		},
 	}
 }
@@ -622,6 +825,20 @@ func seriesFilter(value string) elasticsearch.Filter {
 	}
 }
 
+// staleFilter generates a filter that will match bundles
+// referencing charms that are out of date or no longer available
+// when value is "1", and any other entity otherwise.
+func staleFilter(value string) elasticsearch.Filter {
+	f := elasticsearch.TermFilter{
+		Field: "Stale",
+		Value: "true",
+	}
+	if value == "1" {
+		return f
+	}
+	return elasticsearch.NotFilter{f}
+}
+
 // summaryFilter generates a filter that will match against the
 // summary field from the charm data.
 func summaryFilter(value string) elasticsearch.Filter {
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -86,6 +87,7 @@ func (s *StoreSearchSuite) TestSuccessfulExport(c *gc.C) {
 			Entity:         entity,
 			TotalDownloads: int64(charmDownloadCounts[name]),
 			ReadACLs:       readACLs,
+			Channel:        params.StableChannel,
 		}
 		c.Assert(string(actual), jc.JSONEquals, doc)
 	}
@@ -124,7 +126,11 @@ func (s *StoreSearchSuite) TestExportOnlyLatest(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	err = s.store.ES.GetDocument(s.TestIndex, typeName, s.store.ES.getID(old.URL), &actual)
 	c.Assert(err, gc.IsNil)
-	doc := SearchDoc{Entity: expected, ReadACLs: []string{params.Everyone, "charmers"}}
+	doc := SearchDoc{
+		Entity:   expected,
+		ReadACLs: []string{params.Everyone, "charmers"},
+		Channel:  params.StableChannel,
+	}
 	c.Assert(string(actual), jc.JSONEquals, doc)
 }
 
@@ -133,7 +139,7 @@ func (s *StoreSearchSuite) TestExportSearchDocument(c *gc.C) {
 	var actual json.RawMessage
 	err := s.store.DB.Entities().FindId("cs:~charmers/precise/wordpress-23").One(&entity)
 	c.Assert(err, gc.IsNil)
-	doc := SearchDoc{Entity: entity, TotalDownloads: 4000}
+	doc := SearchDoc{Entity: entity, TotalDownloads: 4000, Channel: params.StableChannel}
 	err = s.store.ES.update(&doc)
 	c.Assert(err, gc.IsNil)
 	err = s.store.ES.GetDocument(s.TestIndex, typeName, s.store.ES.getID(entity.URL), &actual)
@@ -727,3 +733,190 @@ func assertSearchResults(c *gc.C, obtained SearchResult, expected []string) {
 		c.Assert(ids[i], gc.Equals, v)
 	}
 }
+
+func (s *StoreSearchSuite) TestSearchChannels(c *gc.C) {
+	// Add a new revision of varnish to the development channel.
+	url := charm.MustParseReference("cs:~foo/trusty/varnish-2")
+	addCharmToChannels(c, s.store, url, storetesting.Charms.CharmDir("varnish"), params.DevelopmentChannel)
+	err := s.store.ES.Database.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+
+	for i, test := range []struct {
+		channel params.Channel
+		expect  []string
+	}{{
+		channel: params.NoChannel,
+		expect:  []string{exportTestCharms["varnish"]},
+	}, {
+		channel: params.StableChannel,
+		expect:  []string{exportTestCharms["varnish"]},
+	}, {
+		channel: params.DevelopmentChannel,
+		expect:  []string{"cs:~foo/trusty/varnish-2"},
+	}, {
+		channel: params.CandidateChannel,
+		expect:  []string{},
+	}} {
+		c.Logf("test %d: channel %q", i, test.channel)
+		res, err := s.store.Search(SearchParams{
+			Filters: map[string][]string{
+				"name": {"varnish"},
+			},
+			Channel: test.channel,
+		})
+		c.Assert(err, gc.IsNil)
+		assertSearchResults(c, res, test.expect)
+	}
+
+	// Publishing the new revision to the stable
+	// channel replaces the stable record.
+	_, err = s.store.Publish(url, []params.Channel{params.StableChannel})
+	c.Assert(err, gc.IsNil)
+	err = s.store.ES.Database.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+	res, err := s.store.Search(SearchParams{
+		Filters: map[string][]string{
+			"name": {"varnish"},
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	assertSearchResults(c, res, []string{"cs:~foo/trusty/varnish-2"})
+}
+
+func (s *StoreSearchSuite) TestDeleteEntityRemovesSearchDoc(c *gc.C) {
+	url := charm.MustParseReference("cs:~foo/utopic/varnish-0")
+	err := s.store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("varnish"))
+	c.Assert(err, gc.IsNil)
+	present, err := s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.getID(url))
+	c.Assert(err, gc.IsNil)
+	c.Assert(present, jc.IsTrue)
+
+	// Deleting the last revision in the series removes its record.
+	err = s.store.DeleteEntity(url)
+	c.Assert(err, gc.IsNil)
+	present, err = s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.getID(url))
+	c.Assert(err, gc.IsNil)
+	c.Assert(present, jc.IsFalse)
+}
+
+func (s *StoreSearchSuite) TestDeleteEntityRemovesChannelSearchDoc(c *gc.C) {
+	ch := storetesting.Charms.CharmDir("varnish")
+	url0 := charm.MustParseReference("cs:~foo/trusty/varnish-0")
+	url1 := charm.MustParseReference("cs:~foo/trusty/varnish-1")
+	addCharmToChannels(c, s.store, url0, ch, params.StableChannel)
+	addCharmToChannels(c, s.store, url1, ch, params.CandidateChannel)
+	present, err := s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.channelID(url1, params.CandidateChannel))
+	c.Assert(err, gc.IsNil)
+	c.Assert(present, jc.IsTrue)
+
+	// Deleting the only revision in the candidate channel removes
+	// its record, while the stable record is kept.
+	err = s.store.DeleteEntity(url1)
+	c.Assert(err, gc.IsNil)
+	present, err = s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.channelID(url1, params.CandidateChannel))
+	c.Assert(err, gc.IsNil)
+	c.Assert(present, jc.IsFalse)
+	present, err = s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.channelID(url0, params.StableChannel))
+	c.Assert(err, gc.IsNil)
+	c.Assert(present, jc.IsTrue)
+}
+
+func (s *StoreSearchSuite) TestDeleteEntityWithEmbargoedRevisionsRemovesSearchDoc(c *gc.C) {
+	ch := storetesting.Charms.CharmDir("varnish")
+	url0 := charm.MustParseReference("cs:~foo/trusty/varnish-0")
+	url1 := charm.MustParseReference("cs:~foo/trusty/varnish-1")
+	addCharmWithParams(c, s.store, ch, AddParams{
+		URL:                 url0,
+		PromulgatedRevision: -1,
+		PublishAt:           time.Now().Add(time.Hour),
+	})
+	addCharmToChannels(c, s.store, url1, ch, params.StableChannel)
+	present, err := s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.channelID(url1, params.StableChannel))
+	c.Assert(err, gc.IsNil)
+	c.Assert(present, jc.IsTrue)
+
+	// The remaining revision is embargoed, so the series
+	// must not be found by searches.
+	err = s.store.DeleteEntity(url1)
+	c.Assert(err, gc.IsNil)
+	for _, channel := range params.OrderedChannels {
+		present, err = s.store.ES.HasDocument(s.TestIndex, typeName, s.store.ES.channelID(url1, channel))
+		c.Assert(err, gc.IsNil)
+		c.Assert(present, jc.IsFalse, gc.Commentf("channel %s", channel))
+	}
+}
+
+func (s *StoreSearchSuite) TestSearchExpiringReadACLs(c *gc.C) {
+	now := time.Now()
+	baseEntity, err := s.store.FindBaseEntity(charm.MustParseReference("cs:riak"))
+	c.Assert(err, gc.IsNil)
+	baseEntity.ACLs.Read = []string{"quux", "bob", "alice"}
+	baseEntity.ACLs.Expiries = []mongodoc.ACLExpiry{{
+		Perm:    "read",
+		Name:    "bob",
+		Expires: now.Add(time.Hour),
+	}, {
+		Perm:    "read",
+		Name:    "alice",
+		Expires: now.Add(-time.Hour),
+	}}
+	err = s.store.DB.BaseEntities().UpdateId(baseEntity.URL, baseEntity)
+	c.Assert(err, gc.IsNil)
+	err = s.store.UpdateSearch(charm.MustParseReference(exportTestCharms["riak"]))
+	c.Assert(err, gc.IsNil)
+	err = s.store.ES.Database.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+
+	for i, test := range []struct {
+		groups     []string
+		expectRiak bool
+	}{{
+		groups:     []string{"quux"},
+		expectRiak: true,
+	}, {
+		groups:     []string{"bob"},
+		expectRiak: true,
+	}, {
+		groups:     []string{"alice"},
+		expectRiak: false,
+	}, {
+		groups:     []string{"bobby"},
+		expectRiak: false,
+	}} {
+		c.Logf("test %d: groups %v", i, test.groups)
+		res, err := s.store.Search(SearchParams{
+			Filters: map[string][]string{
+				"name": {"riak"},
+			},
+			Groups: test.groups,
+		})
+		c.Assert(err, gc.IsNil)
+		if test.expectRiak {
+			assertSearchResults(c, res, []string{exportTestCharms["riak"]})
+		} else {
+			assertSearchResults(c, res, []string{})
+		}
+	}
+}
+
+func (s *StoreSearchSuite) TestSearchReadACLs(c *gc.C) {
+	now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	permanent, expiring := searchReadACLs(mongodoc.ACL{
+		Read: []string{params.Everyone, "bob", "alice", "charmers"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "read",
+			Name:    "bob",
+			Expires: now.Add(time.Hour),
+		}, {
+			Perm:    "read",
+			Name:    "alice",
+			Expires: now,
+		}, {
+			Perm:    "write",
+			Name:    "charmers",
+			Expires: now.Add(-time.Hour),
+		}},
+	}, now)
+	c.Assert(permanent, jc.DeepEquals, []string{params.Everyone, "charmers"})
+	c.Assert(expiring, jc.DeepEquals, []string{"bob:20150601T130000Z"})
+}
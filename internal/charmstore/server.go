@@ -8,12 +8,15 @@ package charmstore
 
 import (
 	"net/http"
+	"sync"
+	"time"
 
 	"gopkg.in/errgo.v1"
 	"gopkg.in/macaroon-bakery.v0/bakery"
 	"gopkg.in/mgo.v2"
 
 	"gopkg.in/juju/charmstore.v4/internal/router"
+	"gopkg.in/juju/charmstore.v4/params"
 )
 
 // NewAPIHandlerFunc is a function that returns a new API handler that uses
@@ -34,15 +37,80 @@ type ServerParams struct {
 	// PublicKeyLocator holds a public key store.
 	// It may be nil.
 	PublicKeyLocator bakery.PublicKeyLocator
+
+	// GroupsFile optionally holds the path of a YAML file mapping
+	// group names to their members, used to resolve user groups.
+	GroupsFile string
+
+	// IdentityAPIURL optionally holds the URL of the identity
+	// service API used to resolve user groups. It is ignored
+	// if GroupsFile is set.
+	IdentityAPIURL string
+
+	// IdentityAPITimeout holds the maximum duration of the
+	// requests to the identity service API. If zero, a default
+	// timeout is used.
+	IdentityAPITimeout time.Duration
+
+	// GroupsCacheTTL holds the duration for which user groups
+	// are cached. If zero, a default duration is used.
+	GroupsCacheTTL time.Duration
+
+	// ACLPruneInterval holds the interval between removals
+	// of expired time-limited permissions. If zero, expired
+	// permissions are not removed, although they are still
+	// ignored when checking access.
+	ACLPruneInterval time.Duration
+
+	// PublishScheduledInterval holds the interval between
+	// publications of the embargoed charms and bundles whose
+	// publication time has been reached. If zero, embargoed
+	// charms and bundles are only published explicitly.
+	PublishScheduledInterval time.Duration
+
+	// RetentionInterval holds the interval between applications
+	// of the namespace retention policies. If zero, revisions
+	// are never pruned.
+	RetentionInterval time.Duration
+
+	// RateLimits holds the maximum rate of the requests that
+	// each client can make to each class of endpoints, keyed
+	// by class (see params.RateLimitDownload and friends).
+	// Classes with no limit are not rate limited.
+	RateLimits map[string]params.RateLimit
+
+	// StorageQuota holds the default maximum total size in bytes
+	// of the archives in a user namespace. If zero, the size is
+	// not limited unless a quota is set for the namespace.
+	StorageQuota int64
+}
+
+// Server serves the charm store API versions and runs the
+// background jobs of the charm store.
+type Server struct {
+	http.Handler
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Close stops the background jobs of the server. A job that is
+// already running is not interrupted. Close may be called
+// more than once.
+func (srv *Server) Close() {
+	srv.closeOnce.Do(func() {
+		close(srv.closed)
+	})
 }
 
-// NewServer returns a handler that serves the given charm store API
+// NewServer returns a server that serves the given charm store API
 // versions using db to store that charm store data.
 // An optional elasticsearch configuration can be specified in si. If
 // elasticsearch is not being used then si can be set to nil.
 // The key of the versions map is the version name.
 // The handler configuration is provided to all version handlers.
-func NewServer(db *mgo.Database, si *SearchIndex, config ServerParams, versions map[string]NewAPIHandlerFunc) (http.Handler, error) {
+// The server must be closed when it is no longer used.
+func NewServer(db *mgo.Database, si *SearchIndex, config ServerParams, versions map[string]NewAPIHandlerFunc) (*Server, error) {
 	if len(versions) == 0 {
 		return nil, errgo.Newf("charm store server must serve at least one version of the API")
 	}
@@ -71,7 +139,42 @@ func NewServer(db *mgo.Database, si *SearchIndex, config ServerParams, versions
 	for vers, newAPI := range versions {
 		handle(mux, "/"+vers, newAPI(store, config))
 	}
-	return mux, nil
+	srv := &Server{
+		Handler: mux,
+		closed:  make(chan struct{}),
+	}
+	if config.ACLPruneInterval > 0 {
+		go store.pruneExpiredACLsLoop(config.ACLPruneInterval, srv.closed)
+	}
+	if config.PublishScheduledInterval > 0 {
+		go store.publishScheduledLoop(config.PublishScheduledInterval, srv.closed)
+	}
+	if config.RetentionInterval > 0 {
+		go store.applyRetentionPoliciesLoop(config.RetentionInterval, srv.closed)
+	}
+	return srv, nil
+}
+
+// runEvery calls f with the current time every interval until
+// closed is closed.
+func runEvery(interval time.Duration, closed <-chan struct{}, f func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			// Do not start a new run when both the ticker
+			// and closed are ready.
+			select {
+			case <-closed:
+				return
+			default:
+			}
+			f(now)
+		case <-closed:
+			return
+		}
+	}
 }
 
 func handle(mux *router.ServeMux, path string, handler http.Handler) {
@@ -5,6 +5,7 @@ package charmstore
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/juju/testing/httptesting"
 	gc "gopkg.in/check.v1"
@@ -120,6 +121,46 @@ func (s *ServerSuite) TestNewServerWithElasticSearch(c *gc.C) {
 	})
 }
 
+func (s *ServerSuite) TestServerClose(c *gc.C) {
+	config := serverParams
+	config.ACLPruneInterval = time.Millisecond
+	config.PublishScheduledInterval = time.Millisecond
+	config.RetentionInterval = time.Millisecond
+	h, err := NewServer(s.Session.DB("foo"), nil, config, map[string]NewAPIHandlerFunc{
+		"version1": func(*Store, ServerParams) http.Handler { return http.NotFoundHandler() },
+	})
+	c.Assert(err, gc.IsNil)
+	h.Close()
+	// Closing the server again is harmless.
+	h.Close()
+}
+
+func (s *ServerSuite) TestRunEveryStopsWhenClosed(c *gc.C) {
+	called := make(chan struct{}, 1)
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runEvery(time.Millisecond, closed, func(time.Time) {
+			select {
+			case called <- struct{}{}:
+			default:
+			}
+		})
+	}()
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("function never called")
+	}
+	close(closed)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("runEvery did not return after close")
+	}
+}
+
 func assertServesVersion(c *gc.C, h http.Handler, vers string) {
 	path := vers
 	if path != "" {
@@ -0,0 +1,122 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// signingKeySize holds the number of random bytes
+// in the keys used to sign data handed to clients.
+const signingKeySize = 32
+
+// SigningKeys returns the mongo collection where the secret
+// keys used to sign data handed to clients are stored.
+func (s StoreDatabase) SigningKeys() *mgo.Collection {
+	return s.C("signingkeys")
+}
+
+// NewShareToken returns a token allowing anyone to download the
+// archive of the entity with the given fully qualified id until the
+// given expiry time. If meta is true, the token also allows
+// retrieving the entity metadata.
+//
+// The token holds its expiry time and scope, signed with a secret
+// key stored in the database, so that nothing needs to be stored
+// when creating tokens.
+func (s *Store) NewShareToken(id *charm.Reference, meta bool, expires time.Time) (string, error) {
+	key, err := s.signingKey("share")
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	payload := fmt.Sprintf("%d.%s", expires.Unix(), shareScope(meta))
+	return payload + "." + signShareToken(key, id, payload), nil
+}
+
+// CheckShareToken checks that the given share token, as returned by
+// NewShareToken, is valid for the entity with the given fully
+// qualified id. It reports whether the token also allows retrieving
+// the entity metadata. An error with a params.ErrUnauthorized cause
+// is returned if the token is not valid or has expired.
+func (s *Store) CheckShareToken(token string, id *charm.Reference) (meta bool, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid share token")
+	}
+	key, err := s.signingKey("share")
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	sig := signShareToken(key, id, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(sig), []byte(parts[2])) {
+		return false, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid share token")
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid share token")
+	}
+	if !time.Now().Before(time.Unix(expires, 0)) {
+		return false, errgo.WithCausef(nil, params.ErrUnauthorized, "share token expired")
+	}
+	return parts[1] == shareScope(true), nil
+}
+
+// shareScope returns the scope included in share tokens.
+func shareScope(meta bool) string {
+	if meta {
+		return "meta"
+	}
+	return "archive"
+}
+
+// signShareToken returns the signature of the given share token
+// payload for the entity with the given id.
+func signShareToken(key []byte, id *charm.Reference, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id.String() + "\n" + payload))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signingKey returns the signing key with the given name,
+// generating and storing a new random key if none exists.
+func (s *Store) signingKey(name string) ([]byte, error) {
+	var k mongodoc.SigningKey
+	err := s.DB.SigningKeys().FindId(name).One(&k)
+	if err == nil {
+		return k.Key, nil
+	}
+	if err != mgo.ErrNotFound {
+		return nil, errgo.Notef(err, "cannot retrieve %s signing key", name)
+	}
+	k.Name = name
+	k.Key = make([]byte, signingKeySize)
+	if _, err := rand.Read(k.Key); err != nil {
+		return nil, errgo.Notef(err, "cannot generate %s signing key", name)
+	}
+	if err := s.DB.SigningKeys().Insert(&k); err != nil {
+		if !mgo.IsDup(err) {
+			return nil, errgo.Notef(err, "cannot insert %s signing key", name)
+		}
+		// Another server has generated the key concurrently:
+		// use that one.
+		if err := s.DB.SigningKeys().FindId(name).One(&k); err != nil {
+			return nil, errgo.Notef(err, "cannot retrieve %s signing key", name)
+		}
+	}
+	return k.Key, nil
+}
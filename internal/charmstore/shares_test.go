@@ -0,0 +1,59 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestShareToken(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	id := charm.MustParseReference("~bob/trusty/wordpress-1")
+	expires := time.Now().Add(time.Hour)
+
+	token, err := store.NewShareToken(id, false, expires)
+	c.Assert(err, gc.IsNil)
+	meta, err := store.CheckShareToken(token, id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta, jc.IsFalse)
+
+	token, err = store.NewShareToken(id, true, expires)
+	c.Assert(err, gc.IsNil)
+	meta, err = store.CheckShareToken(token, id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta, jc.IsTrue)
+
+	// The token is only valid for the given entity.
+	_, err = store.CheckShareToken(token, charm.MustParseReference("~bob/trusty/wordpress-2"))
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrUnauthorized)
+	c.Assert(err, gc.ErrorMatches, "invalid share token")
+
+	// The token cannot be altered.
+	_, err = store.CheckShareToken("1.meta."+token[len(token)-10:], id)
+	c.Assert(err, gc.ErrorMatches, "invalid share token")
+
+	// Expired tokens are rejected.
+	token, err = store.NewShareToken(id, false, time.Now().Add(-time.Second))
+	c.Assert(err, gc.IsNil)
+	_, err = store.CheckShareToken(token, id)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrUnauthorized)
+	c.Assert(err, gc.ErrorMatches, "share token expired")
+
+	// The signing key is persisted, so that tokens remain valid
+	// when using another store.
+	token, err = store.NewShareToken(id, false, expires)
+	c.Assert(err, gc.IsNil)
+	store, err = NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = store.CheckShareToken(token, id)
+	c.Assert(err, gc.IsNil)
+}
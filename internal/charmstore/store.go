@@ -93,12 +93,48 @@ func (s *Store) ensureIndexes() error {
 	}, {
 		s.DB.Entities(),
 		mgo.Index{Key: []string{"promulgated-url"}, Unique: true, Sparse: true},
+	}, {
+		s.DB.Entities(),
+		mgo.Index{Key: []string{"embargo.publishat"}, Sparse: true},
+	}, {
+		s.DB.Entities(),
+		mgo.Index{Key: []string{"bundlecharms"}},
+	}, {
+		s.DB.Entities(),
+		mgo.Index{Key: []string{"published.stable"}, Sparse: true},
+	}, {
+		s.DB.Entities(),
+		mgo.Index{Key: []string{"published.candidate"}, Sparse: true},
+	}, {
+		s.DB.Entities(),
+		mgo.Index{Key: []string{"published.development"}, Sparse: true},
 	}, {
 		s.DB.BaseEntities(),
 		mgo.Index{Key: []string{"public"}},
+	}, {
+		s.DB.BaseEntities(),
+		mgo.Index{Key: []string{"aliases"}},
 	}, {
 		s.DB.Logs(),
 		mgo.Index{Key: []string{"urls"}},
+	}, {
+		s.DB.APITokens(),
+		mgo.Index{Key: []string{"user"}},
+	}, {
+		s.DB.Audit(),
+		mgo.Index{Key: []string{"time"}},
+	}, {
+		s.DB.Orgs(),
+		mgo.Index{Key: []string{"members.user"}},
+	}, {
+		s.DB.Redirects(),
+		mgo.Index{Key: []string{"to"}},
+	}, {
+		s.DB.Advisories(),
+		mgo.Index{Key: []string{"baseurl", "id"}, Unique: true},
+	}, {
+		s.DB.Advisories(),
+		mgo.Index{Key: []string{"time"}},
 	}}
 	for _, idx := range indexes {
 		err := idx.c.EnsureIndex(idx.i)
@@ -219,6 +255,15 @@ type AddParams struct {
 	// PromulgatedRevision holds the revision number from the promulgated URL.
 	// If the entity is not promulgated this should be set to -1.
 	PromulgatedRevision int
+
+	// Channels holds the channels the entity is published to.
+	// If empty, the entity is published to the stable channel.
+	Channels []params.Channel
+
+	// PublishAt optionally holds the time the entity is published
+	// to its channels. If it is in the future, the entity is
+	// embargoed until then (see PublishScheduled).
+	PublishAt time.Time
 }
 
 // AddCharm adds a charm entities collection with the given
@@ -227,6 +272,8 @@ func (s *Store) AddCharm(c charm.Charm, p AddParams) (err error) {
 	if p.URL.Series == "bundle" || p.URL.User == "" {
 		return errgo.Newf("charm added with invalid id %v", p.URL)
 	}
+	now := time.Now()
+	published, embargo := publication(p, now)
 	entity := &mongodoc.Entity{
 		URL:                     p.URL,
 		BaseURL:                 baseURL(p.URL),
@@ -238,7 +285,7 @@ func (s *Store) AddCharm(c charm.Charm, p AddParams) (err error) {
 		BlobHash256:             p.BlobHash256,
 		BlobName:                p.BlobName,
 		Size:                    p.BlobSize,
-		UploadTime:              time.Now(),
+		UploadTime:              now,
 		CharmMeta:               c.Meta(),
 		CharmConfig:             c.Config(),
 		CharmActions:            c.Actions(),
@@ -247,6 +294,11 @@ func (s *Store) AddCharm(c charm.Charm, p AddParams) (err error) {
 		Contents:                p.Contents,
 		PromulgatedURL:          p.PromulgatedURL,
 		PromulgatedRevision:     p.PromulgatedRevision,
+		Published:               published,
+		Embargo:                 embargo,
+	}
+	if p.PromulgatedURL != nil {
+		entity.PromulgatedTime = now
 	}
 
 	// Check that we're not going to create a charm that duplicates
@@ -269,29 +321,41 @@ func (s *Store) AddCharm(c charm.Charm, p AddParams) (err error) {
 var everyonePerm = []string{params.Everyone}
 
 func (s *Store) insertEntity(entity *mongodoc.Entity) (err error) {
-	readPerm := everyonePerm
-	var writePerm []string
+	acls := mongodoc.ACL{
+		Read: everyonePerm,
+	}
 	if entity.User != "" {
-		readPerm = []string{params.Everyone, entity.User}
-		writePerm = []string{entity.User}
+		// New entities take their permissions and extra-info
+		// from the defaults of their namespace.
+		ns, err := s.Namespace(entity.User)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		acls = ns.ACLs
+		if entity.ExtraInfo == nil && len(ns.ExtraInfo) > 0 {
+			entity.ExtraInfo = ns.ExtraInfo
+		}
 	}
 	// Add the base entity to the database.
 	baseEntity := &mongodoc.BaseEntity{
-		URL:  entity.BaseURL,
-		User: entity.User,
-		Name: entity.Name,
-		// TODO frankban: allow specifying non-public charms on initial upload.
-		Public: true,
-		ACLs: mongodoc.ACL{
-			Read:  readPerm,
-			Write: writePerm,
-		},
+		URL:         entity.BaseURL,
+		User:        entity.User,
+		Name:        entity.Name,
+		Public:      isPublic(acls.Read),
+		ACLs:        acls,
 		Promulgated: entity.PromulgatedURL != nil,
 	}
 	err = s.DB.BaseEntities().Insert(baseEntity)
 	if err != nil && !mgo.IsDup(err) {
 		return errgo.Mask(err)
 	}
+	if err == nil {
+		// The new base entity takes the place of any
+		// entity previously moved away from its id.
+		if err := s.DB.Redirects().RemoveId(entity.BaseURL); err != nil && err != mgo.ErrNotFound {
+			return errgo.Notef(err, "cannot remove redirect for %s", entity.BaseURL)
+		}
+	}
 
 	// Add the entity to the database.
 	err = s.DB.Entities().Insert(entity)
@@ -315,6 +379,10 @@ func (s *Store) insertEntity(entity *mongodoc.Entity) (err error) {
 	if err := s.UpdateSearch(entity.URL); err != nil {
 		return errgo.Notef(err, "cannot index %s to ElasticSearch", entity.URL)
 	}
+	if entity.URL.Series != "bundle" {
+		// A new charm revision may make existing bundles stale.
+		s.updateBundlesSearch(entity.URL)
+	}
 	return nil
 }
 
@@ -356,16 +424,41 @@ func (s *Store) FindEntities(url *charm.Reference, fields ...string) ([]*mongodo
 // FindBestEntity finds the entity that provides the preferred match to
 // the given URL. If any fields are specified, only those fields will be
 // populated in the returned entities. If the given URL has no user then
-// only promulgated entities will be queried.
-func (s *Store) FindBestEntity(url *charm.Reference, fields ...string) (*mongodoc.Entity, error) {
+// only promulgated entities will be queried. If the URL has no revision,
+// only the entities published to the given channel are considered
+// (the stable channel if none is specified). If no entity matches and
+// the URL has no revision, the entities that have the URL name as an
+// alias are queried instead (see FindAlias).
+func (s *Store) FindBestEntity(url *charm.Reference, channel params.Channel, fields ...string) (*mongodoc.Entity, error) {
+	return s.FindBestEntityAt(url, channel, time.Time{}, fields...)
+}
+
+// FindBestEntityAt is like FindBestEntity except that, unless at is
+// zero, it finds the entity that provided the preferred match at the
+// given time: only the entities uploaded by then, promulgated by then
+// if the URL has no user, and published to the channel by then if the
+// URL has no revision are considered.
+func (s *Store) FindBestEntityAt(url *charm.Reference, channel params.Channel, at time.Time, fields ...string) (*mongodoc.Entity, error) {
 	if len(fields) > 0 {
 		// Make sure we have all the fields we need to make a decision.
-		fields = append(fields, "_id", "promulgated-url", "promulgated-revision", "series", "revision")
+		fields = append(fields, "_id", "promulgated-url", "promulgated-revision", "series", "revision", "published")
+		if !at.IsZero() {
+			fields = append(fields, "uploadtime", "promulgated-time")
+		}
 	}
-	entities, err := s.FindEntities(url, fields...)
+	entities, err := s.findEntitiesInChannel(url, channel, at, fields)
 	if err != nil {
 		return nil, errgo.Mask(err)
 	}
+	if len(entities) == 0 && url.Revision == -1 {
+		aliased, err := s.FindAlias(url)
+		if err == nil {
+			entities, err = s.findEntitiesInChannel(aliased, channel, at, fields)
+		}
+		if err != nil && errgo.Cause(err) != params.ErrNotFound {
+			return nil, errgo.Mask(err)
+		}
+	}
 	if len(entities) == 0 {
 		return nil, errgo.WithCausef(nil, params.ErrNotFound, "entity not found")
 	}
@@ -393,6 +486,35 @@ func (s *Store) FindBestEntity(url *charm.Reference, fields ...string) (*mongodo
 	return best, nil
 }
 
+// findEntitiesInChannel is like FindEntities except that, if the
+// given URL has no revision, only the entities published to
+// the given channel are returned. Unless at is zero, only the
+// entities available at the given time are returned (see
+// FindBestEntityAt).
+func (s *Store) findEntitiesInChannel(url *charm.Reference, channel params.Channel, at time.Time, fields []string) ([]*mongodoc.Entity, error) {
+	entities, err := s.FindEntities(url, fields...)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	channel = resolveChannel(channel)
+	found := entities[:0]
+	for _, e := range entities {
+		if url.Revision == -1 && !e.InChannel(channel) {
+			continue
+		}
+		if !at.IsZero() {
+			if !e.AvailableAt(at, url.User == "") {
+				continue
+			}
+			if url.Revision == -1 && !e.InChannelAt(channel, at) {
+				continue
+			}
+		}
+		found = append(found, e)
+	}
+	return found, nil
+}
+
 var seriesScore = map[string]int{
 	"bundle":  -1,
 	"lucid":   1000,
@@ -586,6 +708,7 @@ func (s *Store) Promulgate(url *charm.Reference) error {
 		return errgo.Mask(err)
 	}
 
+	now := time.Now()
 	// Update the newest entity in each series with a base URL that matches the newly promulgated
 	// base entity to have a promulgated URL, if it does not already have one.
 	for _, r := range latestOwned {
@@ -604,6 +727,7 @@ func (s *Store) Promulgate(url *charm.Reference) error {
 				{"$set", bson.D{
 					{"promulgated-url", &pID},
 					{"promulgated-revision", pID.Revision},
+					{"promulgated-time", now},
 				}},
 			},
 		)
@@ -666,6 +790,8 @@ func (s *Store) AddBundle(b charm.Bundle, p AddParams) error {
 	if err != nil {
 		return errgo.Mask(err)
 	}
+	now := time.Now()
+	published, embargo := publication(p, now)
 	entity := &mongodoc.Entity{
 		URL:                 p.URL,
 		BaseURL:             baseURL(p.URL),
@@ -677,7 +803,7 @@ func (s *Store) AddBundle(b charm.Bundle, p AddParams) error {
 		BlobHash256:         p.BlobHash256,
 		BlobName:            p.BlobName,
 		Size:                p.BlobSize,
-		UploadTime:          time.Now(),
+		UploadTime:          now,
 		BundleData:          bundleData,
 		BundleUnitCount:     newInt(bundleUnitCount(bundleData)),
 		BundleMachineCount:  newInt(bundleMachineCount(bundleData)),
@@ -686,6 +812,11 @@ func (s *Store) AddBundle(b charm.Bundle, p AddParams) error {
 		Contents:            p.Contents,
 		PromulgatedURL:      p.PromulgatedURL,
 		PromulgatedRevision: p.PromulgatedRevision,
+		Published:           published,
+		Embargo:             embargo,
+	}
+	if p.PromulgatedURL != nil {
+		entity.PromulgatedTime = now
 	}
 
 	// Check that we're not going to create a bundle that duplicates
@@ -734,6 +865,40 @@ func (s *Store) BlobNameAndHash(id *charm.Reference) (name, hash string, err err
 	return entity.BlobName, entity.BlobHash, nil
 }
 
+// DeleteEntity removes the entity with the given id and its archive,
+// records the deletion in the entity stats, and updates the search
+// index accordingly. It returns an error with a params.ErrNotFound
+// cause if the entity does not exist.
+func (s *Store) DeleteEntity(id *charm.Reference) error {
+	blobName, _, err := s.BlobNameAndHash(id)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if err := s.DB.Entities().RemoveId(id); err != nil {
+		return errgo.Notef(err, "cannot remove %s", id)
+	}
+	// Remove the reference to the archive from the blob store.
+	if err := s.BlobStore.Remove(blobName); err != nil {
+		return errgo.Notef(err, "cannot remove blob %s", blobName)
+	}
+	s.IncCounterAsync(EntityStatsKey(id, params.StatsArchiveDelete))
+	// Index the remaining revisions in the series, if any. The
+	// records of the channels without any remaining published
+	// revision are removed.
+	url := *id
+	url.Revision = -1
+	err = s.UpdateSearch(&url)
+	if errgo.Cause(err) == params.ErrNotFound {
+		// The last revision in the series has been deleted,
+		// so the series must not be found by searches.
+		err = s.ES.delete(&url)
+	}
+	if err != nil {
+		return errgo.Notef(err, "cannot update search index for %q", &url)
+	}
+	return nil
+}
+
 // OpenCachedBlobFile opens a file from the given entity's archive blob.
 // The file is identified by the provided fileId. If the file has not
 // previously been opened on this entity, the isFile function will be
@@ -985,6 +1150,13 @@ var allCollections = []func(StoreDatabase) *mgo.Collection{
 	StoreDatabase.Logs,
 	StoreDatabase.Migrations,
 	StoreDatabase.Macaroons,
+	StoreDatabase.APITokens,
+	StoreDatabase.Namespaces,
+	StoreDatabase.SigningKeys,
+	StoreDatabase.Audit,
+	StoreDatabase.Orgs,
+	StoreDatabase.Redirects,
+	StoreDatabase.Advisories,
 }
 
 // Collections returns a slice of all the collections used
@@ -84,8 +84,18 @@ func (s *StoreSuite) checkAddCharm(c *gc.C, ch charm.Charm, addToES, promulgate
 	// Check the upload time and then reset it to its zero value
 	// so that we can test the deterministic parts later.
 	c.Assert(doc.UploadTime, jc.TimeBetween(beforeAdding, afterAdding))
+	c.Assert(doc.Published, jc.DeepEquals, map[params.Channel]time.Time{
+		params.StableChannel: doc.UploadTime,
+	})
+	if promulgate {
+		c.Assert(doc.PromulgatedTime, jc.DeepEquals, doc.UploadTime)
+	} else {
+		c.Assert(doc.PromulgatedTime.IsZero(), jc.IsTrue)
+	}
 
 	doc.UploadTime = time.Time{}
+	doc.PromulgatedTime = time.Time{}
+	doc.Published = nil
 
 	blobName := doc.BlobName
 	c.Assert(blobName, gc.Matches, "[0-9a-z]+")
@@ -174,7 +184,17 @@ func (s *StoreSuite) checkAddBundle(c *gc.C, bundle charm.Bundle, addToES, promu
 	// Check the upload time and then reset it to its zero value
 	// so that we can test the deterministic parts later.
 	c.Assert(doc.UploadTime, jc.TimeBetween(beforeAdding, afterAdding))
+	c.Assert(doc.Published, jc.DeepEquals, map[params.Channel]time.Time{
+		params.StableChannel: doc.UploadTime,
+	})
+	if promulgate {
+		c.Assert(doc.PromulgatedTime, jc.DeepEquals, doc.UploadTime)
+	} else {
+		c.Assert(doc.PromulgatedTime.IsZero(), jc.IsTrue)
+	}
 	doc.UploadTime = time.Time{}
+	doc.PromulgatedTime = time.Time{}
+	doc.Published = nil
 
 	// The blob name is random, but we check that it's
 	// in the correct format, and non-empty.
@@ -229,13 +249,17 @@ func (s *StoreSuite) checkAddBundle(c *gc.C, bundle charm.Bundle, addToES, promu
 func assertBaseEntity(c *gc.C, store *Store, url *charm.Reference, promulgated bool) {
 	baseEntity, err := store.FindBaseEntity(url)
 	c.Assert(err, gc.IsNil)
-	expectACLs := mongodoc.ACL{
-		Read:  []string{params.Everyone},
-		Write: []string{},
-	}
+	writePerm := []string{}
 	if url.User != "" {
-		expectACLs.Read = append(expectACLs.Read, url.User)
-		expectACLs.Write = append(expectACLs.Write, url.User)
+		writePerm = append(writePerm, url.User)
+	}
+	expectACLs := mongodoc.ACL{
+		Read:       append([]string{params.Everyone}, writePerm...),
+		Write:      writePerm,
+		Upload:     writePerm,
+		Delete:     writePerm,
+		Admin:      writePerm,
+		Promulgate: writePerm,
 	}
 	c.Assert(baseEntity, jc.DeepEquals, &mongodoc.BaseEntity{
 		URL:         url,
@@ -434,8 +458,12 @@ var findBaseEntityTests = []struct {
 		Public:      true,
 		Promulgated: true,
 		ACLs: mongodoc.ACL{
-			Read:  []string{"everyone", "charmers"},
-			Write: []string{"charmers"},
+			Read:       []string{"everyone", "charmers"},
+			Write:      []string{"charmers"},
+			Upload:     []string{"charmers"},
+			Delete:     []string{"charmers"},
+			Admin:      []string{"charmers"},
+			Promulgate: []string{"charmers"},
 		},
 	},
 }, {
@@ -456,8 +484,12 @@ var findBaseEntityTests = []struct {
 	expect: &mongodoc.BaseEntity{
 		URL: charm.MustParseReference("~who/django"),
 		ACLs: mongodoc.ACL{
-			Read:  []string{"everyone", "who"},
-			Write: []string{"who"},
+			Read:       []string{"everyone", "who"},
+			Write:      []string{"who"},
+			Upload:     []string{"who"},
+			Delete:     []string{"who"},
+			Admin:      []string{"who"},
+			Promulgate: []string{"who"},
 		},
 	},
 }, {
@@ -1298,8 +1330,10 @@ func (s *StoreSuite) TestCollections(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	// Some collections don't have indexes so they are created only when used.
 	createdOnUse := map[string]bool{
-		"migrations": true,
-		"macaroons":  true,
+		"migrations":  true,
+		"macaroons":   true,
+		"namespaces":  true,
+		"signingkeys": true,
 	}
 	// Check that all collections mentioned by Collections are actually created.
 	for _, coll := range colls {
@@ -1719,9 +1753,13 @@ func (s *StoreSuite) TestFindBestEntity(c *gc.C) {
 		PromulgatedRevision: 0,
 	})
 	c.Assert(err, gc.IsNil)
+	// Publish all the entities to the stable channel,
+	// where unresolved ids are resolved by default.
+	_, err = store.DB.Entities().UpdateAll(nil, bson.D{{"$set", bson.D{{"published.stable", time.Now()}}}})
+	c.Assert(err, gc.IsNil)
 	for i, test := range findBestEntityTests {
 		c.Logf("test %d: %s", i, test.url)
-		entity, err := store.FindBestEntity(charm.MustParseReference(test.url))
+		entity, err := store.FindBestEntity(charm.MustParseReference(test.url), params.NoChannel)
 		if test.expectErr != "" {
 			c.Assert(err, gc.ErrorMatches, test.expectErr)
 		} else {
@@ -2053,6 +2091,13 @@ func (s *StoreSuite) TestPromulgate(c *gc.C) {
 		for _, expectEntity := range test.expectEntities {
 			entity, err := store.FindEntity(expectEntity.URL)
 			c.Assert(err, gc.IsNil)
+			if !entity.PromulgatedTime.IsZero() {
+				// The time newly promulgated entities were
+				// given their promulgated URL is recorded.
+				c.Assert(entity.PromulgatedURL, gc.NotNil)
+				c.Assert(entity.PromulgatedTime.After(time.Now()), jc.IsFalse)
+				entity.PromulgatedTime = time.Time{}
+			}
 			c.Assert(entity, jc.DeepEquals, expectEntity)
 		}
 		for _, expectBaseEntity := range test.expectBaseEntities {
@@ -2063,6 +2108,49 @@ func (s *StoreSuite) TestPromulgate(c *gc.C) {
 	}
 }
 
+func (s *StoreSuite) TestFindBestEntityAt(c *gc.C) {
+	store, err := NewStore(s.Session.DB("juju_test"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	url0 := charm.MustParseReference("~bob/trusty/wordpress-0")
+	url1 := charm.MustParseReference("~bob/trusty/wordpress-1")
+	err = store.AddCharmWithArchive(url0, nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	err = store.AddCharmWithArchive(url1, nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	t0 := time.Now().Add(-2 * time.Hour)
+	err = store.UpdateEntity(url0, bson.D{{
+		"$set", bson.D{
+			{"uploadtime", t0},
+			{ChannelTimeField(params.StableChannel), t0},
+		},
+	}})
+	c.Assert(err, gc.IsNil)
+	at := t0.Add(time.Hour)
+
+	assertBest := func(id string, at time.Time, expect *charm.Reference) {
+		entity, err := store.FindBestEntityAt(charm.MustParseReference(id), params.NoChannel, at, "_id")
+		if expect == nil {
+			c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+			return
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(entity.URL, jc.DeepEquals, expect)
+	}
+	assertBest("~bob/wordpress", time.Time{}, url1)
+	assertBest("~bob/wordpress", at, url0)
+	assertBest("~bob/trusty/wordpress-1", at, nil)
+	assertBest("~bob/wordpress", t0.Add(-time.Hour), nil)
+
+	// Entities are only found by their promulgated URL
+	// as of their promulgation.
+	err = store.Promulgate(url1)
+	c.Assert(err, gc.IsNil)
+	assertBest("wordpress", time.Time{}, url1)
+	assertBest("wordpress", at, nil)
+	assertBest("~bob/wordpress", at, url0)
+}
+
 func entity(url, purl string) *mongodoc.Entity {
 	id := charm.MustParseReference(url)
 	var pid *charm.Reference
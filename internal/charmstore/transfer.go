@@ -0,0 +1,326 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	"regexp"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// Redirects returns the mongo collection where the ids of
+// entities moved to another namespace are stored.
+func (s StoreDatabase) Redirects() *mgo.Collection {
+	return s.C("redirects")
+}
+
+// entityStatsKinds holds the kinds of stats recorded for charms and
+// bundles, which are moved with them to their new namespace.
+var entityStatsKinds = []string{
+	params.StatsArchiveDownload,
+	params.StatsArchiveDelete,
+	params.StatsArchiveFailedUpload,
+	params.StatsArchiveUpload,
+	params.StatsShareCreate,
+	params.StatsShareUse,
+	params.StatsCharmInfo,
+	params.StatsCharmMissing,
+	params.StatsCharmEvent,
+}
+
+// Redirect returns the base id of the entity that the given id refers
+// to since it was moved to another namespace. It returns an error with
+// a params.ErrNotFound cause if the id has not been moved.
+func (s *Store) Redirect(id *charm.Reference) (*charm.Reference, error) {
+	var r mongodoc.Redirect
+	if err := s.DB.Redirects().FindId(baseURL(id)).One(&r); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, errgo.WithCausef(nil, params.ErrNotFound, "no redirect for %s", id)
+		}
+		return nil, errgo.Notef(err, "cannot retrieve redirect for %s", id)
+	}
+	return r.To, nil
+}
+
+// TransferBaseEntity moves the base entity with the given id and all
+// its revisions to the namespace of the given user, and returns the new
+// base id. The archive blobs, the promulgated ids and the stats of the
+// entities are kept, and the old ids are redirected to the new ones
+// (see Redirect). The old owner is replaced by the new one in the
+// permissions of the entity.
+//
+// The new base entity is marked as pending until the transfer
+// completes. If the transfer is interrupted, calling TransferBaseEntity
+// again with the same arguments resumes it: each step can safely be
+// repeated.
+//
+// It returns an error with a params.ErrNotFound cause if the base
+// entity does not exist, or with a params.ErrForbidden cause if the
+// target base entity already exists.
+func (s *Store) TransferBaseEntity(id *charm.Reference, user string) (*charm.Reference, error) {
+	from := baseURL(id)
+	if from.User == "" {
+		return nil, errgo.WithCausef(nil, params.ErrForbidden, "cannot transfer %s: no owner", from)
+	}
+	if user == "" || user == from.User {
+		return nil, errgo.WithCausef(nil, params.ErrForbidden, "cannot transfer %s to %q", from, user)
+	}
+	to := *from
+	to.User = user
+	if err := s.startTransfer(from, &to); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound), errgo.Is(params.ErrForbidden))
+	}
+
+	var entities []mongodoc.Entity
+	if err := s.DB.Entities().Find(bson.D{{"baseurl", from}}).All(&entities); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve entities of %s", from)
+	}
+	for _, e := range entities {
+		if err := s.transferEntity(&e, &to); err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	// Move the security advisories, whose revision
+	// ranges still apply to the moved entities.
+	if _, err := s.DB.Advisories().UpdateAll(
+		bson.D{{"baseurl", from}},
+		bson.D{{"$set", bson.D{{"baseurl", &to}}}},
+	); err != nil {
+		return nil, errgo.Notef(err, "cannot update advisories of %s", from)
+	}
+	if err := s.DB.BaseEntities().RemoveId(from); err != nil && err != mgo.ErrNotFound {
+		return nil, errgo.Notef(err, "cannot remove %s", from)
+	}
+
+	// Leave a redirect so that the old ids resolve to the new
+	// owner, including any previous id of the entity.
+	if _, err := s.DB.Redirects().UpsertId(from, &mongodoc.Redirect{
+		From: from,
+		To:   &to,
+		Time: time.Now(),
+	}); err != nil {
+		return nil, errgo.Notef(err, "cannot add redirect for %s", from)
+	}
+	if err := s.DB.Redirects().RemoveId(&to); err != nil && err != mgo.ErrNotFound {
+		return nil, errgo.Notef(err, "cannot remove redirect for %s", &to)
+	}
+	if _, err := s.DB.Redirects().UpdateAll(
+		bson.D{{"to", from}},
+		bson.D{{"$set", bson.D{{"to", &to}}}},
+	); err != nil {
+		return nil, errgo.Notef(err, "cannot update redirects to %s", from)
+	}
+
+	// The entities of an interrupted transfer may already have
+	// been moved, so find the series in the new base id.
+	var series []string
+	if err := s.DB.Entities().Find(bson.D{{"baseurl", &to}}).Distinct("series", &series); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve series of %s", &to)
+	}
+	for _, series := range series {
+		if err := s.transferStats(from, &to, series); err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+
+	// Replace the search records of the old ids.
+	if err := s.updateSearchBase(&to); err != nil {
+		return nil, errgo.Notef(err, "cannot update search index")
+	}
+	for _, series := range series {
+		old := *from
+		old.Series = series
+		if err := s.ES.delete(&old); err != nil {
+			return nil, errgo.Notef(err, "cannot update search index")
+		}
+	}
+
+	if err := s.DB.BaseEntities().UpdateId(&to, bson.D{{
+		"$unset", bson.D{{"transferring-from", ""}},
+	}}); err != nil {
+		return nil, errgo.Notef(err, "cannot complete transfer to %s", &to)
+	}
+	return &to, nil
+}
+
+// startTransfer adds the base entity with the given target id, marked
+// as pending, as a copy of the base entity with the given source id.
+// If the target base entity is already pending a transfer from the
+// same source id, the interrupted transfer is resumed instead.
+func (s *Store) startTransfer(from, to *charm.Reference) error {
+	baseEntity, err := s.FindBaseEntity(from)
+	if errgo.Cause(err) == params.ErrNotFound {
+		// An interrupted transfer may have already
+		// removed the source base entity.
+		if s.transferPending(from, to) {
+			return nil
+		}
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	// Add the new base entity first, so that concurrent
+	// transfers to the same id fail.
+	newBaseEntity := *baseEntity
+	newBaseEntity.URL = to
+	newBaseEntity.User = to.User
+	newBaseEntity.ACLs = renameACLEntry(baseEntity.ACLs, from.User, to.User)
+	newBaseEntity.TransferringFrom = from
+	if err := s.DB.BaseEntities().Insert(&newBaseEntity); err != nil {
+		if !mgo.IsDup(err) {
+			return errgo.Notef(err, "cannot insert %s", to)
+		}
+		if !s.transferPending(from, to) {
+			return errgo.WithCausef(nil, params.ErrForbidden, "%s already exists", to)
+		}
+	}
+	return nil
+}
+
+// transferPending reports whether the base entity with the given
+// target id is pending a transfer from the given source id.
+func (s *Store) transferPending(from, to *charm.Reference) bool {
+	baseEntity, err := s.FindBaseEntity(to, "transferring-from")
+	if err != nil {
+		return false
+	}
+	return baseEntity.TransferringFrom != nil && *baseEntity.TransferringFrom == *from
+}
+
+// transferEntity moves the given entity to the given base id. If a
+// previous attempt was interrupted, it completes the move.
+func (s *Store) transferEntity(e *mongodoc.Entity, to *charm.Reference) error {
+	from := e.URL
+	url := *e.URL
+	url.User = to.User
+	e.URL = &url
+	e.BaseURL = to
+	e.User = to.User
+	if e.PromulgatedURL == nil && e.PromulgatedRevision != -1 {
+		// An interrupted transfer has already released the
+		// promulgated URL: rebuild it from the revision.
+		purl := *from
+		purl.User = ""
+		purl.Revision = e.PromulgatedRevision
+		e.PromulgatedURL = &purl
+	}
+	// The promulgated URL is unique, so release it
+	// before inserting the new entity.
+	if e.PromulgatedURL != nil {
+		if err := s.DB.Entities().UpdateId(from, bson.D{{"$unset", bson.D{{"promulgated-url", ""}}}}); err != nil {
+			return errgo.Notef(err, "cannot update %s", from)
+		}
+	}
+	// The new entity may have been inserted by an interrupted
+	// transfer, in which case it is complete.
+	if err := s.DB.Entities().Insert(e); err != nil && !mgo.IsDup(err) {
+		return errgo.Notef(err, "cannot insert %s", e.URL)
+	}
+	if err := s.DB.Entities().RemoveId(from); err != nil && err != mgo.ErrNotFound {
+		return errgo.Notef(err, "cannot remove %s", from)
+	}
+	return nil
+}
+
+// transferStats moves the stats counters of the entities with the given
+// base id and series to the entities with the same series and the new
+// base id. The counts are copied rather than added, so that counters
+// already copied by an interrupted transfer are not counted twice.
+func (s *Store) transferStats(from, to *charm.Reference, series string) error {
+	db := s.DB.Copy()
+	defer db.Close()
+	counters := db.StatCounters()
+	for _, kind := range entityStatsKinds {
+		old := *from
+		old.Series = series
+		oldPrefix, err := s.statsKey(db, EntityStatsKey(&old, kind), false)
+		if errgo.Cause(err) == params.ErrNotFound {
+			// No stats have ever been recorded.
+			continue
+		}
+		if err != nil {
+			return errgo.Notef(err, "cannot get stats key")
+		}
+		// Revisions are keyed after the base id, so moving all
+		// the keys with the base id as prefix moves all the
+		// revision stats too.
+		var docs []struct {
+			Key   string `bson:"k"`
+			Time  int32  `bson:"t"`
+			Count int64  `bson:"c"`
+		}
+		query := bson.D{{"k", bson.D{{"$regex", "^" + regexp.QuoteMeta(oldPrefix)}}}}
+		if err := counters.Find(query).All(&docs); err != nil {
+			return errgo.Notef(err, "cannot retrieve stats")
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		moved := *to
+		moved.Series = series
+		newPrefix, err := s.statsKey(db, EntityStatsKey(&moved, kind), true)
+		if err != nil {
+			return errgo.Notef(err, "cannot get stats key")
+		}
+		for _, doc := range docs {
+			key := newPrefix + doc.Key[len(oldPrefix):]
+			if _, err := counters.Upsert(
+				bson.D{{"k", key}, {"t", doc.Time}},
+				bson.D{{"$set", bson.D{{"c", doc.Count}}}},
+			); err != nil {
+				return errgo.Notef(err, "cannot update stats")
+			}
+			if err := counters.Remove(bson.D{{"k", doc.Key}, {"t", doc.Time}}); err != nil {
+				return errgo.Notef(err, "cannot remove stats")
+			}
+		}
+	}
+	return nil
+}
+
+// renameACLEntry returns a copy of the given ACLs where
+// the user or group from is replaced by to.
+func renameACLEntry(acls mongodoc.ACL, from, to string) mongodoc.ACL {
+	rename := func(names []string) []string {
+		if names == nil {
+			return nil
+		}
+		renamed := make([]string, 0, len(names))
+		seen := make(map[string]bool)
+		for _, name := range names {
+			if name == from {
+				name = to
+			}
+			if !seen[name] {
+				seen[name] = true
+				renamed = append(renamed, name)
+			}
+		}
+		return renamed
+	}
+	result := mongodoc.ACL{
+		Read:       rename(acls.Read),
+		Write:      rename(acls.Write),
+		Upload:     rename(acls.Upload),
+		Delete:     rename(acls.Delete),
+		Admin:      rename(acls.Admin),
+		Promulgate: rename(acls.Promulgate),
+	}
+	for _, e := range acls.Expiries {
+		if e.Name == from {
+			e.Name = to
+		}
+		result.Expiries = append(result.Expiries, e)
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmstore
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *StoreSuite) TestTransferBaseEntity(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	for _, id := range []string{"~alice/trusty/wordpress-0", "~alice/precise/wordpress-0"} {
+		err := store.AddCharmWithArchive(charm.MustParseReference(id), nil, wordpress)
+		c.Assert(err, gc.IsNil)
+	}
+	url := charm.MustParseReference("~alice/trusty/wordpress-1")
+	purl := charm.MustParseReference("trusty/wordpress-3")
+	err = store.AddCharmWithArchive(url, purl, wordpress)
+	c.Assert(err, gc.IsNil)
+	old, err := store.FindEntity(url)
+	c.Assert(err, gc.IsNil)
+	for i := 0; i < 2; i++ {
+		err := store.IncCounter(EntityStatsKey(url, params.StatsArchiveDownload))
+		c.Assert(err, gc.IsNil)
+	}
+	err = store.AddAdvisory(&mongodoc.Advisory{
+		Id:       "CVE-2015-0001",
+		BaseURL:  charm.MustParseReference("cs:~alice/wordpress"),
+		Severity: params.SeverityHigh,
+		Affected: []params.RevisionRange{{From: 1, To: 1}},
+	})
+	c.Assert(err, gc.IsNil)
+
+	to, err := store.TransferBaseEntity(charm.MustParseReference("~alice/wordpress"), "bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(to.String(), gc.Equals, "cs:~bob/wordpress")
+
+	// The entities are moved, keeping their blobs and promulgated ids.
+	newURL := charm.MustParseReference("~bob/trusty/wordpress-1")
+	entity, err := store.FindEntity(newURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.BaseURL, jc.DeepEquals, to)
+	c.Assert(entity.User, gc.Equals, "bob")
+	c.Assert(entity.BlobName, gc.Equals, old.BlobName)
+	c.Assert(entity.PromulgatedURL, jc.DeepEquals, purl)
+	entities, err := store.FindEntities(charm.MustParseReference("~bob/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(entities, gc.HasLen, 3)
+	_, err = store.FindEntity(url)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	_, err = store.FindBaseEntity(url)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+	baseEntity, err := store.FindBaseEntity(newURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs, jc.DeepEquals, DefaultACLs("bob"))
+	c.Assert(bool(baseEntity.Promulgated), jc.IsTrue)
+
+	// The stats are moved too.
+	counters, err := store.Counters(&CounterRequest{
+		Key: EntityStatsKey(newURL, params.StatsArchiveDownload),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(counters[0].Count, gc.Equals, int64(2))
+	counters, err = store.Counters(&CounterRequest{
+		Key: EntityStatsKey(url, params.StatsArchiveDownload),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(counters[0].Count, gc.Equals, int64(0))
+
+	// The advisories are moved too.
+	advisories, err := store.EntityAdvisories(newURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, gc.HasLen, 1)
+	c.Assert(advisories[0].Id, gc.Equals, "CVE-2015-0001")
+	c.Assert(advisories[0].BaseURL, jc.DeepEquals, to)
+	advisories, err = store.FindAdvisories(AdvisoryQuery{
+		BaseURL: charm.MustParseReference("cs:~alice/wordpress"),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, gc.HasLen, 0)
+
+	// The old ids are redirected to the new ones.
+	redirect, err := store.Redirect(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(redirect, jc.DeepEquals, to)
+	_, err = store.Redirect(newURL)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+
+	// Existing entities cannot be replaced.
+	err = store.AddCharmWithArchive(charm.MustParseReference("~carol/trusty/wordpress-0"), nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	_, err = store.TransferBaseEntity(to, "carol")
+	c.Assert(err, gc.ErrorMatches, "cs:~carol/wordpress already exists")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrForbidden)
+	_, err = store.TransferBaseEntity(charm.MustParseReference("~alice/wordpress"), "dave")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+
+	// Previous ids follow further transfers.
+	to, err = store.TransferBaseEntity(to, "dave")
+	c.Assert(err, gc.IsNil)
+	redirect, err = store.Redirect(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(redirect.String(), gc.Equals, "cs:~dave/wordpress")
+
+	// New entities with the old id replace the redirect.
+	err = store.AddCharmWithArchive(url, nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	_, err = store.Redirect(url)
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+}
+
+func (s *StoreSuite) TestTransferBaseEntityResume(c *gc.C) {
+	store, err := NewStore(s.Session.DB("testing"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	for _, id := range []string{"~alice/trusty/wordpress-0", "~alice/precise/wordpress-0"} {
+		err := store.AddCharmWithArchive(charm.MustParseReference(id), nil, wordpress)
+		c.Assert(err, gc.IsNil)
+	}
+	url := charm.MustParseReference("~alice/trusty/wordpress-1")
+	purl := charm.MustParseReference("trusty/wordpress-3")
+	err = store.AddCharmWithArchive(url, purl, wordpress)
+	c.Assert(err, gc.IsNil)
+	for i := 0; i < 2; i++ {
+		err := store.IncCounter(EntityStatsKey(url, params.StatsArchiveDownload))
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Simulate a transfer interrupted after moving one entity and
+	// releasing the promulgated id of another.
+	from := charm.MustParseReference("~alice/wordpress")
+	to := charm.MustParseReference("~bob/wordpress")
+	err = store.startTransfer(from, to)
+	c.Assert(err, gc.IsNil)
+	moved, err := store.FindEntity(charm.MustParseReference("~alice/precise/wordpress-0"))
+	c.Assert(err, gc.IsNil)
+	err = store.transferEntity(moved, to)
+	c.Assert(err, gc.IsNil)
+	err = store.DB.Entities().UpdateId(url, bson.D{{"$unset", bson.D{{"promulgated-url", ""}}}})
+	c.Assert(err, gc.IsNil)
+
+	// Transferring again resumes the transfer.
+	_, err = store.TransferBaseEntity(from, "bob")
+	c.Assert(err, gc.IsNil)
+	entities, err := store.FindEntities(to)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entities, gc.HasLen, 3)
+	entities, err = store.FindEntities(from)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entities, gc.HasLen, 0)
+	newURL := charm.MustParseReference("~bob/trusty/wordpress-1")
+	entity, err := store.FindEntity(newURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.PromulgatedURL, jc.DeepEquals, purl)
+	baseEntity, err := store.FindBaseEntity(to)
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.TransferringFrom, gc.IsNil)
+	redirect, err := store.Redirect(url)
+	c.Assert(err, gc.IsNil)
+	c.Assert(redirect, jc.DeepEquals, to)
+	counters, err := store.Counters(&CounterRequest{
+		Key: EntityStatsKey(newURL, params.StatsArchiveDownload),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(counters[0].Count, gc.Equals, int64(2))
+
+	// Once complete, the transfer cannot be repeated.
+	_, err = store.TransferBaseEntity(from, "bob")
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+}
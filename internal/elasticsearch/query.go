@@ -203,6 +203,25 @@ func (t TermFilter) MarshalJSON() ([]byte, error) {
 	return marshalNamedObject("term", map[string]string{t.Field: t.Value})
 }
 
+// RangeFilter provides a filter that requires a field to be
+// strictly between the given bounds. Empty bounds are omitted.
+type RangeFilter struct {
+	Field string
+	GT    string
+	LT    string
+}
+
+func (r RangeFilter) MarshalJSON() ([]byte, error) {
+	bounds := make(map[string]string)
+	if r.GT != "" {
+		bounds["gt"] = r.GT
+	}
+	if r.LT != "" {
+		bounds["lt"] = r.LT
+	}
+	return marshalNamedObject("range", map[string]interface{}{r.Field: bounds})
+}
+
 // ExistsFilter provides a filter that requres a field to be present.
 type ExistsFilter string
 
@@ -88,6 +88,14 @@ func (s *QuerySuite) TestJSONEncodings(c *gc.C) {
 		about: "regexp filter",
 		query: RegexpFilter{Field: "foo", Regexp: ".*"},
 		json:  `{"regexp": {"foo": ".*"}}`,
+	}, {
+		about: "range filter",
+		query: RangeFilter{Field: "foo", GT: "bar", LT: "baz"},
+		json:  `{"range": {"foo": {"gt": "bar", "lt": "baz"}}}`,
+	}, {
+		about: "range filter with lower bound",
+		query: RangeFilter{Field: "foo", GT: "bar"},
+		json:  `{"range": {"foo": {"gt": "bar"}}}`,
 	}, {
 		about: "query dsl",
 		query: QueryDSL{
@@ -7,6 +7,9 @@
 //
 // A GET call to `/charm-info` returns info about one or more charms, including
 // its canonical URL, revision, SHA256 checksum and VCS revision digest.
+// Deprecated charms are reported in the warnings of the response.
+// If the at parameter holds an RFC3339 time, charm URLs are resolved as they
+// would have been at that time.
 // The returned info is in JSON format.
 // For instance a request to `/charm-info?charms=cs:trusty/juju-gui` returns the
 // following response:
@@ -128,10 +131,19 @@ func (h *Handler) resolveURLStr(urlStr string) (*charm.Reference, bool, error) {
 		return nil, false, errgo.WithCausef(err, params.ErrNotFound, "")
 	}
 	fullySpecified := curl.Series != "" && curl.Revision != -1
-	if err := v4.ResolveURL(h.store, curl); err != nil {
+	if err := v4.ResolveURL(h.store, curl, params.NoChannel); err != nil {
 		// Note: preserve error cause from resolveURL.
 		return nil, false, errgo.Mask(err, errgo.Is(params.ErrNotFound))
 	}
+	// The legacy API does not authenticate its users, so
+	// embargoed revisions are never served.
+	embargoed, err := h.store.Embargoed(curl)
+	if err != nil {
+		return nil, false, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if embargoed {
+		return nil, false, errgo.WithCausef(nil, params.ErrNotFound, "no matching charm or bundle for %q", curl)
+	}
 	return curl, fullySpecified, nil
 }
 
@@ -146,6 +158,10 @@ func charmStatsKey(url *charm.Reference, kind string) []string {
 var errNotFound = fmt.Errorf("entry not found")
 
 func (h *Handler) serveCharmInfo(_ http.Header, req *http.Request) (interface{}, error) {
+	at, err := v4.RequestTime(req)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
 	response := make(map[string]*charmrepo.InfoResponse)
 	for _, url := range req.Form["charms"] {
 		c := &charmrepo.InfoResponse{}
@@ -156,7 +172,7 @@ func (h *Handler) serveCharmInfo(_ http.Header, req *http.Request) (interface{},
 		}
 		var entity *mongodoc.Entity
 		if err == nil {
-			entity, err = h.store.FindBestEntity(curl)
+			entity, err = h.store.FindBestEntityAt(curl, params.NoChannel, at)
 			if errgo.Cause(err) == params.ErrNotFound {
 				// The old API actually returned "entry not found"
 				// on *any* error, but it seems reasonable to be
@@ -164,6 +180,10 @@ func (h *Handler) serveCharmInfo(_ http.Header, req *http.Request) (interface{},
 				err = errNotFound
 			}
 		}
+		if err == nil && entity.Embargo != nil {
+			// Embargoed revisions are never served (see resolveURLStr).
+			err = errNotFound
+		}
 		if err == nil && entity.BlobHash256 == "" {
 			// Lazily calculate SHA256 so that we don't burden
 			// non-legacy code with that task.
@@ -183,6 +203,12 @@ func (h *Handler) serveCharmInfo(_ http.Header, req *http.Request) (interface{},
 			if err != nil {
 				c.Errors = append(c.Errors, err.Error())
 			}
+			deprecation, err := h.store.Deprecation(entity.URL)
+			if err != nil {
+				c.Errors = append(c.Errors, err.Error())
+			} else if deprecation != nil {
+				c.Warnings = append(c.Warnings, charmstore.DeprecationWarning(curl, deprecation))
+			}
 			if v4.StatsEnabled(req) {
 				h.store.IncCounterAsync(charmStatsKey(curl, params.StatsCharmInfo))
 			}
@@ -224,7 +250,7 @@ func (h *Handler) serveCharmEvent(_ http.Header, req *http.Request) (interface{}
 		}
 
 		// Retrieve the charm.
-		entity, err := h.store.FindBestEntity(id, "_id", "uploadtime", "extrainfo")
+		entity, err := h.store.FindBestEntity(id, params.NoChannel, "_id", "uploadtime", "extrainfo")
 		if err != nil {
 			if errgo.Cause(err) == params.ErrNotFound {
 				// The old API actually returned "entry not found"
@@ -24,6 +24,7 @@ import (
 
 	"gopkg.in/juju/charmstore.v4/internal/charmstore"
 	"gopkg.in/juju/charmstore.v4/internal/legacy"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
 	"gopkg.in/juju/charmstore.v4/internal/storetesting"
 	"gopkg.in/juju/charmstore.v4/internal/storetesting/hashtesting"
 	"gopkg.in/juju/charmstore.v4/internal/storetesting/stats"
@@ -231,6 +232,94 @@ func (s *APISuite) TestServerCharmInfo(c *gc.C) {
 	}
 }
 
+func (s *APISuite) TestCharmInfoDeprecated(c *gc.C) {
+	_, wordpress := s.addCharm(c, "wordpress", "cs:precise/wordpress-1")
+	err := s.store.UpdateBaseEntity(charm.MustParseReference("cs:~charmers/wordpress"), bson.D{{
+		"$set", bson.D{{"deprecated", mongodoc.Deprecation{
+			Reason:    "superseded",
+			Successor: charm.MustParseReference("cs:trusty/wordpress"),
+		}}},
+	}})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          "/charm-info?charms=cs:wordpress",
+		ExpectStatus: http.StatusOK,
+		ExpectBody: map[string]charmrepo.InfoResponse{
+			"cs:wordpress": {
+				CanonicalURL: "cs:precise/wordpress-1",
+				Sha256:       fileSHA256(c, wordpress.Path),
+				Revision:     1,
+				Warnings: []string{
+					"cs:precise/wordpress-1 is deprecated: superseded; use cs:trusty/wordpress instead",
+				},
+			},
+		},
+	})
+}
+
+func (s *APISuite) TestCharmInfoEmbargoed(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:precise/wordpress-1")
+	err := s.store.UpdateEntity(charm.MustParseReference("cs:~charmers/precise/wordpress-1"), bson.D{
+		{"$unset", bson.D{{"published", nil}}},
+		{"$set", bson.D{{"embargo", mongodoc.Embargo{
+			PublishAt: time.Now().Add(time.Hour),
+			Channels:  []params.Channel{params.StableChannel},
+		}}}},
+	})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          "/charm-info?charms=cs:precise/wordpress-1",
+		ExpectStatus: http.StatusOK,
+		ExpectBody: map[string]charmrepo.InfoResponse{
+			"cs:precise/wordpress-1": {
+				Errors: []string{"entry not found"},
+			},
+		},
+	})
+}
+
+func (s *APISuite) TestCharmInfoAt(c *gc.C) {
+	_, wordpress0 := s.addCharm(c, "wordpress", "cs:precise/wordpress-0")
+	s.addCharm(c, "wordpress", "cs:precise/wordpress-1")
+	t0 := time.Now().Add(-2 * time.Hour)
+	err := s.store.UpdateEntity(charm.MustParseReference("cs:~charmers/precise/wordpress-0"), bson.D{{
+		"$set", bson.D{
+			{"uploadtime", t0},
+			{"promulgated-time", t0},
+			{charmstore.ChannelTimeField(params.StableChannel), t0},
+		},
+	}})
+	c.Assert(err, gc.IsNil)
+	at := t0.Add(time.Hour).UTC().Format(time.RFC3339)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          "/charm-info?charms=cs:wordpress&charms=cs:precise/wordpress-1&at=" + at,
+		ExpectStatus: http.StatusOK,
+		ExpectBody: map[string]charmrepo.InfoResponse{
+			"cs:wordpress": {
+				CanonicalURL: "cs:precise/wordpress-0",
+				Sha256:       fileSHA256(c, wordpress0.Path),
+				Revision:     0,
+			},
+			"cs:precise/wordpress-1": {
+				Errors: []string{"entry not found"},
+			},
+		},
+	})
+
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          "/charm-info?charms=cs:wordpress&at=yesterday",
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid at parameter: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+		},
+	})
+}
+
 func (s *APISuite) TestCharmInfoCounters(c *gc.C) {
 	if !storetesting.MongoJSEnabled() {
 		c.Skip("MongoDB JavaScript not available")
@@ -9,6 +9,8 @@ import (
 	"gopkg.in/errgo.v1"
 	"gopkg.in/juju/charm.v5-unstable"
 	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/params"
 )
 
 // Entity holds the in-database representation of charm or bundle's
@@ -108,6 +110,27 @@ type Entity struct {
 	// PromulgatedRevision holds the revision number from the promulgated URL.
 	// If the entity is not promulgated this should be set to -1.
 	PromulgatedRevision int `bson:"promulgated-revision"`
+
+	// PromulgatedTime holds when the entity was given its
+	// promulgated URL. It is zero for entities that are not
+	// promulgated, or that were promulgated before the time
+	// was recorded, which are considered promulgated since
+	// their upload.
+	PromulgatedTime time.Time `bson:"promulgated-time,omitempty"`
+
+	// Deprecated holds the deprecation of this revision, if
+	// deprecated. See also BaseEntity.Deprecated.
+	Deprecated *Deprecation `bson:",omitempty" json:",omitempty"`
+
+	// Published holds the channels the entity is published to,
+	// each one with the time the entity was published to it.
+	Published map[params.Channel]time.Time `bson:",omitempty" json:",omitempty"`
+
+	// Embargo holds the scheduled publication of the entity, if
+	// it has been uploaded with a publication time that has not
+	// been reached yet. An embargoed entity is not published to
+	// any channel.
+	Embargo *Embargo `bson:",omitempty" json:",omitempty"`
 }
 
 // PreferredURL returns the preferred way to refer to this entity. If
@@ -120,6 +143,45 @@ func (e *Entity) PreferredURL(usePromulgated bool) *charm.Reference {
 	return e.URL
 }
 
+// InChannel reports whether the entity is published
+// to the given channel.
+func (e *Entity) InChannel(c params.Channel) bool {
+	_, ok := e.Published[c]
+	return ok
+}
+
+// InChannelAt reports whether the entity had been published
+// to the given channel by the given time.
+func (e *Entity) InChannelAt(c params.Channel, at time.Time) bool {
+	t, ok := e.Published[c]
+	return ok && !t.After(at)
+}
+
+// AvailableAt reports whether the entity had been uploaded by
+// the given time and, if promulgated is true, whether it had
+// been promulgated by then too.
+func (e *Entity) AvailableAt(at time.Time, promulgated bool) bool {
+	if e.UploadTime.After(at) {
+		return false
+	}
+	if promulgated {
+		return e.PromulgatedURL != nil && !e.PromulgatedTime.After(at)
+	}
+	return true
+}
+
+// PublishedChannels returns the channels the entity is
+// published to, from the most to the least stable.
+func (e *Entity) PublishedChannels() []params.Channel {
+	channels := make([]params.Channel, 0, len(e.Published))
+	for _, c := range params.OrderedChannels {
+		if e.InChannel(c) {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
 // BaseEntity holds metadata for a charm or bundle
 // independent of any specific uploaded revision or series.
 type BaseEntity struct {
@@ -148,6 +210,43 @@ type BaseEntity struct {
 	// Promulgated specifies whether the charm or bundle should be
 	// promulgated.
 	Promulgated IntBool
+
+	// Aliases holds other names the charm or bundle can be
+	// referred to by, for instance its names before being renamed.
+	Aliases []string `bson:",omitempty" json:",omitempty"`
+
+	// Deprecated holds the deprecation of all the revisions of
+	// the charm or bundle, if deprecated.
+	Deprecated *Deprecation `bson:",omitempty" json:",omitempty"`
+
+	// TransferringFrom holds the base id of the charm or bundle
+	// being moved to this base entity while the transfer is in
+	// progress, so that an interrupted transfer can be resumed.
+	TransferringFrom *charm.Reference `bson:"transferring-from,omitempty" json:",omitempty"`
+}
+
+// Deprecation holds why a charm or bundle is deprecated
+// and what should be used instead.
+type Deprecation struct {
+	// Reason holds the deprecation message.
+	Reason string
+
+	// Successor optionally holds the id of the charm
+	// or bundle recommended as a replacement.
+	Successor *charm.Reference `bson:",omitempty" json:",omitempty"`
+
+	// Time holds the time the charm or bundle was deprecated.
+	Time time.Time
+}
+
+// Embargo holds when and where an embargoed charm
+// or bundle revision is to be published.
+type Embargo struct {
+	// PublishAt holds the time the revision is published.
+	PublishAt time.Time
+
+	// Channels holds the channels the revision is published to.
+	Channels []params.Channel
 }
 
 // ACL holds lists of users and groups that are
@@ -156,9 +255,82 @@ type ACL struct {
 	// Read holds users and groups that are allowed to read the charm
 	// or bundle.
 	Read []string
-	// Write holds users and groups that are allowed to upload/modify the charm
-	// or bundle.
+	// Write holds users and groups that are allowed to modify the charm
+	// or bundle metadata.
 	Write []string
+	// Upload holds users and groups that are allowed to upload new
+	// revisions of the charm or bundle.
+	Upload []string
+	// Delete holds users and groups that are allowed to delete
+	// revisions of the charm or bundle.
+	Delete []string
+	// Admin holds users and groups that are allowed to change the
+	// permissions of the charm or bundle.
+	Admin []string
+	// Promulgate holds users and groups that are allowed to upload
+	// promulgated revisions of the charm or bundle.
+	Promulgate []string
+	// Expiries holds the expiry times of time-limited entries
+	// in the ACLs above. Entries without an expiry time never
+	// expire.
+	Expiries []ACLExpiry `bson:",omitempty" json:",omitempty"`
+}
+
+// ACLExpiry holds the time after which a user or group
+// no longer holds a permission.
+type ACLExpiry struct {
+	// Perm holds the name of the permission (for instance "read").
+	Perm string
+	// Name holds the name of the user or group.
+	Name string
+	// Expires holds the time after which the entry expires.
+	Expires time.Time
+}
+
+// Perm returns a pointer to the list of users and groups holding the
+// given permission (for instance "read"), or nil if the permission is
+// not known.
+func (acl *ACL) Perm(perm string) *[]string {
+	switch perm {
+	case "read":
+		return &acl.Read
+	case "write":
+		return &acl.Write
+	case "upload":
+		return &acl.Upload
+	case "delete":
+		return &acl.Delete
+	case "admin":
+		return &acl.Admin
+	case "promulgate":
+		return &acl.Promulgate
+	}
+	return nil
+}
+
+// Unexpired returns the given users and groups, held in the ACL for
+// the given permission (for instance "read"), excluding any entry
+// that has expired at the given time.
+func (acl ACL) Unexpired(perm string, names []string, now time.Time) []string {
+	if len(acl.Expiries) == 0 {
+		return names
+	}
+	expired := make(map[string]bool)
+	for _, e := range acl.Expiries {
+		if e.Perm == perm && !now.Before(e.Expires) {
+			expired[e.Name] = true
+		}
+	}
+	if len(expired) == 0 {
+		return names
+	}
+	unexpired := make([]string, 0, len(names))
+	for _, name := range names {
+		if !expired[name] {
+			unexpired = append(unexpired, name)
+		}
+	}
+	return unexpired
 }
 
 type FileId string
@@ -243,6 +415,116 @@ type Migration struct {
 	Executed []string
 }
 
+// APIToken holds a long-lived API token, used by automated
+// clients to authenticate as a user.
+type APIToken struct {
+	// Id holds the token identifier. It is also the public
+	// part of the token sent by clients.
+	Id string `bson:"_id"`
+
+	// Hash holds the hex-encoded SHA256 hash of the
+	// secret part of the token.
+	Hash string
+
+	// User holds the name of the user the token authenticates as.
+	User string
+
+	// Description holds a human readable description of the token.
+	Description string `bson:",omitempty"`
+
+	// Operations holds the operations allowed by the token.
+	Operations []string
+
+	// Scope optionally holds the namespace (for instance "~bob")
+	// or the entity (for instance "cs:~bob/trusty/wordpress")
+	// the token is restricted to.
+	Scope string `bson:",omitempty"`
+
+	// Created holds the time the token was created.
+	Created time.Time
+
+	// Expires holds the time after which the token is no longer valid.
+	Expires time.Time
+}
+
+// Namespace holds the defaults applied to the charms and bundles
+// owned by a user or group.
+type Namespace struct {
+	// Name holds the name of the user or group owning the
+	// namespace (for instance "joe").
+	Name string `bson:"_id"`
+
+	// ACLs holds the permissions given to new charms and bundles
+	// in the namespace.
+	ACLs ACL
+
+	// ExtraInfo holds the extra metadata given to new revisions
+	// of charms and bundles in the namespace.
+	ExtraInfo map[string][]byte `bson:",omitempty"`
+
+	// StorageQuota holds the maximum total size in bytes of the
+	// archives in the namespace. Zero means that the size is not
+	// limited. If StorageQuota is nil, the server default applies.
+	StorageQuota *int64 `bson:",omitempty"`
+
+	// Retention holds the policy deciding which revisions of the
+	// charms and bundles in the namespace are pruned, if any.
+	Retention *params.RetentionPolicy `bson:",omitempty"`
+}
+
+// AuditEntry holds the record of a write operation performed
+// on the charm store.
+type AuditEntry struct {
+	// Time holds the time of the operation.
+	Time time.Time
+
+	// User holds the name of the user performing the operation.
+	// It is empty if the user was not authenticated, or if the
+	// operation was performed with the administrator credentials.
+	User string `bson:",omitempty"`
+
+	// Admin holds whether the operation was performed with the
+	// administrator credentials.
+	Admin bool `bson:",omitempty"`
+
+	// TokenId holds the identifier of the API token used to
+	// authenticate, if any.
+	TokenId string `bson:",omitempty"`
+
+	// Operation holds the performed operation (for instance
+	// params.AuditSetPerm).
+	Operation string
+
+	// Entity holds the id of the charm or bundle affected by
+	// the operation, if any.
+	Entity *charm.Reference `bson:",omitempty"`
+
+	// BaseURL holds the base URL of Entity.
+	BaseURL *charm.Reference `bson:",omitempty"`
+
+	// Namespace holds the user or group namespace affected by
+	// the operation, if any.
+	Namespace string `bson:",omitempty"`
+
+	// Old and New optionally hold the JSON-encoded values
+	// changed by the operation, before and after the change.
+	Old []byte `bson:",omitempty"`
+	New []byte `bson:",omitempty"`
+
+	// ClientAddr holds the network address of the client.
+	ClientAddr string
+}
+
+// SigningKey holds a secret key used by the charm store to sign
+// data handed to clients, for instance shared download links.
+type SigningKey struct {
+	// Name holds the purpose of the key (for instance "share").
+	Name string `bson:"_id"`
+
+	// Key holds the secret key.
+	Key []byte
+}
+
 // IntBool is a bool that will be represented internally in the database as 1 for
 // true and -1 for false.
 type IntBool bool
@@ -269,3 +551,84 @@ func (b *IntBool) SetBSON(raw bson.Raw) error {
 	}
 	return nil
 }
+
+// Org holds an organisation: a namespace owned by its members rather
+// than by a single user.
+type Org struct {
+	// Name holds the name of the organisation, which is also the
+	// user part of the ids of its charms and bundles.
+	Name string `bson:"_id"`
+
+	// Members holds the members of the organisation.
+	Members []OrgMember
+}
+
+// OrgMember holds a member of an organisation.
+type OrgMember struct {
+	// User holds the name of the member.
+	User string
+
+	// Role holds the role of the member in the organisation
+	// (for instance params.OrgOwner).
+	Role string
+}
+
+// Redirect holds a base entity id that has been moved to another
+// namespace, so that the old ids keep resolving to the moved charm or
+// bundle.
+type Redirect struct {
+	// From holds the base URL of the entity before it was moved
+	// (for instance "cs:~alice/wordpress").
+	From *charm.Reference `bson:"_id"`
+
+	// To holds the base URL of the entity after it was moved
+	// (for instance "cs:~bob/wordpress").
+	To *charm.Reference
+
+	// Time holds the time the entity was moved.
+	Time time.Time
+}
+
+// Advisory holds a security advisory about some revisions of a
+// charm or bundle.
+type Advisory struct {
+	// Id holds the identifier of the advisory (for instance
+	// "CVE-2015-1234"), unique for the affected charm or bundle:
+	// the same vulnerability can be recorded for several charms.
+	Id string
+
+	// BaseURL holds the base URL of the affected
+	// charm or bundle (for instance "cs:~bob/wordpress").
+	BaseURL *charm.Reference
+
+	// Severity holds the severity of the advisory
+	// (for instance params.SeverityHigh).
+	Severity string
+
+	// Description describes the vulnerability.
+	Description string
+
+	// Affected holds the ranges of affected revisions.
+	Affected []params.RevisionRange
+
+	// Fixed optionally holds the id of the revision fixing
+	// the vulnerability.
+	Fixed *charm.Reference `bson:",omitempty"`
+
+	// Time holds the time the advisory was created.
+	Time time.Time
+}
+
+// Affects reports whether the advisory affects the revision of the
+// charm or bundle with the given id, which must not be promulgated.
+func (a *Advisory) Affects(id *charm.Reference) bool {
+	if id.User != a.BaseURL.User || id.Name != a.BaseURL.Name {
+		return false
+	}
+	for _, r := range a.Affected {
+		if (r.Series == "" || r.Series == id.Series) && r.From <= id.Revision && id.Revision <= r.To {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ package mongodoc_test
 
 import (
 	"testing"
+	"time"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -12,6 +13,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
 )
 
 func TestPackage(t *testing.T) {
@@ -75,3 +77,114 @@ func (s *DocSuite) TestPreferredURL(c *gc.C) {
 	c.Assert(e2.PreferredURL(false), gc.Equals, e2.URL)
 	c.Assert(e2.PreferredURL(true), gc.Equals, e2.PromulgatedURL)
 }
+
+func (s *DocSuite) TestACLUnexpired(c *gc.C) {
+	now := time.Now()
+	acl := mongodoc.ACL{
+		Read:  []string{"everyone", "bob", "alice", "contractor"},
+		Write: []string{"bob", "contractor"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "read",
+			Name:    "contractor",
+			Expires: now.Add(-time.Minute),
+		}, {
+			Perm:    "read",
+			Name:    "alice",
+			Expires: now.Add(time.Minute),
+		}, {
+			Perm:    "write",
+			Name:    "contractor",
+			Expires: now.Add(time.Minute),
+		}},
+	}
+	c.Assert(acl.Unexpired("read", acl.Read, now), jc.DeepEquals, []string{"everyone", "bob", "alice"})
+	c.Assert(acl.Unexpired("write", acl.Write, now), jc.DeepEquals, []string{"bob", "contractor"})
+	c.Assert(acl.Unexpired("write", acl.Write, now.Add(time.Hour)), jc.DeepEquals, []string{"bob"})
+	c.Assert(acl.Unexpired("upload", acl.Upload, now), gc.HasLen, 0)
+}
+
+func (s *DocSuite) TestEntityPublishedChannels(c *gc.C) {
+	e := &mongodoc.Entity{}
+	c.Assert(e.InChannel(params.StableChannel), jc.IsFalse)
+	c.Assert(e.PublishedChannels(), gc.HasLen, 0)
+	e.Published = map[params.Channel]time.Time{
+		params.DevelopmentChannel: time.Now(),
+		params.StableChannel:      time.Now(),
+	}
+	c.Assert(e.InChannel(params.StableChannel), jc.IsTrue)
+	c.Assert(e.InChannel(params.CandidateChannel), jc.IsFalse)
+	c.Assert(e.PublishedChannels(), jc.DeepEquals, []params.Channel{
+		params.StableChannel,
+		params.DevelopmentChannel,
+	})
+}
+
+func (s *DocSuite) TestEntityAvailableAt(c *gc.C) {
+	t0 := time.Now()
+	e := &mongodoc.Entity{
+		UploadTime: t0,
+		Published: map[params.Channel]time.Time{
+			params.StableChannel: t0.Add(time.Hour),
+		},
+	}
+	c.Assert(e.AvailableAt(t0.Add(-time.Second), false), jc.IsFalse)
+	c.Assert(e.AvailableAt(t0, false), jc.IsTrue)
+	c.Assert(e.AvailableAt(t0, true), jc.IsFalse)
+	c.Assert(e.InChannelAt(params.StableChannel, t0), jc.IsFalse)
+	c.Assert(e.InChannelAt(params.StableChannel, t0.Add(time.Hour)), jc.IsTrue)
+	c.Assert(e.InChannelAt(params.DevelopmentChannel, t0.Add(time.Hour)), jc.IsFalse)
+
+	// Entities promulgated before the time was recorded
+	// are promulgated since their upload.
+	e.PromulgatedURL = charm.MustParseReference("trusty/wordpress-0")
+	c.Assert(e.AvailableAt(t0, true), jc.IsTrue)
+
+	e.PromulgatedTime = t0.Add(2 * time.Hour)
+	c.Assert(e.AvailableAt(t0.Add(time.Hour), true), jc.IsFalse)
+	c.Assert(e.AvailableAt(t0.Add(time.Hour), false), jc.IsTrue)
+	c.Assert(e.AvailableAt(t0.Add(2*time.Hour), true), jc.IsTrue)
+}
+
+var advisoryAffectsTests = []struct {
+	id     string
+	expect bool
+}{{
+	id:     "~bob/trusty/wordpress-2",
+	expect: true,
+}, {
+	id:     "~bob/trusty/wordpress-4",
+	expect: true,
+}, {
+	id:     "~bob/trusty/wordpress-5",
+	expect: false,
+}, {
+	id:     "~bob/precise/wordpress-1",
+	expect: false,
+}, {
+	id:     "~bob/precise/wordpress-10",
+	expect: true,
+}, {
+	id:     "~alice/trusty/wordpress-3",
+	expect: false,
+}, {
+	id:     "~bob/trusty/mysql-3",
+	expect: false,
+}}
+
+func (s *DocSuite) TestAdvisoryAffects(c *gc.C) {
+	a := &mongodoc.Advisory{
+		BaseURL: charm.MustParseReference("cs:~bob/wordpress"),
+		Affected: []params.RevisionRange{{
+			Series: "trusty",
+			From:   2,
+			To:     4,
+		}, {
+			From: 10,
+			To:   12,
+		}},
+	}
+	for i, test := range advisoryAffectsTests {
+		c.Logf("test %d: %s", i, test.id)
+		c.Assert(a.Affects(charm.MustParseReference(test.id)), gc.Equals, test.expect)
+	}
+}
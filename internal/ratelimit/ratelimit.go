@@ -0,0 +1,119 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// The ratelimit package implements token bucket rate limiting
+// of the operations performed by different clients.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// minSweepSize holds the number of buckets that a limiter can hold
+// before idle buckets are discarded.
+const minSweepSize = 1024
+
+// Limiter limits the rate of the operations performed by each client.
+// Every client, identified by a key, is given a bucket of tokens which
+// is refilled at a constant rate. Each operation takes a token from
+// the bucket, and is refused if the bucket is empty.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	sweepSize int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New returns a limiter allowing each client to perform rate operations
+// per second on average, in bursts of at most burst operations. The
+// rate must be positive. A burst smaller than one is treated as one.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		sweepSize: minSweepSize,
+	}
+}
+
+// Take takes a token from the bucket of the client with the given key
+// at the current time. See TakeAt.
+func (l *Limiter) Take(key string) (time.Duration, bool) {
+	return l.TakeAt(key, time.Now())
+}
+
+// TakeAt takes a token from the bucket of the client with the given
+// key at the given time. It reports whether a token was available;
+// if not, it also returns the time to wait before the next token
+// is available.
+func (l *Limiter) TakeAt(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.buckets[key]
+	if b == nil {
+		if len(l.buckets) >= l.sweepSize {
+			l.sweep(now)
+		}
+		b = &bucket{
+			tokens:  l.burst,
+			updated: now,
+		}
+		l.buckets[key] = b
+	}
+	b.tokens = l.tokens(b, now)
+	b.updated = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return wait, false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// tokens returns the number of tokens available in the given
+// bucket at the given time.
+func (l *Limiter) tokens(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated)
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	tokens := b.tokens + elapsed.Seconds()*l.rate
+	if tokens > l.burst {
+		return l.burst
+	}
+	return tokens
+}
+
+// sweep discards the buckets that are full at the given time: they
+// are equivalent to the bucket created for a new client, so that
+// removing them does not change the limits applied.
+// It must be called with l.mu held.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.tokens(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.sweepSize = 2 * len(l.buckets)
+	if l.sweepSize < minSweepSize {
+		l.sweepSize = minSweepSize
+	}
+}
+
+// Len returns the number of client buckets currently held by the limiter.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
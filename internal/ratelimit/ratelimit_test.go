@@ -0,0 +1,84 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"fmt"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charmstore.v4/internal/ratelimit"
+)
+
+type ratelimitSuite struct{}
+
+var _ = gc.Suite(&ratelimitSuite{})
+
+func (s *ratelimitSuite) TestTake(c *gc.C) {
+	l := ratelimit.New(2, 3)
+	now := time.Now()
+
+	// The burst is available straight away.
+	for i := 0; i < 3; i++ {
+		wait, ok := l.TakeAt("bob", now)
+		c.Assert(ok, gc.Equals, true, gc.Commentf("token %d", i))
+		c.Assert(wait, gc.Equals, time.Duration(0))
+	}
+	wait, ok := l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, false)
+	c.Assert(wait, gc.Equals, 500*time.Millisecond)
+
+	// Other clients have their own bucket.
+	_, ok = l.TakeAt("alice", now)
+	c.Assert(ok, gc.Equals, true)
+
+	// Tokens are refilled at the given rate.
+	now = now.Add(250 * time.Millisecond)
+	wait, ok = l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, false)
+	c.Assert(wait, gc.Equals, 250*time.Millisecond)
+	now = now.Add(250 * time.Millisecond)
+	_, ok = l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, true)
+
+	// The bucket never holds more than the burst.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		_, ok := l.TakeAt("bob", now)
+		c.Assert(ok, gc.Equals, true, gc.Commentf("token %d", i))
+	}
+	_, ok = l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, false)
+}
+
+func (s *ratelimitSuite) TestZeroBurst(c *gc.C) {
+	l := ratelimit.New(1, 0)
+	now := time.Now()
+	_, ok := l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, true)
+	wait, ok := l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, false)
+	c.Assert(wait, gc.Equals, time.Second)
+}
+
+func (s *ratelimitSuite) TestIdleBucketsDiscarded(c *gc.C) {
+	l := ratelimit.New(1, 1)
+	now := time.Now()
+	for i := 0; i < 1024; i++ {
+		l.TakeAt(fmt.Sprint("client", i), now)
+	}
+	c.Assert(l.Len(), gc.Equals, 1024)
+
+	// Once all the buckets are refilled, adding a new
+	// client discards them.
+	now = now.Add(time.Second)
+	_, ok := l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(l.Len(), gc.Equals, 1)
+
+	// The limits are still applied to active clients.
+	_, ok = l.TakeAt("bob", now)
+	c.Assert(ok, gc.Equals, false)
+}
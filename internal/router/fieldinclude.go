@@ -18,8 +18,9 @@ type FieldQueryFunc func(id *charm.Reference, selector map[string]int, req *http
 
 // FieldUpdater records field changes made by a FieldUpdateFunc.
 type FieldUpdater struct {
-	fields map[string]interface{}
-	search bool
+	fields   map[string]interface{}
+	search   bool
+	onUpdate []func()
 }
 
 // UpdateField requests that the provided field is updated with
@@ -33,6 +34,12 @@ func (u *FieldUpdater) UpdateSearch() {
 	u.search = true
 }
 
+// OnUpdate requests that f is called once the fields have been
+// successfully updated. It is not called if the update fails.
+func (u *FieldUpdater) OnUpdate(f func()) {
+	u.onUpdate = append(u.onUpdate, f)
+}
+
 // A FieldUpdateFunc is used to update a metadata document for the
 // given id. For each field in fields, it should set that field to
 // its corresponding value in the metadata document.
@@ -132,9 +139,20 @@ func (h *fieldIncludeHandler) HandlePut(hs []BulkIncludeHandler, id *charm.Refer
 		// no need to call Update.
 		return errs
 	}
-	if err := h.p.Update(id, updater.fields); err != nil {
-		for i := range hs {
-			setError(i, err)
+	// Handlers may have updated other documents directly,
+	// without any field left to update here.
+	updated := true
+	if len(updater.fields) > 0 {
+		if err := h.p.Update(id, updater.fields); err != nil {
+			for i := range hs {
+				setError(i, err)
+			}
+			updated = false
+		}
+	}
+	if updated {
+		for _, f := range updater.onUpdate {
+			f()
 		}
 	}
 	if updater.search {
@@ -92,6 +92,12 @@ type BulkIncludeHandler interface {
 // fully specified in the original client request.
 type IdHandler func(charmId *charm.Reference, fullySpecified bool, w http.ResponseWriter, req *http.Request) error
 
+// NamespaceHandler handles a charm store request rooted at the
+// namespace of the given user or group, for instance ~bob/meta/perm.
+// The request path (req.URL.Path) holds the URL path after
+// the handler key has been stripped off.
+type NamespaceHandler func(user string, w http.ResponseWriter, req *http.Request) error
+
 // Handlers specifies how HTTP requests will be routed
 // by the router. All errors returned by the handlers will
 // be processed by WriteError with their Cause left intact.
@@ -119,18 +125,31 @@ type Handlers struct {
 	// too.
 	Id map[string]IdHandler
 
+	// ReadOnlyId holds the keys of the Id handlers that never
+	// modify any data, even when invoked with a POST request.
+	// The id in POST requests to these handlers is resolved and
+	// authorized as it would be for a GET request.
+	ReadOnlyId map[string]bool
+
 	// Meta holds metadata handlers for paths under the meta
 	// endpoint. The map key holds the first element of the path,
 	// which may end in a trailing slash (/) to indicate that longer
 	// paths are allowed too.
 	Meta map[string]BulkIncludeHandler
+
+	// Namespace holds handlers for paths under the meta endpoint
+	// of a user namespace (~user/meta). The map key holds the
+	// first element of the path after ~user/meta, which may end
+	// in a trailing slash (/) to indicate that longer paths are
+	// allowed too.
+	Namespace map[string]NamespaceHandler
 }
 
 // Router represents a charm store HTTP request router.
 type Router struct {
 	handlers   *Handlers
 	handler    http.Handler
-	resolveURL func(id *charm.Reference) error
+	resolveURL func(id *charm.Reference, req *http.Request) error
 	authorize  func(id *charm.Reference, req *http.Request) error
 	exists     func(id *charm.Reference, req *http.Request) (bool, error)
 }
@@ -141,6 +160,8 @@ type Router struct {
 // The resolveURL function will be called to resolve ids in
 // router paths - it should fill in the Series and Revision
 // fields of its argument URL if they are not specified.
+// It is passed the request so that it can take account of
+// any parameters that affect resolution, such as the channel.
 // The Cause of the resolveURL error will be left unchanged,
 // as for the handlers.
 //
@@ -153,7 +174,7 @@ type Router struct {
 // but has no appropriate handler to call.
 func New(
 	handlers *Handlers,
-	resolveURL func(id *charm.Reference) error,
+	resolveURL func(id *charm.Reference, req *http.Request) error,
 	authorize func(id *charm.Reference, req *http.Request) error,
 	exists func(id *charm.Reference, req *http.Request) (bool, error),
 ) *Router {
@@ -219,6 +240,14 @@ func (r *Router) serveIds(w http.ResponseWriter, req *http.Request) error {
 	// to slash-terminated URLs.
 	// http://cdivilly.wordpress.com/2014/03/11/why-trailing-slashes-on-uris-are-important/
 	path := strings.TrimSuffix(req.URL.Path, "/")
+	if user, key, rest, ok := splitNamespace(path); ok {
+		if handler := r.handlers.Namespace[key]; handler != nil {
+			req.URL.Path = rest
+			err := handler(user, w, req)
+			// Note: preserve error cause from handlers.
+			return errgo.Mask(err, errgo.Any)
+		}
+	}
 	url, path, err := splitId(path)
 	if err != nil {
 		return errgo.Mask(err)
@@ -229,19 +258,34 @@ func (r *Router) serveIds(w http.ResponseWriter, req *http.Request) error {
 	}
 	fullySpecified := url.Series != "" && url.Revision != -1
 	handler := r.handlers.Id[key]
-	if handler == nil || idHandlerNeedsResolveURL(req) {
+	readOnly := r.handlers.ReadOnlyId[key]
+	if handler == nil || readOnly || idHandlerNeedsResolveURL(req) {
 		// If it's not an id handler, it's a meta endpoint, so
 		// we always want a resolved URL. Otherwise we leave the
 		// URL unresolved for cases where the id may validly not
 		// exist (for example when uploading a new charm).
-		if err := r.resolveURL(url); err != nil {
+		user, name := url.User, url.Name
+		if err := r.resolveURL(url, req); err != nil {
 			// Note: preserve error cause from resolveURL.
 			return errgo.Mask(err, errgo.Any)
 		}
+		if url.User != user || url.Name != name {
+			// Let the client know that the id has been
+			// redirected to another charm or bundle.
+			w.Header().Set(params.EntityRedirectHeader, url.String())
+		}
 	}
 	if handler != nil {
 		req.URL.Path = path
-		if err := r.authorize(url, req); err != nil {
+		authReq := req
+		if readOnly && req.Method == "POST" {
+			// Authorize the request as if it were a GET request,
+			// so that only read access is required.
+			getReq := *req
+			getReq.Method = "GET"
+			authReq = &getReq
+		}
+		if err := r.authorize(url, authReq); err != nil {
 			return errgo.Mask(err, errgo.Any)
 		}
 		err := handler(url, fullySpecified, w, req)
@@ -485,7 +529,7 @@ func (r *Router) serveBulkMetaGet(req *http.Request) (interface{}, error) {
 		if err != nil {
 			return nil, errgo.Mask(err)
 		}
-		if err := r.resolveURL(url); err != nil {
+		if err := r.resolveURL(url, req); err != nil {
 			if errgo.Cause(err) == params.ErrNotFound {
 				// URLs not found will be omitted from the result.
 				// https://github.com/juju/charmstore/blob/v4/docs/API.md#bulk-requests-and-missing-metadata
@@ -541,7 +585,7 @@ func (r *Router) serveBulkMetaPutOne(req *http.Request, id string, val *json.Raw
 	if err != nil {
 		return errgo.Mask(err)
 	}
-	if err := r.resolveURL(url); err != nil {
+	if err := r.resolveURL(url, req); err != nil {
 		// Note: preserve error cause from resolveURL.
 		return errgo.Mask(err, errgo.Any)
 	}
@@ -711,6 +755,27 @@ func splitPath(path string, i int) (elem string, nextIndex int) {
 	return path[i:j], j
 }
 
+// splitNamespace splits the given URL path of the form
+// ~user/meta/key[/rest] into the namespace user, the handler
+// key and the rest of the path. It reports whether the path
+// refers to a namespace.
+func splitNamespace(path string) (user, key, rest string, ok bool) {
+	path = strings.TrimPrefix(path, "/")
+	part, i := splitPath(path, 0)
+	if !strings.HasPrefix(part, "~") || len(part) == 1 {
+		return "", "", "", false
+	}
+	user = part[1:]
+	if part, i = splitPath(path, i); part != "meta" {
+		return "", "", "", false
+	}
+	key, rest = handlerKey(path[i:])
+	if key == "" {
+		return "", "", "", false
+	}
+	return user, key, rest, true
+}
+
 // splitId splits the given URL path into a charm or bundle
 // URL and the rest of the path.
 func splitId(path string) (url *charm.Reference, rest string, err error) {
@@ -39,7 +39,7 @@ var routerGetTests = []struct {
 	expectStatus     int
 	expectBody       interface{}
 	expectQueryCount int32
-	resolveURL       func(*charm.Reference) error
+	resolveURL       func(*charm.Reference, *http.Request) error
 	authorize        func(id *charm.Reference, req *http.Request) error
 	exists           func(*charm.Reference, *http.Request) (bool, error)
 }{{
@@ -723,7 +723,7 @@ var routerGetTests = []struct {
 }, {
 	about:  "bulk meta handler with unresolvable id",
 	urlStr: "/meta/foo?id=unresolved&id=precise/wordpress-23",
-	resolveURL: func(url *charm.Reference) error {
+	resolveURL: func(url *charm.Reference, req *http.Request) error {
 		if url.Name == "unresolved" {
 			return params.ErrNotFound
 		}
@@ -743,7 +743,7 @@ var routerGetTests = []struct {
 }, {
 	about:  "bulk meta handler with id resolution error",
 	urlStr: "/meta/foo?id=resolveerror&id=precise/wordpress-23",
-	resolveURL: func(url *charm.Reference) error {
+	resolveURL: func(url *charm.Reference, req *http.Request) error {
 		if url.Name == "resolveerror" {
 			return errgo.Newf("an error")
 		}
@@ -794,8 +794,8 @@ var routerGetTests = []struct {
 // newResolveURL returns a URL resolver that resolves
 // unspecified series and revision to the given series
 // and revision.
-func newResolveURL(series string, revision int) func(*charm.Reference) error {
-	return func(url *charm.Reference) error {
+func newResolveURL(series string, revision int) func(*charm.Reference, *http.Request) error {
+	return func(url *charm.Reference, req *http.Request) error {
 		if url.Series == "" {
 			url.Series = series
 		}
@@ -806,13 +806,13 @@ func newResolveURL(series string, revision int) func(*charm.Reference) error {
 	}
 }
 
-func resolveURLError(err error) func(*charm.Reference) error {
-	return func(*charm.Reference) error {
+func resolveURLError(err error) func(*charm.Reference, *http.Request) error {
+	return func(*charm.Reference, *http.Request) error {
 		return err
 	}
 }
 
-func noResolveURL(*charm.Reference) error {
+func noResolveURL(*charm.Reference, *http.Request) error {
 	return nil
 }
 
@@ -939,7 +939,7 @@ var routerPutTests = []struct {
 	expectCode          int
 	expectBody          interface{}
 	expectRecordedCalls []interface{}
-	resolveURL          func(*charm.Reference) error
+	resolveURL          func(*charm.Reference, *http.Request) error
 }{{
 	about: "global handler",
 	handlers: Handlers{
@@ -1351,7 +1351,7 @@ var routerPutTests = []struct {
 			}),
 		},
 	},
-	resolveURL: func(id *charm.Reference) error {
+	resolveURL: func(id *charm.Reference, req *http.Request) error {
 		if id.Name == "bad" {
 			return params.ErrBadRequest
 		}
@@ -1445,6 +1445,55 @@ var routerPutTests = []struct {
 	expectBody: params.Error{
 		Message: "ids may not be specified in meta PUT request",
 	},
+}, {
+	about: "field include handler calls update hooks after the update",
+	handlers: Handlers{
+		Meta: map[string]BulkIncludeHandler{
+			"foo": FieldIncludeHandler(FieldIncludeHandlerParams{
+				Key: 0,
+				HandlePut: func(id *charm.Reference, path string, val *json.RawMessage, updater *FieldUpdater, req *http.Request) error {
+					updater.UpdateField("foo", "bar")
+					updater.OnUpdate(func() {
+						RecordCall("updated")
+					})
+					return nil
+				},
+				Update: func(id *charm.Reference, fields map[string]interface{}) error {
+					RecordCall("update")
+					return nil
+				},
+			}),
+		},
+	},
+	urlStr:              "/precise/wordpress-23/meta/foo",
+	body:                "something",
+	expectCode:          http.StatusOK,
+	expectRecordedCalls: []interface{}{"update", "updated"},
+}, {
+	about: "field include handler does not call update hooks when the update fails",
+	handlers: Handlers{
+		Meta: map[string]BulkIncludeHandler{
+			"foo": FieldIncludeHandler(FieldIncludeHandlerParams{
+				Key: 0,
+				HandlePut: func(id *charm.Reference, path string, val *json.RawMessage, updater *FieldUpdater, req *http.Request) error {
+					updater.UpdateField("foo", "bar")
+					updater.OnUpdate(func() {
+						RecordCall("updated")
+					})
+					return nil
+				},
+				Update: func(id *charm.Reference, fields map[string]interface{}) error {
+					return errgo.New("update error")
+				},
+			}),
+		},
+	},
+	urlStr:     "/precise/wordpress-23/meta/foo",
+	body:       "something",
+	expectCode: http.StatusInternalServerError,
+	expectBody: params.Error{
+		Message: "update error",
+	},
 }}
 
 func nopUpdate(id *charm.Reference, fields map[string]interface{}) error {
@@ -1592,6 +1641,111 @@ func (s *RouterSuite) TestMethodsThatPassThroughUnresolvedId(c *gc.C) {
 	}
 }
 
+func (s *RouterSuite) TestReadOnlyIdHandler(c *gc.C) {
+	handlers := Handlers{
+		Id: map[string]IdHandler{
+			"idhandler": testIdHandler,
+		},
+		ReadOnlyId: map[string]bool{
+			"idhandler": true,
+		},
+	}
+	var authMethod string
+	authorize := func(id *charm.Reference, req *http.Request) error {
+		authMethod = req.Method
+		return nil
+	}
+	router := New(&handlers, newResolveURL("series", 1234), authorize, alwaysExists)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: router,
+		Body:    strings.NewReader(""),
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Method: "POST",
+		URL:    "/wordpress/idhandler",
+		ExpectBody: idHandlerTestResp{
+			CharmURL: "cs:series/wordpress-1234",
+			Method:   "POST",
+		},
+	})
+	c.Assert(authMethod, gc.Equals, "GET")
+}
+
+type namespaceHandlerTestResp struct {
+	Method string
+	User   string
+	Path   string
+}
+
+func testNamespaceHandler(user string, w http.ResponseWriter, req *http.Request) error {
+	jsonhttp.WriteJSON(w, http.StatusOK, namespaceHandlerTestResp{
+		User:   user,
+		Path:   req.URL.Path,
+		Method: req.Method,
+	})
+	return nil
+}
+
+var namespaceHandlerTests = []struct {
+	about        string
+	url          string
+	expectStatus int
+	expectBody   interface{}
+}{{
+	about: "namespace handler",
+	url:   "/~bob/meta/perm",
+	expectBody: namespaceHandlerTestResp{
+		Method: "GET",
+		User:   "bob",
+	},
+}, {
+	about: "namespace handler with path",
+	url:   "/~bob/meta/perm/read",
+	expectBody: namespaceHandlerTestResp{
+		Method: "GET",
+		User:   "bob",
+		Path:   "/read",
+	},
+}, {
+	about: "entity named meta",
+	url:   "/~bob/meta/idhandler",
+	expectBody: idHandlerTestResp{
+		Method:   "GET",
+		CharmURL: "cs:~bob/series/meta-1234",
+	},
+}, {
+	about:        "unknown namespace handler",
+	url:          "/~bob/meta/unknown",
+	expectStatus: http.StatusNotFound,
+	expectBody: params.Error{
+		Code:    params.ErrNotFound,
+		Message: params.ErrNotFound.Error(),
+	},
+}}
+
+func (s *RouterSuite) TestNamespaceHandler(c *gc.C) {
+	handlers := Handlers{
+		Id: map[string]IdHandler{
+			"idhandler": testIdHandler,
+		},
+		Namespace: map[string]NamespaceHandler{
+			"perm":  testNamespaceHandler,
+			"perm/": testNamespaceHandler,
+		},
+	}
+	router := New(&handlers, newResolveURL("series", 1234), alwaysAuthorize, alwaysExists)
+	for i, test := range namespaceHandlerTests {
+		c.Logf("test %d: %s", i, test.about)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:      router,
+			URL:          test.url,
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectBody,
+		})
+	}
+}
+
 func alwaysExists(id *charm.Reference, req *http.Request) (bool, error) {
 	return true, nil
 }
@@ -1709,6 +1863,44 @@ func (s *RouterSuite) TestSplitId(c *gc.C) {
 	}
 }
 
+var splitNamespaceTests = []struct {
+	path       string
+	expectOK   bool
+	expectUser string
+	expectKey  string
+	expectRest string
+}{{
+	path:       "/~bob/meta/perm",
+	expectOK:   true,
+	expectUser: "bob",
+	expectKey:  "perm",
+}, {
+	path:       "~bob/meta/perm/read",
+	expectOK:   true,
+	expectUser: "bob",
+	expectKey:  "perm/",
+	expectRest: "/read",
+}, {
+	path: "/~bob/meta",
+}, {
+	path: "/~bob/wordpress/meta/perm",
+}, {
+	path: "/wordpress/meta/perm",
+}, {
+	path: "/~/meta/perm",
+}}
+
+func (s *RouterSuite) TestSplitNamespace(c *gc.C) {
+	for i, test := range splitNamespaceTests {
+		c.Logf("test %d: %s", i, test.path)
+		user, key, rest, ok := splitNamespace(test.path)
+		c.Assert(ok, gc.Equals, test.expectOK)
+		c.Assert(user, gc.Equals, test.expectUser)
+		c.Assert(key, gc.Equals, test.expectKey)
+		c.Assert(rest, gc.Equals, test.expectRest)
+	}
+}
+
 var handlerKeyTests = []struct {
 	path       string
 	expectKey  string
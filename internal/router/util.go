@@ -15,6 +15,10 @@ import (
 	"gopkg.in/juju/charmstore.v4/params"
 )
 
+// statusTooManyRequests holds the HTTP status code defined in RFC 6585,
+// section 4, which is not defined by the net/http package.
+const statusTooManyRequests = 429
+
 var (
 	HandleErrors = jsonhttp.HandleErrors(errorToResp)
 	HandleJSON   = jsonhttp.HandleJSON(errorToResp)
@@ -34,7 +38,7 @@ func errorToResp(err error) (int, interface{}) {
 		status = http.StatusNotFound
 	case params.ErrBadRequest:
 		status = http.StatusBadRequest
-	case params.ErrForbidden:
+	case params.ErrForbidden, params.ErrQuotaExceeded:
 		status = http.StatusForbidden
 	case params.ErrUnauthorized:
 		status = http.StatusUnauthorized
@@ -44,6 +48,8 @@ func errorToResp(err error) (int, interface{}) {
 		// response.
 		// Perhaps we should not ever return StatusMethodNotAllowed.
 		status = http.StatusMethodNotAllowed
+	case params.ErrTooManyRequests:
+		status = statusTooManyRequests
 	}
 	return status, errorBody
 }
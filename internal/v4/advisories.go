@@ -0,0 +1,197 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// validAdvisoryId matches valid security advisory ids.
+var validAdvisoryId = regexp.MustCompile("^[A-Za-z0-9][A-Za-z0-9._-]*$")
+
+// severities holds the valid severities of security advisories.
+var severities = map[string]bool{
+	params.SeverityLow:      true,
+	params.SeverityMedium:   true,
+	params.SeverityHigh:     true,
+	params.SeverityCritical: true,
+}
+
+// POST id/advisories
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idadvisories
+func (h *Handler) serveAdvisories(id *charm.Reference, _ bool, w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		return params.ErrMethodNotAllowed
+	}
+	var areq params.AdvisoryRequest
+	if err := json.NewDecoder(req.Body).Decode(&areq); err != nil {
+		return badRequestf(err, "cannot unmarshal advisory request")
+	}
+	if err := checkAdvisoryRequest(&areq); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	baseEntity, err := h.store.FindBaseEntity(id, "_id")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if areq.Fixed != nil {
+		if _, err := h.store.FindEntity(areq.Fixed, "_id"); err != nil {
+			if errgo.Cause(err) == params.ErrNotFound {
+				return badRequestf(nil, "fixed revision %s not found", areq.Fixed)
+			}
+			return errgo.Mask(err)
+		}
+	}
+	a := &mongodoc.Advisory{
+		Id:          areq.Id,
+		BaseURL:     baseEntity.URL,
+		Severity:    areq.Severity,
+		Description: areq.Description,
+		Affected:    areq.Affected,
+		Fixed:       areq.Fixed,
+	}
+	if err := h.store.AddAdvisory(a); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrForbidden))
+	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditAddAdvisory,
+		Entity:    baseEntity.URL,
+		New:       auditValue(a.Id),
+	})
+	return jsonhttp.WriteJSON(w, http.StatusOK, advisoryResponse(a))
+}
+
+// checkAdvisoryRequest checks that the given advisory request is valid.
+func checkAdvisoryRequest(areq *params.AdvisoryRequest) error {
+	if !validAdvisoryId.MatchString(areq.Id) {
+		return badRequestf(nil, "invalid advisory id %q", areq.Id)
+	}
+	if !severities[areq.Severity] {
+		return badRequestf(nil, "invalid severity %q", areq.Severity)
+	}
+	if areq.Description == "" {
+		return badRequestf(nil, "advisory description not specified")
+	}
+	if len(areq.Affected) == 0 {
+		return badRequestf(nil, "affected revisions not specified")
+	}
+	for _, r := range areq.Affected {
+		if r.From < 0 || r.To < r.From {
+			return badRequestf(nil, "invalid revision range %d-%d", r.From, r.To)
+		}
+	}
+	return nil
+}
+
+// GET id/meta/advisories
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetaadvisories
+func (h *Handler) metaAdvisories(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	advisories, err := h.store.EntityAdvisories(entity.URL)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	response := make([]params.Advisory, len(advisories))
+	for i, a := range advisories {
+		response[i] = advisoryResponse(a)
+	}
+	return response, nil
+}
+
+// GET advisories[?entity=id][&severity=severity][&after=time][&limit=count][&skip=count]
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-advisories
+func (h *Handler) serveAdvisoriesFeed(_ http.Header, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, params.ErrMethodNotAllowed
+	}
+	var q charmstore.AdvisoryQuery
+	var err error
+	if q.Limit, err = intValue(req.Form.Get("limit"), 1, 1000); err != nil {
+		return nil, badRequestf(err, "invalid limit value")
+	}
+	if q.Skip, err = intValue(req.Form.Get("skip"), 0, 0); err != nil {
+		return nil, badRequestf(err, "invalid skip value")
+	}
+	if id := req.Form.Get("entity"); id != "" {
+		ref, err := charm.ParseReference(id)
+		if err != nil {
+			return nil, badRequestf(err, "invalid entity value")
+		}
+		baseEntity, err := h.store.FindBaseEntity(ref, "_id")
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		q.BaseURL = baseEntity.URL
+	}
+	if severity := req.Form.Get("severity"); severity != "" {
+		if !severities[severity] {
+			return nil, badRequestf(nil, "invalid severity %q", severity)
+		}
+		q.Severity = severity
+	}
+	if after := req.Form.Get("after"); after != "" {
+		if q.After, err = time.Parse(time.RFC3339, after); err != nil {
+			return nil, badRequestf(err, "invalid after value")
+		}
+	}
+	advisories, err := h.store.FindAdvisories(q)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	// Only include the advisories about the charms and
+	// bundles the user is allowed to read.
+	readable := make(map[string]bool)
+	response := make([]params.Advisory, 0, len(advisories))
+	for _, a := range advisories {
+		key := a.BaseURL.String()
+		canRead, ok := readable[key]
+		if !ok {
+			canRead = h.authorizeEntityOperation(a.BaseURL, req, opRead) == nil
+			readable[key] = canRead
+		}
+		if canRead {
+			response = append(response, advisoryResponse(a))
+		}
+	}
+	return response, nil
+}
+
+// advisoryHeader returns the value of the advisories header for
+// archive downloads of the entity with the given id, or the empty
+// string if no advisory affects the entity.
+func (h *Handler) advisoryHeader(id *charm.Reference) (string, error) {
+	advisories, err := h.store.EntityAdvisories(id)
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	ids := make([]string, len(advisories))
+	for i, a := range advisories {
+		ids[i] = a.Id
+	}
+	return strings.Join(ids, ", "), nil
+}
+
+func advisoryResponse(a *mongodoc.Advisory) params.Advisory {
+	return params.Advisory{
+		Id:          a.Id,
+		Entity:      a.BaseURL,
+		Severity:    a.Severity,
+		Description: a.Description,
+		Affected:    a.Affected,
+		Fixed:       a.Fixed,
+		Time:        a.Time.UTC(),
+	}
+}
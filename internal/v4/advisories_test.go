@@ -0,0 +1,259 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestAdvisories(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	s.addCharm(c, "mysql", "cs:~charmers/trusty/mysql-0")
+	s.assertGet(c, "~charmers/trusty/wordpress-0/meta/advisories", []params.Advisory{})
+
+	// Create an advisory affecting the first revision.
+	advisory := s.addAdvisory(c, "~charmers/wordpress", params.AdvisoryRequest{
+		Id:          "CVE-2015-1234",
+		Severity:    params.SeverityHigh,
+		Description: "remote code execution",
+		Affected:    []params.RevisionRange{{Series: "trusty", From: 0, To: 0}},
+		Fixed:       charm.MustParseReference("cs:~charmers/trusty/wordpress-1"),
+	})
+	c.Assert(advisory.Entity.String(), gc.Equals, "cs:~charmers/wordpress")
+	c.Assert(advisory.Time.IsZero(), jc.IsFalse)
+	// Make the advisory older so that the order of
+	// the advisories in the feed is predictable.
+	advisory.Time = advisory.Time.Add(-time.Hour)
+	err := s.store.DB.Advisories().UpdateId(advisory.Id, bson.D{{"$set", bson.D{{"time", advisory.Time}}}})
+	c.Assert(err, gc.IsNil)
+	s.assertGet(c, "~charmers/trusty/wordpress-0/meta/advisories", []params.Advisory{advisory})
+	s.assertGet(c, "~charmers/trusty/wordpress-1/meta/advisories", []params.Advisory{})
+
+	// Archive downloads of affected revisions are flagged.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/wordpress-0/archive"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get(params.AdvisoriesHeader), gc.Equals, "CVE-2015-1234")
+	rec = httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/wordpress-1/archive"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get(params.AdvisoriesHeader), gc.Equals, "")
+
+	// Advisories are listed in the feed, most recent first.
+	other := s.addAdvisory(c, "~charmers/trusty/mysql-0", params.AdvisoryRequest{
+		Id:          "CVE-2015-1235",
+		Severity:    params.SeverityLow,
+		Description: "information disclosure",
+		Affected:    []params.RevisionRange{{From: 0, To: 0}},
+	})
+	s.assertGet(c, "advisories", []params.Advisory{other, advisory})
+	s.assertGet(c, "advisories?severity=high", []params.Advisory{advisory})
+	s.assertGet(c, "advisories?entity=~charmers/trusty/wordpress-0", []params.Advisory{advisory})
+	s.assertGet(c, "advisories?limit=1", []params.Advisory{other})
+	s.assertGet(c, "advisories?after="+advisory.Time.Format(time.RFC3339Nano), []params.Advisory{other})
+
+	// The creation of advisories is recorded in the audit log.
+	entries, err = s.store.AuditEntries(charmstore.AuditQuery{
+		Operation: params.AuditAddAdvisory,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 2)
+	c.Assert(entries[1].Entity.String(), gc.Equals, "cs:~charmers/wordpress")
+	c.Assert(string(entries[1].New), gc.Equals, `"CVE-2015-1234"`)
+}
+
+var advisoryErrorsTests = []struct {
+	about        string
+	url          string
+	body         string
+	expectStatus int
+	expectError  params.Error
+}{{
+	about:        "invalid id",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "bad id", "Severity": "high", "Description": "d", "Affected": [{"From": 0, "To": 1}]}`,
+	expectStatus: http.StatusBadRequest,
+	expectError: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: `invalid advisory id "bad id"`,
+	},
+}, {
+	about:        "invalid severity",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "CVE-1", "Severity": "bad", "Description": "d", "Affected": [{"From": 0, "To": 1}]}`,
+	expectStatus: http.StatusBadRequest,
+	expectError: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: `invalid severity "bad"`,
+	},
+}, {
+	about:        "no description",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "CVE-1", "Severity": "high", "Affected": [{"From": 0, "To": 1}]}`,
+	expectStatus: http.StatusBadRequest,
+	expectError: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: "advisory description not specified",
+	},
+}, {
+	about:        "no affected revisions",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "CVE-1", "Severity": "high", "Description": "d"}`,
+	expectStatus: http.StatusBadRequest,
+	expectError: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: "affected revisions not specified",
+	},
+}, {
+	about:        "invalid revision range",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "CVE-1", "Severity": "high", "Description": "d", "Affected": [{"From": 3, "To": 1}]}`,
+	expectStatus: http.StatusBadRequest,
+	expectError: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: "invalid revision range 3-1",
+	},
+}, {
+	about:        "fixed revision not found",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "CVE-1", "Severity": "high", "Description": "d", "Affected": [{"From": 0, "To": 1}], "Fixed": "cs:~charmers/trusty/wordpress-5"}`,
+	expectStatus: http.StatusBadRequest,
+	expectError: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: "fixed revision cs:~charmers/trusty/wordpress-5 not found",
+	},
+}, {
+	about:        "entity not found",
+	url:          "~charmers/mysql/advisories",
+	body:         `{"Id": "CVE-1", "Severity": "high", "Description": "d", "Affected": [{"From": 0, "To": 1}]}`,
+	expectStatus: http.StatusNotFound,
+	expectError: params.Error{
+		Code:    params.ErrNotFound,
+		Message: "base entity not found",
+	},
+}, {
+	about:        "duplicate id",
+	url:          "~charmers/wordpress/advisories",
+	body:         `{"Id": "CVE-0", "Severity": "high", "Description": "d", "Affected": [{"From": 0, "To": 1}]}`,
+	expectStatus: http.StatusForbidden,
+	expectError: params.Error{
+		Code:    params.ErrForbidden,
+		Message: `advisory "CVE-0" already exists for cs:~charmers/wordpress`,
+	},
+}}
+
+func (s *APISuite) TestAdvisoryErrors(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+	s.addAdvisory(c, "~charmers/wordpress", params.AdvisoryRequest{
+		Id:          "CVE-0",
+		Severity:    params.SeverityLow,
+		Description: "d",
+		Affected:    []params.RevisionRange{{From: 0, To: 0}},
+	})
+	for i, test := range advisoryErrorsTests {
+		c.Logf("test %d: %s", i, test.about)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL(test.url),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectError,
+		})
+	}
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("advisories?severity=bad"),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid severity "bad"`,
+		},
+	})
+}
+
+func (s *authSuite) TestAdvisoriesFeedAuthorization(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "kirk", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+	for _, id := range []string{"~charmers/utopic/wordpress-0", "~charmers/utopic/mysql-0"} {
+		err := store.AddCharmWithArchive(charm.MustParseReference(id), nil, storetesting.Charms.CharmDir("wordpress"))
+		c.Assert(err, gc.IsNil)
+	}
+	err := store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/mysql"), bson.D{{"$set", bson.D{
+		{"acls.read", []string{"picard"}},
+	}}})
+	c.Assert(err, gc.IsNil)
+	for _, name := range []string{"wordpress", "mysql"} {
+		err := store.AddAdvisory(&mongodoc.Advisory{
+			Id:          "CVE-" + name,
+			BaseURL:     charm.MustParseReference("cs:~charmers/" + name),
+			Severity:    params.SeverityHigh,
+			Description: "d",
+			Affected:    []params.RevisionRange{{From: 0, To: 0}},
+		})
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Advisories about charms the user cannot read are omitted.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("advisories"),
+		Cookies: cookies,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body))
+	var advisories []params.Advisory
+	err = json.Unmarshal(rec.Body.Bytes(), &advisories)
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisories, gc.HasLen, 1)
+	c.Assert(advisories[0].Id, gc.Equals, "CVE-wordpress")
+}
+
+// addAdvisory creates a security advisory about the charm or bundle
+// with the given id and returns the created advisory.
+func (s *APISuite) addAdvisory(c *gc.C, id string, areq params.AdvisoryRequest) params.Advisory {
+	body, err := json.Marshal(areq)
+	c.Assert(err, gc.IsNil)
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL(id + "/advisories"),
+		Method:  "POST",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Body:     strings.NewReader(string(body)),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body))
+	var advisory params.Advisory
+	err = json.Unmarshal(rec.Body.Bytes(), &advisory)
+	c.Assert(err, gc.IsNil)
+	c.Assert(advisory.Id, gc.Equals, areq.Id)
+	return advisory
+}
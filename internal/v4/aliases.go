@@ -0,0 +1,63 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/router"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// GET id/meta/aliases
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetaaliases
+func (h *Handler) metaAliases(entity *mongodoc.BaseEntity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	if entity.Aliases == nil {
+		return []string{}, nil
+	}
+	return entity.Aliases, nil
+}
+
+// PUT id/meta/aliases
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-idmetaaliases
+func (h *Handler) putMetaAliases(id *charm.Reference, path string, val *json.RawMessage, updater *router.FieldUpdater, req *http.Request) error {
+	var aliases []string
+	if err := json.Unmarshal(*val, &aliases); err != nil {
+		return badRequestf(err, "cannot unmarshal aliases")
+	}
+	if err := h.authorizeEntityOperation(id, req, opAdmin); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	baseEntity, err := h.store.FindBaseEntity(id, "_id", "aliases", "promulgated")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if baseEntity.Promulgated {
+		// The aliases of promulgated entities are
+		// shared with all the promulgated ids.
+		if err := h.authorizeEntityOperation(id, req, opPromulgate); err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+	}
+	if err := h.store.CheckAliases(baseEntity.URL, aliases); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest), errgo.Is(params.ErrForbidden))
+	}
+	updater.UpdateField("aliases", aliases)
+	updater.UpdateSearch()
+	updater.OnUpdate(func() {
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetAliases,
+			Entity:    id,
+			Old:       auditValue(baseEntity.Aliases),
+			New:       auditValue(aliases),
+		})
+	})
+	return nil
+}
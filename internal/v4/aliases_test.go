@@ -0,0 +1,137 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"net/http"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestMetaAliases(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:trusty/wordpress-3")
+	s.addCharm(c, "mysql", "cs:~charmers/trusty/mysql-0")
+	s.assertGet(c, "trusty/wordpress-3/meta/aliases", []string{})
+	s.assertPut(c, "trusty/wordpress-3/meta/aliases", []string{"wp"})
+	s.assertGet(c, "~charmers/wordpress/meta/aliases", []string{"wp"})
+
+	// Aliases resolve to the charm, and the redirect is reported.
+	for _, id := range []string{"wp", "trusty/wp", "~charmers/wp"} {
+		c.Logf("id %s", id)
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: s.srv,
+			URL:     storeURL(id + "/expand-id"),
+		})
+		c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+		c.Assert(rec.Header().Get(params.EntityRedirectHeader), jc.HasSuffix, "wordpress-3")
+	}
+	s.assertGet(c, "wp/meta/id-name", params.IdNameResponse{"wordpress"})
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("trusty/wordpress/meta/id-name"),
+	})
+	c.Assert(rec.Header().Get(params.EntityRedirectHeader), gc.Equals, "")
+
+	// Invalid aliases and aliases already in use are rejected.
+	for i, test := range []struct {
+		body         string
+		expectStatus int
+		expectError  params.Error
+	}{{
+		body:         `["bad/alias"]`,
+		expectStatus: http.StatusBadRequest,
+		expectError: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid alias "bad/alias"`,
+		},
+	}, {
+		body:         `["mysql"]`,
+		expectStatus: http.StatusForbidden,
+		expectError: params.Error{
+			Code:    params.ErrForbidden,
+			Message: `alias "mysql" already in use`,
+		},
+	}} {
+		c.Logf("test %d: %s", i, test.body)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL("trusty/wordpress-3/meta/aliases"),
+			Method:  "PUT",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectError,
+		})
+	}
+
+	// Alias changes are recorded in the audit log.
+	entries, err := s.store.AuditEntries(charmstore.AuditQuery{
+		Operation: params.AuditSetAliases,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(string(entries[0].New), gc.Equals, `["wp"]`)
+}
+
+func (s *authSuite) TestMetaAliasesPromulgated(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+	wordpress := storetesting.Charms.CharmDir("wordpress")
+	err := store.AddCharmWithArchive(charm.MustParseReference("~bob/trusty/wordpress-0"), charm.MustParseReference("trusty/wordpress-0"), wordpress)
+	c.Assert(err, gc.IsNil)
+	err = store.AddCharmWithArchive(charm.MustParseReference("~bob/trusty/blog-0"), nil, wordpress)
+	c.Assert(err, gc.IsNil)
+	for _, id := range []string{"~bob/wordpress", "~bob/blog"} {
+		err := store.DB.BaseEntities().UpdateId(charm.MustParseReference(id), bson.D{{"$set", bson.D{
+			{"acls.promulgate", []string{}},
+		}}})
+		c.Assert(err, gc.IsNil)
+	}
+
+	// Setting the aliases of a promulgated charm requires the
+	// promulgate permission.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: srv,
+		URL:     storeURL("~bob/wordpress/meta/aliases"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Cookies:      cookies,
+		Body:         strings.NewReader(`["wp"]`),
+		ExpectStatus: http.StatusUnauthorized,
+		ExpectBody: params.Error{
+			Code:    params.ErrUnauthorized,
+			Message: `unauthorized: access denied for user "bob"`,
+		},
+	})
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~bob/blog/meta/aliases"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Cookies: cookies,
+		Body:    strings.NewReader(`["wp"]`),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body))
+	baseEntity, err := store.FindBaseEntity(charm.MustParseReference("~bob/wordpress"), "aliases")
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.Aliases, gc.HasLen, 0)
+}
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/juju/loggo"
@@ -22,6 +23,7 @@ import (
 
 	"gopkg.in/juju/charmstore.v4/internal/charmstore"
 	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/ratelimit"
 	"gopkg.in/juju/charmstore.v4/internal/router"
 	"gopkg.in/juju/charmstore.v4/params"
 )
@@ -33,18 +35,40 @@ type Handler struct {
 	store   *charmstore.Store
 	config  charmstore.ServerParams
 	locator *bakery.PublicKeyRing
+
+	// identity holds the provider used to resolve user groups.
+	// It is nil if no provider is configured.
+	identity IdentityProvider
+
+	// limiters holds the rate limiters for each class
+	// of endpoints, keyed by class.
+	limiters map[string]*ratelimit.Limiter
+
+	// authsMu guards auths.
+	authsMu sync.Mutex
+
+	// auths holds the authorizations that allowed the requests
+	// being served, keyed by request. A request has a zero
+	// authorization until it is authorized.
+	auths map[*http.Request]authorization
 }
 
 // New returns a new instance of the v4 API handler.
 func New(store *charmstore.Store, config charmstore.ServerParams) *Handler {
 	h := &Handler{
-		store:   store,
-		config:  config,
-		locator: bakery.NewPublicKeyRing(),
+		store:    store,
+		config:   config,
+		locator:  bakery.NewPublicKeyRing(),
+		identity: newIdentityProvider(config),
+		limiters: newRateLimiters(config.RateLimits),
+		auths:    make(map[*http.Request]authorization),
 	}
 
 	h.Router = router.New(&router.Handlers{
 		Global: map[string]http.Handler{
+			"advisories":         router.HandleJSON(h.serveAdvisoriesFeed),
+			"audit":              router.HandleJSON(h.serveAudit),
+			"bundle/validate":    router.HandleJSON(h.serveBundleValidate),
 			"changes/published":  router.HandleJSON(h.serveChangesPublished),
 			"debug":              http.HandlerFunc(h.serveDebug),
 			"debug/pprof/":       newPprofHandler(h),
@@ -55,28 +79,47 @@ func New(store *charmstore.Store, config charmstore.ServerParams) *Handler {
 			"search/interesting": http.HandlerFunc(h.serveSearchInteresting),
 			"stats/":             router.NotFoundHandler(),
 			"stats/counter/":     router.HandleJSON(h.serveStatsCounter),
+			"tokens":             router.HandleJSON(h.serveAPITokens),
+			"tokens/":            router.HandleJSON(h.serveAPITokens),
 			"macaroon":           router.HandleJSON(h.serveMacaroon),
+			"orgs":               router.HandleJSON(h.serveOrgs),
 		},
 		Id: map[string]router.IdHandler{
-			"archive":     h.serveArchive,
-			"archive/":    h.serveArchiveFile,
-			"diagram.svg": h.serveDiagram,
-			"expand-id":   h.serveExpandId,
-			"icon.svg":    h.serveIcon,
-			"readme":      h.serveReadMe,
-			"resources":   h.serveResources,
+			"advisories":      h.serveAdvisories,
+			"archive":         h.serveArchive,
+			"archive/":        h.serveArchiveFile,
+			"diagram.svg":     h.serveDiagram,
+			"diff":            h.serveDiff,
+			"expand-id":       h.serveExpandId,
+			"icon.svg":        h.serveIcon,
+			"publish":         h.servePublish,
+			"readme":          h.serveReadMe,
+			"resources":       h.serveResources,
+			"share":           h.serveShare,
+			"transfer":        h.serveTransfer,
+			"validate-config": h.serveValidateConfig,
+		},
+		ReadOnlyId: map[string]bool{
+			"share":           true,
+			"validate-config": true,
 		},
 		Meta: map[string]router.BulkIncludeHandler{
+			"advisories":           h.entityHandler(h.metaAdvisories, "_id"),
+			"aliases":              h.puttableBaseEntityHandler(h.metaAliases, h.putMetaAliases, "aliases"),
 			"archive-size":         h.entityHandler(h.metaArchiveSize, "size"),
 			"archive-upload-time":  h.entityHandler(h.metaArchiveUploadTime, "uploadtime"),
+			"bundle-charm-status":  h.entityHandler(h.metaBundleCharmStatus, "bundlecharms"),
 			"bundle-machine-count": h.entityHandler(h.metaBundleMachineCount, "bundlemachinecount"),
 			"bundle-metadata":      h.entityHandler(h.metaBundleMetadata, "bundledata"),
+			"bundle-plan":          h.entityHandler(h.metaBundlePlan, "bundledata"),
 			"bundles-containing":   h.entityHandler(h.metaBundlesContaining),
 			"bundle-unit-count":    h.entityHandler(h.metaBundleUnitCount, "bundleunitcount"),
 			"charm-actions":        h.entityHandler(h.metaCharmActions, "charmactions"),
 			"charm-config":         h.entityHandler(h.metaCharmConfig, "charmconfig"),
 			"charm-metadata":       h.entityHandler(h.metaCharmMetadata, "charmmeta"),
 			"charm-related":        h.entityHandler(h.metaCharmRelated, "charmprovidedinterfaces", "charmrequiredinterfaces"),
+			"deprecated":           h.puttableEntityHandler(h.metaDeprecated, h.putMetaDeprecated, "baseurl", "deprecated"),
+			"dependents":           h.entityHandler(h.metaDependents, "promulgated-url"),
 			"extra-info": h.puttableEntityHandler(
 				h.metaExtraInfo,
 				h.putMetaExtraInfo,
@@ -87,23 +130,33 @@ func New(store *charmstore.Store, config charmstore.ServerParams) *Handler {
 				h.putMetaExtraInfoWithKey,
 				"extrainfo",
 			),
-			"hash":          h.entityHandler(h.metaHash, "blobhash"),
-			"hash256":       h.entityHandler(h.metaHash256, "blobhash256"),
-			"id":            h.entityHandler(h.metaId, "_id"),
-			"id-name":       h.entityHandler(h.metaIdName, "_id"),
-			"id-user":       h.entityHandler(h.metaIdUser, "_id"),
-			"id-revision":   h.entityHandler(h.metaIdRevision, "_id"),
-			"id-series":     h.entityHandler(h.metaIdSeries, "_id"),
-			"manifest":      h.entityHandler(h.metaManifest, "blobname"),
-			"perm":          h.puttableBaseEntityHandler(h.metaPerm, h.putMetaPerm, "acls"),
-			"perm/":         h.puttableBaseEntityHandler(h.metaPermWithKey, h.putMetaPermWithKey, "acls"),
-			"revision-info": router.SingleIncludeHandler(h.metaRevisionInfo),
-			"stats":         h.entityHandler(h.metaStats),
-			"tags":          h.entityHandler(h.metaTags, "charmmeta", "bundledata"),
+			"hash":           h.entityHandler(h.metaHash, "blobhash"),
+			"hash256":        h.entityHandler(h.metaHash256, "blobhash256"),
+			"id":             h.entityHandler(h.metaId, "_id"),
+			"id-name":        h.entityHandler(h.metaIdName, "_id"),
+			"id-user":        h.entityHandler(h.metaIdUser, "_id"),
+			"id-revision":    h.entityHandler(h.metaIdRevision, "_id"),
+			"id-series":      h.entityHandler(h.metaIdSeries, "_id"),
+			"manifest":       h.entityHandler(h.metaManifest, "blobname"),
+			"perm":           h.puttableBaseEntityHandler(h.metaPerm, h.putMetaPerm, "acls"),
+			"perm/":          h.puttableBaseEntityHandler(h.metaPermWithKey, h.putMetaPermWithKey, "acls"),
+			"revision-info":  router.SingleIncludeHandler(h.metaRevisionInfo),
+			"stats":          h.entityHandler(h.metaStats),
+			"tags":           h.entityHandler(h.metaTags, "charmmeta", "bundledata"),
+			"upgrade-report": h.entityHandler(h.metaUpgradeReport, upgradeReportFields...),
 
 			// endpoints not yet implemented:
 			// "color": router.SingleIncludeHandler(h.metaColor),
 		},
+		Namespace: map[string]router.NamespaceHandler{
+			"extra-info": h.serveNamespaceExtraInfo,
+			"members":    h.serveOrgMembers,
+			"members/":   h.serveOrgMembersWithKey,
+			"perm":       h.serveNamespacePerm,
+			"perm/":      h.serveNamespacePermWithKey,
+			"quota":      h.serveNamespaceQuota,
+			"retention":  h.serveNamespaceRetention,
+		},
 	}, h.resolveURL, h.authorizeEntity, h.entityExists)
 	return h
 }
@@ -121,22 +174,59 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// root of this handler, not the absolute root of the web server,
 	// which may be abitrarily many levels up.
 	req.RequestURI = req.URL.Path
+	if err := h.checkRateLimit(w, req); err != nil {
+		router.WriteError(w, err)
+		return
+	}
+	h.authsMu.Lock()
+	h.auths[req] = authorization{}
+	h.authsMu.Unlock()
+	defer func() {
+		h.authsMu.Lock()
+		delete(h.auths, req)
+		h.authsMu.Unlock()
+	}()
 	h.Router.ServeHTTP(w, req)
 }
 
 // ResolveURL resolves the series and revision of the given URL if either is
 // unspecified by filling them out with information retrieved from the store.
-func ResolveURL(store *charmstore.Store, url *charm.Reference) error {
-	if url.Series != "" && url.Revision != -1 {
+// Ids without a revision resolve to the latest revision published to the
+// given channel, or to the stable channel if no channel is specified.
+//
+// Ids of charms and bundles moved to another namespace
+// resolve to their new owner, and ids without a revision
+// may refer to a charm or bundle by one of its aliases.
+func ResolveURL(store *charmstore.Store, url *charm.Reference, channel params.Channel) error {
+	return ResolveURLAt(store, url, channel, time.Time{})
+}
+
+// ResolveURLAt is like ResolveURL except that, unless at is zero, the
+// URL is resolved as it would have been at the given time (see
+// charmstore.Store.FindBestEntityAt). Fully qualified ids of entities
+// that did not exist at that time are not found.
+func ResolveURLAt(store *charmstore.Store, url *charm.Reference, channel params.Channel, at time.Time) error {
+	if url.User != "" {
+		to, err := store.Redirect(url)
+		if err == nil {
+			url.User = to.User
+			url.Name = to.Name
+		} else if errgo.Cause(err) != params.ErrNotFound {
+			return errgo.Mask(err)
+		}
+	}
+	if url.Series != "" && url.Revision != -1 && at.IsZero() {
 		return nil
 	}
-	entity, err := store.FindBestEntity(url, "_id", "promulgated-url")
+	entity, err := store.FindBestEntityAt(url, channel, at, "_id", "promulgated-url")
 	if err != nil && errgo.Cause(err) != params.ErrNotFound {
 		return errgo.Mask(err)
 	}
 	if errgo.Cause(err) == params.ErrNotFound {
 		return noMatchingURLError(url)
 	}
+	// The name differs if the URL refers to the entity by an alias.
+	url.Name = entity.URL.Name
 	url.Series = entity.URL.Series
 	url.Revision = entity.PreferredURL(url.User == "").Revision
 	return nil
@@ -146,8 +236,34 @@ func noMatchingURLError(url *charm.Reference) error {
 	return errgo.WithCausef(nil, params.ErrNotFound, "no matching charm or bundle for %q", url)
 }
 
-func (h *Handler) resolveURL(url *charm.Reference) error {
-	return ResolveURL(h.store, url)
+func (h *Handler) resolveURL(url *charm.Reference, req *http.Request) error {
+	channel, err := requestChannel(req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	at, err := RequestTime(req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	return ResolveURLAt(h.store, url, channel, at)
+}
+
+// RequestTime returns the time specified by the at query parameter
+// of the given HTTP request, as of which ids are resolved, or the
+// zero time if it is not specified.
+func RequestTime(req *http.Request) (time.Time, error) {
+	// It's fine to parse the form more than once, and it avoids
+	// bugs from not parsing it.
+	req.ParseForm()
+	s := req.Form.Get("at")
+	if s == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, badRequestf(err, "invalid at parameter")
+	}
+	return at, nil
 }
 
 type entityHandlerFunc func(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error)
@@ -280,7 +396,7 @@ func (h *Handler) baseEntityQuery(id *charm.Reference, selector map[string]int,
 }
 
 func (h *Handler) entityQuery(id *charm.Reference, selector map[string]int, req *http.Request) (interface{}, error) {
-	val, err := h.store.FindBestEntity(id, fieldsFromSelector(selector)...)
+	val, err := h.store.FindBestEntity(id, params.NoChannel, fieldsFromSelector(selector)...)
 	if errgo.Cause(err) == params.ErrNotFound {
 		return nil, errgo.WithCausef(nil, params.ErrNotFound, "no matching charm or bundle for %s", id)
 	}
@@ -346,18 +462,24 @@ func (h *Handler) serveExpandId(id *charm.Reference, _ bool, w http.ResponseWrit
 	id.Revision = -1
 	id.Series = ""
 
+	at, err := RequestTime(req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+
 	// Retrieve all the entities with the same base URL.
-	q := h.store.EntitiesQuery(id).Select(bson.D{{"_id", 1}, {"promulgated-url", 1}})
+	q := h.store.EntitiesQuery(id).Select(entityAvailabilityFields)
 	if id.User == "" {
 		q = q.Sort("-series", "-promulgated-revision")
 	} else {
 		q = q.Sort("-series", "-revision")
 	}
 	var docs []*mongodoc.Entity
-	err := q.All(&docs)
+	err = q.All(&docs)
 	if err != nil && errgo.Cause(err) != mgo.ErrNotFound {
 		return errgo.Mask(err)
 	}
+	docs = h.withoutEmbargoed(availableAt(docs, at, id.User == ""), req)
 
 	// A not found error should have been already returned by the router in the
 	// case a partial id is provided. Here we do the same for the case when
@@ -377,6 +499,33 @@ func (h *Handler) serveExpandId(id *charm.Reference, _ bool, w http.ResponseWrit
 	return jsonhttp.WriteJSON(w, http.StatusOK, response)
 }
 
+// entityAvailabilityFields holds the entity fields required to list
+// the revisions available at a given time (see availableAt).
+var entityAvailabilityFields = bson.D{
+	{"_id", 1},
+	{"promulgated-url", 1},
+	{"embargo", 1},
+	{"uploadtime", 1},
+	{"promulgated-time", 1},
+}
+
+// availableAt returns the given entities without the ones that were
+// not available at the given time, when referred to by their
+// promulgated URL if promulgated is true. If at is zero, all the
+// entities are returned.
+func availableAt(entities []*mongodoc.Entity, at time.Time, promulgated bool) []*mongodoc.Entity {
+	if at.IsZero() {
+		return entities
+	}
+	available := entities[:0]
+	for _, e := range entities {
+		if e.AvailableAt(at, promulgated) {
+			available = append(available, e)
+		}
+	}
+	return available
+}
+
 func badRequestf(underlying error, f string, a ...interface{}) error {
 	err := errgo.WithCausef(underlying, params.ErrBadRequest, f, a...)
 	err.(*errgo.Err).SetLocation(1)
@@ -544,6 +693,11 @@ func (h *Handler) metaRevisionInfo(id *charm.Reference, path string, flags url.V
 	searchURL := *id
 	searchURL.Revision = -1
 
+	at, err := RequestTime(req)
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+
 	q := h.store.EntitiesQuery(&searchURL)
 	if id.User == "" {
 		q = q.Sort("-promulgated-revision")
@@ -551,9 +705,10 @@ func (h *Handler) metaRevisionInfo(id *charm.Reference, path string, flags url.V
 		q = q.Sort("-revision")
 	}
 	var docs []*mongodoc.Entity
-	if err := q.Select(bson.D{{"_id", 1}, {"promulgated-url", 1}}).All(&docs); err != nil {
+	if err := q.Select(entityAvailabilityFields).All(&docs); err != nil {
 		return "", errgo.Notef(err, "cannot get ids")
 	}
+	docs = h.withoutEmbargoed(availableAt(docs, at, id.User == ""), req)
 
 	if len(docs) == 0 {
 		return "", errgo.WithCausef(nil, params.ErrNotFound, "no matching charm or bundle for %s", id)
@@ -656,7 +811,7 @@ func (h *Handler) putMetaExtraInfo(id *charm.Reference, path string, val *json.R
 	for key, val := range fields {
 		updater.UpdateField("extrainfo."+key, *val)
 	}
-	return nil
+	return h.auditExtraInfo(id, fields, updater, req)
 }
 
 // PUT id/meta/extra-info/key
@@ -667,6 +822,33 @@ func (h *Handler) putMetaExtraInfoWithKey(id *charm.Reference, path string, val
 		return err
 	}
 	updater.UpdateField("extrainfo."+key, *val)
+	return h.auditExtraInfo(id, map[string]*json.RawMessage{key: val}, updater, req)
+}
+
+// auditExtraInfo records a change to the given extra-info fields of
+// the entity with the given id, performed by the given request.
+// The change is recorded once the updater has successfully
+// applied it.
+func (h *Handler) auditExtraInfo(id *charm.Reference, fields map[string]*json.RawMessage, updater *router.FieldUpdater, req *http.Request) error {
+	entity, err := h.store.FindEntity(id, "extrainfo")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	old := make(map[string]*json.RawMessage)
+	for key := range fields {
+		if val, ok := entity.ExtraInfo[key]; ok {
+			data := json.RawMessage(val)
+			old[key] = &data
+		}
+	}
+	updater.OnUpdate(func() {
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetExtraInfo,
+			Entity:    id,
+			Old:       auditValue(old),
+			New:       auditValue(fields),
+		})
+	})
 	return nil
 }
 
@@ -680,10 +862,78 @@ func checkExtraInfoKey(key string) error {
 // GET id/meta/perm
 // https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetaperm
 func (h *Handler) metaPerm(entity *mongodoc.BaseEntity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	return permResponse(entity.ACLs), nil
+}
+
+// permResponse returns the given ACLs in their API representation.
+func permResponse(acls mongodoc.ACL) params.PermResponse {
 	return params.PermResponse{
-		Read:  entity.ACLs.Read,
-		Write: entity.ACLs.Write,
-	}, nil
+		Read:       acls.Read,
+		Write:      acls.Write,
+		Upload:     acls.Upload,
+		Delete:     acls.Delete,
+		Admin:      acls.Admin,
+		Promulgate: acls.Promulgate,
+		Expiries:   permExpiries(acls.Expiries),
+	}
+}
+
+// auditPerm records a change to the permissions of the entity with
+// the given id, performed by the given request. The change function
+// is called to apply the change to a copy of the current ACLs. The
+// change is recorded once the updater has successfully applied it.
+func (h *Handler) auditPerm(id *charm.Reference, updater *router.FieldUpdater, req *http.Request, change func(acls *mongodoc.ACL)) error {
+	baseEntity, err := h.store.FindBaseEntity(id, "acls")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	newACLs := baseEntity.ACLs
+	change(&newACLs)
+	updater.OnUpdate(func() {
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetPerm,
+			Entity:    id,
+			Old:       auditValue(permResponse(baseEntity.ACLs)),
+			New:       auditValue(permResponse(newACLs)),
+		})
+	})
+	return nil
+}
+
+// permExpiries returns the given ACL expiry times in
+// their API representation.
+func permExpiries(expiries []mongodoc.ACLExpiry) []params.PermExpiry {
+	if len(expiries) == 0 {
+		return nil
+	}
+	perms := make([]params.PermExpiry, len(expiries))
+	for i, e := range expiries {
+		perms[i] = params.PermExpiry{
+			Perm:    e.Perm,
+			Name:    e.Name,
+			Expires: e.Expires,
+		}
+	}
+	return perms
+}
+
+// aclExpiries returns the given expiry times as stored in
+// the ACLs, checking that they refer to known permissions.
+func aclExpiries(perms []params.PermExpiry) ([]mongodoc.ACLExpiry, error) {
+	expiries := make([]mongodoc.ACLExpiry, len(perms))
+	for i, p := range perms {
+		switch p.Perm {
+		case opRead, opWrite, opUpload, opDelete, opAdmin, opPromulgate:
+		default:
+			return nil, badRequestf(nil, "unknown permission %q in expiries", p.Perm)
+		}
+		expiries[i] = mongodoc.ACLExpiry{
+			Perm:    p.Perm,
+			Name:    p.Name,
+			Expires: p.Expires.UTC(),
+		}
+	}
+	return expiries, nil
 }
 
 // PUT id/meta/perm
@@ -693,17 +943,85 @@ func (h *Handler) putMetaPerm(id *charm.Reference, path string, val *json.RawMes
 	if err := json.Unmarshal(*val, &perms); err != nil {
 		return errgo.Mask(err)
 	}
-	isPublic := false
-	for _, p := range perms.Read {
-		if p == params.Everyone {
-			isPublic = true
-			break
+	if err := h.authorizeEntityOperation(id, req, opAdmin); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	if err := h.checkPermDependents(id, perms.Read, req); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest), errgo.Is(params.ErrForbidden))
+	}
+	baseEntity, err := h.store.FindBaseEntity(id, "acls")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	newACLs := baseEntity.ACLs
+	updateExpiries := perms.Expiries != nil
+	if updateExpiries {
+		newACLs.Expiries, err = aclExpiries(perms.Expiries)
+		if err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
 		}
 	}
+	newACLs.Read, newACLs.Write = perms.Read, perms.Write
 	updater.UpdateField("acls.read", perms.Read)
-	updater.UpdateField("public", isPublic)
+	updater.UpdateField("public", isPublic(perms.Read))
 	updater.UpdateField("acls.write", perms.Write)
+	optionalPerms := map[string][]string{
+		"upload":     perms.Upload,
+		"delete":     perms.Delete,
+		"admin":      perms.Admin,
+		"promulgate": perms.Promulgate,
+	}
+	for key, perm := range optionalPerms {
+		if perm != nil {
+			updater.UpdateField("acls."+key, perm)
+			*newACLs.Perm(key) = perm
+		}
+	}
+	// Drop the expiry times of the users and groups
+	// no longer holding the corresponding permission.
+	if expiries := retainedExpiries(newACLs); updateExpiries || len(expiries) != len(newACLs.Expiries) {
+		newACLs.Expiries = expiries
+		updater.UpdateField("acls.expiries", expiries)
+	}
 	updater.UpdateSearch()
+	return h.auditPerm(id, updater, req, func(acls *mongodoc.ACL) {
+		*acls = newACLs
+	})
+}
+
+// retainedExpiries returns the expiry times in the given ACLs that
+// refer to a user or group still holding the corresponding permission.
+func retainedExpiries(acls mongodoc.ACL) []mongodoc.ACLExpiry {
+	var expiries []mongodoc.ACLExpiry
+	for _, e := range acls.Expiries {
+		perm := acls.Perm(e.Perm)
+		if perm == nil {
+			continue
+		}
+		for _, name := range *perm {
+			if name == e.Name {
+				expiries = append(expiries, e)
+				break
+			}
+		}
+	}
+	return expiries
+}
+
+// checkPermDependents checks that setting the read permissions of id
+// to the given ones does not break any public bundle, unless the
+// force flag is specified in the request.
+func (h *Handler) checkPermDependents(id *charm.Reference, read []string, req *http.Request) error {
+	force, err := parseBool(req.Form.Get("force"))
+	if err != nil {
+		return badRequestf(err, "invalid force parameter")
+	}
+	if force {
+		return nil
+	}
+	if err := h.checkACLDependents(id, read); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrForbidden))
+	}
 	return nil
 }
 
@@ -715,6 +1033,14 @@ func (h *Handler) metaPermWithKey(entity *mongodoc.BaseEntity, id *charm.Referen
 		return entity.ACLs.Read, nil
 	case "/write":
 		return entity.ACLs.Write, nil
+	case "/upload":
+		return entity.ACLs.Upload, nil
+	case "/delete":
+		return entity.ACLs.Delete, nil
+	case "/admin":
+		return entity.ACLs.Admin, nil
+	case "/promulgate":
+		return entity.ACLs.Promulgate, nil
 	}
 	return nil, errgo.WithCausef(nil, params.ErrNotFound, "unknown permission")
 }
@@ -726,24 +1052,37 @@ func (h *Handler) putMetaPermWithKey(id *charm.Reference, path string, val *json
 	if err := json.Unmarshal(*val, &perms); err != nil {
 		return errgo.Mask(err)
 	}
-	isPublic := false
-	for _, p := range perms {
-		if p == params.Everyone {
-			isPublic = true
-			break
-		}
+	if err := h.authorizeEntityOperation(id, req, opAdmin); err != nil {
+		return errgo.Mask(err, errgo.Any)
 	}
 	switch path {
 	case "/read":
+		if err := h.checkPermDependents(id, perms, req); err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrBadRequest), errgo.Is(params.ErrForbidden))
+		}
 		updater.UpdateField("acls.read", perms)
-		updater.UpdateField("public", isPublic)
+		updater.UpdateField("public", isPublic(perms))
 		updater.UpdateSearch()
-		return nil
-	case "/write":
-		updater.UpdateField("acls.write", perms)
-		return nil
+	case "/write", "/upload", "/delete", "/admin", "/promulgate":
+		updater.UpdateField("acls."+path[1:], perms)
+	default:
+		return errgo.WithCausef(nil, params.ErrNotFound, "unknown permission")
 	}
-	return errgo.WithCausef(nil, params.ErrNotFound, "unknown permission")
+	baseEntity, err := h.store.FindBaseEntity(id, "acls")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	newACLs := baseEntity.ACLs
+	*newACLs.Perm(path[1:]) = perms
+	// Drop the expiry times of the users and groups
+	// no longer holding the permission.
+	if expiries := retainedExpiries(newACLs); len(expiries) != len(newACLs.Expiries) {
+		newACLs.Expiries = expiries
+		updater.UpdateField("acls.expiries", expiries)
+	}
+	return h.auditPerm(id, updater, req, func(acls *mongodoc.ACL) {
+		*acls = newACLs
+	})
 }
 
 // GET id/meta/archive-upload-time
@@ -759,7 +1098,7 @@ type PublishedResponse struct {
 	Published time.Time
 }
 
-// GET changes/published[?limit=$count][&from=$fromdate][&to=$todate]
+// GET changes/published[?limit=$count][&from=$fromdate][&to=$todate][&channel=$channel]
 // https://github.com/juju/charmstore/blob/v4/docs/API.md#get-changespublished
 func (h *Handler) serveChangesPublished(_ http.Header, r *http.Request) (interface{}, error) {
 	start, stop, err := parseDateRange(r.Form)
@@ -773,9 +1112,16 @@ func (h *Handler) serveChangesPublished(_ http.Header, r *http.Request) (interfa
 			return nil, badRequestf(nil, "invalid 'limit' value")
 		}
 	}
-	var tquery bson.D
+	channel, err := requestChannel(r)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	if channel == params.NoChannel {
+		channel = params.StableChannel
+	}
+	timeField := charmstore.ChannelTimeField(channel)
+	tquery := bson.D{{"$exists", true}}
 	if !start.IsZero() {
-		tquery = make(bson.D, 0, 2)
 		tquery = append(tquery, bson.DocElem{
 			Name:  "$gte",
 			Value: start,
@@ -787,14 +1133,10 @@ func (h *Handler) serveChangesPublished(_ http.Header, r *http.Request) (interfa
 			Value: stop,
 		})
 	}
-	var findQuery bson.D
-	if len(tquery) > 0 {
-		findQuery = bson.D{{"uploadtime", tquery}}
-	}
 	query := h.store.DB.Entities().
-		Find(findQuery).
-		Sort("-uploadtime").
-		Select(bson.D{{"_id", 1}, {"uploadtime", 1}})
+		Find(bson.D{{timeField, tquery}}).
+		Sort("-" + timeField).
+		Select(bson.D{{"_id", 1}, {"published", 1}})
 	if limit != -1 {
 		query = query.Limit(limit)
 	}
@@ -804,14 +1146,34 @@ func (h *Handler) serveChangesPublished(_ http.Header, r *http.Request) (interfa
 	for iter := query.Iter(); iter.Next(&entity); {
 		results = append(results, params.Published{
 			Id:          entity.URL,
-			PublishTime: entity.UploadTime.UTC(),
+			PublishTime: entity.Published[channel].UTC(),
 		})
+		// Make sure the published times of the previous
+		// entity are not retained.
+		entity.Published = nil
 	}
 	return results, nil
 }
 
 // GET /macaroon
-// TODO: document macaroon endpoint in the API doc.
-func (h *Handler) serveMacaroon(_ http.Header, _ *http.Request) (interface{}, error) {
-	return h.newMacaroon()
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-macaroon
+//
+// POST /macaroon
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-macaroon
+func (h *Handler) serveMacaroon(_ http.Header, req *http.Request) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return h.newMacaroon()
+	case "POST":
+		var mreq params.MacaroonRequest
+		if err := json.NewDecoder(req.Body).Decode(&mreq); err != nil {
+			return nil, badRequestf(err, "cannot unmarshal macaroon request")
+		}
+		caveats, err := macaroonRequestCaveats(mreq)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+		}
+		return h.newMacaroon(caveats...)
+	}
+	return nil, params.ErrMethodNotAllowed
 }
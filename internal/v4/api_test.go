@@ -142,6 +142,70 @@ var metaEndpoints = []metaEndpoint{{
 	assertCheckData: func(c *gc.C, data interface{}) {
 		c.Assert(data.(*charm.BundleData).Services["wordpress"].Charm, gc.Equals, "wordpress")
 	},
+}, {
+	name:      "bundle-plan",
+	exclusive: bundleOnly,
+	get: entityGetter(func(entity *mongodoc.Entity) interface{} {
+		if entity.BundleData == nil {
+			return nil
+		}
+		// All the test bundles are wordpress-simple.
+		return []params.BundlePlanStep{{
+			Kind:    "deploy",
+			Service: "mysql",
+			Charm:   "mysql",
+		}, {
+			Kind:    "deploy",
+			Service: "wordpress",
+			Charm:   "wordpress",
+		}, {
+			Kind:      "add-relation",
+			Endpoints: []string{"wordpress:db", "mysql:server"},
+		}, {
+			Kind:    "add-unit",
+			Service: "mysql",
+		}, {
+			Kind:    "add-unit",
+			Service: "wordpress",
+		}}
+	}),
+	checkURL: "cs:bundle/wordpress-simple-42",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data.([]params.BundlePlanStep)[0].Kind, gc.Equals, "deploy")
+	},
+}, {
+	name:      "bundle-charm-status",
+	exclusive: bundleOnly,
+	get: func(store *charmstore.Store, url *charm.Reference) (interface{}, error) {
+		if url.Series != "bundle" {
+			return nil, nil
+		}
+		// The detailed status of bundle charms is
+		// tested in bundle_test.go.
+		entity, err := store.FindEntity(url, "bundlecharms")
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		statuses, err := store.BundleCharmStatus(entity.BundleCharms)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		response := make([]params.BundleCharmStatus, len(statuses))
+		for i, status := range statuses {
+			response[i] = params.BundleCharmStatus{
+				Id:             status.Id,
+				PinnedRevision: status.Id.Revision,
+				Latest:         status.Latest,
+				Resolves:       status.Resolves,
+				Stale:          status.Stale,
+			}
+		}
+		return response, nil
+	},
+	checkURL: "cs:bundle/wordpress-simple-42",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data.([]params.BundleCharmStatus), gc.HasLen, 2)
+	},
 }, {
 	name:      "bundle-unit-count",
 	exclusive: bundleOnly,
@@ -283,6 +347,29 @@ var metaEndpoints = []metaEndpoint{{
 	assertCheckData: func(c *gc.C, data interface{}) {
 		c.Assert(data, gc.FitsTypeOf, []*params.MetaAnyResponse(nil))
 	},
+}, {
+	name:      "dependents",
+	exclusive: charmOnly,
+	get: func(store *charmstore.Store, url *charm.Reference) (interface{}, error) {
+		if url.Series == "bundle" {
+			return nil, nil
+		}
+		// The stock bundle only refers to the stock charm
+		// without specifying a revision.
+		// Dependents are tested further in dependents_test.go.
+		if *url != *charm.MustParseReference("cs:precise/wordpress-23") {
+			return []params.Dependent{}, nil
+		}
+		return []params.Dependent{{
+			Id:          charm.MustParseReference("cs:~charmers/bundle/wordpress-simple-42"),
+			Charm:       charm.MustParseReference("cs:wordpress"),
+			Promulgated: true,
+		}}, nil
+	},
+	checkURL: "cs:precise/wordpress-23",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data.([]params.Dependent), gc.HasLen, 1)
+	},
 }, {
 	name: "stats",
 	get: func(store *charmstore.Store, url *charm.Reference) (interface{}, error) {
@@ -317,6 +404,69 @@ var metaEndpoints = []metaEndpoint{{
 	assertCheckData: func(c *gc.C, data interface{}) {
 		c.Assert(data, gc.Equals, "value cs:precise/wordpress-23")
 	},
+}, {
+	name: "advisories",
+	get: func(store *charmstore.Store, url *charm.Reference) (interface{}, error) {
+		advisories, err := store.EntityAdvisories(url)
+		if err != nil {
+			return nil, err
+		}
+		response := make([]params.Advisory, len(advisories))
+		for i, a := range advisories {
+			response[i] = params.Advisory{
+				Id:          a.Id,
+				Entity:      a.BaseURL,
+				Severity:    a.Severity,
+				Description: a.Description,
+				Affected:    a.Affected,
+				Fixed:       a.Fixed,
+				Time:        a.Time,
+			}
+		}
+		return response, nil
+	},
+	checkURL: "cs:~bob/utopic/wordpress-2",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data, gc.FitsTypeOf, []params.Advisory(nil))
+		advisories := data.([]params.Advisory)
+		c.Assert(advisories, gc.HasLen, 1)
+		c.Assert(advisories[0].Id, gc.Equals, "CVE-2015-1234")
+	},
+}, {
+	name: "aliases",
+	get: func(store *charmstore.Store, url *charm.Reference) (interface{}, error) {
+		e, err := store.FindBaseEntity(url)
+		if err != nil {
+			return nil, err
+		}
+		if e.Aliases == nil {
+			return []string{}, nil
+		}
+		return e.Aliases, nil
+	},
+	checkURL: "cs:~bob/utopic/wordpress-2",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data, jc.DeepEquals, []string{})
+	},
+}, {
+	name: "deprecated",
+	get: entityGetter(func(entity *mongodoc.Entity) interface{} {
+		if entity.Deprecated == nil {
+			return nil
+		}
+		return &params.DeprecatedResponse{
+			Reason:    entity.Deprecated.Reason,
+			Successor: entity.Deprecated.Successor,
+			Time:      entity.Deprecated.Time,
+		}
+	}),
+	checkURL: "cs:~bob/utopic/wordpress-2",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data, gc.FitsTypeOf, (*params.DeprecatedResponse)(nil))
+		resp := data.(*params.DeprecatedResponse)
+		c.Assert(resp.Reason, gc.Equals, "superseded")
+		c.Assert(resp.Successor, jc.DeepEquals, charm.MustParseReference("cs:wordpress"))
+	},
 }, {
 	name: "perm",
 	get: func(store *charmstore.Store, url *charm.Reference) (interface{}, error) {
@@ -325,15 +475,23 @@ var metaEndpoints = []metaEndpoint{{
 			return nil, err
 		}
 		return params.PermResponse{
-			Read:  e.ACLs.Read,
-			Write: e.ACLs.Write,
+			Read:       e.ACLs.Read,
+			Write:      e.ACLs.Write,
+			Upload:     e.ACLs.Upload,
+			Delete:     e.ACLs.Delete,
+			Admin:      e.ACLs.Admin,
+			Promulgate: e.ACLs.Promulgate,
 		}, nil
 	},
 	checkURL: "cs:~bob/utopic/wordpress-2",
 	assertCheckData: func(c *gc.C, data interface{}) {
 		c.Assert(data, gc.DeepEquals, params.PermResponse{
-			Read:  []string{params.Everyone, "bob"},
-			Write: []string{"bob"},
+			Read:       []string{params.Everyone, "bob"},
+			Write:      []string{"bob"},
+			Upload:     []string{"bob"},
+			Delete:     []string{"bob"},
+			Admin:      []string{"bob"},
+			Promulgate: []string{"bob"},
 		})
 	},
 }, {
@@ -423,6 +581,20 @@ var metaEndpoints = []metaEndpoint{{
 			Revision: 2,
 		})
 	},
+}, {
+	name:      "upgrade-report",
+	exclusive: charmOnly,
+	get: entityGetter(func(entity *mongodoc.Entity) interface{} {
+		if entity.CharmMeta == nil {
+			return nil
+		}
+		// All the test entities have a single revision.
+		return &params.UpgradeReportResponse{}
+	}),
+	checkURL: "cs:precise/wordpress-23",
+	assertCheckData: func(c *gc.C, data interface{}) {
+		c.Assert(data, jc.DeepEquals, &params.UpgradeReportResponse{})
+	},
 }}
 
 // TestEndpointGet tries to ensure that the endpoint
@@ -493,6 +665,21 @@ func (s *APISuite) addTestEntities(c *gc.C) []*charm.Reference {
 		s.assertPut(c, key, "value "+e)
 		urls[i] = url
 	}
+	// Deprecate the charm with a different user.
+	s.assertPut(c, "~bob/utopic/wordpress-2/meta/deprecated", params.DeprecatedRequest{
+		Deprecated: true,
+		Reason:     "superseded",
+		Successor:  charm.MustParseReference("cs:wordpress"),
+	})
+	// Add a security advisory about the same charm.
+	err := s.store.AddAdvisory(&mongodoc.Advisory{
+		Id:          "CVE-2015-1234",
+		BaseURL:     charm.MustParseReference("cs:~bob/wordpress"),
+		Severity:    params.SeverityHigh,
+		Description: "remote code execution",
+		Affected:    []params.RevisionRange{{From: 0, To: 2}},
+	})
+	c.Assert(err, gc.IsNil)
 	return urls
 }
 
@@ -542,9 +729,14 @@ func (s *APISuite) TestMetaPerm(c *gc.C) {
 	s.addCharm(c, "wordpress", "precise/wordpress-23")
 	s.addCharm(c, "wordpress", "precise/wordpress-24")
 	s.addCharm(c, "wordpress", "trusty/wordpress-1")
+	charmers := []string{"charmers"}
 	s.assertGet(c, "wordpress/meta/perm", params.PermResponse{
-		Read:  []string{params.Everyone, "charmers"},
-		Write: []string{"charmers"},
+		Read:       []string{params.Everyone, "charmers"},
+		Write:      charmers,
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
 	})
 	e, err := s.store.FindBaseEntity(charm.MustParseReference("precise/wordpress-23"))
 	c.Assert(err, gc.IsNil)
@@ -564,8 +756,12 @@ func (s *APISuite) TestMetaPerm(c *gc.C) {
 			URL:     storeURL(u + "/meta/perm"),
 			Cookies: cookies,
 			ExpectBody: params.PermResponse{
-				Read:  []string{"bob"},
-				Write: []string{"admin"},
+				Read:       []string{"bob"},
+				Write:      []string{"admin"},
+				Upload:     charmers,
+				Delete:     charmers,
+				Admin:      charmers,
+				Promulgate: charmers,
 			},
 		})
 	}
@@ -573,23 +769,35 @@ func (s *APISuite) TestMetaPerm(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(e.Public, jc.IsFalse)
 	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{
-		Read:  []string{"bob"},
-		Write: []string{"admin"},
+		Read:       []string{"bob"},
+		Write:      []string{"admin"},
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
 	})
 
 	// Try restoring everyone's read permission.
 	s.assertPut(c, "wordpress/meta/perm/read", []string{"bob", params.Everyone})
 	s.assertGet(c, "wordpress/meta/perm", params.PermResponse{
-		Read:  []string{"bob", params.Everyone},
-		Write: []string{"admin"},
+		Read:       []string{"bob", params.Everyone},
+		Write:      []string{"admin"},
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
 	})
 	s.assertGet(c, "wordpress/meta/perm/read", []string{"bob", params.Everyone})
 	e, err = s.store.FindBaseEntity(charm.MustParseReference("precise/wordpress-23"))
 	c.Assert(err, gc.IsNil)
 	c.Assert(e.Public, jc.IsTrue)
 	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{
-		Read:  []string{"bob", params.Everyone},
-		Write: []string{"admin"},
+		Read:       []string{"bob", params.Everyone},
+		Write:      []string{"admin"},
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
 	})
 
 	// Try deleting all permissions.
@@ -608,7 +816,12 @@ func (s *APISuite) TestMetaPerm(c *gc.C) {
 	e, err = s.store.FindBaseEntity(charm.MustParseReference("precise/wordpress-23"))
 	c.Assert(err, gc.IsNil)
 	c.Assert(e.Public, jc.IsFalse)
-	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{})
+	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
+	})
 	c.Assert(e.ACLs.Read, gc.DeepEquals, []string{})
 
 	// Try setting all permissions in one request
@@ -620,8 +833,12 @@ func (s *APISuite) TestMetaPerm(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(e.Public, jc.IsFalse)
 	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{
-		Read:  []string{"bob"},
-		Write: []string{"admin"},
+		Read:       []string{"bob"},
+		Write:      []string{"admin"},
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
 	})
 
 	// Try only read permissions to meta/perm endpoint
@@ -633,8 +850,102 @@ func (s *APISuite) TestMetaPerm(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(e.Public, jc.IsFalse)
 	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{
-		Read:  []string{"joe"},
-		Write: []string{},
+		Read:       []string{"joe"},
+		Write:      []string{},
+		Upload:     charmers,
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: charmers,
+	})
+
+	// The other permissions can be changed too.
+	s.assertPut(c, "wordpress/meta/perm", params.PermRequest{
+		Read:       []string{"joe"},
+		Upload:     []string{"ci"},
+		Delete:     []string{"charmers"},
+		Admin:      []string{"charmers"},
+		Promulgate: []string{"promulgators"},
+	})
+	s.assertPut(c, "wordpress/meta/perm/upload", []string{"ci", "charmers"})
+	s.assertGet(c, "wordpress/meta/perm/upload", []string{"ci", "charmers"})
+	s.assertGet(c, "wordpress/meta/perm/promulgate", []string{"promulgators"})
+	e, err = s.store.FindBaseEntity(charm.MustParseReference("precise/wordpress-23"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.ACLs, jc.DeepEquals, mongodoc.ACL{
+		Read:       []string{"joe"},
+		Write:      []string{},
+		Upload:     []string{"ci", "charmers"},
+		Delete:     charmers,
+		Admin:      charmers,
+		Promulgate: []string{"promulgators"},
+	})
+}
+
+func (s *APISuite) TestMetaPermExpiries(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/precise/wordpress-23")
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.assertPut(c, "precise/wordpress-23/meta/perm", params.PermRequest{
+		Read:  []string{params.Everyone, "charmers", "bob"},
+		Write: []string{"charmers", "bob"},
+		Expiries: []params.PermExpiry{{
+			Perm:    "write",
+			Name:    "bob",
+			Expires: expires,
+		}},
+	})
+	s.assertGet(c, "wordpress/meta/perm", params.PermResponse{
+		Read:       []string{params.Everyone, "charmers", "bob"},
+		Write:      []string{"charmers", "bob"},
+		Upload:     []string{"charmers"},
+		Delete:     []string{"charmers"},
+		Admin:      []string{"charmers"},
+		Promulgate: []string{"charmers"},
+		Expiries: []params.PermExpiry{{
+			Perm:    "write",
+			Name:    "bob",
+			Expires: expires,
+		}},
+	})
+
+	// Expiries are left unchanged when omitted.
+	s.assertPut(c, "precise/wordpress-23/meta/perm", params.PermRequest{
+		Read:  []string{params.Everyone, "charmers"},
+		Write: []string{"charmers", "bob"},
+	})
+	e, err := s.store.FindBaseEntity(charm.MustParseReference("wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.ACLs.Expiries, jc.DeepEquals, []mongodoc.ACLExpiry{{
+		Perm:    "write",
+		Name:    "bob",
+		Expires: expires,
+	}})
+
+	// Expiries are removed with the entries they refer to.
+	s.assertPut(c, "precise/wordpress-23/meta/perm/write", []string{"charmers"})
+	e, err = s.store.FindBaseEntity(charm.MustParseReference("wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.ACLs.Expiries, gc.HasLen, 0)
+
+	// Unknown permissions are rejected.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("precise/wordpress-23/meta/perm"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Body: strings.NewReader(`{
+			"Read": ["everyone"],
+			"Write": ["charmers"],
+			"Expiries": [{"Perm": "bad", "Name": "bob", "Expires": "2030-01-02T03:04:05Z"}]
+		}`),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `unknown permission "bad" in expiries`,
+		},
 	})
 }
 
@@ -1165,7 +1476,7 @@ func (s *APISuite) TestResolveURL(c *gc.C) {
 	for i, test := range resolveURLTests {
 		c.Logf("test %d: %s", i, test.url)
 		url := charm.MustParseReference(test.url)
-		err := v4.ResolveURL(s.store, url)
+		err := v4.ResolveURL(s.store, url, params.NoChannel)
 		if test.notFound {
 			c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
 			c.Assert(err, gc.ErrorMatches, `no matching charm or bundle for ".*"`)
@@ -1317,6 +1628,97 @@ func (s *APISuite) TestServeMetaRevisionInfo(c *gc.C) {
 	}
 }
 
+func (s *APISuite) TestResolveAt(c *gc.C) {
+	t0 := time.Now().Add(-3 * time.Hour)
+	s.addCharm(c, "wordpress", "cs:trusty/wordpress-0")
+	s.addCharm(c, "wordpress", "cs:trusty/wordpress-1")
+	s.addCharm(c, "wordpress", "cs:~bob/trusty/wordpress-0")
+	s.setEntityTime(c, "~charmers/trusty/wordpress-0", t0)
+	s.setEntityTime(c, "~bob/trusty/wordpress-0", t0)
+	at := t0.Add(time.Hour)
+
+	for i, test := range []struct {
+		url    string
+		at     time.Time
+		expect string
+	}{{
+		url:    "wordpress",
+		expect: "cs:trusty/wordpress-1",
+	}, {
+		url:    "wordpress",
+		at:     at,
+		expect: "cs:trusty/wordpress-0",
+	}, {
+		url:    "~charmers/wordpress",
+		at:     at,
+		expect: "cs:~charmers/trusty/wordpress-0",
+	}, {
+		url:    "trusty/wordpress-0",
+		at:     at,
+		expect: "cs:trusty/wordpress-0",
+	}, {
+		url: "trusty/wordpress-1",
+		at:  at,
+	}, {
+		url: "~bob/wordpress",
+		at:  t0.Add(-time.Hour),
+	}} {
+		c.Logf("test %d: %s at %v", i, test.url, test.at)
+		url := charm.MustParseReference(test.url)
+		err := v4.ResolveURLAt(s.store, url, params.NoChannel, test.at)
+		if test.expect == "" {
+			c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(url.String(), gc.Equals, test.expect)
+	}
+
+	query := "?at=" + at.UTC().Format(time.RFC3339)
+	s.assertGet(c, "wordpress/meta/id-revision"+query, params.IdRevisionResponse{
+		Revision: 0,
+	})
+	s.assertGet(c, "wordpress/expand-id"+query, []params.ExpandedId{
+		{Id: "cs:trusty/wordpress-0"},
+	})
+	s.assertGet(c, "wordpress/meta/revision-info"+query, params.RevisionInfoResponse{
+		Revisions: []*charm.Reference{
+			charm.MustParseReference("cs:trusty/wordpress-0"),
+		},
+	})
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("trusty/wordpress-1/meta/id" + query),
+		ExpectStatus: http.StatusNotFound,
+		ExpectBody: params.Error{
+			Code:    params.ErrNotFound,
+			Message: `no matching charm or bundle for "cs:trusty/wordpress-1"`,
+		},
+	})
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("wordpress/meta/id?at=yesterday"),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid at parameter: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+		},
+	})
+}
+
+// setEntityTime sets the upload, promulgation and stable channel
+// publication times of the entity with the given id to t.
+func (s *APISuite) setEntityTime(c *gc.C, id string, t time.Time) {
+	err := s.store.UpdateEntity(charm.MustParseReference(id), bson.D{{
+		"$set", bson.D{
+			{"uploadtime", t},
+			{"promulgated-time", t},
+			{charmstore.ChannelTimeField(params.StableChannel), t},
+		},
+	}})
+	c.Assert(err, gc.IsNil)
+}
+
 var metaStatsTests = []struct {
 	// about describes the test.
 	about string
@@ -1774,6 +2176,13 @@ var changesPublishedErrorsTests = []struct {
 		Message: `invalid 'stop' value "baddate": parsing time "baddate" as "2006-01-02": cannot parse "baddate" as "2006"`,
 	},
 	status: http.StatusBadRequest,
+}, {
+	args: "?channel=beta",
+	expect: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: `invalid channel "beta"`,
+	},
+	status: http.StatusBadRequest,
 }}
 
 func (s *APISuite) TestChangesPublishedErrors(c *gc.C) {
@@ -1795,7 +2204,10 @@ func (s *APISuite) publishCharmsAtKnownTimes(c *gc.C, charms []publishSpec) {
 	for _, ch := range publishedCharms {
 		id, _ := s.addCharm(c, "wordpress", ch.id)
 		t := ch.published().PublishTime
-		err := s.store.UpdateEntity(id, bson.D{{"$set", bson.D{{"uploadtime", t}}}})
+		err := s.store.UpdateEntity(id, bson.D{{"$set", bson.D{
+			{"uploadtime", t},
+			{"published.stable", t},
+		}}})
 		c.Assert(err, gc.IsNil)
 	}
 }
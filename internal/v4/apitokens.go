@@ -0,0 +1,270 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// maxAPITokenLifetime holds the maximum duration
+// for which an API token can be valid.
+const maxAPITokenLifetime = 365 * 24 * time.Hour
+
+// apiTokenOperations holds the valid API token operations.
+var apiTokenOperations = map[string]bool{
+	params.TokenRead:      true,
+	params.TokenUpload:    true,
+	params.TokenMetaWrite: true,
+}
+
+// GET tokens
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-tokens
+//
+// POST tokens
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-tokens
+//
+// DELETE tokens/id
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#delete-tokensid
+func (h *Handler) serveAPITokens(_ http.Header, req *http.Request) (interface{}, error) {
+	auth, err := h.authenticate(req, params.OperationAdmin, nil)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	if auth.Token != nil {
+		return nil, errgo.WithCausef(nil, params.ErrUnauthorized, "API tokens cannot be used to manage API tokens")
+	}
+	user := auth.Username
+	if auth.Admin {
+		user = req.Form.Get("user")
+	}
+	id := strings.TrimPrefix(req.URL.Path, "/")
+	switch req.Method {
+	case "GET":
+		if id != "" {
+			return nil, errgo.WithCausef(nil, params.ErrNotFound, "")
+		}
+		return h.getAPITokens(user)
+	case "POST":
+		if id != "" {
+			return nil, errgo.WithCausef(nil, params.ErrNotFound, "")
+		}
+		return h.postAPIToken(auth, req)
+	case "DELETE":
+		if id == "" {
+			return nil, params.ErrMethodNotAllowed
+		}
+		if err := h.store.RemoveAPIToken(user, id); err != nil {
+			return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		return nil, nil
+	}
+	return nil, params.ErrMethodNotAllowed
+}
+
+func (h *Handler) getAPITokens(user string) (interface{}, error) {
+	if user == "" {
+		return nil, badRequestf(nil, "user not specified")
+	}
+	tokens, err := h.store.APITokens(user)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	response := make([]params.APIToken, len(tokens))
+	for i, t := range tokens {
+		response[i] = apiTokenResponse(t)
+	}
+	return response, nil
+}
+
+func (h *Handler) postAPIToken(auth authorization, req *http.Request) (interface{}, error) {
+	var treq params.APITokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&treq); err != nil {
+		return nil, badRequestf(err, "cannot unmarshal token request")
+	}
+	user := auth.Username
+	if treq.User != "" && treq.User != user {
+		if !auth.Admin {
+			return nil, errgo.WithCausef(nil, params.ErrUnauthorized, "cannot create API tokens for another user")
+		}
+		user = treq.User
+	}
+	if user == "" {
+		return nil, badRequestf(nil, "user not specified")
+	}
+	if len(treq.Operations) == 0 {
+		return nil, badRequestf(nil, "no operations specified")
+	}
+	for _, op := range treq.Operations {
+		if !apiTokenOperations[op] {
+			return nil, badRequestf(nil, "invalid operation %q", op)
+		}
+	}
+	now := time.Now()
+	if !treq.Expires.After(now) {
+		return nil, badRequestf(nil, "expiry time must be in the future")
+	}
+	if treq.Expires.After(now.Add(maxAPITokenLifetime)) {
+		return nil, badRequestf(nil, "expiry time must be within %v", maxAPITokenLifetime)
+	}
+	scope, err := parseAPITokenScope(treq.Scope, user)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	t := &mongodoc.APIToken{
+		User:        user,
+		Description: treq.Description,
+		Operations:  treq.Operations,
+		Scope:       scope,
+		Expires:     treq.Expires.UTC(),
+	}
+	token, err := h.store.AddAPIToken(t)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	response := apiTokenResponse(t)
+	response.Token = token
+	return response, nil
+}
+
+// parseAPITokenScope validates the given API token scope for a token
+// owned by the given user, and returns its canonical form.
+func parseAPITokenScope(scope, user string) (string, error) {
+	if scope == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(scope, "~") && !strings.Contains(scope, "/") {
+		if scope[1:] != user {
+			return "", badRequestf(nil, "scope %q is not in the namespace of user %q", scope, user)
+		}
+		return scope, nil
+	}
+	ref, err := charm.ParseReference(scope)
+	if err != nil {
+		return "", badRequestf(err, "invalid scope")
+	}
+	if ref.User != user {
+		return "", badRequestf(nil, "scope %q is not in the namespace of user %q", scope, user)
+	}
+	return ref.String(), nil
+}
+
+func apiTokenResponse(t *mongodoc.APIToken) params.APIToken {
+	return params.APIToken{
+		Id:          t.Id,
+		User:        t.User,
+		Description: t.Description,
+		Operations:  t.Operations,
+		Scope:       t.Scope,
+		Created:     t.Created,
+		Expires:     t.Expires,
+	}
+}
+
+// apiTokenOperation returns the API token operation allowing the given
+// operation (one of the op* constants). Deleting entities and changing
+// their permissions or promulgation are never allowed with API tokens,
+// so false is returned for those operations.
+func apiTokenOperation(op string) (string, bool) {
+	switch op {
+	case opRead:
+		return params.TokenRead, true
+	case opUpload:
+		return params.TokenUpload, true
+	case opWrite:
+		return params.TokenMetaWrite, true
+	}
+	return "", false
+}
+
+// checkAPITokenScope checks that the given API token allows the given
+// operation on the entity with the given id, which is nil when the
+// request does not refer to an entity.
+func (h *Handler) checkAPITokenScope(t *mongodoc.APIToken, op string, id *charm.Reference) error {
+	tokenOp, ok := apiTokenOperation(op)
+	if !ok {
+		return errgo.WithCausef(nil, params.ErrUnauthorized, "API tokens cannot be used for %s operations", op)
+	}
+	allowed := false
+	for _, o := range t.Operations {
+		if o == tokenOp {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return errgo.WithCausef(nil, params.ErrUnauthorized, "API token does not allow %s operations", tokenOp)
+	}
+	if t.Scope == "" {
+		return nil
+	}
+	if id == nil {
+		return errgo.WithCausef(nil, params.ErrUnauthorized, "API token restricted to %s", t.Scope)
+	}
+	ownedId, err := h.ownedId(id)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if !apiTokenScopeMatches(t.Scope, ownedId) {
+		return errgo.WithCausef(nil, params.ErrUnauthorized, "API token restricted to %s", t.Scope)
+	}
+	return nil
+}
+
+// ownedId returns the given id, including the name of the entity owner.
+// If the id refers to a promulgated entity, the owner is retrieved
+// from the database.
+func (h *Handler) ownedId(id *charm.Reference) (*charm.Reference, error) {
+	if id.User != "" {
+		return id, nil
+	}
+	if id.Series != "" && id.Revision != -1 {
+		entity, err := h.store.FindEntity(id, "_id")
+		if err == nil {
+			return entity.URL, nil
+		}
+		if errgo.Cause(err) != params.ErrNotFound {
+			return nil, errgo.Mask(err)
+		}
+	}
+	baseEntity, err := h.store.FindBaseEntity(id, "user")
+	if err != nil {
+		if errgo.Cause(err) == params.ErrNotFound {
+			// The entity does not exist yet, and promulgated
+			// entities cannot be uploaded with a token.
+			return id, nil
+		}
+		return nil, errgo.Mask(err)
+	}
+	ownedId := *id
+	ownedId.User = baseEntity.User
+	// The revision of a promulgated id does
+	// not correspond to the owned revision.
+	ownedId.Revision = -1
+	return &ownedId, nil
+}
+
+// apiTokenScopeMatches reports whether the given id
+// is included in the given API token scope.
+func apiTokenScopeMatches(scope string, id *charm.Reference) bool {
+	if strings.HasPrefix(scope, "~") {
+		return scope[1:] == id.User
+	}
+	ref, err := charm.ParseReference(scope)
+	if err != nil {
+		return false
+	}
+	return ref.User == id.User &&
+		ref.Name == id.Name &&
+		(ref.Series == "" || ref.Series == id.Series) &&
+		(ref.Revision == -1 || ref.Revision == id.Revision)
+}
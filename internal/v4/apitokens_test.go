@@ -0,0 +1,373 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// createAPIToken creates an API token using the administrator credentials.
+func (s *APISuite) createAPIToken(c *gc.C, treq params.APITokenRequest) params.APIToken {
+	body, err := json.Marshal(treq)
+	c.Assert(err, gc.IsNil)
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler:  s.srv,
+		URL:      storeURL("tokens"),
+		Method:   "POST",
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body: bytes.NewReader(body),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var t params.APIToken
+	err = json.Unmarshal(rec.Body.Bytes(), &t)
+	c.Assert(err, gc.IsNil)
+	return t
+}
+
+func (s *APISuite) TestCreateAPIToken(c *gc.C) {
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	t := s.createAPIToken(c, params.APITokenRequest{
+		User:        "bob",
+		Description: "ci uploads",
+		Operations:  []string{params.TokenUpload, params.TokenMetaWrite},
+		Scope:       "~bob",
+		Expires:     expires,
+	})
+	c.Assert(t.Id, gc.Not(gc.Equals), "")
+	c.Assert(t.Token, gc.Matches, t.Id+`\..+`)
+	c.Assert(t.User, gc.Equals, "bob")
+	c.Assert(t.Description, gc.Equals, "ci uploads")
+	c.Assert(t.Operations, gc.DeepEquals, []string{params.TokenUpload, params.TokenMetaWrite})
+	c.Assert(t.Scope, gc.Equals, "~bob")
+	c.Assert(t.Expires.Equal(expires), gc.Equals, true)
+
+	// Only the hash of the token is stored.
+	var doc mongodoc.APIToken
+	err := s.store.DB.APITokens().FindId(t.Id).One(&doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc.Hash, gc.Not(gc.Equals), "")
+	c.Assert(bytes.Contains([]byte(t.Token), []byte(doc.Hash)), gc.Equals, false)
+
+	// The token is included in the list of the user's tokens,
+	// without the token secret.
+	t.Token = ""
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler:  s.srv,
+		URL:      storeURL("tokens?user=bob"),
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	var tokens []params.APIToken
+	err = json.Unmarshal(rec.Body.Bytes(), &tokens)
+	c.Assert(err, gc.IsNil)
+	c.Assert(tokens, gc.HasLen, 1)
+	c.Assert(tokens[0].Id, gc.Equals, t.Id)
+	c.Assert(tokens[0].Token, gc.Equals, "")
+}
+
+var createAPITokenErrorsTests = []struct {
+	about       string
+	request     params.APITokenRequest
+	expectError string
+}{{
+	about: "no user",
+	request: params.APITokenRequest{
+		Operations: []string{params.TokenRead},
+		Expires:    time.Now().Add(time.Hour),
+	},
+	expectError: "user not specified",
+}, {
+	about: "no operations",
+	request: params.APITokenRequest{
+		User:    "bob",
+		Expires: time.Now().Add(time.Hour),
+	},
+	expectError: "no operations specified",
+}, {
+	about: "invalid operation",
+	request: params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{"destroy"},
+		Expires:    time.Now().Add(time.Hour),
+	},
+	expectError: `invalid operation "destroy"`,
+}, {
+	about: "expiry in the past",
+	request: params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{params.TokenRead},
+		Expires:    time.Now().Add(-time.Hour),
+	},
+	expectError: "expiry time must be in the future",
+}, {
+	about: "expiry too far in the future",
+	request: params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{params.TokenRead},
+		Expires:    time.Now().Add(400 * 24 * time.Hour),
+	},
+	expectError: "expiry time must be within 8760h0m0s",
+}, {
+	about: "scope in another namespace",
+	request: params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{params.TokenRead},
+		Scope:      "~alice",
+		Expires:    time.Now().Add(time.Hour),
+	},
+	expectError: `scope "~alice" is not in the namespace of user "bob"`,
+}, {
+	about: "entity scope in another namespace",
+	request: params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{params.TokenRead},
+		Scope:      "trusty/wordpress",
+		Expires:    time.Now().Add(time.Hour),
+	},
+	expectError: `scope "trusty/wordpress" is not in the namespace of user "bob"`,
+}}
+
+func (s *APISuite) TestCreateAPITokenErrors(c *gc.C) {
+	for i, test := range createAPITokenErrorsTests {
+		c.Logf("test %d: %s", i, test.about)
+		body, err := json.Marshal(test.request)
+		c.Assert(err, gc.IsNil)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:  s.srv,
+			URL:      storeURL("tokens"),
+			Method:   "POST",
+			Username: serverParams.AuthUsername,
+			Password: serverParams.AuthPassword,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body:         bytes.NewReader(body),
+			ExpectStatus: http.StatusBadRequest,
+			ExpectBody: params.Error{
+				Code:    params.ErrBadRequest,
+				Message: test.expectError,
+			},
+		})
+	}
+}
+
+var apiTokenAuthorizationTests = []struct {
+	about       string
+	operations  []string
+	scope       string
+	expectError string
+}{{
+	about:      "token for all the user's entities",
+	operations: []string{params.TokenMetaWrite},
+}, {
+	about:      "token restricted to the user's namespace",
+	operations: []string{params.TokenMetaWrite},
+	scope:      "~bob",
+}, {
+	about:      "token restricted to the entity",
+	operations: []string{params.TokenMetaWrite},
+	scope:      "~bob/wordpress",
+}, {
+	about:       "token restricted to another entity",
+	operations:  []string{params.TokenMetaWrite},
+	scope:       "~bob/precise/mysql",
+	expectError: "API token restricted to cs:~bob/precise/mysql",
+}, {
+	about:       "token not allowing the operation",
+	operations:  []string{params.TokenRead, params.TokenUpload},
+	expectError: "API token does not allow meta-write operations",
+}}
+
+func (s *APISuite) TestAPITokenAuthorization(c *gc.C) {
+	s.addCharm(c, "wordpress", "~bob/precise/wordpress-1")
+	body := []byte(`"value"`)
+	for i, test := range apiTokenAuthorizationTests {
+		c.Logf("test %d: %s", i, test.about)
+		t := s.createAPIToken(c, params.APITokenRequest{
+			User:       "bob",
+			Operations: test.operations,
+			Scope:      test.scope,
+			Expires:    time.Now().Add(time.Hour),
+		})
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: s.srv,
+			URL:     storeURL("~bob/precise/wordpress-1/meta/extra-info/key"),
+			Method:  "PUT",
+			Header: http.Header{
+				"Authorization": {"Bearer " + t.Token},
+				"Content-Type":  {"application/json"},
+			},
+			Body: bytes.NewReader(body),
+		})
+		if test.expectError == "" {
+			c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+			continue
+		}
+		c.Assert(rec.Code, gc.Equals, http.StatusUnauthorized)
+		var perr params.Error
+		err := json.Unmarshal(rec.Body.Bytes(), &perr)
+		c.Assert(err, gc.IsNil)
+		c.Assert(perr, gc.DeepEquals, params.Error{
+			Code:    params.ErrUnauthorized,
+			Message: test.expectError,
+		})
+	}
+}
+
+var apiTokenAdminOperationsTests = []struct {
+	about       string
+	method      string
+	path        string
+	body        string
+	expectError string
+}{{
+	about:       "delete archive",
+	method:      "DELETE",
+	path:        "~bob/precise/wordpress-1/archive",
+	expectError: "API tokens cannot be used for delete operations",
+}, {
+	about:       "change permissions",
+	method:      "PUT",
+	path:        "~bob/precise/wordpress-1/meta/perm/read",
+	body:        `["everyone"]`,
+	expectError: "API tokens cannot be used for admin operations",
+}, {
+	about:       "change aliases",
+	method:      "PUT",
+	path:        "~bob/precise/wordpress-1/meta/aliases",
+	body:        `["wp"]`,
+	expectError: "API tokens cannot be used for admin operations",
+}}
+
+func (s *APISuite) TestAPITokenAdminOperations(c *gc.C) {
+	s.addCharm(c, "wordpress", "~bob/precise/wordpress-1")
+	t := s.createAPIToken(c, params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{params.TokenRead, params.TokenUpload, params.TokenMetaWrite},
+		Expires:    time.Now().Add(time.Hour),
+	})
+	for i, test := range apiTokenAdminOperationsTests {
+		c.Logf("test %d: %s", i, test.about)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL(test.path),
+			Method:  test.method,
+			Header: http.Header{
+				"Authorization": {"Bearer " + t.Token},
+				"Content-Type":  {"application/json"},
+			},
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: http.StatusUnauthorized,
+			ExpectBody: params.Error{
+				Code:    params.ErrUnauthorized,
+				Message: test.expectError,
+			},
+		})
+	}
+	_, err := s.store.FindEntity(charm.MustParseReference("~bob/precise/wordpress-1"))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *APISuite) TestAPITokenExpired(c *gc.C) {
+	s.addCharm(c, "wordpress", "~bob/precise/wordpress-1")
+	token, err := s.store.AddAPIToken(&mongodoc.APIToken{
+		User:       "bob",
+		Operations: []string{params.TokenMetaWrite},
+		Expires:    time.Now().Add(-time.Minute),
+	})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~bob/precise/wordpress-1/meta/extra-info/key"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Authorization": {"Bearer " + token},
+			"Content-Type":  {"application/json"},
+		},
+		Body:         bytes.NewReader([]byte(`"value"`)),
+		ExpectStatus: http.StatusUnauthorized,
+		ExpectBody: params.Error{
+			Code:    params.ErrUnauthorized,
+			Message: "API token expired",
+		},
+	})
+}
+
+func (s *APISuite) TestRevokeAPIToken(c *gc.C) {
+	s.addCharm(c, "wordpress", "~bob/precise/wordpress-1")
+	t := s.createAPIToken(c, params.APITokenRequest{
+		User:       "bob",
+		Operations: []string{params.TokenMetaWrite},
+		Expires:    time.Now().Add(time.Hour),
+	})
+	// API tokens cannot be used to manage tokens.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("tokens/" + t.Id),
+		Method:  "DELETE",
+		Header: http.Header{
+			"Authorization": {"Bearer " + t.Token},
+		},
+		ExpectStatus: http.StatusUnauthorized,
+		ExpectBody: params.Error{
+			Code:    params.ErrUnauthorized,
+			Message: "API tokens cannot be used to manage API tokens",
+		},
+	})
+
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:  s.srv,
+		URL:      storeURL("tokens/" + t.Id + "?user=bob"),
+		Method:   "DELETE",
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+	})
+
+	// The token can no longer be used.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~bob/precise/wordpress-1/meta/extra-info/key"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Authorization": {"Bearer " + t.Token},
+			"Content-Type":  {"application/json"},
+		},
+		Body:         bytes.NewReader([]byte(`"value"`)),
+		ExpectStatus: http.StatusUnauthorized,
+		ExpectBody: params.Error{
+			Code:    params.ErrUnauthorized,
+			Message: "invalid API token",
+		},
+	})
+
+	// Revoking the token again fails.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("tokens/" + t.Id + "?user=bob"),
+		Method:       "DELETE",
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		ExpectStatus: http.StatusNotFound,
+		ExpectBody: params.Error{
+			Code:    params.ErrNotFound,
+			Message: `API token "` + t.Id + `" not found`,
+		},
+	})
+}
@@ -9,8 +9,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
 	"sort"
@@ -24,6 +26,7 @@ import (
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"gopkg.in/juju/charmstore.v4/internal/blobstore"
 	"gopkg.in/juju/charmstore.v4/internal/charmstore"
 	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
 	"gopkg.in/juju/charmstore.v4/params"
@@ -65,6 +68,20 @@ func (h *Handler) serveArchive(id *charm.Reference, fullySpecified bool, w http.
 	setArchiveCacheControl(w.Header(), fullySpecified)
 	header.Set(params.ContentHashHeader, hash)
 	header.Set(params.EntityIdHeader, id.String())
+	deprecation, err := h.store.Deprecation(id)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if deprecation != nil {
+		header.Set(params.WarningHeader, fmt.Sprintf("299 charmstore %q", charmstore.DeprecationWarning(id, deprecation)))
+	}
+	advisories, err := h.advisoryHeader(id)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if advisories != "" {
+		header.Set(params.AdvisoriesHeader, advisories)
+	}
 
 	if StatsEnabled(req) {
 		h.store.IncrementDownloadCountsAsync(id)
@@ -76,20 +93,23 @@ func (h *Handler) serveArchive(id *charm.Reference, fullySpecified bool, w http.
 }
 
 func (h *Handler) serveDeleteArchive(id *charm.Reference, w http.ResponseWriter, req *http.Request) error {
-	// Retrieve the entity blob name from the database.
-	blobName, _, err := h.store.BlobNameAndHash(id)
+	force, err := parseBool(req.Form.Get("force"))
 	if err != nil {
-		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		return badRequestf(err, "invalid force parameter")
 	}
-	// Remove the entity.
-	if err := h.store.DB.Entities().RemoveId(id); err != nil {
-		return errgo.Notef(err, "cannot remove %s", id)
+	if !force {
+		// Refuse to delete charms that public bundles depend on.
+		if err := h.checkDeleteDependents(id); err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrNotFound), errgo.Is(params.ErrForbidden))
+		}
 	}
-	// Remove the reference to the archive from the blob store.
-	if err := h.store.BlobStore.Remove(blobName); err != nil {
-		return errgo.Notef(err, "cannot remove blob %s", blobName)
+	if err := h.store.DeleteEntity(id); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
 	}
-	h.store.IncCounterAsync(charmstore.EntityStatsKey(id, params.StatsArchiveDelete))
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditDelete,
+		Entity:    id,
+	})
 	return nil
 }
 
@@ -105,23 +125,22 @@ func (h *Handler) updateStatsArchiveUpload(id *charm.Reference, err *error) {
 }
 
 func (h *Handler) servePostArchive(id *charm.Reference, w http.ResponseWriter, req *http.Request) (err error) {
-	defer h.updateStatsArchiveUpload(id, &err)
-
-	if id.Series == "" {
-		return badRequestf(nil, "series not specified")
-	}
-	if id.Revision != -1 {
-		return badRequestf(nil, "revision specified, but should not be specified")
+	dryRun, err := parseBool(req.Form.Get("dry-run"))
+	if err != nil {
+		return badRequestf(err, "invalid dry-run parameter")
 	}
-	if id.User == "" {
-		return badRequestf(nil, "user not specified")
+	if dryRun {
+		return h.servePostArchiveDryRun(id, w, req)
 	}
-	hash := req.Form.Get("hash")
-	if hash == "" {
-		return badRequestf(nil, "hash parameter not specified")
+	defer h.updateStatsArchiveUpload(id, &err)
+
+	hash, err := checkPostArchiveRequest(id, req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
 	}
-	if req.ContentLength == -1 {
-		return badRequestf(nil, "Content-Length not specified")
+	pub, err := parsePublication(req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
 	}
 
 	oldId, oldHash, err := h.latestRevisionInfo(id)
@@ -136,6 +155,10 @@ func (h *Handler) servePostArchive(id *charm.Reference, w http.ResponseWriter, r
 		})
 	}
 
+	if err := h.checkStorageQuota(id.User, req.ContentLength); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrQuotaExceeded))
+	}
+
 	// Find the promulgated URL for the entity. Note: if the entity is not promulgated,
 	// getPromulgatedURL returns nil.
 	pid, err := h.getPromulgatedURL(id)
@@ -150,14 +173,188 @@ func (h *Handler) servePostArchive(id *charm.Reference, w http.ResponseWriter, r
 		id.Revision = 0
 	}
 
-	if err := h.addBlobAndEntity(id, pid, req.Body, hash, req.ContentLength); err != nil {
+	if err := h.addBlobAndEntity(id, pid, pub, req.Body, hash, req.ContentLength); err != nil {
 		return errgo.Mask(err, errgo.Is(params.ErrDuplicateUpload))
 	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditUpload,
+		Entity:    id,
+	})
 	return jsonhttp.WriteJSON(w, http.StatusOK, &params.ArchiveUploadResponse{
 		Id: id,
 	})
 }
 
+// publication holds where and when an uploaded
+// charm or bundle is published.
+type publication struct {
+	channels  []params.Channel
+	publishAt time.Time
+}
+
+// parsePublication returns the publication specified by the channel
+// and publish-at parameters of the given upload request.
+func parsePublication(req *http.Request) (publication, error) {
+	channels, err := requestChannels(req)
+	if err != nil {
+		return publication{}, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	pub := publication{
+		channels: channels,
+	}
+	if s := req.Form.Get("publish-at"); s != "" {
+		pub.publishAt, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return publication{}, badRequestf(err, "invalid publish-at parameter")
+		}
+	}
+	return pub, nil
+}
+
+// checkPostArchiveRequest checks that the given POST id/archive request
+// is well formed and returns the hash specified in the request.
+func checkPostArchiveRequest(id *charm.Reference, req *http.Request) (string, error) {
+	if id.Series == "" {
+		return "", badRequestf(nil, "series not specified")
+	}
+	if id.Revision != -1 {
+		return "", badRequestf(nil, "revision specified, but should not be specified")
+	}
+	if id.User == "" {
+		return "", badRequestf(nil, "user not specified")
+	}
+	hash := req.Form.Get("hash")
+	if hash == "" {
+		return "", badRequestf(nil, "hash parameter not specified")
+	}
+	if req.ContentLength == -1 {
+		return "", badRequestf(nil, "Content-Length not specified")
+	}
+	return hash, nil
+}
+
+// servePostArchiveDryRun serves a POST id/archive?dry-run=1 request.
+// The archive is read and verified as for a normal upload, but
+// neither the blob nor the entity are stored. The response holds the
+// id that the archive would be given, its hashes and any problems
+// found with its contents.
+func (h *Handler) servePostArchiveDryRun(id *charm.Reference, w http.ResponseWriter, req *http.Request) error {
+	hash, err := checkPostArchiveRequest(id, req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	// Spool the archive to a temporary file rather than to memory,
+	// as the archive size is chosen by the client.
+	f, err := ioutil.TempFile("", "charmstore-dry-run")
+	if err != nil {
+		return errgo.Notef(err, "cannot create temporary file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	hash384 := blobstore.NewHash()
+	hash256 := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash384, hash256), io.LimitReader(req.Body, req.ContentLength))
+	if err != nil {
+		return errgo.Notef(err, "cannot read archive")
+	}
+	if size != req.ContentLength {
+		return badRequestf(nil, "archive size does not match Content-Length")
+	}
+	response := &params.ArchiveDryRunResponse{
+		Hash:    fmt.Sprintf("%x", hash384.Sum(nil)),
+		Hash256: fmt.Sprintf("%x", hash256.Sum(nil)),
+		Size:    size,
+	}
+	if response.Hash != hash {
+		response.Errors = []string{"hash mismatch"}
+		return jsonhttp.WriteJSON(w, http.StatusOK, response)
+	}
+
+	oldId, oldHash, err := h.latestRevisionInfo(id)
+	if err != nil && errgo.Cause(err) != params.ErrNotFound {
+		return errgo.Notef(err, "cannot get hash of latest revision")
+	}
+	if oldHash == hash {
+		// An actual upload would return the latest revision
+		// without creating a new one.
+		response.Id = oldId
+		return jsonhttp.WriteJSON(w, http.StatusOK, response)
+	}
+	pid, err := h.getPromulgatedURL(id)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if oldId != nil {
+		id.Revision = oldId.Revision + 1
+	} else {
+		id.Revision = 0
+	}
+	response.Id = id
+	response.PromulgatedId = pid
+	response.Errors, err = h.verifyArchive(id, f, response.Size)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	// Report an exceeded quota as the actual upload would fail.
+	if err := h.checkStorageQuota(id.User, size); err != nil {
+		if errgo.Cause(err) != params.ErrQuotaExceeded {
+			return errgo.Mask(err)
+		}
+		response.Errors = append(response.Errors, err.Error())
+	}
+	return jsonhttp.WriteJSON(w, http.StatusOK, response)
+}
+
+// verifyArchive reads the charm or bundle archive held in r and checks
+// that it would be accepted as the given id. Problems with the archive
+// are returned as a list of messages. The returned error is non-nil
+// only if the verification could not be performed.
+func (h *Handler) verifyArchive(id *charm.Reference, r io.ReaderAt, size int64) ([]string, error) {
+	isBundle := id.Series == "bundle"
+	var messages []string
+	if isBundle {
+		b, err := charm.ReadBundleArchiveFromReader(r, size)
+		if err != nil {
+			return []string{"cannot read bundle archive: " + err.Error()}, nil
+		}
+		err = h.verifyBundle(b.Data())
+		if verr, ok := err.(*charm.VerificationError); ok {
+			messages = verificationMessages(verr)
+		} else if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	} else {
+		ch, err := charm.ReadCharmArchiveFromReader(r, size)
+		if err != nil {
+			return []string{"cannot read charm archive: " + err.Error()}, nil
+		}
+		if err := checkCharmIsValid(ch); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	// Check that a charm would not duplicate the name of a bundle,
+	// or vice versa, as done by the store when adding the entity.
+	base := *id
+	base.Series = ""
+	base.Revision = -1
+	entities, err := h.store.FindEntities(&base, "_id")
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot check for existing entities")
+	}
+	for _, e := range entities {
+		if isBundle != (e.URL.Series == "bundle") {
+			if isBundle {
+				messages = append(messages, fmt.Sprintf("bundle name duplicates charm name %s", e.URL))
+			} else {
+				messages = append(messages, fmt.Sprintf("charm name duplicates bundle name %v", e.URL))
+			}
+			break
+		}
+	}
+	return messages, nil
+}
+
 func (h *Handler) servePutArchive(id *charm.Reference, w http.ResponseWriter, req *http.Request) (err error) {
 	defer h.updateStatsArchiveUpload(id, &err)
 	if id.Series == "" {
@@ -176,6 +373,10 @@ func (h *Handler) servePutArchive(id *charm.Reference, w http.ResponseWriter, re
 	if req.ContentLength == -1 {
 		return badRequestf(nil, "Content-Length not specified")
 	}
+	pub, err := parsePublication(req)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
 	// Get the PromulgatedURL from the request parameters. When ingesting
 	// entities might not be added in order and the promulgated revision might
 	// not match the non-promulgated revision, so the full promulgated URL
@@ -194,9 +395,13 @@ func (h *Handler) servePutArchive(id *charm.Reference, w http.ResponseWriter, re
 			return badRequestf(nil, "promulgated URL has incorrect charm name")
 		}
 	}
-	if err := h.addBlobAndEntity(id, pid, req.Body, hash, req.ContentLength); err != nil {
+	if err := h.addBlobAndEntity(id, pid, pub, req.Body, hash, req.ContentLength); err != nil {
 		return errgo.Mask(err, errgo.Is(params.ErrDuplicateUpload))
 	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditUpload,
+		Entity:    id,
+	})
 	return jsonhttp.WriteJSON(w, http.StatusOK, &params.ArchiveUploadResponse{
 		Id: id,
 	})
@@ -204,10 +409,11 @@ func (h *Handler) servePutArchive(id *charm.Reference, w http.ResponseWriter, re
 }
 
 // addBlobAndEntity streams the contents of the given body
-// to the blob store and adds an entity record for it.
+// to the blob store and adds an entity record for it,
+// published as specified by pub.
 // The hash and contentLength parameters hold
 // the content hash and the content length respectively.
-func (h *Handler) addBlobAndEntity(id, pid *charm.Reference, body io.Reader, hash string, contentLength int64) (err error) {
+func (h *Handler) addBlobAndEntity(id, pid *charm.Reference, pub publication, body io.Reader, hash string, contentLength int64) (err error) {
 	name := bson.NewObjectId().Hex()
 
 	// Calculate the SHA256 hash while uploading the blob in the blob store.
@@ -234,15 +440,16 @@ func (h *Handler) addBlobAndEntity(id, pid *charm.Reference, body io.Reader, has
 
 	// Add the entity entry to the charm store.
 	sum256 := fmt.Sprintf("%x", hash256.Sum(nil))
-	if err := h.addEntity(id, pid, r, name, hash, sum256, contentLength); err != nil {
+	if err := h.addEntity(id, pid, pub, r, name, hash, sum256, contentLength); err != nil {
 		return errgo.Mask(err, errgo.Is(params.ErrDuplicateUpload))
 	}
 	return nil
 }
 
 // addEntity adds the entity represented by the contents
-// of the given reader, associating it with the given id.
-func (h *Handler) addEntity(id, pid *charm.Reference, r io.ReadSeeker, blobName, hash, hash256 string, contentLength int64) error {
+// of the given reader, associating it with the given id
+// and publishing it as specified by pub.
+func (h *Handler) addEntity(id, pid *charm.Reference, pub publication, r io.ReadSeeker, blobName, hash, hash256 string, contentLength int64) error {
 	promulgatedRevision := -1
 	if pid != nil {
 		promulgatedRevision = pid.Revision
@@ -256,20 +463,20 @@ func (h *Handler) addEntity(id, pid *charm.Reference, r io.ReadSeeker, blobName,
 		BlobSize:            contentLength,
 		PromulgatedURL:      pid,
 		PromulgatedRevision: promulgatedRevision,
+		Channels:            pub.channels,
+		PublishAt:           pub.publishAt,
 	}
 	if id.Series == "bundle" {
 		b, err := charm.ReadBundleArchiveFromReader(readerAt, contentLength)
 		if err != nil {
 			return errgo.Notef(err, "cannot read bundle archive")
 		}
-		bundleData := b.Data()
-		charms, err := h.bundleCharms(bundleData.RequiredCharms())
-		if err != nil {
-			return errgo.Notef(err, "cannot retrieve bundle charms")
-		}
-		if err := bundleData.VerifyWithCharms(verifyConstraints, charms); err != nil {
-			// TODO frankban: use multiError (defined in internal/router).
-			return errgo.Notef(verificationError(err), "bundle verification failed")
+		if err := h.verifyBundle(b.Data()); err != nil {
+			if _, ok := err.(*charm.VerificationError); ok {
+				// TODO frankban: use multiError (defined in internal/router).
+				return errgo.Notef(verificationError(err), "bundle verification failed")
+			}
+			return errgo.Mask(err)
 		}
 		if err := h.store.AddBundle(b, p); err != nil {
 			return errgo.Mask(err, errgo.Is(params.ErrDuplicateUpload))
@@ -289,6 +496,17 @@ func (h *Handler) addEntity(id, pid *charm.Reference, r io.ReadSeeker, blobName,
 	return nil
 }
 
+// verifyBundle checks that the given bundle data is valid, resolving
+// the charms it refers to from the store. A *charm.VerificationError
+// is returned, unmasked, if the bundle does not verify.
+func (h *Handler) verifyBundle(data *charm.BundleData) error {
+	charms, err := h.bundleCharms(data.RequiredCharms())
+	if err != nil {
+		return errgo.Notef(err, "cannot retrieve bundle charms")
+	}
+	return data.VerifyWithCharms(verifyConstraints, charms)
+}
+
 func checkCharmIsValid(ch charm.Charm) error {
 	m := ch.Meta()
 	for _, rels := range []map[string]charm.Relation{m.Provides, m.Requires, m.Peers} {
@@ -389,7 +607,7 @@ func (h *Handler) bundleCharms(ids []string) (map[string]charm.Charm, error) {
 			// be returned to the user along with other bundle errors.
 			continue
 		}
-		e, err := h.store.FindBestEntity(url)
+		e, err := h.store.FindBestEntity(url, params.NoChannel)
 		if err != nil {
 			if errgo.Cause(err) == params.ErrNotFound {
 				// Ignore this error too, for the same reasons
@@ -454,12 +672,7 @@ func verificationError(err error) error {
 	if !ok {
 		return err
 	}
-	messages := make([]string, len(verr.Errors))
-	for i, err := range verr.Errors {
-		messages[i] = err.Error()
-	}
-	sort.Strings(messages)
-	encodedMessages, err := json.Marshal(messages)
+	encodedMessages, err := json.Marshal(verificationMessages(verr))
 	if err != nil {
 		// This should never happen.
 		return err
@@ -467,6 +680,17 @@ func verificationError(err error) error {
 	return errgo.New(string(encodedMessages))
 }
 
+// verificationMessages returns the sorted error messages
+// held in the given verification error.
+func verificationMessages(verr *charm.VerificationError) []string {
+	messages := make([]string, len(verr.Errors))
+	for i, err := range verr.Errors {
+		messages[i] = err.Error()
+	}
+	sort.Strings(messages)
+	return messages
+}
+
 var (
 	// archiveCacheVersionedMaxAge specifies the cache expiry duration for items
 	// returned from the archive where the id is fully specified.
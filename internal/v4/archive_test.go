@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -458,6 +459,100 @@ func (s *ArchiveSuite) TestPostBundle(c *gc.C) {
 	s.assertUploadBundle(c, "POST", charm.MustParseReference("~charmers/bundle/wordpress-simple-2"), nil, "wordpress-simple")
 }
 
+func (s *ArchiveSuite) TestPostCharmDryRun(c *gc.C) {
+	s.assertUploadCharm(c, "POST", charm.MustParseReference("~charmers/precise/wordpress-0"), nil, "wordpress")
+
+	// A dry run with different content reports the next revision.
+	ch := storetesting.Charms.CharmArchive(c.MkDir(), "mysql")
+	s.assertDryRun(c, "~charmers/precise/wordpress", ch.Path, params.ArchiveDryRunResponse{
+		Id: charm.MustParseReference("cs:~charmers/precise/wordpress-1"),
+	})
+
+	// A dry run with the same content reports the existing revision.
+	ch = storetesting.Charms.CharmArchive(c.MkDir(), "wordpress")
+	s.assertDryRun(c, "~charmers/precise/wordpress", ch.Path, params.ArchiveDryRunResponse{
+		Id: charm.MustParseReference("cs:~charmers/precise/wordpress-0"),
+	})
+
+	// No new revision has been created.
+	count, err := s.store.DB.Entities().Count()
+	c.Assert(err, gc.IsNil)
+	c.Assert(count, gc.Equals, 1)
+}
+
+func (s *ArchiveSuite) TestPostBundleDryRun(c *gc.C) {
+	err := s.store.AddCharmWithArchive(
+		charm.MustParseReference("cs:~charmers/utopic/wordpress-47"),
+		charm.MustParseReference("cs:utopic/wordpress-47"),
+		storetesting.Charms.CharmArchive(c.MkDir(), "wordpress"))
+	c.Assert(err, gc.IsNil)
+
+	// The mysql charm referred to by the bundle is missing.
+	path := storetesting.Charms.BundleArchivePath(c.MkDir(), "wordpress-simple")
+	s.assertDryRun(c, "~charmers/bundle/wordpress-simple", path, params.ArchiveDryRunResponse{
+		Id: charm.MustParseReference("cs:~charmers/bundle/wordpress-simple-0"),
+		Errors: []string{
+			`service "mysql" refers to non-existent charm "mysql"`,
+		},
+	})
+
+	err = s.store.AddCharmWithArchive(
+		charm.MustParseReference("cs:~charmers/utopic/mysql-42"),
+		charm.MustParseReference("cs:utopic/mysql-42"),
+		storetesting.Charms.CharmArchive(c.MkDir(), "mysql"))
+	c.Assert(err, gc.IsNil)
+	s.assertDryRun(c, "~charmers/bundle/wordpress-simple", path, params.ArchiveDryRunResponse{
+		Id: charm.MustParseReference("cs:~charmers/bundle/wordpress-simple-0"),
+	})
+	count, err := s.store.DB.Entities().Find(bson.D{{"series", "bundle"}}).Count()
+	c.Assert(err, gc.IsNil)
+	c.Assert(count, gc.Equals, 0)
+}
+
+func (s *ArchiveSuite) TestPostDryRunInvalidCharm(c *gc.C) {
+	test := postInvalidCharmMetadataTests[0]
+	ch := charmtesting.NewCharm(c, test.spec)
+	path := filepath.Join(c.MkDir(), "foo.zip")
+	err := ioutil.WriteFile(path, ch.ArchiveBytes(), 0644)
+	c.Assert(err, gc.IsNil)
+	s.assertDryRun(c, "~charmers/trusty/foo", path, params.ArchiveDryRunResponse{
+		Id:     charm.MustParseReference("cs:~charmers/trusty/foo-0"),
+		Errors: []string{test.expectError},
+	})
+}
+
+// assertDryRun uploads the archive in the given file to the
+// given id with the dry-run flag set, and checks that the response
+// matches expect. The hash and size fields are filled in automatically.
+func (s *ArchiveSuite) assertDryRun(c *gc.C, id string, fileName string, expect params.ArchiveDryRunResponse) {
+	f, err := os.Open(fileName)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	hash := blobstore.NewHash()
+	hash256 := sha256.New()
+	size, err := io.Copy(io.MultiWriter(hash, hash256), f)
+	c.Assert(err, gc.IsNil)
+	_, err = f.Seek(0, 0)
+	c.Assert(err, gc.IsNil)
+	expect.Hash = fmt.Sprintf("%x", hash.Sum(nil))
+	expect.Hash256 = fmt.Sprintf("%x", hash256.Sum(nil))
+	expect.Size = size
+
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:       s.srv,
+		URL:           storeURL(id + "/archive?dry-run=1&hash=" + expect.Hash),
+		Method:        "POST",
+		ContentLength: size,
+		Header: http.Header{
+			"Content-Type": {"application/zip"},
+		},
+		Body:       f,
+		Username:   serverParams.AuthUsername,
+		Password:   serverParams.AuthPassword,
+		ExpectBody: expect,
+	})
+}
+
 func (s *ArchiveSuite) TestPostHashMismatch(c *gc.C) {
 	content := []byte("some content")
 	hash, _ := hashOf(bytes.NewReader(content))
@@ -646,6 +741,77 @@ func (s *ArchiveSuite) TestPostFailureCounters(c *gc.C) {
 	stats.CheckCounterSum(c, s.store, key, false, 3)
 }
 
+func (s *ArchiveSuite) TestPostStorageQuota(c *gc.C) {
+	wordpress := storetesting.Charms.CharmArchive(c.MkDir(), "wordpress")
+	wordpressInfo, err := os.Stat(wordpress.Path)
+	c.Assert(err, gc.IsNil)
+	mysql := storetesting.Charms.CharmArchive(c.MkDir(), "mysql")
+	f, err := os.Open(mysql.Path)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	hash, mysqlSize := hashOf(f)
+
+	// Allow a single archive in each namespace.
+	quota := wordpressInfo.Size() + 1
+	config := serverParams
+	config.StorageQuota = quota
+	s.srv, s.store = newServer(c, s.Session, nil, config)
+	s.assertUploadCharm(c, "POST", charm.MustParseReference("~charmers/precise/wordpress-0"), nil, "wordpress")
+
+	doPost := func(url string, expectStatus int, expectBody interface{}) {
+		_, err := f.Seek(0, 0)
+		c.Assert(err, gc.IsNil)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:       s.srv,
+			URL:           storeURL(url + "?hash=" + hash),
+			Method:        "POST",
+			ContentLength: mysqlSize,
+			Header: http.Header{
+				"Content-Type": {"application/zip"},
+			},
+			Body:         f,
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			ExpectStatus: expectStatus,
+			ExpectBody:   expectBody,
+		})
+	}
+	doPost("~charmers/precise/mysql/archive", http.StatusForbidden, params.Error{
+		Code:    params.ErrQuotaExceeded,
+		Message: fmt.Sprintf("storage quota exceeded for ~charmers: %d of %d bytes used, archive size %d", wordpressInfo.Size(), quota, mysqlSize),
+	})
+
+	// A dry run reports the exceeded quota.
+	s.assertDryRun(c, "~charmers/precise/mysql", mysql.Path, params.ArchiveDryRunResponse{
+		Id: charm.MustParseReference("cs:~charmers/precise/mysql-0"),
+		Errors: []string{
+			fmt.Sprintf("storage quota exceeded for ~charmers: %d of %d bytes used, archive size %d", wordpressInfo.Size(), quota, mysqlSize),
+		},
+	})
+
+	// Other namespaces are not affected.
+	doPost("~bob/precise/mysql/archive", http.StatusOK, params.ArchiveUploadResponse{
+		Id: charm.MustParseReference("~bob/precise/mysql-0"),
+	})
+
+	// The quota can be changed for a single namespace.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/meta/quota"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body:     strings.NewReader(`{"Quota": 0}`),
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	doPost("~charmers/precise/mysql/archive", http.StatusOK, params.ArchiveUploadResponse{
+		Id: charm.MustParseReference("~charmers/precise/mysql-0"),
+	})
+}
+
 func (s *ArchiveSuite) assertCannotUpload(c *gc.C, id string, content io.ReadSeeker, errorMessage string) {
 	hash, size := hashOf(content)
 	_, err := content.Seek(0, 0)
@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// maxAuditLimit holds the maximum number of audit records
+// returned by a single request.
+const maxAuditLimit = 1000
+
+// auditOperations holds the operations recorded in the audit log.
+var auditOperations = map[string]bool{
+	params.AuditUpload:                true,
+	params.AuditDelete:                true,
+	params.AuditSetPerm:               true,
+	params.AuditSetExtraInfo:          true,
+	params.AuditSetNamespacePerm:      true,
+	params.AuditSetNamespaceExtraInfo: true,
+	params.AuditSetNamespaceQuota:     true,
+	params.AuditCreateOrg:             true,
+	params.AuditSetOrgMember:          true,
+	params.AuditRemoveOrgMember:       true,
+	params.AuditTransfer:              true,
+	params.AuditSetAliases:            true,
+	params.AuditSetDeprecated:         true,
+	params.AuditPublish:               true,
+	params.AuditAddAdvisory:           true,
+	params.AuditSetNamespaceRetention: true,
+	params.AuditPrune:                 true,
+	params.AuditPruneReport:           true,
+	params.AuditShare:                 true,
+}
+
+// GET audit[?user=name][&entity=id][&operation=op][&after=time][&before=time][&limit=count][&skip=count]
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-audit
+func (h *Handler) serveAudit(_ http.Header, req *http.Request) (interface{}, error) {
+	if err := h.authorize(req, nil); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	if req.Method != "GET" {
+		return nil, params.ErrMethodNotAllowed
+	}
+	var q charmstore.AuditQuery
+	var err error
+	if q.Limit, err = limitValue(req.Form.Get("limit"), maxAuditLimit); err != nil {
+		return nil, badRequestf(err, "invalid limit value")
+	}
+	if q.Skip, err = intValue(req.Form.Get("skip"), 0, 0); err != nil {
+		return nil, badRequestf(err, "invalid skip value")
+	}
+	q.User = req.Form.Get("user")
+	if op := req.Form.Get("operation"); op != "" {
+		if !auditOperations[op] {
+			return nil, badRequestf(nil, "invalid operation %q", op)
+		}
+		q.Operation = op
+	}
+	if id := req.Form.Get("entity"); id != "" {
+		if q.Entity, err = charm.ParseReference(id); err != nil {
+			return nil, badRequestf(err, "invalid entity value")
+		}
+	}
+	for _, t := range []struct {
+		name string
+		time *time.Time
+	}{
+		{"after", &q.After},
+		{"before", &q.Before},
+	} {
+		if val := req.Form.Get(t.name); val != "" {
+			if *t.time, err = time.Parse(time.RFC3339, val); err != nil {
+				return nil, badRequestf(err, "invalid %s value", t.name)
+			}
+		}
+	}
+	entries, err := h.store.AuditEntries(q)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	response := make([]params.AuditEntry, len(entries))
+	for i, e := range entries {
+		response[i] = params.AuditEntry{
+			Time:       e.Time.UTC(),
+			User:       e.User,
+			Admin:      e.Admin,
+			TokenId:    e.TokenId,
+			Operation:  e.Operation,
+			Entity:     e.Entity,
+			Namespace:  e.Namespace,
+			Old:        auditRawValue(e.Old),
+			New:        auditRawValue(e.New),
+			ClientAddr: e.ClientAddr,
+		}
+	}
+	return response, nil
+}
+
+// addAudit records the given write operation, performed by the given
+// request. The user performing the operation is filled out from the
+// authorization that allowed the request, and the client address from
+// the request. Failures are logged, so that the operation, which has
+// already been performed, is not reported as failed.
+func (h *Handler) addAudit(req *http.Request, entry *mongodoc.AuditEntry) {
+	auth := h.requestAuth(req)
+	entry.User = auth.Username
+	entry.Admin = auth.Admin
+	if auth.Token != nil {
+		entry.TokenId = auth.Token.Id
+	}
+	entry.ClientAddr = req.RemoteAddr
+	if err := h.store.AddAudit(entry); err != nil {
+		logger.Errorf("cannot record %s operation: %v", entry.Operation, err)
+	}
+}
+
+// auditValue returns the JSON encoding of the given value,
+// to be stored as an old or new value of an audit entry.
+func auditValue(val interface{}) []byte {
+	data, err := json.Marshal(val)
+	if err != nil {
+		// This should never happen, as only values
+		// retrieved from the database are stored.
+		logger.Errorf("cannot marshal audit value: %v", err)
+		return nil
+	}
+	return data
+}
+
+// auditRawValue returns the given JSON encoded audit value as
+// a raw JSON message, or nil if there is no value.
+func auditRawValue(data []byte) *json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	raw := json.RawMessage(data)
+	return &raw
+}
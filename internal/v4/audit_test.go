@@ -0,0 +1,186 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// getAudit returns the audit entries returned by the given audit
+// request, with their times cleared so that they can be compared.
+func (s *APISuite) getAudit(c *gc.C, url string) []params.AuditEntry {
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler:  s.srv,
+		URL:      storeURL(url),
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var entries []params.AuditEntry
+	err := json.Unmarshal(rec.Body.Bytes(), &entries)
+	c.Assert(err, gc.IsNil)
+	for i := range entries {
+		c.Assert(entries[i].Time.IsZero(), jc.IsFalse)
+		entries[i].Time = time.Time{}
+	}
+	return entries
+}
+
+func rawJSON(s string) *json.RawMessage {
+	m := json.RawMessage(s)
+	return &m
+}
+
+func (s *APISuite) TestAudit(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/precise/wordpress-23")
+	start := time.Now().Add(-time.Second)
+	s.assertPut(c, "~charmers/precise/wordpress-23/meta/extra-info/key", "value")
+	s.assertPut(c, "~charmers/precise/wordpress-23/meta/perm/write", []string{"bob"})
+	s.assertPut(c, "~bob/meta/extra-info", map[string]string{"team": "bob"})
+
+	id := charm.MustParseReference("cs:~charmers/precise/wordpress-23")
+	extraInfoEntry := params.AuditEntry{
+		Admin:     true,
+		Operation: params.AuditSetExtraInfo,
+		Entity:    id,
+		Old:       rawJSON(`{}`),
+		New:       rawJSON(`{"key":"value"}`),
+	}
+	permEntry := params.AuditEntry{
+		Admin:     true,
+		Operation: params.AuditSetPerm,
+		Entity:    id,
+		Old:       rawJSON(`{"Read":["everyone","charmers"],"Write":["charmers"],"Upload":["charmers"],"Delete":["charmers"],"Admin":["charmers"],"Promulgate":["charmers"]}`),
+		New:       rawJSON(`{"Read":["everyone","charmers"],"Write":["bob"],"Upload":["charmers"],"Delete":["charmers"],"Admin":["charmers"],"Promulgate":["charmers"]}`),
+	}
+	namespaceEntry := params.AuditEntry{
+		Admin:     true,
+		Operation: params.AuditSetNamespaceExtraInfo,
+		Namespace: "bob",
+		Old:       rawJSON(`{}`),
+		New:       rawJSON(`{"team":"bob"}`),
+	}
+	for i, test := range []struct {
+		url          string
+		expectResult []params.AuditEntry
+	}{{
+		url:          "audit",
+		expectResult: []params.AuditEntry{namespaceEntry, permEntry, extraInfoEntry},
+	}, {
+		url:          "audit?limit=1&skip=1",
+		expectResult: []params.AuditEntry{permEntry},
+	}, {
+		url:          "audit?operation=set-perm",
+		expectResult: []params.AuditEntry{permEntry},
+	}, {
+		url:          "audit?entity=~charmers/wordpress",
+		expectResult: []params.AuditEntry{permEntry, extraInfoEntry},
+	}, {
+		url:          "audit?entity=~charmers/precise/wordpress-22",
+		expectResult: []params.AuditEntry{},
+	}, {
+		url:          "audit?user=bob",
+		expectResult: []params.AuditEntry{},
+	}, {
+		url:          "audit?after=" + start.UTC().Format(time.RFC3339),
+		expectResult: []params.AuditEntry{namespaceEntry, permEntry, extraInfoEntry},
+	}, {
+		url:          "audit?before=" + start.UTC().Format(time.RFC3339),
+		expectResult: []params.AuditEntry{},
+	}} {
+		c.Logf("test %d: %s", i, test.url)
+		entries := s.getAudit(c, test.url)
+		for i := range entries {
+			entries[i].ClientAddr = ""
+		}
+		c.Assert(entries, jc.DeepEquals, test.expectResult)
+	}
+}
+
+func (s *APISuite) TestAuditBadRequest(c *gc.C) {
+	for i, test := range []struct {
+		url           string
+		expectMessage string
+	}{{
+		url:           "audit?operation=bad",
+		expectMessage: `invalid operation "bad"`,
+	}, {
+		url:           "audit?entity=bad:wolf",
+		expectMessage: `invalid entity value: charm URL has invalid schema: "bad:wolf"`,
+	}, {
+		url:           "audit?after=yesterday",
+		expectMessage: `invalid after value: parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+	}, {
+		url:           "audit?limit=0",
+		expectMessage: "invalid limit value: value must be >= 1",
+	}, {
+		url:           "audit?limit=1001",
+		expectMessage: "invalid limit value: value must be <= 1000",
+	}} {
+		c.Logf("test %d: %s", i, test.url)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:      s.srv,
+			URL:          storeURL(test.url),
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			ExpectStatus: http.StatusBadRequest,
+			ExpectBody: params.Error{
+				Code:    params.ErrBadRequest,
+				Message: test.expectMessage,
+			},
+		})
+	}
+}
+
+func (s *authSuite) TestAuditUser(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+
+	// Upload and delete a charm.
+	body, hash, size := s.archiveInfo(c)
+	defer body.Close()
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler:       srv,
+		URL:           storeURL("~bob/utopic/wordpress/archive?hash=" + hash),
+		Method:        "POST",
+		ContentLength: size,
+		Header: http.Header{
+			"Content-Type": {"application/zip"},
+		},
+		Body:    body,
+		Cookies: cookies,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	rec = httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~bob/utopic/wordpress-0/archive"),
+		Method:  "DELETE",
+		Cookies: cookies,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+
+	entries, err := store.AuditEntries(charmstore.AuditQuery{
+		User: "bob",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 2)
+	id := charm.MustParseReference("cs:~bob/utopic/wordpress-0")
+	c.Assert(entries[0].Operation, gc.Equals, params.AuditDelete)
+	c.Assert(entries[0].Entity, jc.DeepEquals, id)
+	c.Assert(entries[1].Operation, gc.Equals, params.AuditUpload)
+	c.Assert(entries[1].Entity, jc.DeepEquals, id)
+	c.Assert(entries[1].User, gc.Equals, "bob")
+	c.Assert(entries[1].Admin, jc.IsFalse)
+}
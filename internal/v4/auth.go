@@ -4,9 +4,11 @@
 package v4
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
 	"net/http"
 	"strings"
+	"time"
 
 	"gopkg.in/errgo.v1"
 	"gopkg.in/juju/charm.v5-unstable"
@@ -15,6 +17,7 @@ import (
 	"gopkg.in/macaroon-bakery.v0/httpbakery"
 	"gopkg.in/macaroon.v1"
 
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
 	"gopkg.in/juju/charmstore.v4/params"
 )
 
@@ -25,11 +28,21 @@ const basicRealm = "CharmStore4"
 // current user in the following ways:
 // - by checking that the request's headers HTTP basic auth credentials match
 //   the superuser credentials stored in the API handler;
+// - by checking that the request's headers hold a valid API token;
 // - by checking that there is a valid macaroon in the request's cookies.
-// A params.ErrUnauthorized error is returned if superuser credentials fail;
-// otherwise a macaroon is minted and a httpbakery discharge-required
-// error is returned holding the macaroon.
+// A params.ErrUnauthorized error is returned if superuser credentials or
+// the API token fail; otherwise a macaroon is minted and a httpbakery
+// discharge-required error is returned holding the macaroon.
 func (h *Handler) authorize(req *http.Request, acl []string) error {
+	return h.authorizeId(req, acl, opAdmin, nil)
+}
+
+// authorizeId is like authorize, except that the request performs the
+// given operation (one of the op* constants) on the entity with the
+// given id. The id is nil if the request does not refer to an entity.
+// Any macaroon or API token used to authenticate the request must allow
+// both the operation and the entity.
+func (h *Handler) authorizeId(req *http.Request, acl []string, op string, id *charm.Reference) error {
 	logger.Infof(
 		"authorize, bakery %p, auth location %q, acl %q, path: %q, method: %q",
 		h.store.Bakery,
@@ -45,37 +58,90 @@ func (h *Handler) authorize(req *http.Request, acl []string) error {
 		}
 	}
 
-	auth, verr := h.checkRequest(req)
-	if verr == nil {
-		logger.Infof("authenticated with auth: %q", auth)
-		if err := h.checkACLMembership(auth, acl); err != nil {
-			return errgo.WithCausef(err, params.ErrUnauthorized, "")
+	auth, err := h.authenticate(req, macaroonOperation(op), id)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	logger.Infof("authenticated with auth: %q", auth)
+	if auth.Token != nil {
+		if err := h.checkAPITokenScope(auth.Token, op, id); err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrUnauthorized))
 		}
-		return nil
+	}
+	if err := h.checkACLMembership(auth, acl); err != nil {
+		return errgo.WithCausef(err, params.ErrUnauthorized, "")
+	}
+	h.setRequestAuth(req, auth)
+	return nil
+}
+
+// setRequestAuth records auth as the authorization that allowed
+// the given request, so that it can be recorded in the audit log.
+// It does nothing if the request is not being served by the handler,
+// as is the case for the copies of requests made by the router.
+func (h *Handler) setRequestAuth(req *http.Request, auth authorization) {
+	h.authsMu.Lock()
+	defer h.authsMu.Unlock()
+	if _, ok := h.auths[req]; ok {
+		h.auths[req] = auth
+	}
+}
+
+// requestAuth returns the authorization that allowed the given
+// request. A zero authorization is returned if the request was not
+// authorized, or was allowed without authentication.
+func (h *Handler) requestAuth(req *http.Request) authorization {
+	h.authsMu.Lock()
+	defer h.authsMu.Unlock()
+	return h.auths[req]
+}
+
+// authenticate returns the authorization held by the given request,
+// which performs the given macaroon operation on the entity with the
+// given id (nil if the request does not refer to an entity).
+// If the request holds no valid credentials, a macaroon is minted
+// and a httpbakery discharge-required error is returned holding the
+// macaroon.
+func (h *Handler) authenticate(req *http.Request, op string, id *charm.Reference) (authorization, error) {
+	auth, verr := h.checkRequest(req, op, id)
+	if verr == nil {
+		return auth, nil
 	}
 	if _, ok := errgo.Cause(verr).(*bakery.VerificationError); !ok {
-		return errgo.Mask(verr, errgo.Is(params.ErrUnauthorized))
+		return authorization{}, errgo.Mask(verr, errgo.Is(params.ErrUnauthorized))
 	}
 
 	// Macaroon verification failed: mint a new macaroon.
 	m, err := h.newMacaroon()
 	if err != nil {
-		return errgo.Notef(err, "cannot mint macaroon")
+		return authorization{}, errgo.Notef(err, "cannot mint macaroon")
 	}
 	// Request that this macaroon be supplied for all requests
 	// to the whole handler.
 	// TODO use a relative URL here: router.RelativeURLPath(req.RequestURI, "/")
 	cookiePath := "/"
-	return httpbakery.NewDischargeRequiredError(m, cookiePath, verr)
+	return authorization{}, httpbakery.NewDischargeRequiredError(m, cookiePath, verr)
 }
 
 // checkRequest checks for any authorization tokens in the request and returns any
 // found as an authorization. If no suitable credentials are found, or an error occurs,
 // then a zero valued authorization is returned.
-func (h *Handler) checkRequest(req *http.Request) (authorization, error) {
+// The given operation and id are used to check the first-party caveats
+// of any macaroon included in the request.
+func (h *Handler) checkRequest(req *http.Request, op string, id *charm.Reference) (authorization, error) {
+	if token, ok := parseBearerToken(req); ok {
+		t, err := h.store.CheckAPIToken(token)
+		if err != nil {
+			return authorization{}, errgo.Mask(err, errgo.Is(params.ErrUnauthorized))
+		}
+		return authorization{
+			Username: t.User,
+			Token:    t,
+		}, nil
+	}
 	user, passwd, err := parseCredentials(req)
 	if err == nil {
-		if user != h.config.AuthUsername || passwd != h.config.AuthPassword {
+		if !h.isAdminCredentials(user, passwd) {
 			return authorization{}, errgo.WithCausef(nil, params.ErrUnauthorized, "invalid user name or password")
 		}
 		return authorization{Admin: true}, nil
@@ -83,7 +149,7 @@ func (h *Handler) checkRequest(req *http.Request) (authorization, error) {
 	if errgo.Cause(err) != errNoCreds || h.store.Bakery == nil || h.config.IdentityLocation == "" {
 		return authorization{}, errgo.WithCausef(err, params.ErrUnauthorized, "authentication failed")
 	}
-	attrMap, err := httpbakery.CheckRequest(h.store.Bakery, req, nil, checkers.New())
+	attrMap, err := httpbakery.CheckRequest(h.store.Bakery, req, nil, checkers.New(h.requestCheckers(req, op, id)))
 	if err != nil {
 		return authorization{}, errgo.Mask(err, errgo.Any)
 	}
@@ -95,6 +161,28 @@ func (h *Handler) checkRequest(req *http.Request) (authorization, error) {
 }
 
 func (h *Handler) authorizeEntity(id *charm.Reference, req *http.Request) error {
+	return h.authorizeEntityOperation(id, req, entityOperation(req))
+}
+
+// authorizeEntityOperation checks that the current user is authorized
+// to perform the given operation on the entity with the given id.
+func (h *Handler) authorizeEntityOperation(id *charm.Reference, req *http.Request, op string) error {
+	if token := req.Form.Get("share"); token != "" && op == opRead {
+		// Shared links allow reading the entity regardless
+		// of its permissions.
+		return h.authorizeShare(id, req, token)
+	}
+	if op == opRead && id.Series != "" && id.Revision != -1 {
+		// Embargoed revisions can only be read by the
+		// users allowed to modify them.
+		embargoed, err := h.store.Embargoed(id)
+		if err != nil && errgo.Cause(err) != params.ErrNotFound {
+			return errgo.Notef(err, "cannot check embargo of %q", id)
+		}
+		if embargoed {
+			op = opWrite
+		}
+	}
 	// TThe first time a new charm is published, its corresponding base entity
 	// is not yet present in the database. For this reason, the check below
 	// must still allow specific users to proceed with the request, even in the
@@ -103,30 +191,94 @@ func (h *Handler) authorizeEntity(id *charm.Reference, req *http.Request) error
 	if err != nil {
 		if errgo.Cause(err) == params.ErrNotFound {
 			// Cannot get the ACL from a non-existing entity.
-			// Assume read permissions for everyone and write permissions
-			// for the entity user. If no user is associated with the entity,
-			// than no write permission are for the time being we only grant
-			// access to the HTTP basic auth superuser.
-			var writePerm []string
-			if id.User != "" {
-				writePerm = []string{id.User}
+			// Use the defaults of the entity namespace, which the
+			// entity will be given when created. If no user is
+			// associated with the entity, assume read permissions
+			// for everyone and no other permissions: for the time
+			// being we only grant access to the HTTP basic auth
+			// superuser.
+			if id.User == "" {
+				return h.authorizeWithPerms(req, mongodoc.ACL{
+					Read: []string{params.Everyone},
+				}, op, id)
 			}
-			return h.authorizeWithPerms(req, []string{params.Everyone}, writePerm)
+			ns, err := h.store.Namespace(id.User)
+			if err != nil {
+				return errgo.Notef(err, "cannot retrieve namespace for authorization")
+			}
+			return h.authorizeWithPerms(req, ns.ACLs, op, id)
 		}
 		return errgo.Notef(err, "cannot retrieve entity %q for authorization", id)
 	}
-	return h.authorizeWithPerms(req, baseEntity.ACLs.Read, baseEntity.ACLs.Write)
+	return h.authorizeWithPerms(req, baseEntity.ACLs, op, id)
 }
 
-func (h *Handler) authorizeWithPerms(req *http.Request, read, write []string) error {
+// authorizeWithPerms checks that the current user is authorized to
+// perform the given operation according to the given ACLs.
+func (h *Handler) authorizeWithPerms(req *http.Request, acls mongodoc.ACL, op string, id *charm.Reference) error {
 	var acl []string
-	switch req.Method {
-	case "DELETE", "PATCH", "POST", "PUT":
-		acl = write
+	switch op {
+	case opRead:
+		acl = acls.Read
+	case opWrite:
+		acl = acls.Write
+	case opUpload:
+		acl = acls.Upload
+	case opDelete:
+		acl = acls.Delete
+	case opAdmin:
+		acl = acls.Admin
+	case opPromulgate:
+		acl = acls.Promulgate
 	default:
-		acl = read
+		return errgo.Newf("unknown operation %q", op)
+	}
+	// Time-limited entries are ignored once expired, even
+	// before they are pruned from the database.
+	acl = acls.Unexpired(op, acl, time.Now())
+	return h.authorizeId(req, acl, op, id)
+}
+
+// Operations on entities, each one requiring the corresponding ACL.
+const (
+	opRead       = "read"
+	opWrite      = "write"
+	opUpload     = "upload"
+	opDelete     = "delete"
+	opAdmin      = "admin"
+	opPromulgate = "promulgate"
+)
+
+// entityOperation returns the operation performed by the given
+// request on an entity.
+func entityOperation(req *http.Request) string {
+	switch req.Method {
+	case "GET", "HEAD":
+		return opRead
 	}
-	return h.authorize(req, acl)
+	// Note that req.RequestURI holds the path of the request
+	// relative to the handler, while the router modifies
+	// req.URL.Path.
+	path := strings.TrimSuffix(req.RequestURI, "/")
+	switch {
+	case strings.HasSuffix(path, "/archive"):
+		switch req.Method {
+		case "DELETE":
+			return opDelete
+		case "PUT":
+			if req.Form.Get("promulgated") != "" {
+				return opPromulgate
+			}
+		}
+		return opUpload
+	case strings.HasSuffix(path, "/publish"):
+		return opUpload
+	case strings.HasSuffix(path, "/advisories"):
+		return opAdmin
+	case strings.Contains(path, "/meta/perm"):
+		return opAdmin
+	}
+	return opWrite
 }
 
 const (
@@ -140,6 +292,9 @@ type authorization struct {
 	Admin    bool
 	Username string
 	Groups   []string
+
+	// Token holds the API token used to authenticate, if any.
+	Token *mongodoc.APIToken
 }
 
 func (h *Handler) checkACLMembership(auth authorization, acl []string) error {
@@ -153,7 +308,20 @@ func (h *Handler) checkACLMembership(auth authorization, acl []string) error {
 		params.Everyone: true,
 		auth.Username:   true,
 	}
-	for _, name := range auth.Groups {
+	for _, name := range acl {
+		if members[name] {
+			return nil
+		}
+	}
+	groups, err := h.userGroups(auth)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	orgGroups, err := h.store.OrgGroups(auth.Username)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, name := range append(groups, orgGroups...) {
 		members[name] = true
 	}
 	for _, name := range acl {
@@ -164,18 +332,57 @@ func (h *Handler) checkACLMembership(auth authorization, acl []string) error {
 	return errgo.Newf("access denied for user %q", auth.Username)
 }
 
-func (h *Handler) newMacaroon() (*macaroon.Macaroon, error) {
-	// TODO generate different caveats depending on the requested operation
-	// and whether there's a charm id or not.
+// userGroups returns the groups the user with the given authorization
+// is a member of. When an identity provider is configured, it is
+// authoritative: the groups declared in the macaroon may be out of
+// date, for instance when the user has been removed from a group,
+// so they are ignored.
+func (h *Handler) userGroups(auth authorization) ([]string, error) {
+	if h.identity == nil {
+		return auth.Groups, nil
+	}
+	if auth.Username == "" {
+		return nil, nil
+	}
+	groups, err := h.identity.Groups(auth.Username)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve groups for user %q", auth.Username)
+	}
+	return groups, nil
+}
+
+// newMacaroon mints a macaroon requiring the client to authenticate
+// with the identity service. The given first-party caveats are
+// added to the macaroon.
+func (h *Handler) newMacaroon(caveats ...checkers.Caveat) (*macaroon.Macaroon, error) {
 	// Mint an appropriate macaroon and send it back to the client.
-	return h.store.Bakery.NewMacaroon("", nil, []checkers.Caveat{checkers.NeedDeclaredCaveat(checkers.Caveat{
+	return h.store.Bakery.NewMacaroon("", nil, append(caveats, checkers.NeedDeclaredCaveat(checkers.Caveat{
 		Location:  h.config.IdentityLocation,
 		Condition: "is-authenticated-user",
-	}, usernameAttr, groupsAttr)})
+	}, usernameAttr, groupsAttr)))
 }
 
 var errNoCreds = errgo.New("missing HTTP auth header")
 
+// parseBearerToken returns the API token held by the
+// HTTP bearer auth header of the given request, if any.
+func parseBearerToken(req *http.Request) (string, bool) {
+	parts := strings.Fields(req.Header.Get("Authorization"))
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// isAdminCredentials reports whether the given user name and password
+// are the administrator credentials. The comparison takes a constant
+// time, so that the credentials cannot be guessed by timing requests.
+func (h *Handler) isAdminCredentials(user, passwd string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(h.config.AuthUsername)) == 1
+	passwdOK := subtle.ConstantTimeCompare([]byte(passwd), []byte(h.config.AuthPassword)) == 1
+	return userOK && passwdOK
+}
+
 // parseCredentials parses the given request and returns the HTTP basic auth
 // credentials included in its header.
 func parseCredentials(req *http.Request) (username, password string, err error) {
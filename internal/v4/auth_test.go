@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/testing/httptesting"
@@ -26,6 +27,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
 	"gopkg.in/juju/charmstore.v4/internal/storetesting"
 	"gopkg.in/juju/charmstore.v4/internal/v4"
 	"gopkg.in/juju/charmstore.v4/params"
@@ -634,6 +636,207 @@ func (s *authSuite) TestUploadEntityAuthorization(c *gc.C) {
 	}
 }
 
+var operationAuthorizationTests = []struct {
+	// about holds the test description.
+	about string
+	// acls holds the permissions of the testing charm.
+	acls mongodoc.ACL
+	// method and path hold the request to be performed.
+	method string
+	path   string
+	// upload holds whether an archive is sent in the request body.
+	upload bool
+	// expectStatus is the expected HTTP response status.
+	// Defaults to 200 status OK.
+	expectStatus int
+}{{
+	about: "write permission allows changing metadata",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+	},
+	method: "PUT",
+	path:   "~charmers/wordpress/meta/extra-info/key",
+}, {
+	about: "upload permission does not allow changing metadata",
+	acls: mongodoc.ACL{
+		Upload: []string{"bob"},
+	},
+	method:       "PUT",
+	path:         "~charmers/wordpress/meta/extra-info/key",
+	expectStatus: http.StatusUnauthorized,
+}, {
+	about: "upload permission allows uploading",
+	acls: mongodoc.ACL{
+		Upload: []string{"bob"},
+	},
+	method: "POST",
+	path:   "~charmers/utopic/wordpress/archive",
+	upload: true,
+}, {
+	about: "write permission does not allow uploading",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+	},
+	method:       "POST",
+	path:         "~charmers/utopic/wordpress/archive",
+	upload:       true,
+	expectStatus: http.StatusUnauthorized,
+}, {
+	about: "delete permission allows deleting",
+	acls: mongodoc.ACL{
+		Delete: []string{"bob"},
+	},
+	method: "DELETE",
+	path:   "~charmers/utopic/wordpress-42/archive",
+}, {
+	about: "write permission does not allow deleting",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+	},
+	method:       "DELETE",
+	path:         "~charmers/utopic/wordpress-42/archive",
+	expectStatus: http.StatusUnauthorized,
+}, {
+	about: "admin permission allows changing permissions",
+	acls: mongodoc.ACL{
+		Admin: []string{"bob"},
+	},
+	method: "PUT",
+	path:   "~charmers/wordpress/meta/perm/read",
+}, {
+	about: "write permission does not allow changing permissions",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+	},
+	method:       "PUT",
+	path:         "~charmers/wordpress/meta/perm/read",
+	expectStatus: http.StatusUnauthorized,
+}, {
+	about: "write permission does not allow changing permissions through meta/any",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+	},
+	method:       "PUT",
+	path:         "~charmers/wordpress/meta/any",
+	expectStatus: http.StatusUnauthorized,
+}, {
+	about: "unexpired write permission allows changing metadata",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "write",
+			Name:    "bob",
+			Expires: time.Now().Add(time.Hour),
+		}},
+	},
+	method: "PUT",
+	path:   "~charmers/wordpress/meta/extra-info/key",
+}, {
+	about: "expired write permission does not allow changing metadata",
+	acls: mongodoc.ACL{
+		Write: []string{"bob"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "write",
+			Name:    "bob",
+			Expires: time.Now().Add(-time.Hour),
+		}},
+	},
+	method:       "PUT",
+	path:         "~charmers/wordpress/meta/extra-info/key",
+	expectStatus: http.StatusUnauthorized,
+}, {
+	about: "unexpired read permission allows reading",
+	acls: mongodoc.ACL{
+		Read: []string{"bob"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "read",
+			Name:    "bob",
+			Expires: time.Now().Add(time.Hour),
+		}},
+	},
+	method: "GET",
+	path:   "~charmers/wordpress/meta/archive-size",
+}, {
+	about: "expired read permission does not allow reading",
+	acls: mongodoc.ACL{
+		Read: []string{"bob"},
+		Expiries: []mongodoc.ACLExpiry{{
+			Perm:    "read",
+			Name:    "bob",
+			Expires: time.Now().Add(-time.Hour),
+		}},
+	},
+	method:       "GET",
+	path:         "~charmers/wordpress/meta/archive-size",
+	expectStatus: http.StatusUnauthorized,
+}}
+
+func (s *authSuite) TestOperationAuthorization(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+	bodies := map[string]string{
+		"~charmers/wordpress/meta/extra-info/key": `42`,
+		"~charmers/wordpress/meta/perm/read":      `["bob"]`,
+		"~charmers/wordpress/meta/any":            `{"Meta": {"perm": {"Read": ["bob"]}}}`,
+	}
+	for i, test := range operationAuthorizationTests {
+		c.Logf("test %d: %s", i, test.about)
+
+		// Add a charm to the store, used for testing.
+		err := store.AddCharmWithArchive(
+			charm.MustParseReference("~charmers/utopic/wordpress-42"),
+			nil,
+			storetesting.Charms.CharmDir("wordpress"))
+		c.Assert(err, gc.IsNil)
+
+		// Change the ACLs for the testing charm.
+		err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/wordpress"), bson.D{{"$set",
+			bson.D{{"acls", test.acls}},
+		}})
+		c.Assert(err, gc.IsNil)
+
+		// Prepare the expected status.
+		expectStatus := test.expectStatus
+		if expectStatus == 0 {
+			expectStatus = http.StatusOK
+		}
+
+		p := httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL(test.path),
+			Method:  test.method,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body:    strings.NewReader(bodies[test.path]),
+			Cookies: cookies,
+		}
+		if test.upload {
+			body, hash, size := s.archiveInfo(c)
+			defer body.Close()
+			p.URL += "?hash=" + hash
+			p.Header.Set("Content-Type", "application/zip")
+			p.ContentLength = size
+			p.Body = body
+		}
+		rec := httptesting.DoRequest(c, p)
+		c.Assert(rec.Code, gc.Equals, expectStatus, gc.Commentf("body: %s", rec.Body))
+		if expectStatus == http.StatusUnauthorized {
+			c.Assert(rec.Body.String(), jc.JSONEquals, params.Error{
+				Code:    params.ErrUnauthorized,
+				Message: `unauthorized: access denied for user "bob"`,
+			})
+		}
+
+		// Remove all entities from the store.
+		_, err = store.DB.Entities().RemoveAll(nil)
+		c.Assert(err, gc.IsNil)
+		_, err = store.DB.BaseEntities().RemoveAll(nil)
+		c.Assert(err, gc.IsNil)
+	}
+}
+
 // archiveInfo prepares a zip archive of an entity and return a reader for the
 // archive, its blob hash and size.
 func (s *authSuite) archiveInfo(c *gc.C) (r io.ReadCloser, hashSum string, size int64) {
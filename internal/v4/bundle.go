@@ -0,0 +1,267 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// maxBundleSize holds the maximum size of the bundle
+// in the body of a bundle/validate request.
+const maxBundleSize = 1024 * 1024
+
+// maxBundlePlanUnits holds the maximum total number of units
+// in a bundle for which a deployment plan is returned.
+const maxBundlePlanUnits = 1000
+
+// POST bundle/validate
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-bundlevalidate
+func (h *Handler) serveBundleValidate(_ http.Header, req *http.Request) (interface{}, error) {
+	if req.Method != "POST" {
+		return nil, params.ErrMethodNotAllowed
+	}
+	data, err := charm.ReadBundleData(io.LimitReader(req.Body, maxBundleSize))
+	if err != nil {
+		return nil, badRequestf(err, "cannot read bundle")
+	}
+	charms, err := h.bundleCharms(data.RequiredCharms())
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve bundle charms")
+	}
+	h.removeUnreadableCharms(charms, req)
+	response := &params.BundleValidateResponse{
+		Charms: make(map[string]*charm.Reference),
+	}
+	for id, ch := range charms {
+		ref, err := charm.ParseReference(id)
+		if err != nil {
+			// This cannot happen, as bundleCharms only
+			// returns charms for valid references.
+			continue
+		}
+		response.Charms[id] = ch.(*entityCharm).PreferredURL(ref.User == "")
+	}
+	if err := data.VerifyWithCharms(verifyConstraints, charms); err != nil {
+		verr, ok := err.(*charm.VerificationError)
+		if !ok {
+			return nil, errgo.Notef(err, "cannot verify bundle")
+		}
+		response.Errors = verificationMessages(verr)
+	}
+	return response, nil
+}
+
+// removeUnreadableCharms removes from the given charms, as returned
+// by bundleCharms, the ones that the given request is not authorized
+// to read, so that they are reported as if they did not exist.
+func (h *Handler) removeUnreadableCharms(charms map[string]charm.Charm, req *http.Request) {
+	for id, ch := range charms {
+		if err := h.authorizeEntityOperation(ch.(*entityCharm).URL, req, opRead); err != nil {
+			delete(charms, id)
+		}
+	}
+}
+
+// GET id/meta/bundle-plan
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetabundle-plan
+func (h *Handler) metaBundlePlan(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	if entity.BundleData == nil {
+		return nil, nil
+	}
+	// The number of units is chosen by the bundle author, and
+	// each unit adds a step to the plan.
+	units := 0
+	for _, svc := range entity.BundleData.Services {
+		if svc.NumUnits > maxBundlePlanUnits-units {
+			return nil, badRequestf(nil, "bundle has too many units (maximum %d)", maxBundlePlanUnits)
+		}
+		units += svc.NumUnits
+	}
+	return bundlePlan(entity.BundleData), nil
+}
+
+// GET id/meta/bundle-charm-status
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetabundle-charm-status
+func (h *Handler) metaBundleCharmStatus(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	if id.Series != "bundle" {
+		return nil, nil
+	}
+	statuses, err := h.store.BundleCharmStatus(entity.BundleCharms)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	response := make([]params.BundleCharmStatus, len(statuses))
+	for i, status := range statuses {
+		response[i] = params.BundleCharmStatus{
+			Id:             status.Id,
+			PinnedRevision: status.Id.Revision,
+			Latest:         status.Latest,
+			Resolves:       status.Resolves,
+			Stale:          status.Stale,
+		}
+	}
+	return response, nil
+}
+
+// bundlePlan returns the ordered steps required to deploy
+// the given bundle. Services are deployed first, then
+// machines are added, then relations, and finally units
+// are added to their target machines, units placed onto
+// the units of other services coming after them.
+func bundlePlan(data *charm.BundleData) []params.BundlePlanStep {
+	var steps []params.BundlePlanStep
+	serviceNames := make([]string, 0, len(data.Services))
+	for name := range data.Services {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+	for _, name := range serviceNames {
+		svc := data.Services[name]
+		steps = append(steps, params.BundlePlanStep{
+			Kind:        "deploy",
+			Service:     name,
+			Charm:       svc.Charm,
+			Options:     svc.Options,
+			Constraints: svc.Constraints,
+		})
+	}
+	machineIds := make([]string, 0, len(data.Machines))
+	for id := range data.Machines {
+		machineIds = append(machineIds, id)
+	}
+	sort.Sort(machineIdsByNumber(machineIds))
+	for _, id := range machineIds {
+		step := params.BundlePlanStep{
+			Kind:    "add-machine",
+			Machine: id,
+		}
+		if m := data.Machines[id]; m != nil {
+			step.Series = m.Series
+			step.Constraints = m.Constraints
+		}
+		steps = append(steps, step)
+	}
+	for _, rel := range data.Relations {
+		steps = append(steps, params.BundlePlanStep{
+			Kind:      "add-relation",
+			Endpoints: rel,
+		})
+	}
+	for _, u := range orderedUnits(data, serviceNames) {
+		steps = append(steps, params.BundlePlanStep{
+			Kind:    "add-unit",
+			Service: u.service,
+			To:      u.to,
+		})
+	}
+	return steps
+}
+
+// planUnit holds a unit to be added by a bundle plan.
+type planUnit struct {
+	service string
+	index   int
+	to      string
+}
+
+// orderedUnits returns the units of the bundle services, taken
+// in the given order, so that units placed onto the units of other
+// services are added after them.
+func orderedUnits(data *charm.BundleData, serviceNames []string) []planUnit {
+	var pending []planUnit
+	for _, name := range serviceNames {
+		svc := data.Services[name]
+		for i := 0; i < svc.NumUnits; i++ {
+			pending = append(pending, planUnit{
+				service: name,
+				index:   i,
+				to:      unitPlacement(svc.To, i),
+			})
+		}
+	}
+	ordered := make([]planUnit, 0, len(pending))
+	added := make(map[string]bool)
+	addedCount := make(map[string]int)
+	ready := func(u planUnit) bool {
+		if u.to == "" {
+			return true
+		}
+		p, err := charm.ParsePlacement(u.to)
+		if err != nil || p.Service == "" || p.Service == u.service {
+			// Invalid placements are reported by the bundle
+			// verification, so just ignore them here.
+			return true
+		}
+		if p.Unit >= 0 {
+			return added[fmt.Sprintf("%s/%d", p.Service, p.Unit)]
+		}
+		target, ok := data.Services[p.Service]
+		return !ok || addedCount[p.Service] == target.NumUnits
+	}
+	for len(pending) > 0 {
+		remaining := pending[:0]
+		for _, u := range pending {
+			if !ready(u) {
+				remaining = append(remaining, u)
+				continue
+			}
+			ordered = append(ordered, u)
+			added[fmt.Sprintf("%s/%d", u.service, u.index)] = true
+			addedCount[u.service]++
+		}
+		if len(remaining) == len(pending) {
+			// The remaining placements are cyclic or refer to
+			// units that do not exist: keep their original order.
+			ordered = append(ordered, remaining...)
+			break
+		}
+		pending = remaining
+	}
+	return ordered
+}
+
+// unitPlacement returns the placement directive for the unit
+// with the given index, given the placement directives of its service.
+// As described in the charm.ServiceSpec documentation, the last
+// directive is replicated to cover any units beyond the
+// end of the list. An empty string is returned if the unit
+// should be placed on a new machine.
+func unitPlacement(to []string, unit int) string {
+	if len(to) == 0 {
+		return ""
+	}
+	if unit >= len(to) {
+		unit = len(to) - 1
+	}
+	if to[unit] == "new" {
+		return ""
+	}
+	return to[unit]
+}
+
+// machineIdsByNumber sorts machine ids numerically.
+// Bundle machine ids are always numbers.
+type machineIdsByNumber []string
+
+func (m machineIdsByNumber) Len() int      { return len(m) }
+func (m machineIdsByNumber) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m machineIdsByNumber) Less(i, j int) bool {
+	a, errA := strconv.Atoi(m[i])
+	b, errB := strconv.Atoi(m[j])
+	if errA != nil || errB != nil {
+		return m[i] < m[j]
+	}
+	return a < b
+}
@@ -0,0 +1,448 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+var bundleValidateTests = []struct {
+	about        string
+	bundle       string
+	expectStatus int
+	expectBody   interface{}
+}{{
+	about: "valid bundle",
+	bundle: `
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+    mysql:
+        charm: cs:~charmers/precise/mysql
+        num_units: 1
+relations:
+    - ["wordpress:db", "mysql:server"]
+`,
+	expectBody: params.BundleValidateResponse{
+		Charms: map[string]*charm.Reference{
+			"wordpress":                  charm.MustParseReference("cs:precise/wordpress-23"),
+			"cs:~charmers/precise/mysql": charm.MustParseReference("cs:~charmers/precise/mysql-5"),
+		},
+	},
+}, {
+	about: "invalid bundle",
+	bundle: `
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+    mysql:
+        charm: no-such
+        num_units: 1
+`,
+	expectBody: params.BundleValidateResponse{
+		Charms: map[string]*charm.Reference{
+			"wordpress": charm.MustParseReference("cs:precise/wordpress-23"),
+		},
+		Errors: []string{
+			`service "mysql" refers to non-existent charm "no-such"`,
+		},
+	},
+}, {
+	about:        "invalid YAML",
+	bundle:       "services: [",
+	expectStatus: http.StatusBadRequest,
+}}
+
+func (s *APISuite) TestBundleValidate(c *gc.C) {
+	s.addCharm(c, "wordpress", "precise/wordpress-23")
+	s.addCharm(c, "mysql", "precise/mysql-5")
+	for i, test := range bundleValidateTests {
+		c.Logf("test %d: %s", i, test.about)
+		if test.expectStatus != 0 {
+			rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+				Handler: s.srv,
+				URL:     storeURL("bundle/validate"),
+				Method:  "POST",
+				Body:    strings.NewReader(test.bundle),
+			})
+			c.Assert(rec.Code, gc.Equals, test.expectStatus)
+			var perr params.Error
+			err := json.Unmarshal(rec.Body.Bytes(), &perr)
+			c.Assert(err, gc.IsNil)
+			c.Assert(perr.Message, gc.Matches, "cannot read bundle: .*")
+			continue
+		}
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:    s.srv,
+			URL:        storeURL("bundle/validate"),
+			Method:     "POST",
+			Body:       strings.NewReader(test.bundle),
+			ExpectBody: test.expectBody,
+		})
+	}
+}
+
+func (s *APISuite) TestBundleValidateUnreadableCharm(c *gc.C) {
+	s.addCharm(c, "wordpress", "precise/wordpress-23")
+	s.addCharm(c, "mysql", "~bob/precise/mysql-5")
+	s.assertPut(c, "~bob/precise/mysql-5/meta/perm/read", []string{"bob"})
+
+	// Charms that cannot be read are reported as not found.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("bundle/validate"),
+		Method:  "POST",
+		Body: strings.NewReader(`
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+    mysql:
+        charm: cs:~bob/precise/mysql
+        num_units: 1
+`),
+		ExpectBody: params.BundleValidateResponse{
+			Charms: map[string]*charm.Reference{
+				"wordpress": charm.MustParseReference("cs:precise/wordpress-23"),
+			},
+			Errors: []string{
+				`service "mysql" refers to non-existent charm "cs:~bob/precise/mysql"`,
+			},
+		},
+	})
+}
+
+func (s *APISuite) TestMetaBundlePlan(c *gc.C) {
+	bundle := &testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"wordpress": {
+					Charm:       "wordpress",
+					NumUnits:    3,
+					To:          []string{"lxc:10", "2"},
+					Constraints: "mem=2G",
+				},
+				"mysql": {
+					Charm:    "utopic/mysql-23",
+					NumUnits: 1,
+					Options: map[string]interface{}{
+						"dataset-size": "50%",
+					},
+				},
+			},
+			Machines: map[string]*charm.MachineSpec{
+				"10": {
+					Series: "trusty",
+				},
+				"2": {
+					Constraints: "cpu-cores=4",
+				},
+			},
+			Relations: [][]string{
+				{"wordpress:db", "mysql:server"},
+			},
+		},
+	}
+	err := s.store.AddBundle(bundle, charmstore.AddParams{
+		URL:      charm.MustParseReference("cs:~charmers/bundle/wordpressbundle-42"),
+		BlobName: "blobName",
+		BlobHash: fakeBlobHash,
+		BlobSize: fakeBlobSize,
+	})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/bundle/wordpressbundle-42/meta/bundle-plan"),
+		ExpectBody: []params.BundlePlanStep{{
+			Kind:    "deploy",
+			Service: "mysql",
+			Charm:   "utopic/mysql-23",
+			Options: map[string]interface{}{
+				"dataset-size": "50%",
+			},
+		}, {
+			Kind:        "deploy",
+			Service:     "wordpress",
+			Charm:       "wordpress",
+			Constraints: "mem=2G",
+		}, {
+			Kind:        "add-machine",
+			Machine:     "2",
+			Constraints: "cpu-cores=4",
+		}, {
+			Kind:    "add-machine",
+			Machine: "10",
+			Series:  "trusty",
+		}, {
+			Kind:      "add-relation",
+			Endpoints: []string{"wordpress:db", "mysql:server"},
+		}, {
+			Kind:    "add-unit",
+			Service: "mysql",
+		}, {
+			Kind:    "add-unit",
+			Service: "wordpress",
+			To:      "lxc:10",
+		}, {
+			Kind:    "add-unit",
+			Service: "wordpress",
+			To:      "2",
+		}, {
+			Kind:    "add-unit",
+			Service: "wordpress",
+			To:      "2",
+		}},
+	})
+}
+
+func (s *APISuite) TestMetaBundlePlanCrossServicePlacement(c *gc.C) {
+	bundle := &testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"haproxy": {
+					Charm:    "haproxy",
+					NumUnits: 1,
+					To:       []string{"lxc:wordpress/0"},
+				},
+				"mysql": {
+					Charm:    "mysql",
+					NumUnits: 1,
+				},
+				"wordpress": {
+					Charm:    "wordpress",
+					NumUnits: 2,
+					To:       []string{"mysql/0", "new"},
+				},
+			},
+		},
+	}
+	err := s.store.AddBundle(bundle, charmstore.AddParams{
+		URL:      charm.MustParseReference("cs:~charmers/bundle/placed-0"),
+		BlobName: "blobName",
+		BlobHash: fakeBlobHash,
+		BlobSize: fakeBlobSize,
+	})
+	c.Assert(err, gc.IsNil)
+	var steps []params.BundlePlanStep
+	for _, step := range s.bundlePlan(c, "~charmers/bundle/placed-0") {
+		if step.Kind == "add-unit" {
+			steps = append(steps, step)
+		}
+	}
+	// Units are added after the units they are placed onto.
+	c.Assert(steps, jc.DeepEquals, []params.BundlePlanStep{{
+		Kind:    "add-unit",
+		Service: "mysql",
+	}, {
+		Kind:    "add-unit",
+		Service: "wordpress",
+		To:      "mysql/0",
+	}, {
+		Kind:    "add-unit",
+		Service: "wordpress",
+	}, {
+		Kind:    "add-unit",
+		Service: "haproxy",
+		To:      "lxc:wordpress/0",
+	}})
+}
+
+func (s *APISuite) TestMetaBundlePlanTooManyUnits(c *gc.C) {
+	bundle := &testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"mysql": {
+					Charm:    "mysql",
+					NumUnits: 600,
+				},
+				"wordpress": {
+					Charm:    "wordpress",
+					NumUnits: 100000000,
+				},
+			},
+		},
+	}
+	err := s.store.AddBundle(bundle, charmstore.AddParams{
+		URL:      charm.MustParseReference("cs:~charmers/bundle/huge-0"),
+		BlobName: "blobName",
+		BlobHash: fakeBlobHash,
+		BlobSize: fakeBlobSize,
+	})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("~charmers/bundle/huge-0/meta/bundle-plan"),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "bundle has too many units (maximum 1000)",
+		},
+	})
+}
+
+// bundlePlan returns the deployment plan of the bundle with the given id.
+func (s *APISuite) bundlePlan(c *gc.C, id string) []params.BundlePlanStep {
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL(id + "/meta/bundle-plan"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var steps []params.BundlePlanStep
+	err := json.Unmarshal(rec.Body.Bytes(), &steps)
+	c.Assert(err, gc.IsNil)
+	return steps
+}
+
+func (s *APISuite) TestMetaBundleCharmStatus(c *gc.C) {
+	s.addCharm(c, "wordpress", "precise/wordpress-23")
+	s.addCharm(c, "wordpress", "precise/wordpress-24")
+	s.addCharm(c, "wordpress", "trusty/wordpress-1")
+	s.addCharm(c, "mysql", "~bob/trusty/mysql-1")
+	bundle := &testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"wordpress": {
+					Charm:    "precise/wordpress-23",
+					NumUnits: 1,
+				},
+				"mysql": {
+					Charm:    "cs:~bob/trusty/mysql",
+					NumUnits: 1,
+				},
+				"varnish": {
+					Charm:    "precise/varnish-1",
+					NumUnits: 1,
+				},
+			},
+		},
+	}
+	err := s.store.AddBundle(bundle, charmstore.AddParams{
+		URL:      charm.MustParseReference("cs:~charmers/bundle/wordpressbundle-42"),
+		BlobName: "blobName",
+		BlobHash: fakeBlobHash,
+		BlobSize: fakeBlobSize,
+	})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/bundle/wordpressbundle-42/meta/bundle-charm-status"),
+		ExpectBody: []params.BundleCharmStatus{{
+			Id:             charm.MustParseReference("cs:precise/varnish-1"),
+			PinnedRevision: 1,
+			Latest:         map[string]int{},
+			Stale:          true,
+		}, {
+			Id:             charm.MustParseReference("cs:precise/wordpress-23"),
+			PinnedRevision: 23,
+			Latest: map[string]int{
+				"precise": 24,
+				"trusty":  1,
+			},
+			Resolves: true,
+			Stale:    true,
+		}, {
+			Id:             charm.MustParseReference("cs:varnish"),
+			PinnedRevision: -1,
+			Latest:         map[string]int{},
+			Stale:          true,
+		}, {
+			Id:             charm.MustParseReference("cs:wordpress"),
+			PinnedRevision: -1,
+			Latest: map[string]int{
+				"precise": 24,
+				"trusty":  1,
+			},
+			Resolves: true,
+		}, {
+			Id:             charm.MustParseReference("cs:~bob/mysql"),
+			PinnedRevision: -1,
+			Latest: map[string]int{
+				"trusty": 1,
+			},
+			Resolves: true,
+		}, {
+			Id:             charm.MustParseReference("cs:~bob/trusty/mysql"),
+			PinnedRevision: -1,
+			Latest: map[string]int{
+				"trusty": 1,
+			},
+			Resolves: true,
+		}},
+	})
+}
+
+func (s *APISuite) TestMetaBundleCharmStatusIgnoresUnavailableRevisions(c *gc.C) {
+	s.addCharm(c, "wordpress", "~bob/precise/wordpress-23")
+	// Revision 24 is embargoed.
+	err := s.store.AddCharm(storetesting.Charms.CharmDir("wordpress"), charmstore.AddParams{
+		URL:                 charm.MustParseReference("~bob/precise/wordpress-24"),
+		PromulgatedRevision: -1,
+		BlobName:            "blobName",
+		BlobHash:            fakeBlobHash,
+		BlobSize:            fakeBlobSize,
+		PublishAt:           time.Now().Add(time.Hour),
+	})
+	c.Assert(err, gc.IsNil)
+	// Revision 25 is not published to any channel.
+	s.addCharm(c, "wordpress", "~bob/precise/wordpress-25")
+	err = s.store.DB.Entities().UpdateId(charm.MustParseReference("~bob/precise/wordpress-25"), bson.D{
+		{"$unset", bson.D{{"published", nil}}},
+	})
+	c.Assert(err, gc.IsNil)
+	bundle := &testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"wordpress": {
+					Charm:    "cs:~bob/precise/wordpress-23",
+					NumUnits: 1,
+				},
+				"wordpress-next": {
+					Charm:    "cs:~bob/precise/wordpress-24",
+					NumUnits: 1,
+				},
+			},
+		},
+	}
+	err = s.store.AddBundle(bundle, charmstore.AddParams{
+		URL:      charm.MustParseReference("cs:~charmers/bundle/wordpressbundle-42"),
+		BlobName: "blobName",
+		BlobHash: fakeBlobHash,
+		BlobSize: fakeBlobSize,
+	})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/bundle/wordpressbundle-42/meta/bundle-charm-status"),
+		ExpectBody: []params.BundleCharmStatus{{
+			Id:             charm.MustParseReference("cs:~bob/precise/wordpress-23"),
+			PinnedRevision: 23,
+			Latest: map[string]int{
+				"precise": 23,
+			},
+			Resolves: true,
+		}, {
+			Id:             charm.MustParseReference("cs:~bob/precise/wordpress-24"),
+			PinnedRevision: 24,
+			Latest: map[string]int{
+				"precise": 23,
+			},
+			Stale: true,
+		}},
+	})
+}
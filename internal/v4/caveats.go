@@ -0,0 +1,193 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/macaroon-bakery.v0/bakery/checkers"
+
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// macaroonOperation returns the macaroon operation corresponding to
+// the given operation (one of the op* constants). Changing the
+// permissions, advisories or promulgation of an entity, and requests
+// not referring to an entity, are administrative operations.
+func macaroonOperation(op string) string {
+	switch op {
+	case opRead:
+		return params.OperationRead
+	case opAdmin, opPromulgate:
+		return params.OperationAdmin
+	}
+	return params.OperationWrite
+}
+
+// requestCheckers returns the checkers for the first-party caveats
+// that can be added to charm store macaroons, when used to perform the
+// given operation on the entity with the given id.
+func (h *Handler) requestCheckers(req *http.Request, op string, id *charm.Reference) checkers.Checker {
+	return checkers.Map{
+		params.OperationCaveat: func(_, arg string) error {
+			for _, allowed := range strings.Fields(arg) {
+				if allowed == op {
+					return nil
+				}
+			}
+			return errgo.Newf("%s operation not allowed", op)
+		},
+		params.EntityCaveat: func(_, arg string) error {
+			return h.checkEntityCaveat(arg, id)
+		},
+		params.ExpiresCaveat: func(_, arg string) error {
+			t, err := time.Parse(time.RFC3339, arg)
+			if err != nil {
+				return errgo.Notef(err, "invalid expiry time")
+			}
+			if !time.Now().Before(t) {
+				return errgo.New("macaroon has expired")
+			}
+			return nil
+		},
+		params.ClientIPCaveat: func(_, arg string) error {
+			return checkClientIP(req, arg)
+		},
+	}
+}
+
+// checkEntityCaveat checks that the entity with the given id is
+// included in one of the space separated base URL prefixes in arg.
+func (h *Handler) checkEntityCaveat(arg string, id *charm.Reference) error {
+	if id == nil {
+		return errgo.New("operation not associated with an entity")
+	}
+	ownedId, err := h.ownedId(id)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	for _, prefix := range strings.Fields(arg) {
+		if entityPrefixMatches(prefix, id) || entityPrefixMatches(prefix, ownedId) {
+			return nil
+		}
+	}
+	return errgo.Newf("operation on entity %s not allowed", id)
+}
+
+// entityPrefixMatches reports whether the given id is included in the
+// given entity prefix, which is either a user namespace (for instance
+// "cs:~bob") or a base URL (for instance "cs:~bob/wordpress").
+func entityPrefixMatches(prefix string, id *charm.Reference) bool {
+	prefix = strings.TrimPrefix(prefix, "cs:")
+	if strings.HasPrefix(prefix, "~") && !strings.Contains(prefix, "/") {
+		return prefix[1:] == id.User
+	}
+	ref, err := charm.ParseReference(prefix)
+	if err != nil {
+		return false
+	}
+	return ref.User == id.User && ref.Name == id.Name
+}
+
+// checkClientIP checks that the given request comes from one of the
+// space separated IP addresses or CIDR networks in arg.
+func checkClientIP(req *http.Request, arg string) error {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errgo.Newf("cannot determine client IP address from %q", req.RemoteAddr)
+	}
+	for _, allowed := range strings.Fields(arg) {
+		if strings.Contains(allowed, "/") {
+			_, ipnet, err := net.ParseCIDR(allowed)
+			if err == nil && ipnet.Contains(ip) {
+				return nil
+			}
+			continue
+		}
+		if ip.Equal(net.ParseIP(allowed)) {
+			return nil
+		}
+	}
+	return errgo.Newf("client IP address %s not allowed", ip)
+}
+
+// macaroonRequestCaveats validates the given macaroon request and
+// returns the corresponding first-party caveats.
+func macaroonRequestCaveats(mreq params.MacaroonRequest) ([]checkers.Caveat, error) {
+	var caveats []checkers.Caveat
+	if len(mreq.Operations) > 0 {
+		for _, op := range mreq.Operations {
+			switch op {
+			case params.OperationRead, params.OperationWrite, params.OperationAdmin:
+			default:
+				return nil, badRequestf(nil, "invalid operation %q", op)
+			}
+		}
+		caveats = append(caveats, firstPartyCaveat(params.OperationCaveat, mreq.Operations...))
+	}
+	if len(mreq.Entities) > 0 {
+		prefixes := make([]string, len(mreq.Entities))
+		for i, e := range mreq.Entities {
+			prefix, err := parseEntityPrefix(e)
+			if err != nil {
+				return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+			}
+			prefixes[i] = prefix
+		}
+		caveats = append(caveats, firstPartyCaveat(params.EntityCaveat, prefixes...))
+	}
+	if !mreq.Expires.IsZero() {
+		if !mreq.Expires.After(time.Now()) {
+			return nil, badRequestf(nil, "expiry time must be in the future")
+		}
+		caveats = append(caveats, firstPartyCaveat(params.ExpiresCaveat, mreq.Expires.UTC().Format(time.RFC3339)))
+	}
+	if len(mreq.ClientIPs) > 0 {
+		for _, addr := range mreq.ClientIPs {
+			if _, _, err := net.ParseCIDR(addr); err == nil {
+				continue
+			}
+			if net.ParseIP(addr) == nil {
+				return nil, badRequestf(nil, "invalid client IP address %q", addr)
+			}
+		}
+		caveats = append(caveats, firstPartyCaveat(params.ClientIPCaveat, mreq.ClientIPs...))
+	}
+	return caveats, nil
+}
+
+// parseEntityPrefix validates the given entity prefix
+// and returns its canonical form.
+func parseEntityPrefix(prefix string) (string, error) {
+	p := strings.TrimPrefix(prefix, "cs:")
+	if strings.HasPrefix(p, "~") && !strings.Contains(p, "/") {
+		if p == "~" {
+			return "", badRequestf(nil, "invalid entity %q", prefix)
+		}
+		return "cs:" + p, nil
+	}
+	ref, err := charm.ParseReference(p)
+	if err != nil {
+		return "", badRequestf(err, "invalid entity %q", prefix)
+	}
+	if ref.Series != "" || ref.Revision != -1 {
+		return "", badRequestf(nil, "entity %q is not a base URL", prefix)
+	}
+	return ref.String(), nil
+}
+
+func firstPartyCaveat(cond string, args ...string) checkers.Caveat {
+	return checkers.Caveat{
+		Condition: cond + " " + strings.Join(args, " "),
+	}
+}
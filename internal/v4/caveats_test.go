@@ -0,0 +1,329 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/macaroon-bakery.v0/httpbakery"
+	"gopkg.in/macaroon.v1"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// restrictedAuthCookie retrieves a macaroon restricted according to
+// the given request, adds the given first-party caveat conditions
+// and discharges it.
+func restrictedAuthCookie(c *gc.C, srv http.Handler, mreq params.MacaroonRequest, conditions ...string) *http.Cookie {
+	body, err := json.Marshal(mreq)
+	c.Assert(err, gc.IsNil)
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("macaroon"),
+		Method:  "POST",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body: bytes.NewReader(body),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var m macaroon.Macaroon
+	err = json.Unmarshal(rec.Body.Bytes(), &m)
+	c.Assert(err, gc.IsNil)
+	for _, cond := range conditions {
+		err := m.AddFirstPartyCaveat(cond)
+		c.Assert(err, gc.IsNil)
+	}
+	ms, err := httpbakery.DischargeAll(&m, httpbakery.NewHTTPClient(), noInteraction)
+	c.Assert(err, gc.IsNil)
+	cookie, err := httpbakery.NewCookie(ms)
+	c.Assert(err, gc.IsNil)
+	return cookie
+}
+
+var restrictedMacaroonTests = []struct {
+	// about holds the test description.
+	about string
+	// request holds the restrictions requested when minting the macaroon.
+	request params.MacaroonRequest
+	// conditions holds first-party caveats added by the client.
+	conditions []string
+	// method, path and body hold the request to be performed.
+	// If body is empty, a JSON string is sent.
+	method string
+	path   string
+	body   string
+	// expectError holds the expected error message pattern.
+	// If empty, the request is expected to succeed.
+	expectError string
+}{{
+	about:  "unrestricted macaroon",
+	method: "GET",
+	path:   "~bob/wordpress/meta/archive-size",
+}, {
+	about: "read operation allowed",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead},
+	},
+	method: "GET",
+	path:   "~bob/wordpress/meta/archive-size",
+}, {
+	about: "write operation not allowed",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead},
+	},
+	method:      "PUT",
+	path:        "~bob/wordpress/meta/extra-info/key",
+	expectError: ".*write operation not allowed",
+}, {
+	about: "write operation allowed",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead, params.OperationWrite},
+	},
+	method: "PUT",
+	path:   "~bob/wordpress/meta/extra-info/key",
+}, {
+	about: "admin operation not allowed",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead, params.OperationWrite},
+	},
+	method:      "GET",
+	path:        "log",
+	expectError: ".*admin operation not allowed",
+}, {
+	about: "permission change not allowed with write operation",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead, params.OperationWrite},
+	},
+	method:      "PUT",
+	path:        "~bob/wordpress/meta/perm/read",
+	expectError: ".*admin operation not allowed",
+}, {
+	about: "alias change not allowed with write operation",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead, params.OperationWrite},
+	},
+	method:      "PUT",
+	path:        "~bob/wordpress/meta/aliases",
+	body:        `["wp"]`,
+	expectError: ".*admin operation not allowed",
+}, {
+	about: "deprecation not allowed with write operation",
+	request: params.MacaroonRequest{
+		Operations: []string{params.OperationRead, params.OperationWrite},
+	},
+	method:      "PUT",
+	path:        "~bob/wordpress/meta/deprecated",
+	body:        `{"Deprecated": true, "Reason": "obsolete"}`,
+	expectError: ".*admin operation not allowed",
+}, {
+	about: "entity allowed",
+	request: params.MacaroonRequest{
+		Entities: []string{"cs:~bob/wordpress"},
+	},
+	method: "GET",
+	path:   "~bob/utopic/wordpress-0/meta/archive-size",
+}, {
+	about: "namespace allowed",
+	request: params.MacaroonRequest{
+		Entities: []string{"~bob"},
+	},
+	method: "GET",
+	path:   "~bob/mysql/meta/archive-size",
+}, {
+	about: "entity not allowed",
+	request: params.MacaroonRequest{
+		Entities: []string{"cs:~bob/wordpress"},
+	},
+	method:      "GET",
+	path:        "~bob/mysql/meta/archive-size",
+	expectError: `.*operation on entity cs:~bob/mysql not allowed`,
+}, {
+	about: "not expired",
+	request: params.MacaroonRequest{
+		Expires: time.Now().Add(time.Hour),
+	},
+	method: "GET",
+	path:   "~bob/wordpress/meta/archive-size",
+}, {
+	about:       "expired",
+	conditions:  []string{"expires 2000-01-01T00:00:00Z"},
+	method:      "GET",
+	path:        "~bob/wordpress/meta/archive-size",
+	expectError: ".*macaroon has expired",
+}, {
+	about:       "client attenuation",
+	conditions:  []string{"operation read"},
+	method:      "PUT",
+	path:        "~bob/wordpress/meta/extra-info/key",
+	expectError: ".*write operation not allowed",
+}}
+
+func (s *authSuite) TestRestrictedMacaroon(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	for _, id := range []string{"~bob/utopic/wordpress-0", "~bob/utopic/mysql-0"} {
+		url := charm.MustParseReference(id)
+		err := store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir(url.Name))
+		c.Assert(err, gc.IsNil)
+		// Restrict read access so that authorization is required.
+		err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~bob/"+url.Name), bson.D{{"$set",
+			bson.D{{"acls.read", []string{"bob"}}},
+		}})
+		c.Assert(err, gc.IsNil)
+	}
+	for i, test := range restrictedMacaroonTests {
+		c.Logf("test %d: %s", i, test.about)
+		cookie := restrictedAuthCookie(c, srv, test.request, test.conditions...)
+		body := test.body
+		if body == "" {
+			body = `"value"`
+		}
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL(test.path),
+			Method:  test.method,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body:    strings.NewReader(body),
+			Cookies: []*http.Cookie{cookie},
+		})
+		if test.expectError == "" {
+			c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+			continue
+		}
+		c.Assert(rec.Code, gc.Equals, http.StatusUnauthorized, gc.Commentf("body: %s", rec.Body.Bytes()))
+		var perr params.Error
+		err := json.Unmarshal(rec.Body.Bytes(), &perr)
+		c.Assert(err, gc.IsNil)
+		c.Assert(perr.Message, gc.Matches, test.expectError)
+	}
+}
+
+func (s *authSuite) TestRestrictedMacaroonBulkPermChange(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	url := charm.MustParseReference("~bob/utopic/wordpress-0")
+	err := store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	cookie := restrictedAuthCookie(c, srv, params.MacaroonRequest{
+		Operations: []string{params.OperationRead, params.OperationWrite},
+	})
+
+	// Changing the permissions through meta/any requires the
+	// admin operation, as for meta/perm.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~bob/wordpress/meta/any"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body:    strings.NewReader(`{"Meta": {"perm": {"Read": ["everyone"], "Write": ["alice"]}}}`),
+		Cookies: []*http.Cookie{cookie},
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var perr params.Error
+	err = json.Unmarshal(rec.Body.Bytes(), &perr)
+	c.Assert(err, gc.IsNil)
+	c.Assert(perr.Code, gc.Equals, params.ErrMultipleErrors)
+	c.Assert(perr.Info["perm"], gc.NotNil)
+	c.Assert(perr.Info["perm"].Message, gc.Matches, ".*admin operation not allowed")
+	baseEntity, err := store.FindBaseEntity(url, "acls")
+	c.Assert(err, gc.IsNil)
+	c.Assert(baseEntity.ACLs.Write, jc.DeepEquals, []string{"bob"})
+}
+
+func (s *authSuite) TestClientIPCaveat(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	url := charm.MustParseReference("~bob/utopic/wordpress-0")
+	err := store.AddCharmWithArchive(url, nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~bob/"+url.Name), bson.D{{"$set",
+		bson.D{{"acls.read", []string{"bob"}}},
+	}})
+	c.Assert(err, gc.IsNil)
+	cookie := restrictedAuthCookie(c, srv, params.MacaroonRequest{
+		ClientIPs: []string{"10.0.0.1", "192.168.1.0/24"},
+	})
+	for remoteAddr, expectStatus := range map[string]int{
+		"10.0.0.1:1234":    http.StatusOK,
+		"192.168.1.5:1234": http.StatusOK,
+		"10.0.0.2:1234":    http.StatusUnauthorized,
+	} {
+		c.Logf("remote address %s", remoteAddr)
+		req, err := http.NewRequest("GET", storeURL("~bob/wordpress/meta/archive-size"), nil)
+		c.Assert(err, gc.IsNil)
+		req.RemoteAddr = remoteAddr
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		c.Assert(rec.Code, gc.Equals, expectStatus, gc.Commentf("body: %s", rec.Body.Bytes()))
+	}
+}
+
+var macaroonRequestErrorsTests = []struct {
+	about       string
+	request     params.MacaroonRequest
+	expectError string
+}{{
+	about: "invalid operation",
+	request: params.MacaroonRequest{
+		Operations: []string{"destroy"},
+	},
+	expectError: `invalid operation "destroy"`,
+}, {
+	about: "entity with series",
+	request: params.MacaroonRequest{
+		Entities: []string{"~bob/utopic/wordpress"},
+	},
+	expectError: `entity "~bob/utopic/wordpress" is not a base URL`,
+}, {
+	about: "expiry in the past",
+	request: params.MacaroonRequest{
+		Expires: time.Now().Add(-time.Hour),
+	},
+	expectError: "expiry time must be in the future",
+}, {
+	about: "invalid client IP",
+	request: params.MacaroonRequest{
+		ClientIPs: []string{"bad-address"},
+	},
+	expectError: `invalid client IP address "bad-address"`,
+}}
+
+func (s *APISuite) TestMacaroonRequestErrors(c *gc.C) {
+	for i, test := range macaroonRequestErrorsTests {
+		c.Logf("test %d: %s", i, test.about)
+		body, err := json.Marshal(test.request)
+		c.Assert(err, gc.IsNil)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL("macaroon"),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body:         bytes.NewReader(body),
+			ExpectStatus: http.StatusBadRequest,
+			ExpectBody: params.Error{
+				Code:    params.ErrBadRequest,
+				Message: test.expectError,
+			},
+		})
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// GET id/meta/dependents
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetadependents
+func (h *Handler) metaDependents(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	if id.Series == "bundle" {
+		return nil, nil
+	}
+	deps, err := h.dependents(entity)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return h.readableDependents(deps, req), nil
+}
+
+// readableDependents returns the dependents that the given request is
+// authorized to read, taking embargoes into account. The read
+// permissions of the bundles are only included for admin requests.
+func (h *Handler) readableDependents(deps []params.Dependent, req *http.Request) []params.Dependent {
+	auth, err := h.checkRequest(req, params.OperationRead, nil)
+	admin := err == nil && auth.Admin
+	readable := make([]params.Dependent, 0, len(deps))
+	for _, dep := range deps {
+		if err := h.authorizeEntityOperation(dep.Id, req, opRead); err != nil {
+			continue
+		}
+		if !admin {
+			dep.ReadACLs = nil
+		}
+		readable = append(readable, dep)
+	}
+	return readable
+}
+
+// dependents returns information on the bundles referencing the given
+// charm entity, either at any revision or at its exact revision.
+// The entity must include at least the _id and promulgated-url fields.
+func (h *Handler) dependents(entity *mongodoc.Entity) ([]params.Dependent, error) {
+	bundles, err := h.bundlesReferencing(entity.URL, entity.PromulgatedURL != nil)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	deps := make([]params.Dependent, 0, len(bundles))
+	for _, b := range bundles {
+		ref, exact := referenceTo(b.BundleData, entity)
+		if ref == nil {
+			// The bundle references another revision of the charm.
+			continue
+		}
+		baseEntity, err := h.store.FindBaseEntity(b.URL, "acls")
+		if err != nil {
+			return nil, errgo.Notef(err, "cannot retrieve base entity for %s", b.URL)
+		}
+		counts, _, err := h.store.ArchiveDownloadCounts(b.URL)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		deps = append(deps, params.Dependent{
+			Id:            b.URL,
+			Charm:         ref,
+			ExactRevision: exact,
+			ReadACLs:      baseEntity.ACLs.Read,
+			Downloads:     counts.Total,
+			Promulgated:   b.PromulgatedURL != nil,
+		})
+	}
+	return deps, nil
+}
+
+// bundlesReferencing returns all the bundles referencing any revision
+// of the charm with the given id. If promulgated is true, bundles
+// referencing the charm by its promulgated name are included too.
+// Only the _id, promulgated-url and bundledata fields are populated.
+func (h *Handler) bundlesReferencing(id *charm.Reference, promulgated bool) ([]*mongodoc.Entity, error) {
+	// The bundle charms always include the base URL
+	// corresponding to each referenced charm.
+	baseId := *id
+	baseId.Series = ""
+	baseId.Revision = -1
+	refs := []*charm.Reference{&baseId}
+	if promulgated {
+		refs = append(refs, &charm.Reference{
+			Schema:   "cs",
+			Name:     id.Name,
+			Revision: -1,
+		})
+	}
+	var bundles []*mongodoc.Entity
+	if err := h.store.DB.Entities().
+		Find(bson.D{{"bundlecharms", bson.D{{"$in", refs}}}}).
+		Select(bson.D{{"_id", 1}, {"promulgated-url", 1}, {"bundledata", 1}}).
+		Sort("_id").
+		All(&bundles); err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve the bundles referencing %s", id)
+	}
+	return bundles, nil
+}
+
+// referenceTo returns the charm reference used by the given bundle to
+// refer to the given charm entity, if any. Exact reports whether the
+// reference is pinned to the exact revision of the entity.
+// References not specifying a revision are only returned if no
+// exact reference is found.
+func referenceTo(data *charm.BundleData, entity *mongodoc.Entity) (ref *charm.Reference, exact bool) {
+	if data == nil {
+		return nil, false
+	}
+	names := make([]string, 0, len(data.Services))
+	for name := range data.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r, err := charm.ParseReference(data.Services[name].Charm)
+		if err != nil {
+			continue
+		}
+		var revision int
+		switch {
+		case r.User == entity.URL.User:
+			revision = entity.URL.Revision
+		case r.User == "" && entity.PromulgatedURL != nil:
+			revision = entity.PromulgatedURL.Revision
+		default:
+			continue
+		}
+		if r.Name != entity.URL.Name || (r.Series != "" && r.Series != entity.URL.Series) {
+			continue
+		}
+		if r.Revision == revision {
+			return r, true
+		}
+		if r.Revision == -1 && ref == nil {
+			ref = r
+		}
+	}
+	return ref, false
+}
+
+// checkDeleteDependents returns an error if deleting the charm with
+// the given id would break any public bundle. A bundle is broken when
+// it references the exact revision of the charm, or when no other
+// charm satisfies its reference.
+func (h *Handler) checkDeleteDependents(id *charm.Reference) error {
+	if id.Series == "bundle" {
+		return nil
+	}
+	entity, err := h.store.FindEntity(id, "_id", "promulgated-url")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	deps, err := h.dependents(entity)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	var broken []*charm.Reference
+	for _, dep := range deps {
+		if !isPublic(dep.ReadACLs) {
+			continue
+		}
+		if !dep.ExactRevision {
+			others, err := h.store.FindEntities(dep.Charm, "_id")
+			if err != nil {
+				return errgo.Mask(err)
+			}
+			if len(others) > 1 || len(others) == 1 && *others[0].URL != *entity.URL {
+				continue
+			}
+		}
+		broken = append(broken, dep.Id)
+	}
+	if len(broken) > 0 {
+		return publicDependentsError("delete", id, broken)
+	}
+	return nil
+}
+
+// checkACLDependents returns an error if changing the read
+// permissions of the base entity of the given id to the given ones
+// would break any public bundle referencing it.
+func (h *Handler) checkACLDependents(id *charm.Reference, read []string) error {
+	if id.Series == "bundle" || isPublic(read) {
+		return nil
+	}
+	baseEntity, err := h.store.FindBaseEntity(id, "_id", "acls", "promulgated")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if !isPublic(baseEntity.ACLs.Read) {
+		// Public bundles are already unable to use the charm.
+		return nil
+	}
+	bundles, err := h.bundlesReferencing(baseEntity.URL, bool(baseEntity.Promulgated))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	var broken []*charm.Reference
+	for _, b := range bundles {
+		bundleBase, err := h.store.FindBaseEntity(b.URL, "acls")
+		if err != nil {
+			return errgo.Notef(err, "cannot retrieve base entity for %s", b.URL)
+		}
+		if isPublic(bundleBase.ACLs.Read) {
+			broken = append(broken, b.URL)
+		}
+	}
+	if len(broken) > 0 {
+		return publicDependentsError("restrict read permissions of", id, broken)
+	}
+	return nil
+}
+
+// publicDependentsError returns an error reporting that the
+// given operation on id would break the given public bundles.
+func publicDependentsError(op string, id *charm.Reference, bundles []*charm.Reference) error {
+	ids := make([]string, len(bundles))
+	for i, b := range bundles {
+		ids[i] = b.String()
+	}
+	return errgo.WithCausef(nil, params.ErrForbidden, "cannot %s %s: public bundles depend on it: %s (use force=1 to override)", op, id, strings.Join(ids, ", "))
+}
+
+// isPublic reports whether the given permissions
+// grant access to everyone.
+func isPublic(perms []string) bool {
+	for _, p := range perms {
+		if p == params.Everyone {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// addDependentBundles adds some charms and bundles referencing them.
+func (s *APISuite) addDependentBundles(c *gc.C) {
+	s.addCharm(c, "wordpress", "precise/wordpress-23")
+	s.addCharm(c, "wordpress", "precise/wordpress-24")
+	for id, charmRef := range map[string]string{
+		"cs:~charmers/bundle/pinned-1":   "precise/wordpress-23",
+		"cs:~charmers/bundle/unpinned-1": "wordpress",
+		"cs:~bob/bundle/other-1":         "cs:~charmers/precise/wordpress-24",
+	} {
+		bundle := &testingBundle{
+			data: &charm.BundleData{
+				Services: map[string]*charm.ServiceSpec{
+					"wordpress": {
+						Charm:    charmRef,
+						NumUnits: 1,
+					},
+				},
+			},
+		}
+		err := s.store.AddBundle(bundle, charmstore.AddParams{
+			URL:      charm.MustParseReference(id),
+			BlobName: "blobName",
+			BlobHash: fakeBlobHash,
+			BlobSize: fakeBlobSize,
+		})
+		c.Assert(err, gc.IsNil)
+	}
+}
+
+func (s *APISuite) TestMetaDependents(c *gc.C) {
+	s.addDependentBundles(c)
+	s.assertGet(c, "precise/wordpress-23/meta/dependents", []params.Dependent{{
+		Id:            charm.MustParseReference("cs:~charmers/bundle/pinned-1"),
+		Charm:         charm.MustParseReference("cs:precise/wordpress-23"),
+		ExactRevision: true,
+	}, {
+		Id:    charm.MustParseReference("cs:~charmers/bundle/unpinned-1"),
+		Charm: charm.MustParseReference("cs:wordpress"),
+	}})
+	s.assertGet(c, "~charmers/precise/wordpress-24/meta/dependents", []params.Dependent{{
+		Id:            charm.MustParseReference("cs:~bob/bundle/other-1"),
+		Charm:         charm.MustParseReference("cs:~charmers/precise/wordpress-24"),
+		ExactRevision: true,
+	}, {
+		Id:    charm.MustParseReference("cs:~charmers/bundle/unpinned-1"),
+		Charm: charm.MustParseReference("cs:wordpress"),
+	}})
+}
+
+func (s *APISuite) TestMetaDependentsReadACLsForAdmin(c *gc.C) {
+	s.addDependentBundles(c)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:  s.srv,
+		URL:      storeURL("precise/wordpress-23/meta/dependents"),
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		ExpectBody: []params.Dependent{{
+			Id:            charm.MustParseReference("cs:~charmers/bundle/pinned-1"),
+			Charm:         charm.MustParseReference("cs:precise/wordpress-23"),
+			ExactRevision: true,
+			ReadACLs:      []string{params.Everyone, "charmers"},
+		}, {
+			Id:       charm.MustParseReference("cs:~charmers/bundle/unpinned-1"),
+			Charm:    charm.MustParseReference("cs:wordpress"),
+			ReadACLs: []string{params.Everyone, "charmers"},
+		}},
+	})
+}
+
+func (s *APISuite) TestMetaDependentsExcludesUnreadableBundles(c *gc.C) {
+	s.addDependentBundles(c)
+	err := s.store.DB.BaseEntities().UpdateId(charm.MustParseReference("cs:~charmers/bundle/unpinned"), bson.D{{"$set", bson.D{
+		{"acls.read", []string{"charmers"}},
+	}}})
+	c.Assert(err, gc.IsNil)
+	s.assertGet(c, "precise/wordpress-23/meta/dependents", []params.Dependent{{
+		Id:            charm.MustParseReference("cs:~charmers/bundle/pinned-1"),
+		Charm:         charm.MustParseReference("cs:precise/wordpress-23"),
+		ExactRevision: true,
+	}})
+}
+
+func (s *APISuite) TestDeleteWithPublicDependents(c *gc.C) {
+	s.addDependentBundles(c)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("~charmers/precise/wordpress-23/archive"),
+		Method:       "DELETE",
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		ExpectStatus: http.StatusForbidden,
+		ExpectBody: params.Error{
+			Code:    params.ErrForbidden,
+			Message: "cannot delete cs:~charmers/precise/wordpress-23: public bundles depend on it: cs:~charmers/bundle/pinned-1 (use force=1 to override)",
+		},
+	})
+	_, err := s.store.FindEntity(charm.MustParseReference("~charmers/precise/wordpress-23"))
+	c.Assert(err, gc.IsNil)
+
+	// The deletion succeeds when forced.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:  s.srv,
+		URL:      storeURL("~charmers/precise/wordpress-23/archive?force=1"),
+		Method:   "DELETE",
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+	})
+	_, err = s.store.FindEntity(charm.MustParseReference("~charmers/precise/wordpress-23"))
+	c.Assert(errgo.Cause(err), gc.Equals, params.ErrNotFound)
+}
+
+func (s *APISuite) TestDeleteWithResolvableDependents(c *gc.C) {
+	s.addDependentBundles(c)
+	// The unpinned bundle is not reported, as its
+	// reference still resolves to wordpress-23.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("~charmers/precise/wordpress-24/archive"),
+		Method:       "DELETE",
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		ExpectStatus: http.StatusForbidden,
+		ExpectBody: params.Error{
+			Code:    params.ErrForbidden,
+			Message: "cannot delete cs:~charmers/precise/wordpress-24: public bundles depend on it: cs:~bob/bundle/other-1 (use force=1 to override)",
+		},
+	})
+}
+
+func (s *APISuite) TestPutPermWithPublicDependents(c *gc.C) {
+	s.addDependentBundles(c)
+	body, err := json.Marshal([]string{"charmers"})
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:  s.srv,
+		URL:      storeURL("precise/wordpress-24/meta/perm/read"),
+		Method:   "PUT",
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body:         bytes.NewReader(body),
+		ExpectStatus: http.StatusForbidden,
+		ExpectBody: params.Error{
+			Code:    params.ErrForbidden,
+			Message: "cannot restrict read permissions of cs:precise/wordpress-24: public bundles depend on it: cs:~bob/bundle/other-1, cs:~charmers/bundle/pinned-1, cs:~charmers/bundle/unpinned-1 (use force=1 to override)",
+		},
+	})
+	s.assertGet(c, "precise/wordpress-24/meta/perm/read", []string{params.Everyone, "charmers"})
+
+	// Changes that keep the charm public are allowed.
+	s.assertPut(c, "precise/wordpress-24/meta/perm", params.PermRequest{
+		Read:  []string{params.Everyone, "bob"},
+		Write: []string{"charmers"},
+	})
+
+	// The change succeeds when forced.
+	s.assertPut(c, "precise/wordpress-24/meta/perm/read?force=1", []string{"charmers"})
+	s.assertGet(c, "precise/wordpress-24/meta/perm/read", []string{"charmers"})
+}
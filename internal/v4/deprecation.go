@@ -0,0 +1,102 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/router"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// GET id/meta/deprecated
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetadeprecated
+func (h *Handler) metaDeprecated(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	if entity.Deprecated != nil {
+		return deprecatedResponse(entity.Deprecated, false), nil
+	}
+	baseEntity, err := h.store.FindBaseEntity(entity.BaseURL, "deprecated")
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	if baseEntity.Deprecated != nil {
+		return deprecatedResponse(baseEntity.Deprecated, true), nil
+	}
+	return nil, nil
+}
+
+func deprecatedResponse(d *mongodoc.Deprecation, allRevisions bool) *params.DeprecatedResponse {
+	return &params.DeprecatedResponse{
+		Reason:       d.Reason,
+		Successor:    d.Successor,
+		Time:         d.Time,
+		AllRevisions: allRevisions,
+	}
+}
+
+// PUT id/meta/deprecated
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-idmetadeprecated
+func (h *Handler) putMetaDeprecated(id *charm.Reference, path string, val *json.RawMessage, updater *router.FieldUpdater, req *http.Request) error {
+	var r params.DeprecatedRequest
+	if err := json.Unmarshal(*val, &r); err != nil {
+		return badRequestf(err, "cannot unmarshal deprecation")
+	}
+	var deprecation *mongodoc.Deprecation
+	if r.Deprecated {
+		if r.Reason == "" {
+			return badRequestf(nil, "deprecation reason not specified")
+		}
+		deprecation = &mongodoc.Deprecation{
+			Reason:    r.Reason,
+			Successor: r.Successor,
+			Time:      time.Now(),
+		}
+	}
+	if err := h.authorizeEntityOperation(id, req, opAdmin); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	var old *mongodoc.Deprecation
+	if r.AllRevisions {
+		baseEntity, err := h.store.FindBaseEntity(id, "_id", "deprecated")
+		if err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		old = baseEntity.Deprecated
+		update := bson.D{{"$unset", bson.D{{"deprecated", ""}}}}
+		if deprecation != nil {
+			update = bson.D{{"$set", bson.D{{"deprecated", deprecation}}}}
+		}
+		if err := h.store.UpdateBaseEntity(baseEntity.URL, update); err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		if err := h.updateSearchBase(baseEntity.URL, nil); err != nil {
+			return errgo.Mask(err)
+		}
+	} else {
+		entity, err := h.store.FindEntity(id, "deprecated")
+		if err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		old = entity.Deprecated
+		updater.UpdateField("deprecated", deprecation)
+		updater.UpdateSearch()
+	}
+	updater.OnUpdate(func() {
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetDeprecated,
+			Entity:    id,
+			Old:       auditValue(old),
+			New:       auditValue(deprecation),
+		})
+	})
+	return nil
+}
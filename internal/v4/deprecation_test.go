@@ -0,0 +1,122 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestMetaDeprecated(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	s.addCharm(c, "mysql", "cs:~charmers/trusty/mysql-0")
+	s.assertDeprecatedNotFound(c, "~charmers/trusty/wordpress-1")
+
+	// A single revision can be deprecated.
+	s.assertPut(c, "~charmers/trusty/wordpress-0/meta/deprecated", params.DeprecatedRequest{
+		Deprecated: true,
+		Reason:     "security issue",
+	})
+	resp := s.getDeprecated(c, "~charmers/trusty/wordpress-0")
+	c.Assert(resp.Reason, gc.Equals, "security issue")
+	c.Assert(resp.AllRevisions, jc.IsFalse)
+	s.assertDeprecatedNotFound(c, "~charmers/trusty/wordpress-1")
+
+	// Deprecating all revisions applies to every revision, but
+	// a revision specific deprecation takes precedence.
+	s.assertPut(c, "~charmers/wordpress/meta/deprecated", params.DeprecatedRequest{
+		Deprecated:   true,
+		Reason:       "no longer maintained",
+		Successor:    charm.MustParseReference("cs:~charmers/mysql"),
+		AllRevisions: true,
+	})
+	resp = s.getDeprecated(c, "~charmers/trusty/wordpress-1")
+	c.Assert(resp.Reason, gc.Equals, "no longer maintained")
+	c.Assert(resp.Successor.String(), gc.Equals, "cs:~charmers/mysql")
+	c.Assert(resp.AllRevisions, jc.IsTrue)
+	resp = s.getDeprecated(c, "~charmers/trusty/wordpress-0")
+	c.Assert(resp.Reason, gc.Equals, "security issue")
+
+	// Archive downloads of deprecated entities include a warning.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/wordpress-1/archive"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get(params.WarningHeader), gc.Equals,
+		`299 charmstore "cs:~charmers/trusty/wordpress-1 is deprecated: no longer maintained; use cs:~charmers/mysql instead"`)
+	rec = httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/mysql-0/archive"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get(params.WarningHeader), gc.Equals, "")
+
+	// Deprecations can be removed.
+	s.assertPut(c, "~charmers/wordpress/meta/deprecated", params.DeprecatedRequest{
+		AllRevisions: true,
+	})
+	s.assertDeprecatedNotFound(c, "~charmers/trusty/wordpress-1")
+	s.assertPut(c, "~charmers/trusty/wordpress-0/meta/deprecated", params.DeprecatedRequest{})
+	s.assertDeprecatedNotFound(c, "~charmers/trusty/wordpress-0")
+
+	// A reason must be given.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/wordpress-0/meta/deprecated"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		Body:         strings.NewReader(`{"Deprecated": true}`),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "deprecation reason not specified",
+		},
+	})
+
+	// Deprecation changes are recorded in the audit log.
+	entries, err := s.store.AuditEntries(charmstore.AuditQuery{
+		Operation: params.AuditSetDeprecated,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 4)
+}
+
+func (s *APISuite) getDeprecated(c *gc.C, id string) *params.DeprecatedResponse {
+	var resp params.DeprecatedResponse
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL(id + "/meta/deprecated"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	c.Assert(err, gc.IsNil)
+	return &resp
+}
+
+func (s *APISuite) assertDeprecatedNotFound(c *gc.C, id string) {
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL(id + "/meta/deprecated"),
+		ExpectStatus: http.StatusNotFound,
+		ExpectBody: params.Error{
+			Code:    params.ErrMetadataNotFound,
+			Message: params.ErrMetadataNotFound.Error(),
+		},
+	})
+}
@@ -0,0 +1,483 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+const (
+	// maxDiffFileSize holds the maximum size of a file for which
+	// a unified diff will be generated.
+	maxDiffFileSize = 64 * 1024
+
+	// maxDiffCells holds the maximum product of the line counts
+	// of two files for which a unified diff will be generated.
+	maxDiffCells = 4 * 1024 * 1024
+
+	// diffContext holds the number of unchanged lines shown
+	// around each change in a unified diff.
+	diffContext = 3
+)
+
+// GET id/diff?to=otherid
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-iddiff
+func (h *Handler) serveDiff(id *charm.Reference, _ bool, w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "GET" {
+		return params.ErrMethodNotAllowed
+	}
+	toStr := req.Form.Get("to")
+	if toStr == "" {
+		return badRequestf(nil, "to parameter not specified")
+	}
+	toId, err := charm.ParseReference(toStr)
+	if err != nil {
+		return badRequestf(err, "invalid to parameter")
+	}
+	if err := h.resolveURL(toId, req); err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound), errgo.Is(params.ErrBadRequest))
+	}
+	if err := h.authorizeEntity(toId, req); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	fields := []string{"_id", "charmmeta", "charmconfig", "charmactions"}
+	from, err := h.store.FindEntity(id, fields...)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	to, err := h.store.FindEntity(toId, fields...)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	response := params.DiffResponse{
+		From: id,
+		To:   toId,
+	}
+	if err := h.diffArchives(&response); err != nil {
+		return errgo.Mask(err)
+	}
+	diffEntities(&response, from, to)
+	return jsonhttp.WriteJSON(w, http.StatusOK, response)
+}
+
+// diffArchives compares the files in the archives of
+// the entities in the given response, and fills out
+// the Added, Removed and Modified fields accordingly.
+func (h *Handler) diffArchives(response *params.DiffResponse) error {
+	fromFiles, closeFrom, err := h.archiveFiles(response.From)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer closeFrom()
+	toFiles, closeTo, err := h.archiveFiles(response.To)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer closeTo()
+
+	for name, toFile := range toFiles {
+		fromFile, ok := fromFiles[name]
+		if !ok {
+			response.Added = append(response.Added, name)
+			continue
+		}
+		if fromFile.CRC32 == toFile.CRC32 && fromFile.UncompressedSize64 == toFile.UncompressedSize64 {
+			continue
+		}
+		diff, err := fileDiff(fromFile, toFile)
+		if err != nil {
+			return errgo.Notef(err, "cannot compare %q", name)
+		}
+		response.Modified = append(response.Modified, params.FileDiff{
+			Name:    name,
+			OldSize: int64(fromFile.UncompressedSize64),
+			NewSize: int64(toFile.UncompressedSize64),
+			Diff:    diff,
+		})
+	}
+	for name := range fromFiles {
+		if _, ok := toFiles[name]; !ok {
+			response.Removed = append(response.Removed, name)
+		}
+	}
+	sort.Strings(response.Added)
+	sort.Strings(response.Removed)
+	sort.Sort(fileDiffsByName(response.Modified))
+	return nil
+}
+
+// archiveFiles returns all the regular files in the archive of the
+// entity with the given id, keyed by clean path name. The returned
+// function must be called to release the archive when the files
+// are no longer needed.
+func (h *Handler) archiveFiles(id *charm.Reference) (map[string]*zip.File, func(), error) {
+	r, size, _, err := h.store.OpenBlob(id)
+	if err != nil {
+		return nil, nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	zipReader, err := zip.NewReader(charmstore.ReaderAtSeeker(r), size)
+	if err != nil {
+		r.Close()
+		return nil, nil, errgo.Notef(err, "cannot read archive data for %s", id)
+	}
+	files := make(map[string]*zip.File, len(zipReader.File))
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		files[strings.TrimPrefix(file.Name, "./")] = file
+	}
+	return files, func() { r.Close() }, nil
+}
+
+// fileDiff returns a unified diff between the contents of the given
+// files. It returns an empty string if either file is too large or
+// does not hold text.
+func fileDiff(from, to *zip.File) (string, error) {
+	if from.UncompressedSize64 > maxDiffFileSize || to.UncompressedSize64 > maxDiffFileSize {
+		return "", nil
+	}
+	fromData, err := readZipFile(from)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	toData, err := readZipFile(to)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	if !isText(fromData) || !isText(toData) {
+		return "", nil
+	}
+	fromLines, toLines := splitLines(string(fromData)), splitLines(string(toData))
+	if len(fromLines)*len(toLines) > maxDiffCells {
+		return "", nil
+	}
+	return unifiedDiff(from.Name, to.Name, fromLines, toLines), nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return data, nil
+}
+
+// isText reports whether the given data looks like text.
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) == -1
+}
+
+// splitLines splits the given text into lines,
+// without their trailing newlines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+type fileDiffsByName []params.FileDiff
+
+func (d fileDiffsByName) Len() int           { return len(d) }
+func (d fileDiffsByName) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d fileDiffsByName) Less(i, j int) bool { return d[i].Name < d[j].Name }
+
+// diffOp holds a single line in a line-by-line diff.
+type diffOp struct {
+	// kind holds ' ' for an unchanged line, '-' for a removed
+	// line and '+' for an added line.
+	kind byte
+	line string
+}
+
+// diffLines returns the operations required to turn a into b,
+// using a longest common subsequence of their lines.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] holds the length of the longest common
+	// subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff returns a unified diff turning the lines in a into
+// the lines in b. It returns the empty string if there are
+// no differences.
+func unifiedDiff(fromName, toName string, a, b []string) string {
+	ops := diffLines(a, b)
+	// aPos[i] and bPos[i] hold the number of lines
+	// of a and b that precede ops[i].
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(ops); {
+		// Find the start of the next change.
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk over any changes that are close
+		// enough for their context lines to overlap.
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[stop]-aPos[start]),
+			hunkRange(bPos[start], bPos[stop]-bPos[start]),
+		)
+		for _, op := range ops[start:stop] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			buf.WriteByte('\n')
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+// hunkRange formats a unified diff hunk range of count lines
+// after the given number of preceding lines.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffEntities fills out the structural differences between the
+// metadata, config and actions of the given charm entities.
+// Nothing is filled out unless both entities are charms.
+func diffEntities(response *params.DiffResponse, from, to *mongodoc.Entity) {
+	if from.CharmMeta == nil || to.CharmMeta == nil {
+		return
+	}
+	response.Metadata = metadataDiff(from.CharmMeta, to.CharmMeta)
+	response.Config = configDiff(from.CharmConfig, to.CharmConfig)
+	response.Actions = actionsDiff(from.CharmActions, to.CharmActions)
+}
+
+// metadataDiff returns the differences between the given charm
+// metadata, or nil if there are none.
+func metadataDiff(from, to *charm.Meta) *params.MetadataDiff {
+	fields := make(map[string]params.ValueChange)
+	addChange(fields, "name", from.Name, to.Name)
+	addChange(fields, "summary", from.Summary, to.Summary)
+	addChange(fields, "description", from.Description, to.Description)
+	addChange(fields, "subordinate", from.Subordinate, to.Subordinate)
+	addChange(fields, "categories", from.Categories, to.Categories)
+	addChange(fields, "tags", from.Tags, to.Tags)
+	relations := itemsDiff(relationAttrs(from), relationAttrs(to))
+	if len(fields) == 0 && relations == nil {
+		return nil
+	}
+	diff := &params.MetadataDiff{
+		Relations: relations,
+	}
+	if len(fields) > 0 {
+		diff.Fields = fields
+	}
+	return diff
+}
+
+// relationAttrs returns the attributes of all the relations
+// defined by the given metadata, keyed by relation name.
+func relationAttrs(meta *charm.Meta) map[string]map[string]interface{} {
+	attrs := make(map[string]map[string]interface{})
+	for _, rels := range []map[string]charm.Relation{meta.Provides, meta.Requires, meta.Peers} {
+		for name, rel := range rels {
+			attrs[name] = map[string]interface{}{
+				"role":      string(rel.Role),
+				"interface": rel.Interface,
+				"optional":  rel.Optional,
+				"limit":     rel.Limit,
+				"scope":     string(rel.Scope),
+			}
+		}
+	}
+	return attrs
+}
+
+// configDiff returns the differences between the given charm
+// configurations, or nil if there are none.
+func configDiff(from, to *charm.Config) *params.ItemsDiff {
+	return itemsDiff(configAttrs(from), configAttrs(to))
+}
+
+func configAttrs(config *charm.Config) map[string]map[string]interface{} {
+	attrs := make(map[string]map[string]interface{})
+	if config == nil {
+		return attrs
+	}
+	for name, opt := range config.Options {
+		attrs[name] = map[string]interface{}{
+			"type":        opt.Type,
+			"description": opt.Description,
+			"default":     opt.Default,
+		}
+	}
+	return attrs
+}
+
+// actionsDiff returns the differences between the given charm
+// actions, or nil if there are none.
+func actionsDiff(from, to *charm.Actions) *params.ItemsDiff {
+	return itemsDiff(actionAttrs(from), actionAttrs(to))
+}
+
+func actionAttrs(actions *charm.Actions) map[string]map[string]interface{} {
+	attrs := make(map[string]map[string]interface{})
+	if actions == nil {
+		return attrs
+	}
+	for name, spec := range actions.ActionSpecs {
+		attrs[name] = map[string]interface{}{
+			"description": spec.Description,
+			"params":      spec.Params,
+		}
+	}
+	return attrs
+}
+
+// itemsDiff compares two sets of named items, each holding a set
+// of named attributes, and returns their differences, or nil if
+// there are none.
+func itemsDiff(from, to map[string]map[string]interface{}) *params.ItemsDiff {
+	var diff params.ItemsDiff
+	for name, toAttrs := range to {
+		fromAttrs, ok := from[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		changes := make(map[string]params.ValueChange)
+		for attr, toVal := range toAttrs {
+			addChange(changes, attr, fromAttrs[attr], toVal)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if diff.Changed == nil {
+			diff.Changed = make(map[string]map[string]params.ValueChange)
+		}
+		diff.Changed[name] = changes
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	if diff.Added == nil && diff.Removed == nil && diff.Changed == nil {
+		return nil
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return &diff
+}
+
+// addChange adds an entry for the given attribute to changes
+// if the old and new values differ.
+func addChange(changes map[string]params.ValueChange, attr string, old, new interface{}) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	changes[attr] = params.ValueChange{
+		Old: old,
+		New: new,
+	}
+}
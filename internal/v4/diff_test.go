@@ -0,0 +1,199 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/v4"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestDiff(c *gc.C) {
+	s.addCharm(c, "mysql", "cs:~charmers/trusty/mysql-1")
+	s.addCharm(c, "varnish", "cs:~charmers/trusty/mysql-2")
+
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/mysql-1/diff?to=~charmers/mysql"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var resp params.DiffResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	c.Assert(err, gc.IsNil)
+
+	c.Assert(resp.From, gc.DeepEquals, charm.MustParseReference("cs:~charmers/trusty/mysql-1"))
+	c.Assert(resp.To, gc.DeepEquals, charm.MustParseReference("cs:~charmers/trusty/mysql-2"))
+	c.Assert(resp.Added, gc.HasLen, 0)
+	c.Assert(resp.Removed, gc.HasLen, 0)
+	c.Assert(resp.Modified, gc.HasLen, 1)
+	c.Assert(resp.Modified[0].Name, gc.Equals, "metadata.yaml")
+	c.Assert(resp.Modified[0].Diff, gc.Equals, `--- metadata.yaml
++++ metadata.yaml
+@@ -1,5 +1,5 @@
+-name: mysql
++name: varnish
+ summary: "Database engine"
+-description: "A pretty popular database"
++description: "Another popular database"
+ provides:
+-  server: mysql
++  webcache: varnish
+`)
+
+	c.Assert(resp.Metadata, gc.NotNil)
+	c.Assert(resp.Metadata.Fields, gc.DeepEquals, map[string]params.ValueChange{
+		"name": {
+			Old: "mysql",
+			New: "varnish",
+		},
+		"description": {
+			Old: "A pretty popular database",
+			New: "Another popular database",
+		},
+	})
+	c.Assert(resp.Metadata.Relations, gc.NotNil)
+	c.Assert(resp.Metadata.Relations.Added, gc.DeepEquals, []string{"webcache"})
+	c.Assert(resp.Metadata.Relations.Removed, gc.DeepEquals, []string{"server"})
+	c.Assert(resp.Metadata.Relations.Changed, gc.HasLen, 0)
+	c.Assert(resp.Config, gc.IsNil)
+	c.Assert(resp.Actions, gc.IsNil)
+}
+
+func (s *APISuite) TestDiffIdentical(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	s.addCharm(c, "wordpress", "cs:~charmers/precise/wordpress-1")
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/wordpress-1/diff?to=~charmers/precise/wordpress-1"),
+		ExpectBody: params.DiffResponse{
+			From: charm.MustParseReference("cs:~charmers/trusty/wordpress-1"),
+			To:   charm.MustParseReference("cs:~charmers/precise/wordpress-1"),
+		},
+	})
+}
+
+var diffErrorsTests = []struct {
+	about        string
+	url          string
+	method       string
+	expectStatus int
+	expectBody   params.Error
+}{{
+	about:        "no to parameter",
+	url:          "~charmers/trusty/wordpress-1/diff",
+	expectStatus: http.StatusBadRequest,
+	expectBody: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: "to parameter not specified",
+	},
+}, {
+	about:        "invalid to parameter",
+	url:          "~charmers/trusty/wordpress-1/diff?to=no-such:reference",
+	expectStatus: http.StatusBadRequest,
+	expectBody: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: `invalid to parameter: charm URL has invalid schema: "no-such:reference"`,
+	},
+}, {
+	about:        "to entity not found",
+	url:          "~charmers/trusty/wordpress-1/diff?to=~charmers/trusty/no-such",
+	expectStatus: http.StatusNotFound,
+	expectBody: params.Error{
+		Code:    params.ErrNotFound,
+		Message: `no matching charm or bundle for "cs:~charmers/trusty/no-such"`,
+	},
+}, {
+	about:        "method not allowed",
+	url:          "~charmers/trusty/wordpress-1/diff?to=~charmers/trusty/wordpress-1",
+	method:       "POST",
+	expectStatus: http.StatusMethodNotAllowed,
+	expectBody: params.Error{
+		Code:    params.ErrMethodNotAllowed,
+		Message: params.ErrMethodNotAllowed.Error(),
+	},
+}}
+
+func (s *APISuite) TestDiffErrors(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	for i, test := range diffErrorsTests {
+		c.Logf("test %d: %s", i, test.about)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:      s.srv,
+			URL:          storeURL(test.url),
+			Method:       test.method,
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectBody,
+		})
+	}
+}
+
+var unifiedDiffTests = []struct {
+	about  string
+	a, b   []string
+	expect string
+}{{
+	about: "no changes",
+	a:     []string{"a", "b"},
+	b:     []string{"a", "b"},
+}, {
+	about: "added to empty file",
+	b:     []string{"a"},
+	expect: `--- from
++++ to
+@@ -0,0 +1 @@
++a
+`,
+}, {
+	about: "separate hunks",
+	a:     []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"},
+	b:     []string{"x", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "y"},
+	expect: `--- from
++++ to
+@@ -1,4 +1,4 @@
+-1
++x
+ 2
+ 3
+ 4
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++y
+`,
+}, {
+	about: "merged hunks",
+	a:     []string{"1", "2", "3", "4", "5", "6", "7", "8"},
+	b:     []string{"x", "2", "3", "4", "5", "6", "7", "y"},
+	expect: `--- from
++++ to
+@@ -1,8 +1,8 @@
+-1
++x
+ 2
+ 3
+ 4
+ 5
+ 6
+ 7
+-8
++y
+`,
+}}
+
+func (s *APISuite) TestUnifiedDiff(c *gc.C) {
+	for i, test := range unifiedDiffTests {
+		c.Logf("test %d: %s", i, test.about)
+		c.Assert(v4.UnifiedDiff("from", "to", test.a, test.b), gc.Equals, test.expect)
+	}
+}
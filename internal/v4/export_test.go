@@ -15,4 +15,6 @@ var (
 	UsernameAttr                   = usernameAttr
 	GroupsAttr                     = groupsAttr
 	GetPromulgatedURL              = (*Handler).getPromulgatedURL
+	UnifiedDiff                    = unifiedDiff
+	RateLimitClass                 = rateLimitClass
 )
@@ -0,0 +1,198 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+)
+
+// defaultGroupsCacheTTL holds the duration for which user groups
+// are cached when no duration is specified in the server parameters.
+const defaultGroupsCacheTTL = 10 * time.Minute
+
+// defaultIdentityAPITimeout holds the maximum duration of the requests
+// to the identity service API when no timeout is specified in the
+// server parameters.
+const defaultIdentityAPITimeout = 5 * time.Second
+
+// IdentityProvider resolves identity information for users.
+type IdentityProvider interface {
+	// Groups returns the names of the groups
+	// the given user is a member of.
+	Groups(user string) ([]string, error)
+}
+
+// newIdentityProvider returns the identity provider configured in
+// the given server parameters, or nil if none is configured.
+func newIdentityProvider(config charmstore.ServerParams) IdentityProvider {
+	var p IdentityProvider
+	switch {
+	case config.GroupsFile != "":
+		p = NewStaticGroupsProvider(config.GroupsFile)
+	case config.IdentityAPIURL != "":
+		timeout := config.IdentityAPITimeout
+		if timeout == 0 {
+			timeout = defaultIdentityAPITimeout
+		}
+		p = NewHTTPIdentityProvider(config.IdentityAPIURL, &http.Client{
+			Timeout: timeout,
+		})
+	default:
+		return nil
+	}
+	ttl := config.GroupsCacheTTL
+	if ttl == 0 {
+		ttl = defaultGroupsCacheTTL
+	}
+	return NewCachingIdentityProvider(p, ttl)
+}
+
+// NewStaticGroupsProvider returns an identity provider that retrieves
+// groups from the YAML file at the given path. The file maps group
+// names to the list of their members, for instance:
+//
+//	charmers: [bob, alice]
+//	openstack: [bob]
+//
+// The file is read every time groups are requested, so changes are
+// picked up without restarting the server.
+func NewStaticGroupsProvider(path string) IdentityProvider {
+	return staticGroupsProvider(path)
+}
+
+type staticGroupsProvider string
+
+// Groups implements IdentityProvider.Groups.
+func (p staticGroupsProvider) Groups(user string) ([]string, error) {
+	data, err := ioutil.ReadFile(string(p))
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot read groups file")
+	}
+	var members map[string][]string
+	if err := yaml.Unmarshal(data, &members); err != nil {
+		return nil, errgo.Notef(err, "cannot parse groups file %q", string(p))
+	}
+	var groups []string
+	for group, users := range members {
+		for _, u := range users {
+			if u == user {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// NewHTTPIdentityProvider returns an identity provider that retrieves
+// groups from the identity service API at the given URL, by sending
+// GET requests to $url/v1/u/$user/groups. If client is nil, a client
+// with a default timeout is used.
+func NewHTTPIdentityProvider(url string, client *http.Client) IdentityProvider {
+	if client == nil {
+		client = &http.Client{
+			Timeout: defaultIdentityAPITimeout,
+		}
+	}
+	return &httpIdentityProvider{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+	}
+}
+
+type httpIdentityProvider struct {
+	url    string
+	client *http.Client
+}
+
+// Groups implements IdentityProvider.Groups.
+func (p *httpIdentityProvider) Groups(user string) ([]string, error) {
+	// Escape the user name as a path segment: a query
+	// escaped name has spaces encoded as "+".
+	path := (&url.URL{Path: "/v1/u/" + user + "/groups"}).String()
+	resp, err := p.client.Get(p.url + path)
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot get groups for user %q", user)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// The user is not known by the identity service.
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errgo.Newf("cannot get groups for user %q: unexpected status %q", user, resp.Status)
+	}
+	var groups []string
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		return nil, errgo.Notef(err, "cannot unmarshal groups for user %q", user)
+	}
+	return groups, nil
+}
+
+// NewCachingIdentityProvider returns an identity provider that caches
+// the groups returned by the given provider for the given duration.
+// Errors are not cached.
+func NewCachingIdentityProvider(p IdentityProvider, ttl time.Duration) IdentityProvider {
+	return &cachingIdentityProvider{
+		provider: p,
+		ttl:      ttl,
+		entries:  make(map[string]groupsCacheEntry),
+	}
+}
+
+type cachingIdentityProvider struct {
+	provider IdentityProvider
+	ttl      time.Duration
+
+	// mu guards the fields below it.
+	mu      sync.Mutex
+	entries map[string]groupsCacheEntry
+}
+
+type groupsCacheEntry struct {
+	groups  []string
+	expires time.Time
+}
+
+// Groups implements IdentityProvider.Groups.
+func (p *cachingIdentityProvider) Groups(user string) ([]string, error) {
+	now := time.Now()
+	p.mu.Lock()
+	entry, ok := p.entries[user]
+	p.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.groups, nil
+	}
+	groups, err := p.provider.Groups(user)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Remove expired entries so that the cache does not
+	// grow without bound.
+	for u, e := range p.entries {
+		if !now.Before(e.expires) {
+			delete(p.entries, u)
+		}
+	}
+	p.entries[user] = groupsCacheEntry{
+		groups:  groups,
+		expires: now.Add(p.ttl),
+	}
+	return groups, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	jujutesting "github.com/juju/testing"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/macaroon-bakery.v0/bakery/checkers"
+	"gopkg.in/macaroon-bakery.v0/bakerytest"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/internal/v4"
+)
+
+type identitySuite struct {
+	jujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&identitySuite{})
+
+func (s *identitySuite) TestStaticGroupsProvider(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "groups.yaml")
+	err := ioutil.WriteFile(path, []byte("charmers: [bob, alice]\nopenstack: [bob]\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	p := v4.NewStaticGroupsProvider(path)
+	groups, err := p.Groups("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"charmers", "openstack"})
+	groups, err = p.Groups("alice")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"charmers"})
+	groups, err = p.Groups("who")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.HasLen, 0)
+
+	// Changes to the file are picked up.
+	err = ioutil.WriteFile(path, []byte("openstack: [alice]\n"), 0666)
+	c.Assert(err, gc.IsNil)
+	groups, err = p.Groups("alice")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"openstack"})
+
+	// Invalid files are reported.
+	err = ioutil.WriteFile(path, []byte("bad: {yaml"), 0666)
+	c.Assert(err, gc.IsNil)
+	_, err = p.Groups("alice")
+	c.Assert(err, gc.ErrorMatches, `cannot parse groups file ".*": .*`)
+}
+
+func (s *identitySuite) TestHTTPIdentityProvider(c *gc.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/u/bob/groups":
+			json.NewEncoder(w).Encode([]string{"charmers", "openstack"})
+		case "/v1/u/bob smith/groups":
+			json.NewEncoder(w).Encode([]string{"smiths"})
+		case "/v1/u/bob+smith/groups":
+			json.NewEncoder(w).Encode([]string{"plus"})
+		case "/v1/u/broken/groups":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+	p := v4.NewHTTPIdentityProvider(srv.URL+"/", nil)
+	groups, err := p.Groups("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"charmers", "openstack"})
+
+	// User names are escaped as path segments.
+	groups, err = p.Groups("bob smith")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"smiths"})
+	groups, err = p.Groups("bob+smith")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"plus"})
+
+	// Unknown users are not members of any group.
+	groups, err = p.Groups("who")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.HasLen, 0)
+
+	_, err = p.Groups("broken")
+	c.Assert(err, gc.ErrorMatches, `cannot get groups for user "broken": unexpected status "500 Internal Server Error"`)
+}
+
+type countingIdentityProvider struct {
+	calls  int
+	groups []string
+	err    error
+}
+
+func (p *countingIdentityProvider) Groups(user string) ([]string, error) {
+	p.calls++
+	return p.groups, p.err
+}
+
+func (s *identitySuite) TestCachingIdentityProvider(c *gc.C) {
+	underlying := &countingIdentityProvider{
+		groups: []string{"charmers"},
+	}
+	p := v4.NewCachingIdentityProvider(underlying, 50*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		groups, err := p.Groups("bob")
+		c.Assert(err, gc.IsNil)
+		c.Assert(groups, gc.DeepEquals, []string{"charmers"})
+	}
+	c.Assert(underlying.calls, gc.Equals, 1)
+
+	// Other users are retrieved separately.
+	_, err := p.Groups("alice")
+	c.Assert(err, gc.IsNil)
+	c.Assert(underlying.calls, gc.Equals, 2)
+
+	// Expired entries are retrieved again.
+	time.Sleep(60 * time.Millisecond)
+	underlying.groups = []string{"openstack"}
+	groups, err := p.Groups("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(groups, gc.DeepEquals, []string{"openstack"})
+	c.Assert(underlying.calls, gc.Equals, 3)
+
+	// Errors are not cached.
+	time.Sleep(60 * time.Millisecond)
+	underlying.err = errgo.New("bad wolf")
+	_, err = p.Groups("bob")
+	c.Assert(err, gc.ErrorMatches, "bad wolf")
+	underlying.err = nil
+	_, err = p.Groups("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(underlying.calls, gc.Equals, 5)
+}
+
+func (s *authSuite) TestIdentityProviderGroups(c *gc.C) {
+	groupsFile := filepath.Join(c.MkDir(), "groups.yaml")
+	err := ioutil.WriteFile(groupsFile, []byte("charmers: [bob]\n"), 0666)
+	c.Assert(err, gc.IsNil)
+
+	// The discharger does not declare any group for bob.
+	discharger := bakerytest.NewDischarger(nil, func(cond string, arg string) ([]checkers.Caveat, error) {
+		return []checkers.Caveat{
+			checkers.DeclaredCaveat(v4.UsernameAttr, "bob"),
+		}, nil
+	})
+	defer discharger.Close()
+	srv, store := newServer(c, s.Session, nil, charmstore.ServerParams{
+		AuthUsername:     serverParams.AuthUsername,
+		AuthPassword:     serverParams.AuthPassword,
+		IdentityLocation: discharger.Location(),
+		PublicKeyLocator: discharger,
+		GroupsFile:       groupsFile,
+	})
+	err = store.AddCharmWithArchive(
+		charm.MustParseReference("~charmers/utopic/wordpress-42"),
+		nil,
+		storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/wordpress"), bson.D{{"$set",
+		bson.D{{"acls.read", []string{"charmers"}}},
+	}})
+	c.Assert(err, gc.IsNil)
+
+	// Bob is a member of charmers according to the groups file.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~charmers/wordpress/meta/archive-size"),
+		Cookies: []*http.Cookie{dischargedAuthCookie(c, srv)},
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+}
+
+func (s *authSuite) TestIdentityProviderGroupsAuthoritative(c *gc.C) {
+	groupsFile := filepath.Join(c.MkDir(), "groups.yaml")
+	err := ioutil.WriteFile(groupsFile, []byte("charmers: [alice]\n"), 0666)
+	c.Assert(err, gc.IsNil)
+
+	// The discharger declares bob as a member of charmers.
+	discharger := bakerytest.NewDischarger(nil, func(cond string, arg string) ([]checkers.Caveat, error) {
+		return []checkers.Caveat{
+			checkers.DeclaredCaveat(v4.UsernameAttr, "bob"),
+			checkers.DeclaredCaveat(v4.GroupsAttr, "charmers"),
+		}, nil
+	})
+	defer discharger.Close()
+	srv, store := newServer(c, s.Session, nil, charmstore.ServerParams{
+		AuthUsername:     serverParams.AuthUsername,
+		AuthPassword:     serverParams.AuthPassword,
+		IdentityLocation: discharger.Location(),
+		PublicKeyLocator: discharger,
+		GroupsFile:       groupsFile,
+	})
+	err = store.AddCharmWithArchive(
+		charm.MustParseReference("~charmers/utopic/wordpress-42"),
+		nil,
+		storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/wordpress"), bson.D{{"$set",
+		bson.D{{"acls.read", []string{"charmers"}}},
+	}})
+	c.Assert(err, gc.IsNil)
+
+	// Bob is no longer a member of charmers according to the
+	// groups file, so the group declared in the macaroon is ignored.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~charmers/wordpress/meta/archive-size"),
+		Cookies: []*http.Cookie{dischargedAuthCookie(c, srv)},
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusUnauthorized, gc.Commentf("body: %s", rec.Body.Bytes()))
+}
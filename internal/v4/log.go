@@ -202,3 +202,17 @@ func intValue(strValue string, minValue, defaultValue int) (int, error) {
 	}
 	return value, nil
 }
+
+// limitValue checks that the given string value is a number between 1
+// and the given maxValue. If the provided value is an empty string,
+// maxValue is returned without errors.
+func limitValue(strValue string, maxValue int) (int, error) {
+	value, err := intValue(strValue, 1, maxValue)
+	if err != nil {
+		return 0, errgo.Mask(err)
+	}
+	if value > maxValue {
+		return 0, errgo.Newf("value must be <= %d", maxValue)
+	}
+	return value, nil
+}
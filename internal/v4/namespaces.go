@@ -0,0 +1,364 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// authorizeNamespace checks that the current user is allowed
+// to manage the namespace of the given user, group or organisation.
+// Organisation namespaces are managed by the organisation owners.
+func (h *Handler) authorizeNamespace(user string, req *http.Request) error {
+	acl := []string{user}
+	if _, err := h.store.Org(user); err == nil {
+		acl = []string{params.OrgGroup(user, params.OrgOwner)}
+	} else if errgo.Cause(err) != params.ErrNotFound {
+		return errgo.Mask(err)
+	}
+	return h.authorize(req, acl)
+}
+
+// GET ~user/meta/perm
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetaperm
+//
+// PUT ~user/meta/perm[?apply=1][&force=1]
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-usermetaperm
+func (h *Handler) serveNamespacePerm(user string, w http.ResponseWriter, req *http.Request) error {
+	if err := h.authorizeNamespace(user, req); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	ns, err := h.store.Namespace(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+		return jsonhttp.WriteJSON(w, http.StatusOK, permResponse(ns.ACLs))
+	case "PUT":
+		var perms params.PermRequest
+		if err := json.NewDecoder(req.Body).Decode(&perms); err != nil {
+			return badRequestf(err, "cannot unmarshal permissions")
+		}
+		acls := ns.ACLs
+		acls.Read = nonNilPerm(perms.Read)
+		acls.Write = nonNilPerm(perms.Write)
+		for _, p := range []struct {
+			acl  *[]string
+			perm []string
+		}{
+			{&acls.Upload, perms.Upload},
+			{&acls.Delete, perms.Delete},
+			{&acls.Admin, perms.Admin},
+			{&acls.Promulgate, perms.Promulgate},
+		} {
+			if p.perm != nil {
+				*p.acl = p.perm
+			}
+		}
+		return h.putNamespaceACLs(user, acls, req)
+	}
+	return params.ErrMethodNotAllowed
+}
+
+// GET ~user/meta/perm/key
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetapermkey
+//
+// PUT ~user/meta/perm/key[?apply=1][&force=1]
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-usermetapermkey
+func (h *Handler) serveNamespacePermWithKey(user string, w http.ResponseWriter, req *http.Request) error {
+	if err := h.authorizeNamespace(user, req); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	ns, err := h.store.Namespace(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	acls := ns.ACLs
+	var acl *[]string
+	switch req.URL.Path {
+	case "/read":
+		acl = &acls.Read
+	case "/write":
+		acl = &acls.Write
+	case "/upload":
+		acl = &acls.Upload
+	case "/delete":
+		acl = &acls.Delete
+	case "/admin":
+		acl = &acls.Admin
+	case "/promulgate":
+		acl = &acls.Promulgate
+	default:
+		return errgo.WithCausef(nil, params.ErrNotFound, "unknown permission")
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+		return jsonhttp.WriteJSON(w, http.StatusOK, *acl)
+	case "PUT":
+		var perms []string
+		if err := json.NewDecoder(req.Body).Decode(&perms); err != nil {
+			return badRequestf(err, "cannot unmarshal permissions")
+		}
+		*acl = nonNilPerm(perms)
+		return h.putNamespaceACLs(user, acls, req)
+	}
+	return params.ErrMethodNotAllowed
+}
+
+// putNamespaceACLs stores the given ACLs as the defaults for the
+// namespace of the given user or group. If the apply flag is set in
+// the request, the ACLs are also applied to all the existing charms
+// and bundles in the namespace.
+func (h *Handler) putNamespaceACLs(user string, acls mongodoc.ACL, req *http.Request) error {
+	apply, err := parseBool(req.Form.Get("apply"))
+	if err != nil {
+		return badRequestf(err, "invalid apply parameter")
+	}
+	force, err := parseBool(req.Form.Get("force"))
+	if err != nil {
+		return badRequestf(err, "invalid force parameter")
+	}
+	if apply && !force {
+		// Check that no public bundle would be broken before
+		// changing anything.
+		var baseEntities []*mongodoc.BaseEntity
+		if err := h.store.DB.BaseEntities().Find(bson.D{{"user", user}}).Select(bson.D{{"_id", 1}}).All(&baseEntities); err != nil {
+			return errgo.Notef(err, "cannot retrieve base entities")
+		}
+		for _, e := range baseEntities {
+			if err := h.checkACLDependents(e.URL, acls.Read); err != nil {
+				return errgo.Mask(err, errgo.Is(params.ErrForbidden))
+			}
+		}
+	}
+	ns, err := h.store.Namespace(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if err := h.store.SetNamespaceACLs(user, acls); err != nil {
+		return errgo.Mask(err)
+	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditSetNamespacePerm,
+		Namespace: user,
+		Old:       auditValue(permResponse(ns.ACLs)),
+		New:       auditValue(permResponse(acls)),
+	})
+	if apply {
+		if _, err := h.store.ApplyNamespaceACLs(user); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+	return nil
+}
+
+// GET ~user/meta/extra-info
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetaextra-info
+//
+// PUT ~user/meta/extra-info
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-usermetaextra-info
+func (h *Handler) serveNamespaceExtraInfo(user string, w http.ResponseWriter, req *http.Request) error {
+	if err := h.authorizeNamespace(user, req); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	ns, err := h.store.Namespace(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+		return jsonhttp.WriteJSON(w, http.StatusOK, extraInfoResponse(ns.ExtraInfo))
+	case "PUT":
+		var fields map[string]*json.RawMessage
+		if err := json.NewDecoder(req.Body).Decode(&fields); err != nil {
+			return badRequestf(err, "cannot unmarshal extra info")
+		}
+		extraInfo := make(map[string][]byte)
+		for key, val := range fields {
+			if err := checkExtraInfoKey(key); err != nil {
+				return errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+			}
+			if val == nil {
+				continue
+			}
+			extraInfo[key] = *val
+		}
+		if err := h.store.SetNamespaceExtraInfo(user, extraInfo); err != nil {
+			return errgo.Mask(err)
+		}
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetNamespaceExtraInfo,
+			Namespace: user,
+			Old:       auditValue(extraInfoResponse(ns.ExtraInfo)),
+			New:       auditValue(extraInfoResponse(extraInfo)),
+		})
+		return nil
+	}
+	return params.ErrMethodNotAllowed
+}
+
+// GET ~user/meta/quota
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetaquota
+//
+// PUT ~user/meta/quota
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-usermetaquota
+func (h *Handler) serveNamespaceQuota(user string, w http.ResponseWriter, req *http.Request) error {
+	switch req.Method {
+	case "GET", "HEAD":
+		if err := h.authorizeNamespace(user, req); err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+		ns, err := h.store.Namespace(user)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		used, err := h.store.NamespaceStorageUsed(user)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		return jsonhttp.WriteJSON(w, http.StatusOK, params.QuotaResponse{
+			Quota: h.storageQuota(ns),
+			Used:  used,
+		})
+	case "PUT":
+		// Only the administrator can change quotas.
+		if err := h.authorize(req, nil); err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+		var quota params.QuotaRequest
+		if err := json.NewDecoder(req.Body).Decode(&quota); err != nil {
+			return badRequestf(err, "cannot unmarshal quota")
+		}
+		if quota.Quota != nil && *quota.Quota < 0 {
+			return badRequestf(nil, "invalid quota %d", *quota.Quota)
+		}
+		ns, err := h.store.Namespace(user)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		if err := h.store.SetNamespaceStorageQuota(user, quota.Quota); err != nil {
+			return errgo.Mask(err)
+		}
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetNamespaceQuota,
+			Namespace: user,
+			Old:       auditValue(params.QuotaRequest{Quota: ns.StorageQuota}),
+			New:       auditValue(quota),
+		})
+		return nil
+	}
+	return params.ErrMethodNotAllowed
+}
+
+// GET ~user/meta/retention
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetaretention
+//
+// PUT ~user/meta/retention
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-usermetaretention
+func (h *Handler) serveNamespaceRetention(user string, w http.ResponseWriter, req *http.Request) error {
+	if err := h.authorizeNamespace(user, req); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	ns, err := h.store.Namespace(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	switch req.Method {
+	case "GET", "HEAD":
+		return jsonhttp.WriteJSON(w, http.StatusOK, retentionResponse(ns.Retention))
+	case "PUT":
+		var policy params.RetentionPolicy
+		if err := json.NewDecoder(req.Body).Decode(&policy); err != nil {
+			return badRequestf(err, "cannot unmarshal retention policy")
+		}
+		if policy.KeepRevisions < 0 {
+			return badRequestf(nil, "invalid retention policy: negative number of revisions %d", policy.KeepRevisions)
+		}
+		if err := h.store.SetNamespaceRetention(user, &policy); err != nil {
+			return errgo.Mask(err)
+		}
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetNamespaceRetention,
+			Namespace: user,
+			Old:       auditValue(retentionResponse(ns.Retention)),
+			New:       auditValue(policy),
+		})
+		return nil
+	}
+	return params.ErrMethodNotAllowed
+}
+
+// retentionResponse returns the given retention policy in its API
+// representation.
+func retentionResponse(policy *params.RetentionPolicy) params.RetentionPolicy {
+	if policy == nil {
+		return params.RetentionPolicy{}
+	}
+	return *policy
+}
+
+// storageQuota returns the maximum total size in bytes of the archives
+// in the given namespace, or zero if the size is not limited.
+func (h *Handler) storageQuota(ns *mongodoc.Namespace) int64 {
+	if ns.StorageQuota != nil {
+		return *ns.StorageQuota
+	}
+	return h.config.StorageQuota
+}
+
+// checkStorageQuota checks that adding an archive of the given size
+// to the namespace of the given user does not exceed the namespace
+// storage quota.
+//
+// The check is best-effort: no space is reserved, so concurrent
+// uploads to the same namespace may each pass the check and together
+// exceed the quota by up to the size of the archives in flight.
+func (h *Handler) checkStorageQuota(user string, size int64) error {
+	ns, err := h.store.Namespace(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	quota := h.storageQuota(ns)
+	if quota == 0 {
+		return nil
+	}
+	used, err := h.store.NamespaceStorageUsed(user)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if used+size > quota {
+		return errgo.WithCausef(nil, params.ErrQuotaExceeded, "storage quota exceeded for ~%s: %d of %d bytes used, archive size %d", user, used, quota, size)
+	}
+	return nil
+}
+
+// extraInfoResponse returns the given extra-info, holding
+// JSON-encoded values, in its API representation.
+func extraInfoResponse(extraInfo map[string][]byte) map[string]*json.RawMessage {
+	m := make(map[string]*json.RawMessage)
+	for key, val := range extraInfo {
+		data := json.RawMessage(val)
+		m[key] = &data
+	}
+	return m
+}
+
+// nonNilPerm returns the given permissions, or an empty
+// list if they are nil, so that nil is never stored as
+// a namespace permission and mistaken for the default.
+func nonNilPerm(perm []string) []string {
+	if perm == nil {
+		return []string{}
+	}
+	return perm
+}
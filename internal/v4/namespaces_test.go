@@ -0,0 +1,344 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"net/http"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// assertAdminGet is like assertGet, except that the request
+// is authenticated as the admin user.
+func (s *APISuite) assertAdminGet(c *gc.C, url string, expectVal interface{}) {
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:    s.srv,
+		URL:        storeURL(url),
+		Username:   serverParams.AuthUsername,
+		Password:   serverParams.AuthPassword,
+		ExpectBody: expectVal,
+	})
+}
+
+func (s *APISuite) TestNamespacePerm(c *gc.C) {
+	bob := []string{"bob"}
+	s.assertAdminGet(c, "~bob/meta/perm", params.PermResponse{
+		Read:       []string{params.Everyone, "bob"},
+		Write:      bob,
+		Upload:     bob,
+		Delete:     bob,
+		Admin:      bob,
+		Promulgate: bob,
+	})
+
+	// Change the namespace defaults.
+	s.assertPut(c, "~bob/meta/perm", params.PermRequest{
+		Read:   []string{"bob", "openstack"},
+		Write:  bob,
+		Upload: []string{"bob", "ci"},
+	})
+	s.assertPut(c, "~bob/meta/perm/delete", []string{})
+	expectPerm := params.PermResponse{
+		Read:       []string{"bob", "openstack"},
+		Write:      bob,
+		Upload:     []string{"bob", "ci"},
+		Delete:     []string{},
+		Admin:      bob,
+		Promulgate: bob,
+	}
+	s.assertAdminGet(c, "~bob/meta/perm", expectPerm)
+	s.assertAdminGet(c, "~bob/meta/perm/upload", []string{"bob", "ci"})
+
+	// New charms get the namespace defaults.
+	s.addCharm(c, "wordpress", "~bob/utopic/wordpress-0")
+	s.assertAdminGet(c, "~bob/wordpress/meta/perm", expectPerm)
+	e, err := s.store.FindBaseEntity(charm.MustParseReference("~bob/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.Public, jc.IsFalse)
+
+	// Other namespaces are not affected.
+	s.addCharm(c, "wordpress", "~alice/utopic/wordpress-0")
+	s.assertGet(c, "~alice/wordpress/meta/perm/read", []string{params.Everyone, "alice"})
+}
+
+func (s *APISuite) TestNamespacePermApply(c *gc.C) {
+	s.addCharm(c, "wordpress", "~bob/utopic/wordpress-0")
+	s.addCharm(c, "mysql", "~bob/precise/mysql-0")
+	s.addCharm(c, "wordpress", "~alice/utopic/wordpress-0")
+
+	// Without the apply flag, existing entities are not changed.
+	s.assertPut(c, "~bob/meta/perm/write", []string{"bob", "charmers"})
+	s.assertGet(c, "~bob/wordpress/meta/perm/write", []string{"bob"})
+
+	// With the apply flag, all entities in the namespace are changed.
+	s.assertPut(c, "~bob/meta/perm/admin?apply=1", []string{"bob", "charmers"})
+	expectACLs := mongodoc.ACL{
+		Read:       []string{params.Everyone, "bob"},
+		Write:      []string{"bob", "charmers"},
+		Upload:     []string{"bob"},
+		Delete:     []string{"bob"},
+		Admin:      []string{"bob", "charmers"},
+		Promulgate: []string{"bob"},
+	}
+	for _, id := range []string{"~bob/wordpress", "~bob/mysql"} {
+		e, err := s.store.FindBaseEntity(charm.MustParseReference(id))
+		c.Assert(err, gc.IsNil)
+		c.Assert(e.ACLs, jc.DeepEquals, expectACLs)
+	}
+	s.assertGet(c, "~alice/wordpress/meta/perm/write", []string{"alice"})
+}
+
+func (s *APISuite) TestNamespacePermApplyPublicDependents(c *gc.C) {
+	s.addDependentBundles(c)
+	s.assertPut(c, "~charmers/meta/perm/read", []string{"charmers"})
+
+	// Restricting the read permission of charms used by public
+	// bundles is not allowed.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/meta/perm/read?apply=1"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		Body:         strings.NewReader(`["charmers"]`),
+		ExpectStatus: http.StatusForbidden,
+		ExpectBody: params.Error{
+			Code:    params.ErrForbidden,
+			Message: "cannot restrict read permissions of cs:~charmers/wordpress: public bundles depend on it: cs:~bob/bundle/other-1, cs:~charmers/bundle/pinned-1, cs:~charmers/bundle/unpinned-1 (use force=1 to override)",
+		},
+	})
+	s.assertGet(c, "wordpress/meta/perm/read", []string{params.Everyone, "charmers"})
+
+	// The change succeeds when forced.
+	s.assertPut(c, "~charmers/meta/perm/read?apply=1&force=1", []string{"charmers"})
+	e, err := s.store.FindBaseEntity(charm.MustParseReference("~charmers/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.ACLs.Read, jc.DeepEquals, []string{"charmers"})
+	c.Assert(e.Public, jc.IsFalse)
+}
+
+func (s *APISuite) TestNamespaceExtraInfo(c *gc.C) {
+	s.assertAdminGet(c, "~bob/meta/extra-info", map[string]interface{}{})
+	s.assertPut(c, "~bob/meta/extra-info", map[string]interface{}{
+		"bugs-url": "https://bugs.example.com",
+		"team":     []string{"bob"},
+	})
+	s.assertAdminGet(c, "~bob/meta/extra-info", map[string]interface{}{
+		"bugs-url": "https://bugs.example.com",
+		"team":     []string{"bob"},
+	})
+
+	// New charms get the namespace extra-info.
+	s.addCharm(c, "wordpress", "~bob/utopic/wordpress-0")
+	s.assertGet(c, "~bob/wordpress/meta/extra-info", map[string]interface{}{
+		"bugs-url": "https://bugs.example.com",
+		"team":     []string{"bob"},
+	})
+
+	// Bad keys are rejected.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~bob/meta/extra-info"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		Body:         strings.NewReader(`{"bad.key": 1}`),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "bad key for extra-info",
+		},
+	})
+}
+
+func (s *APISuite) TestNamespaceQuota(c *gc.C) {
+	s.assertAdminGet(c, "~bob/meta/quota", params.QuotaResponse{})
+
+	s.addCharm(c, "wordpress", "~bob/utopic/wordpress-0")
+	entity, err := s.store.FindEntity(charm.MustParseReference("~bob/utopic/wordpress-0"), "size")
+	c.Assert(err, gc.IsNil)
+	s.assertAdminGet(c, "~bob/meta/quota", params.QuotaResponse{
+		Used: entity.Size,
+	})
+
+	quota := int64(1000000)
+	s.assertPut(c, "~bob/meta/quota", params.QuotaRequest{
+		Quota: &quota,
+	})
+	s.assertAdminGet(c, "~bob/meta/quota", params.QuotaResponse{
+		Quota: quota,
+		Used:  entity.Size,
+	})
+
+	// Omitting the quota restores the server default.
+	s.assertPut(c, "~bob/meta/quota", params.QuotaRequest{})
+	s.assertAdminGet(c, "~bob/meta/quota", params.QuotaResponse{
+		Used: entity.Size,
+	})
+
+	// Negative quotas are rejected.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~bob/meta/quota"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		Body:         strings.NewReader(`{"Quota": -1}`),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "invalid quota -1",
+		},
+	})
+}
+
+func (s *APISuite) TestNamespaceRetention(c *gc.C) {
+	s.assertAdminGet(c, "~bob/meta/retention", params.RetentionPolicy{})
+
+	s.assertPut(c, "~bob/meta/retention", params.RetentionPolicy{
+		KeepRevisions: 3,
+		ReportOnly:    true,
+	})
+	s.assertAdminGet(c, "~bob/meta/retention", params.RetentionPolicy{
+		KeepRevisions: 3,
+		ReportOnly:    true,
+	})
+	ns, err := s.store.Namespace("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns.Retention, jc.DeepEquals, &params.RetentionPolicy{
+		KeepRevisions: 3,
+		ReportOnly:    true,
+	})
+
+	// Keeping zero revisions removes the policy.
+	s.assertPut(c, "~bob/meta/retention", params.RetentionPolicy{})
+	s.assertAdminGet(c, "~bob/meta/retention", params.RetentionPolicy{})
+	ns, err = s.store.Namespace("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ns.Retention, gc.IsNil)
+
+	// Negative numbers of revisions are rejected.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~bob/meta/retention"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		Body:         strings.NewReader(`{"KeepRevisions": -1}`),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "invalid retention policy: negative number of revisions -1",
+		},
+	})
+}
+
+func (s *authSuite) TestNamespaceAuthorization(c *gc.C) {
+	for _, test := range []struct {
+		username     string
+		groups       []string
+		expectStatus int
+	}{{
+		username:     "bob",
+		expectStatus: http.StatusOK,
+	}, {
+		username:     "alice",
+		groups:       []string{"bob"},
+		expectStatus: http.StatusOK,
+	}, {
+		username:     "alice",
+		expectStatus: http.StatusUnauthorized,
+	}} {
+		c.Logf("user %s, groups %v", test.username, test.groups)
+		srv, _, discharger := newServerWithDischarger(c, s.Session, test.username, test.groups)
+		defer discharger.Close()
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL("~bob/meta/perm"),
+			Cookies: []*http.Cookie{dischargedAuthCookie(c, srv)},
+		})
+		c.Assert(rec.Code, gc.Equals, test.expectStatus, gc.Commentf("body: %s", rec.Body.Bytes()))
+	}
+}
+
+func (s *authSuite) TestNamespaceUploadPermission(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "ci", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+	upload := func() int {
+		body, hash, size := s.archiveInfo(c)
+		defer body.Close()
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler:       srv,
+			URL:           storeURL("~bob/utopic/wordpress/archive?hash=" + hash),
+			Method:        "POST",
+			ContentLength: size,
+			Header: http.Header{
+				"Content-Type": {"application/zip"},
+			},
+			Body:    body,
+			Cookies: cookies,
+		})
+		return rec.Code
+	}
+
+	// By default only bob can upload charms to his namespace.
+	c.Assert(upload(), gc.Equals, http.StatusUnauthorized)
+
+	// The namespace defaults allow other users to upload new charms.
+	err := store.SetNamespaceACLs("bob", mongodoc.ACL{
+		Upload: []string{"bob", "ci"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(upload(), gc.Equals, http.StatusOK)
+	e, err := store.FindBaseEntity(charm.MustParseReference("~bob/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(e.ACLs.Upload, jc.DeepEquals, []string{"bob", "ci"})
+}
+
+func (s *authSuite) TestNamespaceQuotaAuthorization(c *gc.C) {
+	srv, _, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+
+	// Namespace owners can retrieve their quota.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~bob/meta/quota"),
+		Cookies: cookies,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+
+	// Only the administrator can change it.
+	rec = httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~bob/meta/quota"),
+		Method:  "PUT",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body:    strings.NewReader(`{"Quota": 0}`),
+		Cookies: cookies,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusUnauthorized, gc.Commentf("body: %s", rec.Body.Bytes()))
+}
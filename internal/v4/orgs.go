@@ -0,0 +1,212 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// orgRoles holds the valid roles of organisation members.
+var orgRoles = map[string]bool{
+	params.OrgOwner:  true,
+	params.OrgMember: true,
+	params.OrgReader: true,
+}
+
+// POST orgs
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-orgs
+func (h *Handler) serveOrgs(_ http.Header, req *http.Request) (interface{}, error) {
+	// Only the administrator can create organisations, so that
+	// users cannot claim namespaces or groups they do not own.
+	if err := h.authorize(req, nil); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	if req.Method != "POST" {
+		return nil, params.ErrMethodNotAllowed
+	}
+	var oreq params.OrgRequest
+	if err := json.NewDecoder(req.Body).Decode(&oreq); err != nil {
+		return nil, badRequestf(err, "cannot unmarshal organisation request")
+	}
+	if err := checkOrgName(oreq.Name); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	owner := oreq.Owner
+	if owner == "" {
+		return nil, badRequestf(nil, "owner not specified")
+	}
+	if err := h.store.AddOrg(oreq.Name, owner); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrForbidden))
+	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditCreateOrg,
+		Namespace: oreq.Name,
+		New: auditValue(params.OrgMember{
+			User: owner,
+			Role: params.OrgOwner,
+		}),
+	})
+	return nil, nil
+}
+
+// checkOrgName checks that the given organisation name
+// is valid as the user part of charm and bundle ids.
+func checkOrgName(name string) error {
+	if name == "" {
+		return badRequestf(nil, "organisation name not specified")
+	}
+	ref, err := charm.ParseReference("cs:~" + name + "/org")
+	if err != nil || ref.User != name || ref.Series != "" {
+		return badRequestf(nil, "invalid organisation name %q", name)
+	}
+	return nil
+}
+
+// GET ~org/meta/members
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-orgmetamembers
+func (h *Handler) serveOrgMembers(org string, w http.ResponseWriter, req *http.Request) error {
+	if err := h.authorize(req, []string{params.OrgGroup(org, "")}); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return params.ErrMethodNotAllowed
+	}
+	o, err := h.store.Org(org)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	members := make([]params.OrgMember, len(o.Members))
+	for i, m := range o.Members {
+		members[i] = params.OrgMember{
+			User: m.User,
+			Role: m.Role,
+		}
+	}
+	return jsonhttp.WriteJSON(w, http.StatusOK, members)
+}
+
+// GET ~org/meta/members/user
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-orgmetamembersuser
+//
+// PUT ~org/meta/members/user
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#put-orgmetamembersuser
+//
+// DELETE ~org/meta/members/user
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#delete-orgmetamembersuser
+func (h *Handler) serveOrgMembersWithKey(org string, w http.ResponseWriter, req *http.Request) error {
+	user := strings.TrimPrefix(req.URL.Path, "/")
+	if user == "" || strings.Contains(user, "/") {
+		return errgo.WithCausef(nil, params.ErrNotFound, "")
+	}
+	acl := []string{params.OrgGroup(org, params.OrgOwner)}
+	if req.Method == "GET" || req.Method == "HEAD" {
+		// All members can see the other members.
+		acl = []string{params.OrgGroup(org, "")}
+	}
+	if err := h.authorize(req, acl); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	o, err := h.store.Org(org)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	member := orgMember(o, user)
+	switch req.Method {
+	case "GET", "HEAD":
+		if member == nil {
+			return errgo.WithCausef(nil, params.ErrNotFound, "user %q is not a member of %q", user, org)
+		}
+		return jsonhttp.WriteJSON(w, http.StatusOK, params.OrgMember{
+			User: member.User,
+			Role: member.Role,
+		})
+	case "PUT":
+		var mreq params.OrgMemberRequest
+		if err := json.NewDecoder(req.Body).Decode(&mreq); err != nil {
+			return badRequestf(err, "cannot unmarshal member")
+		}
+		if !orgRoles[mreq.Role] {
+			return badRequestf(nil, "invalid role %q", mreq.Role)
+		}
+		if mreq.Role != params.OrgOwner && isLastOrgOwner(o, user) {
+			return errgo.WithCausef(nil, params.ErrForbidden, "cannot remove the last owner of %q", org)
+		}
+		if err := h.store.SetOrgMember(org, user, mreq.Role); err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditSetOrgMember,
+			Namespace: org,
+			Old:       auditOrgMember(member),
+			New: auditValue(params.OrgMember{
+				User: user,
+				Role: mreq.Role,
+			}),
+		})
+		return nil
+	case "DELETE":
+		if member == nil {
+			return errgo.WithCausef(nil, params.ErrNotFound, "user %q is not a member of %q", user, org)
+		}
+		if isLastOrgOwner(o, user) {
+			return errgo.WithCausef(nil, params.ErrForbidden, "cannot remove the last owner of %q", org)
+		}
+		if err := h.store.RemoveOrgMember(org, user); err != nil {
+			return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		h.addAudit(req, &mongodoc.AuditEntry{
+			Operation: params.AuditRemoveOrgMember,
+			Namespace: org,
+			Old:       auditOrgMember(member),
+		})
+		return nil
+	}
+	return params.ErrMethodNotAllowed
+}
+
+// orgMember returns the member of the given organisation with the
+// given user name, or nil if the user is not a member.
+func orgMember(org *mongodoc.Org, user string) *mongodoc.OrgMember {
+	for i := range org.Members {
+		if org.Members[i].User == user {
+			return &org.Members[i]
+		}
+	}
+	return nil
+}
+
+// isLastOrgOwner reports whether the given user is
+// the only owner of the given organisation.
+func isLastOrgOwner(org *mongodoc.Org, user string) bool {
+	owners := 0
+	isOwner := false
+	for _, m := range org.Members {
+		if m.Role == params.OrgOwner {
+			owners++
+			isOwner = isOwner || m.User == user
+		}
+	}
+	return isOwner && owners == 1
+}
+
+// auditOrgMember returns the given organisation member as an audit
+// value, or nil if member is nil.
+func auditOrgMember(member *mongodoc.OrgMember) []byte {
+	if member == nil {
+		return nil
+	}
+	return auditValue(params.OrgMember{
+		User: member.User,
+		Role: member.Role,
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *authSuite) TestOrgUploadPermission(c *gc.C) {
+	_, store, discharger := newServerWithDischarger(c, s.Session, "", nil)
+	discharger.Close()
+	err := store.AddOrg("acme", "alice")
+	c.Assert(err, gc.IsNil)
+	err = store.SetOrgMember("acme", "bob", params.OrgMember)
+	c.Assert(err, gc.IsNil)
+	err = store.SetOrgMember("acme", "carol", params.OrgReader)
+	c.Assert(err, gc.IsNil)
+
+	for _, test := range []struct {
+		username     string
+		expectStatus int
+	}{{
+		username:     "carol",
+		expectStatus: http.StatusUnauthorized,
+	}, {
+		username:     "dave",
+		expectStatus: http.StatusUnauthorized,
+	}, {
+		username:     "bob",
+		expectStatus: http.StatusOK,
+	}, {
+		username:     "alice",
+		expectStatus: http.StatusOK,
+	}} {
+		c.Logf("user %s", test.username)
+		srv, _, discharger := newServerWithDischarger(c, s.Session, test.username, nil)
+		defer discharger.Close()
+		body, hash, size := s.archiveInfo(c)
+		defer body.Close()
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler:       srv,
+			URL:           storeURL("~acme/utopic/wordpress/archive?hash=" + hash),
+			Method:        "POST",
+			ContentLength: size,
+			Header: http.Header{
+				"Content-Type": {"application/zip"},
+			},
+			Body:    body,
+			Cookies: []*http.Cookie{dischargedAuthCookie(c, srv)},
+		})
+		c.Assert(rec.Code, gc.Equals, test.expectStatus, gc.Commentf("body: %s", rec.Body.Bytes()))
+	}
+}
+
+func (s *authSuite) TestOrgMembers(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "alice", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+	assertStatus := func(method, url string, body interface{}, expectStatus int) {
+		p := httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL(url),
+			Method:  method,
+			Cookies: cookies,
+		}
+		if body != nil {
+			data, err := json.Marshal(body)
+			c.Assert(err, gc.IsNil)
+			p.Header = http.Header{"Content-Type": {"application/json"}}
+			p.Body = strings.NewReader(string(data))
+		}
+		rec := httptesting.DoRequest(c, p)
+		c.Assert(rec.Code, gc.Equals, expectStatus, gc.Commentf("%s %s: %s", method, url, rec.Body.Bytes()))
+	}
+
+	// Only the administrator can create organisations.
+	assertStatus("POST", "orgs", params.OrgRequest{Name: "acme", Owner: "alice"}, http.StatusUnauthorized)
+	createOrg := func(name string, expectStatus int) {
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler:  srv,
+			URL:      storeURL("orgs"),
+			Method:   "POST",
+			Username: serverParams.AuthUsername,
+			Password: serverParams.AuthPassword,
+			Header:   http.Header{"Content-Type": {"application/json"}},
+			Body:     strings.NewReader(`{"Name": "` + name + `", "Owner": "alice"}`),
+		})
+		c.Assert(rec.Code, gc.Equals, expectStatus, gc.Commentf("body: %s", rec.Body.Bytes()))
+	}
+	createOrg("acme", http.StatusOK)
+	createOrg("acme", http.StatusForbidden)
+
+	// Owners manage the members.
+	assertStatus("PUT", "~acme/meta/members/bob", params.OrgMemberRequest{Role: params.OrgMember}, http.StatusOK)
+	assertStatus("PUT", "~acme/meta/members/carol", params.OrgMemberRequest{Role: params.OrgReader}, http.StatusOK)
+	assertStatus("PUT", "~acme/meta/members/carol", params.OrgMemberRequest{Role: "bad"}, http.StatusBadRequest)
+	assertStatus("DELETE", "~acme/meta/members/carol", nil, http.StatusOK)
+	assertStatus("DELETE", "~acme/meta/members/carol", nil, http.StatusNotFound)
+
+	// The last owner cannot be removed.
+	assertStatus("DELETE", "~acme/meta/members/alice", nil, http.StatusForbidden)
+	assertStatus("PUT", "~acme/meta/members/alice", params.OrgMemberRequest{Role: params.OrgMember}, http.StatusForbidden)
+
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: srv,
+		URL:     storeURL("~acme/meta/members"),
+		Cookies: cookies,
+		ExpectBody: []params.OrgMember{
+			{User: "alice", Role: params.OrgOwner},
+			{User: "bob", Role: params.OrgMember},
+		},
+	})
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:    srv,
+		URL:        storeURL("~acme/meta/members/bob"),
+		Cookies:    cookies,
+		ExpectBody: params.OrgMember{User: "bob", Role: params.OrgMember},
+	})
+
+	// Owners manage the namespace defaults.
+	assertStatus("GET", "~acme/meta/perm", nil, http.StatusOK)
+
+	// Members which are not owners cannot manage the organisation.
+	srv, _, discharger = newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	cookies = []*http.Cookie{dischargedAuthCookie(c, srv)}
+	assertStatus("GET", "~acme/meta/members", nil, http.StatusOK)
+	assertStatus("PUT", "~acme/meta/members/carol", params.OrgMemberRequest{Role: params.OrgOwner}, http.StatusUnauthorized)
+	assertStatus("GET", "~acme/meta/perm", nil, http.StatusUnauthorized)
+
+	org, err := store.Org("acme")
+	c.Assert(err, gc.IsNil)
+	c.Assert(org.Members, gc.HasLen, 2)
+
+	// Organisation changes are recorded in the audit log.
+	entries, err := store.AuditEntries(charmstore.AuditQuery{User: "alice"})
+	c.Assert(err, gc.IsNil)
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Operation)
+	}
+	c.Assert(ops, jc.DeepEquals, []string{
+		params.AuditRemoveOrgMember,
+		params.AuditSetOrgMember,
+		params.AuditSetOrgMember,
+	})
+	entries, err = store.AuditEntries(charmstore.AuditQuery{Operation: params.AuditCreateOrg})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].Admin, jc.IsTrue)
+}
+
+func (s *authSuite) TestOrgGroupsNotDeclarable(c *gc.C) {
+	// A group declared by the identity service cannot be
+	// mistaken for the members of an organisation.
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", []string{"acme/owner", "acme"})
+	defer discharger.Close()
+	err := store.AddOrg("acme", "alice")
+	c.Assert(err, gc.IsNil)
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~acme/meta/members"),
+		Cookies: []*http.Cookie{dischargedAuthCookie(c, srv)},
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusUnauthorized, gc.Commentf("body: %s", rec.Body.Bytes()))
+}
+
+func (s *APISuite) TestOrgsBadRequest(c *gc.C) {
+	for i, test := range []struct {
+		body          string
+		expectMessage string
+	}{{
+		body:          `{}`,
+		expectMessage: "organisation name not specified",
+	}, {
+		body:          `{"Name": "acme/bad"}`,
+		expectMessage: `invalid organisation name "acme/bad"`,
+	}, {
+		body:          `{"Name": "Bad name"}`,
+		expectMessage: `invalid organisation name "Bad name"`,
+	}, {
+		body:          `{"Name": "acme"}`,
+		expectMessage: "owner not specified",
+	}} {
+		c.Logf("test %d: %s", i, test.body)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL("orgs"),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: http.StatusBadRequest,
+			ExpectBody: params.Error{
+				Code:    params.ErrBadRequest,
+				Message: test.expectMessage,
+			},
+		})
+	}
+}
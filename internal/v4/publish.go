@@ -0,0 +1,92 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// POST id/publish
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idpublish
+func (h *Handler) servePublish(id *charm.Reference, fullySpecified bool, w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		return params.ErrMethodNotAllowed
+	}
+	if !fullySpecified {
+		return badRequestf(nil, "id %s must specify a series and revision", id)
+	}
+	var preq params.PublishRequest
+	if err := json.NewDecoder(req.Body).Decode(&preq); err != nil {
+		return badRequestf(err, "cannot unmarshal publish request")
+	}
+	entity, err := h.store.Publish(id, preq.Channels)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound), errgo.Is(params.ErrBadRequest))
+	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditPublish,
+		Entity:    entity.URL,
+		New:       auditValue(preq.Channels),
+	})
+	return jsonhttp.WriteJSON(w, http.StatusOK, params.PublishResponse{
+		Id:       entity.URL,
+		Channels: entity.PublishedChannels(),
+	})
+}
+
+// requestChannel returns the channel specified in the
+// channel query parameter of the given request, if any.
+func requestChannel(req *http.Request) (params.Channel, error) {
+	channel := params.Channel(req.Form.Get("channel"))
+	if channel == params.NoChannel {
+		return params.NoChannel, nil
+	}
+	if err := charmstore.CheckChannels([]params.Channel{channel}); err != nil {
+		return params.NoChannel, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	return channel, nil
+}
+
+// requestChannels returns all the channels specified in
+// the channel query parameters of the given request.
+func requestChannels(req *http.Request) ([]params.Channel, error) {
+	var channels []params.Channel
+	for _, c := range req.Form["channel"] {
+		channels = append(channels, params.Channel(c))
+	}
+	if err := charmstore.CheckChannels(channels); err != nil {
+		return nil, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+	}
+	return channels, nil
+}
+
+// withoutEmbargoed returns the given entities, all sharing the same
+// base entity, without the embargoed ones unless the request is
+// authorized to modify them.
+func (h *Handler) withoutEmbargoed(entities []*mongodoc.Entity, req *http.Request) []*mongodoc.Entity {
+	visible := entities[:0]
+	checked, canWrite := false, false
+	for _, e := range entities {
+		if e.Embargo != nil {
+			if !checked {
+				canWrite = h.authorizeEntityOperation(e.URL, req, opWrite) == nil
+				checked = true
+			}
+			if !canWrite {
+				continue
+			}
+		}
+		visible = append(visible, e)
+	}
+	return visible
+}
@@ -0,0 +1,322 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestPublish(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+
+	// Upload a new revision to the development channel only.
+	s.uploadToChannel(c, "~charmers/trusty/wordpress", "mysql", "development", "cs:~charmers/trusty/wordpress-1")
+
+	// Unresolved ids resolve within the stable channel by default.
+	s.assertGet(c, "~charmers/trusty/wordpress/meta/id-revision", params.IdRevisionResponse{0})
+	s.assertGet(c, "~charmers/wordpress/meta/id-revision?channel=stable", params.IdRevisionResponse{0})
+	s.assertGet(c, "~charmers/wordpress/meta/id-revision?channel=development", params.IdRevisionResponse{1})
+	s.assertGet(c, "~charmers/trusty/wordpress-1/meta/id-revision", params.IdRevisionResponse{1})
+
+	// Publish the new revision to the stable channel.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/trusty/wordpress-1/publish"),
+		Method:  "POST",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Body:     strings.NewReader(`{"Channels": ["stable"]}`),
+		ExpectBody: params.PublishResponse{
+			Id:       charm.MustParseReference("cs:~charmers/trusty/wordpress-1"),
+			Channels: []params.Channel{params.StableChannel, params.DevelopmentChannel},
+		},
+	})
+	s.assertGet(c, "~charmers/trusty/wordpress/meta/id-revision", params.IdRevisionResponse{1})
+
+	// The publication is recorded in the audit log.
+	entries, err := s.store.AuditEntries(charmstore.AuditQuery{
+		Operation: params.AuditPublish,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].Entity.String(), gc.Equals, "cs:~charmers/trusty/wordpress-1")
+	c.Assert(string(entries[0].New), gc.Equals, `["stable"]`)
+}
+
+func (s *APISuite) TestPublishErrors(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+	for i, test := range []struct {
+		method       string
+		url          string
+		body         string
+		expectStatus int
+		expectError  params.Error
+	}{{
+		method:       "POST",
+		url:          "~charmers/wordpress/publish",
+		body:         `{"Channels": ["stable"]}`,
+		expectStatus: http.StatusBadRequest,
+		expectError: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "id cs:~charmers/wordpress must specify a series and revision",
+		},
+	}, {
+		method:       "POST",
+		url:          "~charmers/trusty/wordpress-0/publish",
+		body:         `{"Channels": []}`,
+		expectStatus: http.StatusBadRequest,
+		expectError: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "no channels specified",
+		},
+	}, {
+		method:       "POST",
+		url:          "~charmers/trusty/wordpress-0/publish",
+		body:         `{"Channels": ["beta"]}`,
+		expectStatus: http.StatusBadRequest,
+		expectError: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid channel "beta"`,
+		},
+	}, {
+		method:       "POST",
+		url:          "~charmers/trusty/wordpress-1/publish",
+		body:         `{"Channels": ["stable"]}`,
+		expectStatus: http.StatusNotFound,
+		expectError: params.Error{
+			Code:    params.ErrNotFound,
+			Message: "entity not found",
+		},
+	}, {
+		method:       "PUT",
+		url:          "~charmers/trusty/wordpress-0/publish",
+		body:         `{"Channels": ["stable"]}`,
+		expectStatus: http.StatusMethodNotAllowed,
+		expectError: params.Error{
+			Code:    params.ErrMethodNotAllowed,
+			Message: params.ErrMethodNotAllowed.Error(),
+		},
+	}} {
+		c.Logf("test %d: %s %s", i, test.method, test.url)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL(test.url),
+			Method:  test.method,
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectError,
+		})
+	}
+}
+
+func (s *APISuite) TestResolveInvalidChannel(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("~charmers/wordpress/meta/id?channel=beta"),
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid channel "beta"`,
+		},
+	})
+}
+
+func (s *APISuite) TestChangesPublishedChannel(c *gc.C) {
+	s.publishCharmsAtKnownTimes(c, publishedCharms)
+	// Publish some of the charms to the development channel.
+	for _, index := range []int{1, 4} {
+		p := publishedCharms[index].published()
+		err := s.store.UpdateEntity(p.Id, bson.D{{"$set", bson.D{
+			{"published.development", p.PublishTime.Add(time.Hour)},
+		}}})
+		c.Assert(err, gc.IsNil)
+	}
+	expect := []params.Published{}
+	for _, index := range []int{4, 1} {
+		p := publishedCharms[index].published()
+		p.PublishTime = p.PublishTime.Add(time.Hour)
+		expect = append(expect, p)
+	}
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:    s.srv,
+		URL:        storeURL("changes/published?channel=development"),
+		ExpectBody: expect,
+	})
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:    s.srv,
+		URL:        storeURL("changes/published?channel=candidate"),
+		ExpectBody: []params.Published{},
+	})
+}
+
+func (s *APISuite) TestUploadEmbargoed(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-0")
+	publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	s.uploadWithQuery(c, "~charmers/trusty/wordpress", "mysql", "publish-at="+publishAt.Format(time.RFC3339), "cs:~charmers/trusty/wordpress-1")
+
+	// The embargoed revision is not published.
+	entity, err := s.store.FindEntity(charm.MustParseReference("~charmers/trusty/wordpress-1"), "published", "embargo")
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.Published, gc.HasLen, 0)
+	c.Assert(entity.Embargo.PublishAt.Equal(publishAt), jc.IsTrue)
+	c.Assert(entity.Embargo.Channels, jc.DeepEquals, []params.Channel{params.StableChannel})
+
+	// Unresolved ids ignore the embargoed revision, but writers can
+	// still access it directly.
+	s.assertGet(c, "~charmers/trusty/wordpress/meta/id-revision", params.IdRevisionResponse{0})
+	s.assertGet(c, "~charmers/trusty/wordpress-1/meta/id-revision", params.IdRevisionResponse{1})
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("changes/published"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(strings.Contains(rec.Body.String(), "wordpress-1"), jc.IsFalse)
+
+	// The revision is published at the scheduled time.
+	n, err := s.store.PublishScheduled(publishAt)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 1)
+	s.assertGet(c, "~charmers/trusty/wordpress/meta/id-revision", params.IdRevisionResponse{1})
+}
+
+func (s *APISuite) TestUploadInvalidPublishAt(c *gc.C) {
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("~charmers/trusty/wordpress/archive?hash=1234&publish-at=tomorrow"),
+		Method:       "POST",
+		Username:     serverParams.AuthUsername,
+		Password:     serverParams.AuthPassword,
+		ExpectStatus: http.StatusBadRequest,
+		ExpectBody: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid publish-at parameter: parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+		},
+	})
+}
+
+func (s *authSuite) TestEmbargoedReadAuthorization(c *gc.C) {
+	for i, test := range []struct {
+		username        string
+		expectStatus    int
+		expectExpandIds []params.ExpandedId
+	}{{
+		username:     "kirk",
+		expectStatus: http.StatusUnauthorized,
+		expectExpandIds: []params.ExpandedId{
+			{Id: "cs:~charmers/utopic/wordpress-0"},
+		},
+	}, {
+		username:     "picard",
+		expectStatus: http.StatusOK,
+		expectExpandIds: []params.ExpandedId{
+			{Id: "cs:~charmers/utopic/wordpress-1"},
+			{Id: "cs:~charmers/utopic/wordpress-0"},
+		},
+	}} {
+		c.Logf("test %d: %s", i, test.username)
+		srv, store, discharger := newServerWithDischarger(c, s.Session, test.username, nil)
+		defer discharger.Close()
+		cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+
+		// Add a published and an embargoed revision of the charm.
+		for _, id := range []string{"~charmers/utopic/wordpress-0", "~charmers/utopic/wordpress-1"} {
+			err := store.AddCharmWithArchive(charm.MustParseReference(id), nil, storetesting.Charms.CharmDir("wordpress"))
+			c.Assert(err, gc.IsNil)
+		}
+		err := store.UpdateEntity(charm.MustParseReference("~charmers/utopic/wordpress-1"), bson.D{
+			{"$unset", bson.D{{"published", nil}}},
+			{"$set", bson.D{{"embargo", mongodoc.Embargo{
+				PublishAt: time.Now().Add(time.Hour),
+				Channels:  []params.Channel{params.StableChannel},
+			}}}},
+		})
+		c.Assert(err, gc.IsNil)
+		err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/wordpress"), bson.D{{"$set", bson.D{
+			{"acls.read", []string{params.Everyone}},
+			{"acls.write", []string{"picard"}},
+		}}})
+		c.Assert(err, gc.IsNil)
+
+		// Only writers can read the embargoed revision.
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL("~charmers/utopic/wordpress-1/meta/id-revision"),
+			Cookies: cookies,
+		})
+		c.Assert(rec.Code, gc.Equals, test.expectStatus, gc.Commentf("body: %s", rec.Body))
+
+		// Only writers can see the embargoed revision in lists.
+		rec = httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL("~charmers/wordpress/expand-id"),
+			Cookies: cookies,
+		})
+		c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body))
+		c.Assert(rec.Body.String(), jc.JSONEquals, test.expectExpandIds)
+
+		_, err = store.DB.Entities().RemoveAll(nil)
+		c.Assert(err, gc.IsNil)
+	}
+}
+
+// uploadToChannel uploads the testing charm with the given name
+// to the given id through the API, publishing it to the given channel,
+// and checks that the resulting id is expectId.
+func (s *APISuite) uploadToChannel(c *gc.C, id, charmName, channel, expectId string) {
+	s.uploadWithQuery(c, id, charmName, "channel="+channel, expectId)
+	entity, err := s.store.FindEntity(charm.MustParseReference(expectId), "published")
+	c.Assert(err, gc.IsNil)
+	c.Assert(entity.PublishedChannels(), jc.DeepEquals, []params.Channel{params.Channel(channel)})
+}
+
+// uploadWithQuery uploads the testing charm with the given name
+// to the given id through the API, adding the given query to the
+// upload URL, and checks that the resulting id is expectId.
+func (s *APISuite) uploadWithQuery(c *gc.C, id, charmName, query, expectId string) {
+	path := storetesting.Charms.CharmArchivePath(c.MkDir(), charmName)
+	f, err := os.Open(path)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	hash, size := hashOf(f)
+	_, err = f.Seek(0, 0)
+	c.Assert(err, gc.IsNil)
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:       s.srv,
+		URL:           storeURL(id + "/archive?hash=" + hash + "&" + query),
+		Method:        "POST",
+		ContentLength: size,
+		Header: http.Header{
+			"Content-Type": {"application/zip"},
+		},
+		Body:     f,
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		ExpectBody: params.ArchiveUploadResponse{
+			Id: charm.MustParseReference(expectId),
+		},
+	})
+}
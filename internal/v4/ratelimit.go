@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+
+	"gopkg.in/juju/charmstore.v4/internal/ratelimit"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// newRateLimiters returns the rate limiters for the classes of
+// endpoints limited in the given configuration, keyed by class.
+func newRateLimiters(limits map[string]params.RateLimit) map[string]*ratelimit.Limiter {
+	limiters := make(map[string]*ratelimit.Limiter)
+	for class, limit := range limits {
+		if limit.Rate <= 0 {
+			logger.Warningf("ignoring invalid rate %v for %s requests", limit.Rate, class)
+			continue
+		}
+		limiters[class] = ratelimit.New(limit.Rate, limit.Burst)
+	}
+	return limiters
+}
+
+// rateLimitClass returns the class of endpoints the given request
+// belongs to, or the empty string if the request is not subject to
+// rate limiting. Note that the path is relative to the handler.
+func rateLimitClass(req *http.Request) string {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	switch {
+	case path == "/search" || strings.HasPrefix(path, "/search/"):
+		return params.RateLimitSearch
+	case strings.HasSuffix(path, "/archive"):
+		switch req.Method {
+		case "GET", "HEAD":
+			return params.RateLimitDownload
+		case "POST", "PUT":
+			return params.RateLimitUpload
+		}
+	case strings.Contains(path, "/archive/"):
+		return params.RateLimitDownload
+	case strings.Contains(path+"/", "/meta/"):
+		return params.RateLimitMeta
+	}
+	return ""
+}
+
+// checkRateLimit checks that the client making the given request has
+// not exceeded the rate limit configured for the request class. If it
+// has, a Retry-After header is set in the response and an error with
+// the params.ErrTooManyRequests cause is returned.
+func (h *Handler) checkRateLimit(w http.ResponseWriter, req *http.Request) error {
+	class := rateLimitClass(req)
+	limiter := h.limiters[class]
+	if limiter == nil {
+		return nil
+	}
+	key, ok := h.rateLimitKey(req)
+	if !ok {
+		return nil
+	}
+	wait, ok := limiter.Take(key)
+	if ok {
+		return nil
+	}
+	// Round up to the next second, as required by the header format.
+	seconds := (wait + time.Second - 1) / time.Second
+	w.Header().Set("Retry-After", fmt.Sprint(int64(seconds)))
+	return errgo.WithCausef(nil, params.ErrTooManyRequests, "rate limit exceeded for %s requests", class)
+}
+
+// rateLimitKey returns the key identifying the client making the given
+// request for rate limiting: the user owning the API token used by the
+// request, if valid, or the client IP address otherwise. API tokens are
+// cheap to verify, as they are looked up by id and only their hash is
+// compared, while macaroons are not verified, as that would be costly
+// enough to defeat the purpose of rate limiting. It reports false if
+// the request is made with the administrator credentials, which are
+// not subject to rate limiting.
+func (h *Handler) rateLimitKey(req *http.Request) (string, bool) {
+	user, passwd, err := parseCredentials(req)
+	if err == nil && h.isAdminCredentials(user, passwd) {
+		return "", false
+	}
+	if token, ok := parseBearerToken(req); ok {
+		if t, err := h.store.CheckAPIToken(token); err == nil {
+			return "user:" + t.User, true
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host, true
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charmstore.v4/internal/v4"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestRateLimit(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/precise/wordpress-23")
+	config := serverParams
+	config.RateLimits = map[string]params.RateLimit{
+		params.RateLimitMeta: {Rate: 0.5, Burst: 2},
+	}
+	srv, _ := newServer(c, s.Session, nil, config)
+	get := func(url string, admin bool) *httptest.ResponseRecorder {
+		p := httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL(url),
+		}
+		if admin {
+			p.Username = serverParams.AuthUsername
+			p.Password = serverParams.AuthPassword
+		}
+		return httptesting.DoRequest(c, p)
+	}
+
+	// The burst is allowed.
+	for i := 0; i < 2; i++ {
+		rec := get("~charmers/precise/wordpress-23/meta/id-name", false)
+		c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("request %d, body: %s", i, rec.Body.Bytes()))
+	}
+
+	// Then requests are refused.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      srv,
+		URL:          storeURL("~charmers/precise/wordpress-23/meta/id-name"),
+		ExpectStatus: 429,
+		ExpectBody: params.Error{
+			Code:    params.ErrTooManyRequests,
+			Message: "rate limit exceeded for meta requests",
+		},
+	})
+	rec := get("meta/id-name?id=~charmers/precise/wordpress-23", false)
+	c.Assert(rec.Code, gc.Equals, 429)
+	c.Assert(rec.Header().Get("Retry-After"), gc.Equals, "2")
+
+	// Other classes of endpoints are not limited.
+	rec = get("~charmers/precise/wordpress-23/archive", false)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+
+	// Nor is the administrator.
+	rec = get("~charmers/precise/wordpress-23/meta/id-name", true)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+
+	// Requests made with an API token are limited per user, so
+	// they are not affected by the requests made from the same
+	// address, and all the tokens of a user share the limit.
+	getWithToken := func(token string) int {
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL("~charmers/precise/wordpress-23/meta/id-name"),
+			Header: http.Header{
+				"Authorization": {"Bearer " + token},
+			},
+		})
+		return rec.Code
+	}
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		t := s.createAPIToken(c, params.APITokenRequest{
+			User:       "bob",
+			Operations: []string{params.TokenRead},
+			Expires:    time.Now().Add(time.Hour),
+		})
+		tokens = append(tokens, t.Token)
+	}
+	c.Assert(getWithToken(tokens[0]), gc.Equals, http.StatusOK)
+	c.Assert(getWithToken(tokens[1]), gc.Equals, http.StatusOK)
+	c.Assert(getWithToken(tokens[0]), gc.Equals, 429)
+
+	// Invalid tokens are limited by address.
+	c.Assert(getWithToken("bad.token"), gc.Equals, 429)
+}
+
+var rateLimitClassTests = []struct {
+	method      string
+	path        string
+	expectClass string
+}{{
+	path:        "/search",
+	expectClass: params.RateLimitSearch,
+}, {
+	path:        "/search/interesting",
+	expectClass: params.RateLimitSearch,
+}, {
+	path:        "/~bob/trusty/wordpress-0/archive",
+	expectClass: params.RateLimitDownload,
+}, {
+	path:        "/wordpress/archive/hooks/install",
+	expectClass: params.RateLimitDownload,
+}, {
+	method:      "POST",
+	path:        "/~bob/trusty/wordpress/archive",
+	expectClass: params.RateLimitUpload,
+}, {
+	method:      "PUT",
+	path:        "/~bob/trusty/wordpress-0/archive",
+	expectClass: params.RateLimitUpload,
+}, {
+	method: "DELETE",
+	path:   "/~bob/trusty/wordpress-0/archive",
+}, {
+	path:        "/wordpress/meta/any",
+	expectClass: params.RateLimitMeta,
+}, {
+	path:        "/meta/archive-size",
+	expectClass: params.RateLimitMeta,
+}, {
+	path:        "/wordpress/meta",
+	expectClass: params.RateLimitMeta,
+}, {
+	path: "/wordpress/expand-id",
+}, {
+	path: "/changes/published",
+}}
+
+func (s *APISuite) TestRateLimitClass(c *gc.C) {
+	for i, test := range rateLimitClassTests {
+		c.Logf("test %d: %s %s", i, test.method, test.path)
+		method := test.method
+		if method == "" {
+			method = "GET"
+		}
+		req, err := http.NewRequest(method, test.path, nil)
+		c.Assert(err, gc.IsNil)
+		c.Assert(v4.RateLimitClass(req), gc.Equals, test.expectClass)
+	}
+}
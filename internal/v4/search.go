@@ -25,15 +25,27 @@ func (h *Handler) serveSearch(_ http.Header, req *http.Request) (interface{}, er
 	if err != nil {
 		return "", err
 	}
-	auth, err := h.checkRequest(req)
+	auth, err := h.checkRequest(req, params.OperationRead, nil)
 	if err != nil {
 		logger.Infof("authorization failed on search request, granting no privileges: %v", err)
 	}
+	if auth.Token != nil {
+		// API tokens restricted to a namespace or entity, or not
+		// allowing read operations, grant no search privileges.
+		if err := h.checkAPITokenScope(auth.Token, opRead, nil); err != nil {
+			logger.Infof("API token not valid for search request, granting no privileges: %v", err)
+			auth = authorization{}
+		}
+	}
 	sp.Admin = auth.Admin
 	if auth.Username != "" {
 		sp.Groups = append(sp.Groups, auth.Username)
 	}
-	sp.Groups = append(sp.Groups, auth.Groups...)
+	groups, err := h.userGroups(auth)
+	if err != nil {
+		logger.Infof("cannot retrieve user groups on search request: %v", err)
+	}
+	sp.Groups = append(sp.Groups, groups...)
 	// perform query
 	results, err := h.store.Search(sp)
 	if err != nil {
@@ -117,11 +129,24 @@ func parseSearchParams(req *http.Request) (charmstore.SearchParams, error) {
 					sp.Include = append(sp.Include, s)
 				}
 			}
+		case "advisories", "deprecated", "stale":
+			if _, err := parseBool(v[0]); err != nil {
+				return charmstore.SearchParams{}, badRequestf(err, "invalid %s parameter", k)
+			}
+			if sp.Filters == nil {
+				sp.Filters = make(map[string][]string)
+			}
+			sp.Filters[k] = v[:1]
 		case "description", "name", "owner", "provides", "requires", "series", "summary", "tags", "type":
 			if sp.Filters == nil {
 				sp.Filters = make(map[string][]string)
 			}
 			sp.Filters[k] = v
+		case "channel":
+			sp.Channel = params.Channel(v[0])
+			if err := charmstore.CheckChannels([]params.Channel{sp.Channel}); err != nil {
+				return charmstore.SearchParams{}, errgo.Mask(err, errgo.Is(params.ErrBadRequest))
+			}
 		case "skip":
 			sp.Skip, err = strconv.Atoi(v[0])
 			if err != nil {
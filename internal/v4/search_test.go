@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/juju/loggo"
 	jc "github.com/juju/testing/checkers"
@@ -233,6 +234,52 @@ func (s *SearchSuite) TestParseSearchParams(c *gc.C) {
 				"type": {"text"},
 			},
 		},
+	}, {
+		about: "stale filter",
+		query: "stale=1",
+		expectParams: charmstore.SearchParams{
+			Filters: map[string][]string{
+				"stale": {"1"},
+			},
+		},
+	}, {
+		about:       "invalid stale filter",
+		query:       "stale=yes",
+		expectError: `invalid stale parameter: unexpected bool value "yes" (must be "0" or "1")`,
+	}, {
+		about: "deprecated filter",
+		query: "deprecated=1",
+		expectParams: charmstore.SearchParams{
+			Filters: map[string][]string{
+				"deprecated": {"1"},
+			},
+		},
+	}, {
+		about:       "invalid deprecated filter",
+		query:       "deprecated=yes",
+		expectError: `invalid deprecated parameter: unexpected bool value "yes" (must be "0" or "1")`,
+	}, {
+		about: "advisories filter",
+		query: "advisories=1",
+		expectParams: charmstore.SearchParams{
+			Filters: map[string][]string{
+				"advisories": {"1"},
+			},
+		},
+	}, {
+		about:       "invalid advisories filter",
+		query:       "advisories=yes",
+		expectError: `invalid advisories parameter: unexpected bool value "yes" (must be "0" or "1")`,
+	}, {
+		about: "channel",
+		query: "channel=development",
+		expectParams: charmstore.SearchParams{
+			Channel: params.DevelopmentChannel,
+		},
+	}, {
+		about:       "invalid channel",
+		query:       "channel=beta",
+		expectError: `invalid channel "beta"`,
 	}, {
 		about: "many filters",
 		query: "name=name&owner=owner&series=series1&series=series2",
@@ -727,6 +774,158 @@ func (s *SearchSuite) TestDownloadsBoost(c *gc.C) {
 	c.Assert(sr.Results[2].Id.Name, gc.Equals, "mysql")
 }
 
+func (s *SearchSuite) TestStaleBundleSearch(c *gc.C) {
+	bundle := &testingBundle{
+		data: &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"wordpress": {
+					Charm:    "precise/wordpress-23",
+					NumUnits: 1,
+				},
+			},
+		},
+	}
+	err := s.store.AddBundle(bundle, charmstore.AddParams{
+		URL:      charm.MustParseReference("cs:~charmers/bundle/wordpress-pinned-1"),
+		BlobName: "blobName",
+		BlobHash: fakeBlobHash,
+		BlobSize: fakeBlobSize,
+	})
+	c.Assert(err, gc.IsNil)
+	err = s.ES.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+	s.assertSearchResults(c, "stale=1", nil)
+
+	// Adding a new revision of the pinned charm makes the bundle stale.
+	err = s.store.AddCharmWithArchive(
+		charm.MustParseReference("cs:~charmers/precise/wordpress-24"),
+		charm.MustParseReference("cs:precise/wordpress-24"),
+		getCharm("wordpress"),
+	)
+	c.Assert(err, gc.IsNil)
+	// The search records of the bundles are updated in the background.
+	s.waitSearchResults(c, "stale=1", 1)
+	s.assertSearchResults(c, "stale=1", []string{"cs:~charmers/bundle/wordpress-pinned-1"})
+	s.assertSearchResults(c, "stale=0&type=bundle", []string{exportTestBundles["wordpress-simple"]})
+}
+
+func (s *SearchSuite) TestDeprecatedSearch(c *gc.C) {
+	s.assertPut(c, "~charmers/precise/wordpress-23/meta/deprecated", params.DeprecatedRequest{
+		Deprecated: true,
+		Reason:     "superseded",
+	})
+	err := s.ES.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+	s.assertSearchResults(c, "deprecated=1", []string{exportTestCharms["wordpress"]})
+	s.assertSearchResults(c, "deprecated=0&type=charm", []string{
+		exportTestCharms["mysql"],
+		exportTestCharms["varnish"],
+	})
+
+	// Deprecating all the revisions updates the search records too.
+	s.assertPut(c, "~charmers/precise/wordpress-23/meta/deprecated", params.DeprecatedRequest{})
+	s.assertPut(c, "~charmers/trusty/mysql-7/meta/deprecated", params.DeprecatedRequest{
+		Deprecated:   true,
+		Reason:       "superseded",
+		AllRevisions: true,
+	})
+	err = s.ES.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+	s.assertSearchResults(c, "deprecated=1", []string{exportTestCharms["mysql"]})
+}
+
+func (s *SearchSuite) TestChannelSearch(c *gc.C) {
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~charmers/precise/wordpress-23/publish"),
+		Method:  "POST",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Body:     strings.NewReader(`{"Channels": ["development"]}`),
+		ExpectBody: params.PublishResponse{
+			Id:       charm.MustParseReference("cs:~charmers/precise/wordpress-23"),
+			Channels: []params.Channel{params.StableChannel, params.DevelopmentChannel},
+		},
+	})
+	err := s.ES.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+	s.assertSearchResults(c, "channel=development", []string{exportTestCharms["wordpress"]})
+	s.assertSearchResults(c, "channel=candidate", []string{})
+	s.assertSearchResults(c, "channel=stable&name=wordpress&type=charm", []string{exportTestCharms["wordpress"]})
+}
+
+func (s *SearchSuite) TestAdvisoriesSearch(c *gc.C) {
+	err := s.store.AddAdvisory(&mongodoc.Advisory{
+		Id:          "CVE-2015-1234",
+		BaseURL:     charm.MustParseReference("cs:~charmers/wordpress"),
+		Severity:    params.SeverityHigh,
+		Description: "remote code execution",
+		Affected:    []params.RevisionRange{{Series: "precise", From: 0, To: 23}},
+	})
+	c.Assert(err, gc.IsNil)
+	err = s.ES.RefreshIndex(s.TestIndex)
+	c.Assert(err, gc.IsNil)
+	s.assertSearchResults(c, "advisories=1", []string{exportTestCharms["wordpress"]})
+	s.assertSearchResults(c, "advisories=0&type=charm", []string{
+		exportTestCharms["mysql"],
+		exportTestCharms["varnish"],
+	})
+
+	// The advisories can be included in the results.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("search?advisories=1&include=advisories"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	var sr struct {
+		Results []struct {
+			Meta struct {
+				Advisories []params.Advisory `json:"advisories"`
+			}
+		}
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &sr)
+	c.Assert(err, gc.IsNil)
+	c.Assert(sr.Results, gc.HasLen, 1)
+	c.Assert(sr.Results[0].Meta.Advisories, gc.HasLen, 1)
+	c.Assert(sr.Results[0].Meta.Advisories[0].Id, gc.Equals, "CVE-2015-1234")
+}
+
+func (s *SearchSuite) assertSearchResults(c *gc.C, query string, expect []string) {
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("search?" + query),
+	})
+	var sr params.SearchResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &sr)
+	c.Assert(err, gc.IsNil)
+	c.Assert(sr.Results, gc.HasLen, len(expect))
+	assertResultSet(c, sr, expect)
+}
+
+// waitSearchResults waits for the search with the given query to
+// return the given number of results.
+func (s *SearchSuite) waitSearchResults(c *gc.C, query string, n int) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		err := s.ES.RefreshIndex(s.TestIndex)
+		c.Assert(err, gc.IsNil)
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: s.srv,
+			URL:     storeURL("search?" + query),
+		})
+		var sr params.SearchResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &sr)
+		c.Assert(err, gc.IsNil)
+		if len(sr.Results) == n {
+			return
+		}
+	}
+	c.Fatalf("timed out waiting for %d results for search %q", n, query)
+}
+
 // TODO(mhilton) remove this test when removing legacy counts logic.
 func (s *SearchSuite) TestLegacyStatsUpdatesSearch(c *gc.C) {
 	patchLegacyDownloadCountsEnabled(s.AddCleanup, true)
@@ -0,0 +1,100 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+const (
+	// defaultShareLifetime holds the duration for which shared
+	// links are valid when no expiry time is requested.
+	defaultShareLifetime = 24 * time.Hour
+
+	// maxShareLifetime holds the maximum duration
+	// for which a shared link can be valid.
+	maxShareLifetime = 7 * 24 * time.Hour
+)
+
+// POST id/share
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idshare
+func (h *Handler) serveShare(id *charm.Reference, fullySpecified bool, w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		return params.ErrMethodNotAllowed
+	}
+	// The router only checks read access, so that the id is
+	// resolved as for a GET request, but handing out the entity
+	// requires write access.
+	if err := h.authorizeEntityOperation(id, req, opWrite); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	var sreq params.ShareRequest
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&sreq); err != nil {
+			return badRequestf(err, "cannot unmarshal share request")
+		}
+	}
+	now := time.Now()
+	expires := sreq.Expires
+	if expires.IsZero() {
+		expires = now.Add(defaultShareLifetime)
+	}
+	if !expires.After(now) {
+		return badRequestf(nil, "expiry time must be in the future")
+	}
+	if expires.After(now.Add(maxShareLifetime)) {
+		return badRequestf(nil, "expiry time must be within %v", maxShareLifetime)
+	}
+	token, err := h.store.NewShareToken(id, sreq.Meta, expires)
+	if err != nil {
+		return errgo.Notef(err, "cannot create share token")
+	}
+	h.store.IncCounterAsync(charmstore.EntityStatsKey(id, params.StatsShareCreate))
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditShare,
+		Entity:    id,
+		New: auditValue(params.ShareRequest{
+			Expires: time.Unix(expires.Unix(), 0).UTC(),
+			Meta:    sreq.Meta,
+		}),
+	})
+	return jsonhttp.WriteJSON(w, http.StatusOK, params.ShareResponse{
+		URL:     id.Path() + "/archive?share=" + url.QueryEscape(token),
+		Token:   token,
+		Expires: time.Unix(expires.Unix(), 0).UTC(),
+	})
+}
+
+// authorizeShare checks that the given share token allows the request,
+// which reads the entity with the given id. Each use of a valid share
+// token is recorded in the stats.
+func (h *Handler) authorizeShare(id *charm.Reference, req *http.Request, token string) error {
+	meta, err := h.store.CheckShareToken(token, id)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrUnauthorized))
+	}
+	// Note that req.RequestURI holds the path of the request
+	// relative to the handler.
+	path := strings.TrimSuffix(req.RequestURI, "/")
+	switch {
+	case strings.HasSuffix(path, "/archive"):
+	case meta && (strings.Contains(path, "/meta/") || strings.HasSuffix(path, "/meta")):
+	default:
+		return errgo.WithCausef(nil, params.ErrUnauthorized, "share token does not allow this request")
+	}
+	h.store.IncCounterAsync(charmstore.EntityStatsKey(id, params.StatsShareUse))
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting/stats"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *authSuite) TestShare(c *gc.C) {
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	cookies := []*http.Cookie{dischargedAuthCookie(c, srv)}
+
+	// Add two revisions of a charm only accessible by bob.
+	for _, id := range []string{"~charmers/utopic/wordpress-42", "~charmers/utopic/wordpress-43"} {
+		err := store.AddCharmWithArchive(charm.MustParseReference(id), nil, storetesting.Charms.CharmDir("wordpress"))
+		c.Assert(err, gc.IsNil)
+	}
+	err := store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/wordpress"), bson.D{{"$set",
+		bson.D{{"acls.read", []string{"bob"}}, {"acls.write", []string{"bob"}}},
+	}})
+	c.Assert(err, gc.IsNil)
+
+	share := func(sreq params.ShareRequest) params.ShareResponse {
+		body, err := json.Marshal(sreq)
+		c.Assert(err, gc.IsNil)
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL("~charmers/utopic/wordpress-42/share"),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body:    strings.NewReader(string(body)),
+			Cookies: cookies,
+		})
+		c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+		var resp params.ShareResponse
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		c.Assert(err, gc.IsNil)
+		return resp
+	}
+	get := func(url string) int {
+		rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+			Handler: srv,
+			URL:     storeURL(url),
+		})
+		return rec.Code
+	}
+
+	// Without a share token, anonymous users cannot read the charm.
+	c.Assert(get("~charmers/utopic/wordpress-42/archive"), gc.Not(gc.Equals), http.StatusOK)
+
+	resp := share(params.ShareRequest{})
+	c.Assert(strings.HasPrefix(resp.URL, "~charmers/utopic/wordpress-42/archive?share="), gc.Equals, true, gc.Commentf("url %q", resp.URL))
+	c.Assert(resp.Expires.After(time.Now().Add(23*time.Hour)), gc.Equals, true)
+
+	// The shared link allows downloading the archive.
+	c.Assert(get(resp.URL), gc.Equals, http.StatusOK)
+
+	// It does not allow retrieving metadata or other revisions.
+	c.Assert(get("~charmers/utopic/wordpress-42/meta/archive-size?share="+resp.Token), gc.Equals, http.StatusUnauthorized)
+	c.Assert(get("~charmers/utopic/wordpress-43/archive?share="+resp.Token), gc.Equals, http.StatusUnauthorized)
+
+	// Tokens can include the metadata.
+	resp = share(params.ShareRequest{Meta: true})
+	c.Assert(get("~charmers/utopic/wordpress-42/meta/archive-size?share="+resp.Token), gc.Equals, http.StatusOK)
+	c.Assert(get("~charmers/utopic/wordpress-42/archive?share="+resp.Token), gc.Equals, http.StatusOK)
+
+	// Bad tokens are rejected.
+	c.Assert(get("~charmers/utopic/wordpress-42/archive?share=bad"), gc.Equals, http.StatusUnauthorized)
+
+	// Each use is recorded in the stats.
+	if storetesting.MongoJSEnabled() {
+		stats.CheckCounterSum(c, store, []string{params.StatsShareCreate, "utopic", "wordpress", "charmers", "42"}, false, 2)
+		stats.CheckCounterSum(c, store, []string{params.StatsShareUse, "utopic", "wordpress", "charmers", "42"}, false, 3)
+	}
+
+	// Each creation is recorded in the audit log.
+	entries, err := store.AuditEntries(charmstore.AuditQuery{
+		Operation: params.AuditShare,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 2)
+	c.Assert(entries[0].User, gc.Equals, "bob")
+	c.Assert(entries[0].Entity.String(), gc.Equals, "cs:~charmers/utopic/wordpress-42")
+	var logged params.ShareRequest
+	err = json.Unmarshal(entries[0].New, &logged)
+	c.Assert(err, gc.IsNil)
+	c.Assert(logged.Meta, gc.Equals, true)
+	c.Assert(logged.Expires.Equal(resp.Expires), gc.Equals, true)
+}
+
+func (s *authSuite) TestShareRequiresWritePermission(c *gc.C) {
+	// Bob can read the charm but not share it.
+	srv, store, discharger := newServerWithDischarger(c, s.Session, "bob", nil)
+	defer discharger.Close()
+	err := store.AddCharmWithArchive(charm.MustParseReference("~charmers/utopic/wordpress-42"), nil, storetesting.Charms.CharmDir("wordpress"))
+	c.Assert(err, gc.IsNil)
+	err = store.DB.BaseEntities().UpdateId(charm.MustParseReference("~charmers/wordpress"), bson.D{{"$set",
+		bson.D{{"acls.read", []string{"bob"}}},
+	}})
+	c.Assert(err, gc.IsNil)
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: srv,
+		URL:     storeURL("~charmers/utopic/wordpress-42/share"),
+		Method:  "POST",
+		Cookies: []*http.Cookie{dischargedAuthCookie(c, srv)},
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusUnauthorized, gc.Commentf("body: %s", rec.Body.Bytes()))
+}
+
+func (s *APISuite) TestShareBadExpiry(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/precise/wordpress-23")
+	for i, test := range []struct {
+		expires       time.Time
+		expectMessage string
+	}{{
+		expires:       time.Now().Add(-time.Hour),
+		expectMessage: "expiry time must be in the future",
+	}, {
+		expires:       time.Now().Add(30 * 24 * time.Hour),
+		expectMessage: "expiry time must be within 168h0m0s",
+	}} {
+		c.Logf("test %d: %v", i, test.expires)
+		body, err := json.Marshal(params.ShareRequest{Expires: test.expires})
+		c.Assert(err, gc.IsNil)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL("~charmers/precise/wordpress-23/share"),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			Body:         strings.NewReader(string(body)),
+			ExpectStatus: http.StatusBadRequest,
+			ExpectBody: params.Error{
+				Code:    params.ErrBadRequest,
+				Message: test.expectMessage,
+			},
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// POST id/transfer
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idtransfer
+func (h *Handler) serveTransfer(id *charm.Reference, fullySpecified bool, w http.ResponseWriter, req *http.Request) error {
+	if err := h.authorize(req, nil); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	if req.Method != "POST" {
+		return params.ErrMethodNotAllowed
+	}
+	if id.User == "" {
+		return badRequestf(nil, "cannot transfer promulgated id %s", id)
+	}
+	var treq params.TransferRequest
+	if err := json.NewDecoder(req.Body).Decode(&treq); err != nil {
+		return badRequestf(err, "cannot unmarshal transfer request")
+	}
+	if err := checkOrgName(treq.User); err != nil {
+		return badRequestf(nil, "invalid user %q", treq.User)
+	}
+	from := *id
+	from.Series = ""
+	from.Revision = -1
+	to, err := h.store.TransferBaseEntity(&from, treq.User)
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound), errgo.Is(params.ErrForbidden))
+	}
+	h.addAudit(req, &mongodoc.AuditEntry{
+		Operation: params.AuditTransfer,
+		Entity:    &from,
+		Old:       auditValue(from.String()),
+		New:       auditValue(to.String()),
+	})
+	return jsonhttp.WriteJSON(w, http.StatusOK, params.TransferResponse{
+		Id: to,
+	})
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestTransfer(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~alice/trusty/wordpress-0")
+	s.addCharm(c, "wordpress", "cs:~alice/trusty/wordpress-1")
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("~alice/trusty/wordpress-1/transfer"),
+		Method:  "POST",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+		Body:     strings.NewReader(`{"User": "bob"}`),
+		ExpectBody: params.TransferResponse{
+			Id: charm.MustParseReference("cs:~bob/wordpress"),
+		},
+	})
+
+	// The old ids resolve to the new owner.
+	for _, id := range []string{"~alice/trusty/wordpress-0", "~alice/wordpress"} {
+		s.assertGet(c, id+"/meta/id-user", params.IdUserResponse{"bob"})
+	}
+	s.assertGet(c, "~alice/wordpress/meta/id", params.IdResponse{
+		Id:       charm.MustParseReference("cs:~bob/trusty/wordpress-1"),
+		User:     "bob",
+		Series:   "trusty",
+		Name:     "wordpress",
+		Revision: 1,
+	})
+
+	// The transfer is recorded in the audit log.
+	entries, err := s.store.AuditEntries(charmstore.AuditQuery{
+		Operation: params.AuditTransfer,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].Entity.String(), gc.Equals, "cs:~alice/wordpress")
+	c.Assert(string(entries[0].New), gc.Equals, `"cs:~bob/wordpress"`)
+}
+
+func (s *APISuite) TestTransferErrors(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~alice/trusty/wordpress-0")
+	s.addCharm(c, "wordpress", "cs:~bob/trusty/wordpress-0")
+	for i, test := range []struct {
+		url          string
+		body         string
+		expectStatus int
+		expectError  params.Error
+	}{{
+		url:          "trusty/wordpress-0/transfer",
+		body:         `{"User": "bob"}`,
+		expectStatus: http.StatusBadRequest,
+		expectError: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: "cannot transfer promulgated id cs:trusty/wordpress-0",
+		},
+	}, {
+		url:          "~alice/wordpress/transfer",
+		body:         `{"User": "bad/user"}`,
+		expectStatus: http.StatusBadRequest,
+		expectError: params.Error{
+			Code:    params.ErrBadRequest,
+			Message: `invalid user "bad/user"`,
+		},
+	}, {
+		url:          "~alice/wordpress/transfer",
+		body:         `{"User": "bob"}`,
+		expectStatus: http.StatusForbidden,
+		expectError: params.Error{
+			Code:    params.ErrForbidden,
+			Message: "cs:~bob/wordpress already exists",
+		},
+	}, {
+		url:          "~alice/mysql/transfer",
+		body:         `{"User": "bob"}`,
+		expectStatus: http.StatusNotFound,
+		expectError: params.Error{
+			Code:    params.ErrNotFound,
+			Message: "base entity not found",
+		},
+	}} {
+		c.Logf("test %d: %s %s", i, test.url, test.body)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL(test.url),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Username:     serverParams.AuthUsername,
+			Password:     serverParams.AuthPassword,
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectError,
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/mgo.v2/bson"
+
+	"gopkg.in/juju/charmstore.v4/internal/mongodoc"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// upgradeReportFields holds the entity fields required
+// to produce an upgrade report.
+var upgradeReportFields = []string{
+	"_id",
+	"promulgated-url",
+	"charmmeta",
+	"charmconfig",
+	"charmactions",
+	"charmprovidedinterfaces",
+	"embargo",
+}
+
+// GET id/meta/upgrade-report[?from=rev]
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetaupgrade-report
+func (h *Handler) metaUpgradeReport(entity *mongodoc.Entity, id *charm.Reference, path string, flags url.Values, req *http.Request) (interface{}, error) {
+	if entity.CharmMeta == nil {
+		// Upgrade reports are only available for charms.
+		return nil, nil
+	}
+	var from *mongodoc.Entity
+	if fromStr := flags.Get("from"); fromStr != "" {
+		rev, err := strconv.Atoi(fromStr)
+		if err != nil || rev < 0 {
+			return nil, badRequestf(nil, "invalid from revision %q", fromStr)
+		}
+		fromId := *id
+		fromId.Revision = rev
+		from, err = h.store.FindEntity(&fromId, upgradeReportFields...)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Is(params.ErrNotFound))
+		}
+		if from.Embargo != nil {
+			// Embargoed revisions only exist for the users
+			// allowed to modify them.
+			if err := h.authorizeEntityOperation(from.URL, req, opWrite); err != nil {
+				return nil, errgo.WithCausef(nil, params.ErrNotFound, "entity not found")
+			}
+		}
+	} else {
+		var err error
+		from, err = h.previousRevision(id)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+	}
+	if from == nil {
+		// There is no earlier revision to compare against.
+		return &params.UpgradeReportResponse{}, nil
+	}
+	if from.CharmMeta == nil {
+		return nil, badRequestf(nil, "cannot compare charm with bundle %s", from.PreferredURL(id.User == ""))
+	}
+	return upgradeReport(from, entity, id.User == ""), nil
+}
+
+// previousRevision returns the entity with the highest revision lower
+// than the revision of the given id, with the same series and name.
+// Promulgated revisions are used if the id has no user, and embargoed
+// revisions are ignored.
+// It returns a nil entity if there is no such revision.
+func (h *Handler) previousRevision(id *charm.Reference) (*mongodoc.Entity, error) {
+	searchURL := *id
+	searchURL.Revision = -1
+	q := h.store.EntitiesQuery(&searchURL)
+	if id.User == "" {
+		q = q.Sort("-promulgated-revision")
+	} else {
+		q = q.Sort("-revision")
+	}
+	var docs []*mongodoc.Entity
+	if err := q.Select(bson.D{{"_id", 1}, {"promulgated-url", 1}, {"embargo", 1}}).All(&docs); err != nil {
+		return nil, errgo.Notef(err, "cannot get ids")
+	}
+	for _, doc := range docs {
+		url := doc.PreferredURL(id.User == "")
+		if url.Revision >= id.Revision || doc.Embargo != nil {
+			continue
+		}
+		entity, err := h.store.FindEntity(url, upgradeReportFields...)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		return entity, nil
+	}
+	return nil, nil
+}
+
+// upgradeReport returns a report of the changes between the from
+// and to charm entities, classifying each one as breaking or not.
+func upgradeReport(from, to *mongodoc.Entity, promulgated bool) *params.UpgradeReportResponse {
+	var changes upgradeChanges
+	if diff := metadataDiff(from.CharmMeta, to.CharmMeta); diff != nil {
+		for _, name := range sortedValueChangeKeys(diff.Fields) {
+			changes.add("metadata", name, name == "subordinate", "%s changed", name)
+		}
+	}
+	changes.addRelationChanges(relationAttrs(from.CharmMeta), relationAttrs(to.CharmMeta))
+	if diff := configDiff(from.CharmConfig, to.CharmConfig); diff != nil {
+		changes.addItemChanges("config", "option", diff, map[string]bool{
+			"type": true,
+		})
+	}
+	if diff := actionsDiff(from.CharmActions, to.CharmActions); diff != nil {
+		changes.addItemChanges("action", "action", diff, map[string]bool{
+			"params": true,
+		})
+	}
+	removed, added := stringSetDiff(from.CharmProvidedInterfaces, to.CharmProvidedInterfaces)
+	if len(removed) > 0 {
+		changes.add("provided-interfaces", "", true, "provided interfaces removed: %s", strings.Join(removed, ", "))
+	}
+	if len(added) > 0 {
+		changes.add("provided-interfaces", "", false, "provided interfaces added: %s", strings.Join(added, ", "))
+	}
+	report := &params.UpgradeReportResponse{
+		From:    from.PreferredURL(promulgated),
+		Changes: changes,
+	}
+	for _, change := range changes {
+		if change.Breaking {
+			report.Breaking = true
+			break
+		}
+	}
+	return report
+}
+
+type upgradeChanges []params.UpgradeChange
+
+func (c *upgradeChanges) add(kind, name string, breaking bool, f string, a ...interface{}) {
+	*c = append(*c, params.UpgradeChange{
+		Kind:        kind,
+		Name:        name,
+		Breaking:    breaking,
+		Description: fmt.Sprintf(f, a...),
+	})
+}
+
+// addItemChanges adds the changes described by the given items diff.
+// Removed items, and changes to any of the attributes in
+// breakingAttrs, are considered to be breaking.
+func (c *upgradeChanges) addItemChanges(kind, noun string, diff *params.ItemsDiff, breakingAttrs map[string]bool) {
+	for _, name := range diff.Removed {
+		c.add(kind, name, true, "%s %q removed", noun, name)
+	}
+	for _, name := range diff.Added {
+		c.add(kind, name, false, "%s %q added", noun, name)
+	}
+	for _, name := range sortedItemKeys(diff.Changed) {
+		attrs := diff.Changed[name]
+		for _, attr := range sortedValueChangeKeys(attrs) {
+			change := attrs[attr]
+			if breakingAttrs[attr] {
+				c.add(kind, name, true, "%s %q %s changed from %v to %v", noun, name, attr, change.Old, change.New)
+			} else {
+				c.add(kind, name, false, "%s %q %s changed", noun, name, attr)
+			}
+		}
+	}
+}
+
+// addRelationChanges adds the changes between the given relations,
+// as returned by relationAttrs. A removed relation that has been
+// replaced by an added relation with the same role and interface
+// is reported as renamed.
+func (c *upgradeChanges) addRelationChanges(from, to map[string]map[string]interface{}) {
+	diff := itemsDiff(from, to)
+	if diff == nil {
+		return
+	}
+	renamed := make(map[string]bool)
+	for _, name := range diff.Removed {
+		newName := ""
+		for _, added := range diff.Added {
+			if renamed[added] {
+				continue
+			}
+			if from[name]["role"] == to[added]["role"] && from[name]["interface"] == to[added]["interface"] {
+				newName = added
+				break
+			}
+		}
+		if newName != "" {
+			renamed[newName] = true
+			c.add("relation", name, true, "relation %q renamed to %q", name, newName)
+			continue
+		}
+		c.add("relation", name, true, "relation %q removed", name)
+	}
+	for _, name := range diff.Added {
+		if !renamed[name] {
+			c.add("relation", name, false, "relation %q added", name)
+		}
+	}
+	for _, name := range sortedItemKeys(diff.Changed) {
+		attrs := diff.Changed[name]
+		for _, attr := range sortedValueChangeKeys(attrs) {
+			change := attrs[attr]
+			switch attr {
+			case "interface", "role", "scope":
+				c.add("relation", name, true, "relation %q %s changed from %v to %v", name, attr, change.Old, change.New)
+			default:
+				c.add("relation", name, false, "relation %q %s changed", name, attr)
+			}
+		}
+	}
+}
+
+// stringSetDiff returns the sorted strings that are only in
+// from (removed) and only in to (added).
+func stringSetDiff(from, to []string) (removed, added []string) {
+	fromSet := make(map[string]bool)
+	for _, s := range from {
+		fromSet[s] = true
+	}
+	toSet := make(map[string]bool)
+	for _, s := range to {
+		toSet[s] = true
+		if !fromSet[s] {
+			added = append(added, s)
+		}
+	}
+	for s := range fromSet {
+		if !toSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+	return removed, added
+}
+
+func sortedItemKeys(m map[string]map[string]params.ValueChange) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedValueChangeKeys(m map[string]params.ValueChange) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
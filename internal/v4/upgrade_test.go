@@ -0,0 +1,250 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	charmtesting "gopkg.in/juju/charm.v5-unstable/testing"
+
+	"gopkg.in/juju/charmstore.v4/internal/charmstore"
+	"gopkg.in/juju/charmstore.v4/internal/storetesting"
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+func (s *APISuite) TestMetaUpgradeReport(c *gc.C) {
+	s.addCharm(c, "wordpress", "trusty/wordpress-1")
+	s.addCharm(c, "mysql", "trusty/wordpress-2")
+
+	// Without a from revision, the previous revision is used.
+	report := s.getUpgradeReport(c, "trusty/wordpress-2/meta/upgrade-report")
+	c.Assert(report.From, jc.DeepEquals, charm.MustParseReference("cs:trusty/wordpress-1"))
+	c.Assert(report.Breaking, gc.Equals, true)
+	for _, expect := range []params.UpgradeChange{{
+		Kind:        "metadata",
+		Name:        "summary",
+		Description: "summary changed",
+	}, {
+		Kind:        "relation",
+		Name:        "db",
+		Breaking:    true,
+		Description: `relation "db" removed`,
+	}, {
+		Kind:        "relation",
+		Name:        "server",
+		Description: `relation "server" added`,
+	}, {
+		Kind:        "config",
+		Name:        "blog-title",
+		Breaking:    true,
+		Description: `option "blog-title" removed`,
+	}} {
+		assertContainsChange(c, report.Changes, expect)
+	}
+
+	// The first revision has nothing to be compared with.
+	report = s.getUpgradeReport(c, "trusty/wordpress-1/meta/upgrade-report")
+	c.Assert(report, jc.DeepEquals, params.UpgradeReportResponse{})
+}
+
+func (s *APISuite) TestMetaUpgradeReportFrom(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	s.addCharm(c, "mysql", "cs:~charmers/trusty/wordpress-2")
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-3")
+
+	report := s.getUpgradeReport(c, "~charmers/trusty/wordpress-3/meta/upgrade-report?from=1")
+	c.Assert(report, jc.DeepEquals, params.UpgradeReportResponse{
+		From: charm.MustParseReference("cs:~charmers/trusty/wordpress-1"),
+	})
+
+	report = s.getUpgradeReport(c, "~charmers/trusty/wordpress-3/meta/upgrade-report")
+	c.Assert(report.From, jc.DeepEquals, charm.MustParseReference("cs:~charmers/trusty/wordpress-2"))
+	c.Assert(report.Breaking, gc.Equals, false)
+	assertContainsChange(c, report.Changes, params.UpgradeChange{
+		Kind:        "config",
+		Name:        "blog-title",
+		Description: `option "blog-title" added`,
+	})
+}
+
+func (s *APISuite) TestMetaUpgradeReportEmbargoedRevision(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	err := s.store.AddCharm(storetesting.Charms.CharmDir("mysql"), charmstore.AddParams{
+		URL:                 charm.MustParseReference("cs:~charmers/trusty/wordpress-2"),
+		PromulgatedRevision: -1,
+		BlobName:            "blobName",
+		BlobHash:            fakeBlobHash,
+		BlobSize:            fakeBlobSize,
+		PublishAt:           time.Now().Add(time.Hour),
+	})
+	c.Assert(err, gc.IsNil)
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-3")
+
+	// The embargoed revision is not used as the previous revision.
+	report := s.getUpgradeReport(c, "~charmers/trusty/wordpress-3/meta/upgrade-report")
+	c.Assert(report.From, jc.DeepEquals, charm.MustParseReference("cs:~charmers/trusty/wordpress-1"))
+
+	// It cannot be requested explicitly by users not allowed to modify it.
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("~charmers/trusty/wordpress-3/meta/upgrade-report?from=2"),
+		ExpectStatus: http.StatusNotFound,
+		ExpectBody: params.Error{
+			Code:    params.ErrNotFound,
+			Message: "entity not found",
+		},
+	})
+
+	// Users allowed to modify it can.
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler:  s.srv,
+		URL:      storeURL("~charmers/trusty/wordpress-3/meta/upgrade-report?from=2"),
+		Username: serverParams.AuthUsername,
+		Password: serverParams.AuthPassword,
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var resp params.UpgradeReportResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &resp)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.From, jc.DeepEquals, charm.MustParseReference("cs:~charmers/trusty/wordpress-2"))
+}
+
+func (s *APISuite) TestMetaUpgradeReportRenamedRelation(c *gc.C) {
+	s.addCharmSpec(c, "cs:~charmers/trusty/foo-1", charmtesting.CharmSpec{
+		Meta: `
+name: foo
+summary: s
+description: d
+provides:
+    website:
+        interface: http
+requires:
+    db:
+        interface: mysql
+`,
+	})
+	s.addCharmSpec(c, "cs:~charmers/trusty/foo-2", charmtesting.CharmSpec{
+		Meta: `
+name: foo
+summary: s
+description: d
+provides:
+    url:
+        interface: http
+requires:
+    db:
+        interface: pgsql
+`,
+	})
+	report := s.getUpgradeReport(c, "~charmers/trusty/foo-2/meta/upgrade-report")
+	c.Assert(report.Breaking, gc.Equals, true)
+	assertContainsChange(c, report.Changes, params.UpgradeChange{
+		Kind:        "relation",
+		Name:        "website",
+		Breaking:    true,
+		Description: `relation "website" renamed to "url"`,
+	})
+	assertContainsChange(c, report.Changes, params.UpgradeChange{
+		Kind:        "relation",
+		Name:        "db",
+		Breaking:    true,
+		Description: `relation "db" interface changed from mysql to pgsql`,
+	})
+	for _, change := range report.Changes {
+		c.Assert(change.Description, gc.Not(gc.Equals), `relation "url" added`)
+	}
+}
+
+func (s *APISuite) TestBulkMetaUpgradeReport(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-2")
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler: s.srv,
+		URL:     storeURL("meta/upgrade-report?id=~charmers/trusty/wordpress-2&id=~charmers/trusty/wordpress-1"),
+		ExpectBody: map[string]params.UpgradeReportResponse{
+			"~charmers/trusty/wordpress-2": {
+				From: charm.MustParseReference("cs:~charmers/trusty/wordpress-1"),
+			},
+			"~charmers/trusty/wordpress-1": {},
+		},
+	})
+}
+
+var metaUpgradeReportErrorsTests = []struct {
+	about        string
+	url          string
+	expectStatus int
+	expectBody   params.Error
+}{{
+	about:        "invalid from revision",
+	url:          "~charmers/trusty/wordpress-1/meta/upgrade-report?from=bad",
+	expectStatus: http.StatusBadRequest,
+	expectBody: params.Error{
+		Code:    params.ErrBadRequest,
+		Message: `invalid from revision "bad"`,
+	},
+}, {
+	about:        "from revision not found",
+	url:          "~charmers/trusty/wordpress-1/meta/upgrade-report?from=42",
+	expectStatus: http.StatusNotFound,
+	expectBody: params.Error{
+		Code:    params.ErrNotFound,
+		Message: "entity not found",
+	},
+}}
+
+func (s *APISuite) TestMetaUpgradeReportErrors(c *gc.C) {
+	s.addCharm(c, "wordpress", "cs:~charmers/trusty/wordpress-1")
+	for i, test := range metaUpgradeReportErrorsTests {
+		c.Logf("test %d: %s", i, test.about)
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler:      s.srv,
+			URL:          storeURL(test.url),
+			ExpectStatus: test.expectStatus,
+			ExpectBody:   test.expectBody,
+		})
+	}
+}
+
+func (s *APISuite) getUpgradeReport(c *gc.C, path string) params.UpgradeReportResponse {
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL(path),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("body: %s", rec.Body.Bytes()))
+	var report params.UpgradeReportResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &report)
+	c.Assert(err, gc.IsNil)
+	return report
+}
+
+// addCharmSpec adds a charm created from the given spec to the store
+// with the given id.
+func (s *APISuite) addCharmSpec(c *gc.C, id string, spec charmtesting.CharmSpec) {
+	path := filepath.Join(c.MkDir(), "charm.zip")
+	err := ioutil.WriteFile(path, charmtesting.NewCharm(c, spec).ArchiveBytes(), 0644)
+	c.Assert(err, gc.IsNil)
+	ch, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	err = s.store.AddCharmWithArchive(charm.MustParseReference(id), nil, ch)
+	c.Assert(err, gc.IsNil)
+}
+
+// assertContainsChange asserts that changes contains the expected change.
+func assertContainsChange(c *gc.C, changes []params.UpgradeChange, expect params.UpgradeChange) {
+	for _, change := range changes {
+		if change == expect {
+			return
+		}
+	}
+	c.Fatalf("change %#v not found in %#v", expect, changes)
+}
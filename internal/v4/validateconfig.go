@@ -0,0 +1,210 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/juju/utils/jsonhttp"
+	"gopkg.in/errgo.v1"
+	"gopkg.in/juju/charm.v5-unstable"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+// maxConfigSize holds the maximum size of the body
+// of a validate-config request.
+const maxConfigSize = 1024 * 1024
+
+// POST id/validate-config
+// https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idvalidate-config
+func (h *Handler) serveValidateConfig(id *charm.Reference, _ bool, w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		return params.ErrMethodNotAllowed
+	}
+	entity, err := h.store.FindEntity(id, "charmconfig", "bundledata")
+	if err != nil {
+		return errgo.Mask(err, errgo.Is(params.ErrNotFound))
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, maxConfigSize+1))
+	if err != nil {
+		return errgo.Notef(err, "cannot read request body")
+	}
+	if len(data) > maxConfigSize {
+		return badRequestf(nil, "request body too large")
+	}
+	var response *params.ValidateConfigResponse
+	if entity.BundleData != nil {
+		var overrides map[string]map[string]interface{}
+		if err := yaml.Unmarshal(data, &overrides); err != nil {
+			return badRequestf(err, "cannot unmarshal settings")
+		}
+		response, err = h.validateBundleConfig(entity.BundleData, overrides, req)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	} else {
+		var settings map[string]interface{}
+		if err := yaml.Unmarshal(data, &settings); err != nil {
+			return badRequestf(err, "cannot unmarshal settings")
+		}
+		response = validateConfig(entity.CharmConfig, settings)
+	}
+	return jsonhttp.WriteJSON(w, http.StatusOK, response)
+}
+
+// validateBundleConfig validates the options of every service in the
+// given bundle against the configuration of the charm used by the
+// service. The options in overrides, keyed by service name, replace
+// those specified in the bundle.
+// Charms that the given request is not authorized to read are
+// reported as not found.
+func (h *Handler) validateBundleConfig(data *charm.BundleData, overrides map[string]map[string]interface{}, req *http.Request) (*params.ValidateConfigResponse, error) {
+	response := &params.ValidateConfigResponse{
+		Services: make(map[string]*params.ValidateConfigResponse),
+	}
+	for name := range overrides {
+		if _, ok := data.Services[name]; !ok {
+			addConfigError(response, name, "unknown service")
+		}
+	}
+	charms, err := h.bundleCharms(data.RequiredCharms())
+	if err != nil {
+		return nil, errgo.Notef(err, "cannot retrieve bundle charms")
+	}
+	h.removeUnreadableCharms(charms, req)
+	for name, svc := range data.Services {
+		ch, ok := charms[svc.Charm]
+		if !ok {
+			addConfigError(response, name, fmt.Sprintf("charm %q not found", svc.Charm))
+			continue
+		}
+		settings := make(map[string]interface{})
+		for key, val := range svc.Options {
+			settings[key] = val
+		}
+		for key, val := range overrides[name] {
+			settings[key] = val
+		}
+		response.Services[name] = validateConfig(ch.Config(), settings)
+	}
+	return response, nil
+}
+
+// validateConfig validates the given settings against the given charm
+// configuration and returns the resulting errors and effective
+// configuration.
+func validateConfig(config *charm.Config, settings map[string]interface{}) *params.ValidateConfigResponse {
+	response := &params.ValidateConfigResponse{
+		Config: make(map[string]interface{}),
+	}
+	var options map[string]charm.Option
+	if config != nil {
+		options = config.Options
+	}
+	for name, opt := range options {
+		if opt.Default != nil {
+			response.Config[name] = opt.Default
+		}
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		opt, ok := options[name]
+		if !ok {
+			addConfigError(response, name, "unknown option")
+			continue
+		}
+		value := settings[name]
+		if value == nil {
+			// A nil value leaves the option with its default value.
+			continue
+		}
+		value, err := checkOptionValue(opt.Type, value)
+		if err != nil {
+			addConfigError(response, name, err.Error())
+			continue
+		}
+		response.Config[name] = value
+	}
+	return response
+}
+
+// addConfigError records an error for the given option
+// or service name in the given response.
+func addConfigError(response *params.ValidateConfigResponse, name, msg string) {
+	if response.Errors == nil {
+		response.Errors = make(map[string]string)
+	}
+	response.Errors[name] = msg
+}
+
+// checkOptionValue checks that the given value is valid for a config
+// option of the given type, and returns the value converted to
+// that type. String values are parsed if the option is not
+// itself a string.
+func checkOptionValue(optionType string, value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok && optionType != "string" {
+		var parsed interface{}
+		var err error
+		switch optionType {
+		case "int":
+			parsed, err = strconv.ParseInt(s, 10, 64)
+		case "float":
+			parsed, err = strconv.ParseFloat(s, 64)
+		case "boolean":
+			parsed, err = strconv.ParseBool(s)
+		default:
+			return nil, errgo.Newf("unknown option type %q", optionType)
+		}
+		if err != nil {
+			return nil, errgo.Newf("cannot parse %q as %s", s, optionType)
+		}
+		return parsed, nil
+	}
+	switch optionType {
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "int":
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			// JSON numbers are unmarshaled as float64.
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		}
+	case "float":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case "boolean":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	default:
+		return nil, errgo.Newf("unknown option type %q", optionType)
+	}
+	return nil, errgo.Newf("expected %s, got %#v", optionType, value)
+}
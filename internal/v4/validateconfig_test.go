@@ -0,0 +1,164 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package v4_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/juju/testing/httptesting"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charmstore.v4/params"
+)
+
+var validateConfigTests = []struct {
+	about        string
+	url          string
+	body         string
+	expectStatus int
+	expectBody   interface{}
+}{{
+	about: "no settings",
+	url:   "precise/dummy-10/validate-config",
+	body:  "{}",
+	expectBody: params.ValidateConfigResponse{
+		Config: map[string]interface{}{
+			"title":    "My Title",
+			"username": "admin001",
+		},
+	},
+}, {
+	about: "valid JSON settings",
+	url:   "precise/dummy-10/validate-config",
+	body:  `{"title": "Another Title", "skill-level": 42}`,
+	expectBody: params.ValidateConfigResponse{
+		Config: map[string]interface{}{
+			"title":       "Another Title",
+			"username":    "admin001",
+			"skill-level": 42,
+		},
+	},
+}, {
+	about: "valid YAML settings with a string value for an int option",
+	url:   "precise/dummy-10/validate-config",
+	body:  "outlook: sunny\nskill-level: '7'\n",
+	expectBody: params.ValidateConfigResponse{
+		Config: map[string]interface{}{
+			"title":       "My Title",
+			"username":    "admin001",
+			"outlook":     "sunny",
+			"skill-level": 7,
+		},
+	},
+}, {
+	about: "invalid settings",
+	url:   "precise/dummy-10/validate-config",
+	body:  `{"titel": "Another Title", "skill-level": "lots", "username": true, "outlook": 4}`,
+	expectBody: params.ValidateConfigResponse{
+		Errors: map[string]string{
+			"titel":       "unknown option",
+			"skill-level": `cannot parse "lots" as int`,
+			"username":    "expected string, got true",
+			"outlook":     "expected string, got 4",
+		},
+		Config: map[string]interface{}{
+			"title":    "My Title",
+			"username": "admin001",
+		},
+	},
+}, {
+	about: "bundle",
+	url:   "bundle/wordpress-simple-42/validate-config",
+	body:  `{"wordpress": {"blog-title": 42}, "mysql": {"bad": 1}, "varnish": {}}`,
+	expectBody: params.ValidateConfigResponse{
+		Errors: map[string]string{
+			"varnish": "unknown service",
+		},
+		Services: map[string]*params.ValidateConfigResponse{
+			"wordpress": {
+				Errors: map[string]string{
+					"blog-title": "expected string, got 42",
+				},
+				Config: map[string]interface{}{
+					"blog-title": "My Title",
+				},
+			},
+			"mysql": {
+				Errors: map[string]string{
+					"bad": "unknown option",
+				},
+			},
+		},
+	},
+}, {
+	about:        "entity not found",
+	url:          "precise/no-such/validate-config",
+	body:         "{}",
+	expectStatus: http.StatusNotFound,
+	expectBody: params.Error{
+		Code:    params.ErrNotFound,
+		Message: `no matching charm or bundle for "cs:precise/no-such"`,
+	},
+}}
+
+func (s *APISuite) TestValidateConfig(c *gc.C) {
+	s.addCharm(c, "dummy", "precise/dummy-10")
+	s.addCharm(c, "wordpress", "precise/wordpress-23")
+	s.addCharm(c, "mysql", "precise/mysql-5")
+	s.addBundle(c, "wordpress-simple", "bundle/wordpress-simple-42")
+	for i, test := range validateConfigTests {
+		c.Logf("test %d: %s", i, test.about)
+		expectStatus := test.expectStatus
+		if expectStatus == 0 {
+			expectStatus = http.StatusOK
+		}
+		// Note that no credentials are provided: only read
+		// access is required to validate a configuration.
+		httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+			Handler: s.srv,
+			URL:     storeURL(test.url),
+			Method:  "POST",
+			Header: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			Body:         strings.NewReader(test.body),
+			ExpectStatus: expectStatus,
+			ExpectBody:   test.expectBody,
+		})
+	}
+}
+
+func (s *APISuite) TestValidateConfigMethodNotAllowed(c *gc.C) {
+	s.addCharm(c, "dummy", "precise/dummy-10")
+	httptesting.AssertJSONCall(c, httptesting.JSONCallParams{
+		Handler:      s.srv,
+		URL:          storeURL("precise/dummy-10/validate-config"),
+		ExpectStatus: http.StatusMethodNotAllowed,
+		ExpectBody: params.Error{
+			Code:    params.ErrMethodNotAllowed,
+			Message: params.ErrMethodNotAllowed.Error(),
+		},
+	})
+}
+
+func (s *APISuite) TestValidateConfigInvalidBody(c *gc.C) {
+	s.addCharm(c, "dummy", "precise/dummy-10")
+	rec := httptesting.DoRequest(c, httptesting.DoRequestParams{
+		Handler: s.srv,
+		URL:     storeURL("precise/dummy-10/validate-config"),
+		Method:  "POST",
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+		},
+		Body: strings.NewReader("{{"),
+	})
+	c.Assert(rec.Code, gc.Equals, http.StatusBadRequest)
+	var perr params.Error
+	err := json.Unmarshal(rec.Body.Bytes(), &perr)
+	c.Assert(err, gc.IsNil)
+	c.Assert(perr.Code, gc.Equals, params.ErrBadRequest)
+	c.Assert(perr.Message, gc.Matches, "cannot unmarshal settings: .*")
+}
@@ -29,6 +29,8 @@ const (
 	ErrMultipleErrors   ErrorCode = "multiple errors"
 	ErrUnauthorized     ErrorCode = "unauthorized"
 	ErrMethodNotAllowed ErrorCode = "method not allowed"
+	ErrTooManyRequests  ErrorCode = "too many requests"
+	ErrQuotaExceeded    ErrorCode = "quota exceeded"
 
 	// Note that these error codes sit in the same name space
 	// as the bakery error codes defined in gopkg.in/macaroon-bakery.v0/httpbakery .
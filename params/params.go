@@ -22,6 +22,22 @@ const (
 	// EntityIdHeader specifies the header attribute that will hold the
 	// id of the entity for archive GET responses.
 	EntityIdHeader = "Entity-Id"
+
+	// EntityRedirectHeader specifies the header attribute that will
+	// hold the id the requested id resolved to, when the request
+	// refers to a charm or bundle by an alias or by its id before
+	// being moved to another namespace.
+	EntityRedirectHeader = "Entity-Redirect"
+
+	// WarningHeader specifies the header attribute that will hold
+	// a warning about the entity for archive GET responses,
+	// for instance when the entity is deprecated.
+	WarningHeader = "Warning"
+
+	// AdvisoriesHeader specifies the header attribute that will hold
+	// the comma separated ids of the security advisories affecting
+	// the entity for archive GET responses.
+	AdvisoriesHeader = "Security-Advisories"
 )
 
 // Special user/group names.
@@ -43,6 +59,120 @@ type ArchiveUploadResponse struct {
 	Id *charm.Reference
 }
 
+// ArchiveDryRunResponse holds the result of a post to /id/archive
+// when the dry-run flag is set.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idarchive
+type ArchiveDryRunResponse struct {
+	// Id holds the id that the uploaded entity would be given.
+	Id *charm.Reference `json:",omitempty"`
+
+	// PromulgatedId holds the promulgated id that the uploaded
+	// entity would be given, if any.
+	PromulgatedId *charm.Reference `json:",omitempty"`
+
+	// Hash and Hash256 hold the SHA384 and SHA256 hashes
+	// of the archive, in hexadecimal format.
+	Hash    string
+	Hash256 string
+
+	// Size holds the size of the archive.
+	Size int64
+
+	// Errors holds any problems found when verifying the archive.
+	// If it is empty, the archive would be accepted.
+	Errors []string `json:",omitempty"`
+}
+
+// DiffResponse holds the result of an id/diff GET request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-iddiff
+type DiffResponse struct {
+	// From and To hold the ids of the compared entities.
+	From *charm.Reference
+	To   *charm.Reference
+
+	// Added and Removed hold the names of the files that
+	// are present only in the To or the From archive respectively.
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+
+	// Modified holds the files whose contents differ.
+	Modified []FileDiff `json:",omitempty"`
+
+	// Metadata, Config and Actions hold the structural
+	// differences between the metadata.yaml, config.yaml
+	// and actions.yaml files of two charms. Each is
+	// omitted when there are no differences.
+	Metadata *MetadataDiff `json:",omitempty"`
+	Config   *ItemsDiff    `json:",omitempty"`
+	Actions  *ItemsDiff    `json:",omitempty"`
+}
+
+// FileDiff holds information about a file that differs
+// between two archives.
+type FileDiff struct {
+	Name string
+
+	// OldSize and NewSize hold the sizes of the file
+	// in the From and To archives.
+	OldSize int64
+	NewSize int64
+
+	// Diff holds a unified diff of the file contents.
+	// It is omitted when the file is not text or is too
+	// large to compare.
+	Diff string `json:",omitempty"`
+}
+
+// MetadataDiff holds the differences between two charm metadata
+// documents.
+type MetadataDiff struct {
+	// Fields maps the name of each changed top level
+	// metadata field to its old and new values.
+	Fields map[string]ValueChange `json:",omitempty"`
+
+	// Relations holds the changes to the charm relations,
+	// keyed by relation name.
+	Relations *ItemsDiff `json:",omitempty"`
+}
+
+// ItemsDiff holds the differences between two sets of named items,
+// such as config options or actions.
+type ItemsDiff struct {
+	// Added and Removed hold the names of the items that are
+	// present only in the new or the old set respectively.
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+
+	// Changed maps the name of each item present in both sets
+	// to the attributes of that item that have changed.
+	Changed map[string]map[string]ValueChange `json:",omitempty"`
+}
+
+// ValueChange holds the old and new values of a changed attribute.
+type ValueChange struct {
+	Old interface{}
+	New interface{}
+}
+
+// ValidateConfigResponse holds the result of an id/validate-config
+// POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idvalidate-config
+type ValidateConfigResponse struct {
+	// Errors maps the name of each invalid option to a
+	// description of the problem. For bundles, it maps
+	// service names to problems with the service itself.
+	Errors map[string]string `json:",omitempty"`
+
+	// Config holds the effective charm configuration:
+	// the default values of all options overridden by
+	// any valid settings. It is omitted for bundles.
+	Config map[string]interface{} `json:",omitempty"`
+
+	// Services holds the result of validating the options of
+	// each service in a bundle, keyed by service name.
+	Services map[string]*ValidateConfigResponse `json:",omitempty"`
+}
+
 // ExpandedId holds a charm or bundle fully qualified id.
 // A slice of ExpandedId is used as response for
 // id/expand-id GET requests.
@@ -98,6 +228,369 @@ type RevisionInfoResponse struct {
 	Revisions []*charm.Reference
 }
 
+// UpgradeReportResponse holds the result of an id/meta/upgrade-report
+// GET request. See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetaupgrade-report
+type UpgradeReportResponse struct {
+	// From holds the id of the revision that the charm
+	// is compared with. It is omitted when there is no
+	// earlier revision.
+	From *charm.Reference `json:",omitempty"`
+
+	// Breaking holds whether any of the changes is breaking.
+	Breaking bool
+
+	// Changes holds all the changes between the two revisions.
+	Changes []UpgradeChange `json:",omitempty"`
+}
+
+// UpgradeChange holds a single change reported by id/meta/upgrade-report.
+type UpgradeChange struct {
+	// Kind holds the kind of thing that has changed: one of
+	// "metadata", "relation", "config", "action" or
+	// "provided-interfaces".
+	Kind string
+
+	// Name holds the name of the changed metadata field,
+	// relation, config option or action.
+	Name string `json:",omitempty"`
+
+	// Breaking holds whether the change may break
+	// existing deployments when they are upgraded.
+	Breaking bool
+
+	// Description holds a human readable description of the change.
+	Description string
+}
+
+// BundleValidateResponse holds the result of a bundle/validate POST
+// request. See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-bundlevalidate
+type BundleValidateResponse struct {
+	// Charms maps each charm reference in the bundle that
+	// could be resolved to the id of the charm it resolves to.
+	Charms map[string]*charm.Reference `json:",omitempty"`
+
+	// Errors holds the problems found when verifying the bundle.
+	// If it is empty, the bundle is valid.
+	Errors []string `json:",omitempty"`
+}
+
+// BundlePlanStep holds one step in the deployment of a bundle.
+// A slice of BundlePlanStep is used as response for id/meta/bundle-plan
+// GET requests. See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetabundle-plan
+type BundlePlanStep struct {
+	// Kind holds the kind of the step: one of "deploy",
+	// "add-machine", "add-relation" or "add-unit".
+	Kind string
+
+	// Service holds the name of the service deployed
+	// by a deploy step or extended by an add-unit step.
+	Service string `json:",omitempty"`
+
+	// Charm holds the charm used by a deploy step.
+	Charm string `json:",omitempty"`
+
+	// Options holds the service options used by a deploy step.
+	Options map[string]interface{} `json:",omitempty"`
+
+	// Machine holds the bundle machine id added
+	// by an add-machine step.
+	Machine string `json:",omitempty"`
+
+	// Series holds the series of the machine added by
+	// an add-machine step.
+	Series string `json:",omitempty"`
+
+	// Constraints holds the constraints of a deploy
+	// or add-machine step.
+	Constraints string `json:",omitempty"`
+
+	// Endpoints holds the endpoints related by an
+	// add-relation step.
+	Endpoints []string `json:",omitempty"`
+
+	// To holds the placement directive of an add-unit step.
+	// It is empty when the unit is placed on a new machine.
+	To string `json:",omitempty"`
+}
+
+// BundleCharmStatus holds the status of a charm referenced by a bundle.
+// A slice of BundleCharmStatus is used as response for
+// id/meta/bundle-charm-status GET requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetabundle-charm-status
+type BundleCharmStatus struct {
+	// Id holds the charm reference as found in the bundle.
+	Id *charm.Reference
+
+	// PinnedRevision holds the revision the reference is
+	// pinned to, or -1 if it does not specify a revision.
+	PinnedRevision int
+
+	// Latest maps each series the charm is available in to
+	// the latest revision available in that series.
+	Latest map[string]int
+
+	// Resolves holds whether the reference currently
+	// resolves to a charm.
+	Resolves bool
+
+	// Stale holds whether the reference no longer resolves, or is
+	// pinned to a revision older than the latest available one.
+	Stale bool
+}
+
+// Dependent holds information on a bundle referencing a charm.
+// A slice of Dependent is used as response for id/meta/dependents
+// GET requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetadependents
+type Dependent struct {
+	// Id holds the id of the bundle.
+	Id *charm.Reference
+
+	// Charm holds the reference used by the bundle to refer to the charm.
+	Charm *charm.Reference
+
+	// ExactRevision holds whether the bundle refers to
+	// the exact revision of the charm.
+	ExactRevision bool
+
+	// ReadACLs holds the read permissions of the bundle.
+	// It is only included in responses to admin requests.
+	ReadACLs []string `json:",omitempty"`
+
+	// Downloads holds the total download count of the bundle revision.
+	Downloads int64
+
+	// Promulgated holds whether the bundle is promulgated.
+	Promulgated bool
+}
+
+// API token operations.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#api-tokens
+const (
+	// TokenRead allows reading charms and bundles.
+	TokenRead = "read"
+
+	// TokenUpload allows uploading and publishing archives.
+	TokenUpload = "upload"
+
+	// TokenMetaWrite allows updating metadata.
+	TokenMetaWrite = "meta-write"
+)
+
+// APITokenRequest holds the body of a tokens POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-tokens
+type APITokenRequest struct {
+	// User holds the user the token authenticates as.
+	// It can only be specified by the administrator:
+	// by default, the authenticated user is used.
+	User string `json:",omitempty"`
+
+	// Description holds a human readable description of the token.
+	Description string `json:",omitempty"`
+
+	// Operations holds the operations allowed by the token.
+	Operations []string
+
+	// Scope optionally restricts the token to a namespace
+	// (for instance "~bob") or to an entity.
+	Scope string `json:",omitempty"`
+
+	// Expires holds the time after which the token is no longer valid.
+	Expires time.Time
+}
+
+// APIToken holds information on an API token.
+// It is used as response for tokens POST requests, and a
+// slice of APIToken is used as response for tokens GET requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-tokens
+type APIToken struct {
+	// Id holds the token identifier.
+	Id string
+
+	// Token holds the token to be used as bearer credentials.
+	// It is only returned when the token is created.
+	Token string `json:",omitempty"`
+
+	User        string
+	Description string `json:",omitempty"`
+	Operations  []string
+	Scope       string `json:",omitempty"`
+	Created     time.Time
+	Expires     time.Time
+}
+
+// ShareRequest holds the body of an id/share POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idshare
+type ShareRequest struct {
+	// Expires optionally holds the time after which the shared
+	// link is no longer valid. By default, the link is valid
+	// for one day.
+	Expires time.Time
+
+	// Meta holds whether the shared link also allows retrieving
+	// the metadata of the charm or bundle.
+	Meta bool `json:",omitempty"`
+}
+
+// ShareResponse holds the result of an id/share POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idshare
+type ShareResponse struct {
+	// URL holds the shared link to the entity archive, relative
+	// to the charm store API root.
+	URL string
+
+	// Token holds the share token included in URL. It can be
+	// added as the share query parameter to metadata requests
+	// if the link allows them.
+	Token string
+
+	// Expires holds the time after which the link is no longer valid.
+	Expires time.Time
+}
+
+// DeprecatedResponse holds the result of an id/meta/deprecated GET request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetadeprecated
+type DeprecatedResponse struct {
+	// Reason holds the deprecation message.
+	Reason string
+
+	// Successor optionally holds the id of the charm or
+	// bundle recommended as a replacement.
+	Successor *charm.Reference `json:",omitempty"`
+
+	// Time holds the time the entity was deprecated.
+	Time time.Time
+
+	// AllRevisions holds whether all the revisions
+	// of the charm or bundle are deprecated.
+	AllRevisions bool `json:",omitempty"`
+}
+
+// DeprecatedRequest holds the body of an id/meta/deprecated PUT request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#put-idmetadeprecated
+type DeprecatedRequest struct {
+	// Deprecated holds whether the entity is deprecated.
+	// If false, the deprecation is removed.
+	Deprecated bool
+
+	// Reason holds the deprecation message. It is
+	// required when deprecating.
+	Reason string `json:",omitempty"`
+
+	// Successor optionally holds the id of the charm or
+	// bundle recommended as a replacement.
+	Successor *charm.Reference `json:",omitempty"`
+
+	// AllRevisions holds whether the request applies to all
+	// the revisions of the charm or bundle rather than to
+	// the given revision only.
+	AllRevisions bool `json:",omitempty"`
+}
+
+// TransferRequest holds the body of an id/transfer POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idtransfer
+type TransferRequest struct {
+	// User holds the namespace the charm or bundle is moved to.
+	User string
+}
+
+// TransferResponse holds the result of an id/transfer POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idtransfer
+type TransferResponse struct {
+	// Id holds the new base id of the charm or bundle.
+	Id *charm.Reference
+}
+
+// PublishRequest holds the body of an id/publish POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idpublish
+type PublishRequest struct {
+	// Channels holds the channels the charm or bundle
+	// revision is published to.
+	Channels []Channel
+}
+
+// PublishResponse holds the result of an id/publish POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idpublish
+type PublishResponse struct {
+	// Id holds the id of the published charm or bundle revision.
+	Id *charm.Reference
+
+	// Channels holds all the channels the revision is
+	// now published to.
+	Channels []Channel
+}
+
+// Severities of security advisories, from the least to the most severe.
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// RevisionRange holds an inclusive range of revisions of a charm or
+// bundle, as numbered in the namespace of its owner.
+type RevisionRange struct {
+	// Series optionally restricts the range to the
+	// revisions of the given series.
+	Series string `json:",omitempty"`
+
+	// From and To hold the first and the last
+	// revisions in the range.
+	From, To int
+}
+
+// AdvisoryRequest holds the body of an id/advisories POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-idadvisories
+type AdvisoryRequest struct {
+	// Id holds the unique identifier of the advisory,
+	// for instance "CVE-2015-1234".
+	Id string
+
+	// Severity holds the severity of the advisory
+	// (for instance SeverityHigh).
+	Severity string
+
+	// Description describes the vulnerability.
+	Description string
+
+	// Affected holds the ranges of affected revisions.
+	Affected []RevisionRange
+
+	// Fixed optionally holds the id of the revision
+	// fixing the vulnerability.
+	Fixed *charm.Reference `json:",omitempty"`
+}
+
+// Advisory holds a security advisory. A slice of Advisory is used as
+// response for id/advisories, id/meta/advisories and advisories GET
+// requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-advisories
+type Advisory struct {
+	// Id holds the unique identifier of the advisory.
+	Id string
+
+	// Entity holds the id of the affected charm or bundle,
+	// without series and revision.
+	Entity *charm.Reference
+
+	// Severity holds the severity of the advisory.
+	Severity string
+
+	// Description describes the vulnerability.
+	Description string
+
+	// Affected holds the ranges of affected revisions.
+	Affected []RevisionRange
+
+	// Fixed holds the id of the revision fixing
+	// the vulnerability, if any.
+	Fixed *charm.Reference `json:",omitempty"`
+
+	// Time holds the time the advisory was created.
+	Time time.Time
+}
+
 // BundleCount holds the result of an id/meta/bundle-unit-count
 // or bundle-machine-count GET request.
 // See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetabundle-unit-count
@@ -179,17 +672,106 @@ type IdResponse struct {
 // PermResponse holds the result of an id/meta/perm GET request.
 // See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-idmetaperm
 type PermResponse struct {
-	Read  []string
-	Write []string
+	Read       []string
+	Write      []string
+	Upload     []string
+	Delete     []string
+	Admin      []string
+	Promulgate []string
+	Expiries   []PermExpiry `json:",omitempty"`
+}
+
+// PermExpiry holds the time after which a user or group
+// loses a permission granted to them.
+type PermExpiry struct {
+	// Perm holds the name of the permission (for instance "read").
+	Perm string
+	// Name holds the name of the user or group.
+	Name string
+	// Expires holds the time after which the permission is
+	// no longer granted.
+	Expires time.Time
 }
 
 // PermRequest holds the request of an id/meta/perm PUT request.
+// The Upload, Delete, Admin and Promulgate ACLs and the
+// Expiries are left unchanged when omitted.
 // See https://github.com/juju/charmstore/blob/v4/docs/API.md#put-idmetaperm
 type PermRequest struct {
-	Read  []string
-	Write []string
+	Read       []string
+	Write      []string
+	Upload     []string     `json:",omitempty"`
+	Delete     []string     `json:",omitempty"`
+	Admin      []string     `json:",omitempty"`
+	Promulgate []string     `json:",omitempty"`
+	Expiries   []PermExpiry `json:",omitempty"`
 }
 
+// QuotaResponse holds the result of a ~user/meta/quota GET request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetaquota
+type QuotaResponse struct {
+	// Quota holds the maximum total size in bytes of the archives
+	// in the namespace. Zero means that the size is not limited.
+	Quota int64
+
+	// Used holds the total size in bytes of the archives
+	// currently in the namespace.
+	Used int64
+}
+
+// QuotaRequest holds the request of a ~user/meta/quota PUT request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#put-usermetaquota
+type QuotaRequest struct {
+	// Quota holds the maximum total size in bytes of the archives
+	// in the namespace. Zero means that the size is not limited.
+	// If Quota is omitted, the server default quota is used.
+	Quota *int64
+}
+
+// RetentionPolicy holds the revision retention policy of a namespace.
+// It is used as the request and response of ~user/meta/retention PUT
+// and GET requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-usermetaretention
+type RetentionPolicy struct {
+	// KeepRevisions holds the number of most recent revisions
+	// kept in each series of each charm or bundle in the namespace.
+	// Zero means that no revision is pruned.
+	KeepRevisions int
+
+	// ReportOnly holds whether the revisions that would be
+	// pruned are only reported in the audit log rather than
+	// deleted.
+	ReportOnly bool `json:",omitempty"`
+}
+
+// RateLimit holds the maximum rate of the requests that a client
+// can make to a class of endpoints.
+type RateLimit struct {
+	// Rate holds the number of requests per second allowed
+	// on average.
+	Rate float64
+
+	// Burst holds the number of requests that can be made
+	// at once, before the rate applies.
+	Burst int
+}
+
+// Classes of endpoints subject to rate limiting.
+const (
+	// RateLimitDownload holds the class of archive
+	// and archive file downloads.
+	RateLimitDownload = "download"
+
+	// RateLimitUpload holds the class of archive uploads.
+	RateLimitUpload = "upload"
+
+	// RateLimitSearch holds the class of search requests.
+	RateLimitSearch = "search"
+
+	// RateLimitMeta holds the class of metadata requests.
+	RateLimitMeta = "meta"
+)
+
 const (
 	// BzrDigestKey is the extra-info key used to store the Bazaar digest
 	BzrDigestKey = "bzr-digest"
@@ -248,6 +830,39 @@ const (
 	ErrorLevel   LogLevel = "error"
 )
 
+// Channel identifies a publishing channel. Ids without a revision
+// resolve to the latest revision published to the requested channel.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#channels
+type Channel string
+
+const (
+	DevelopmentChannel Channel = "development"
+	CandidateChannel   Channel = "candidate"
+	StableChannel      Channel = "stable"
+
+	// NoChannel stands for the default channel,
+	// which is StableChannel.
+	NoChannel Channel = ""
+)
+
+// OrderedChannels holds all the valid channels, from
+// the most to the least stable.
+var OrderedChannels = []Channel{
+	StableChannel,
+	CandidateChannel,
+	DevelopmentChannel,
+}
+
+// ValidChannel reports whether c is a valid channel.
+func ValidChannel(c Channel) bool {
+	for _, vc := range OrderedChannels {
+		if c == vc {
+			return true
+		}
+	}
+	return false
+}
+
 // LogType defines log types (e.g. "ingestion") to be used in log requests and
 // responses.
 type LogType string
@@ -262,3 +877,234 @@ const (
 	LegacyStatisticsImportStart    = "legacy statistics import started"
 	LegacyStatisticsImportComplete = "legacy statistics import completed"
 )
+
+// First-party macaroon caveat conditions understood by the charm store.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-macaroon
+const (
+	// OperationCaveat restricts a macaroon to the space separated
+	// list of operations specified as argument (see OperationRead,
+	// OperationWrite and OperationAdmin).
+	OperationCaveat = "operation"
+
+	// EntityCaveat restricts a macaroon to the space separated list
+	// of base URL prefixes specified as argument, for instance
+	// "cs:~bob/wordpress" or "cs:~bob".
+	EntityCaveat = "entity"
+
+	// ExpiresCaveat restricts a macaroon to requests made
+	// before the RFC3339 time specified as argument.
+	ExpiresCaveat = "expires"
+
+	// ClientIPCaveat restricts a macaroon to requests made from the
+	// space separated list of IP addresses or CIDR networks
+	// specified as argument.
+	ClientIPCaveat = "client-ip"
+)
+
+// Operations used with the OperationCaveat macaroon caveat.
+const (
+	// OperationRead allows GET and HEAD requests on entities.
+	OperationRead = "read"
+
+	// OperationWrite allows all other requests on entities,
+	// except the ones allowed by OperationAdmin.
+	OperationWrite = "write"
+
+	// OperationAdmin allows requests not referring to an entity
+	// and requiring authorization, for instance managing logs
+	// and API tokens, and requests changing the permissions,
+	// aliases, deprecation, advisories or promulgation of an entity.
+	OperationAdmin = "admin"
+)
+
+// MacaroonRequest holds the body of a macaroon POST request.
+// All the fields are optional: each one that is specified adds a
+// first-party caveat to the resulting macaroon.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-macaroon
+type MacaroonRequest struct {
+	// Operations holds the operations allowed by the macaroon.
+	Operations []string `json:",omitempty"`
+
+	// Entities holds the base URL prefixes the macaroon
+	// is restricted to, for instance "cs:~bob/wordpress".
+	Entities []string `json:",omitempty"`
+
+	// Expires holds the time after which the macaroon is no longer valid.
+	Expires time.Time
+
+	// ClientIPs holds the IP addresses or CIDR networks
+	// the macaroon can be used from.
+	ClientIPs []string `json:",omitempty"`
+}
+
+// Operations recorded in the audit log.
+const (
+	// AuditUpload records the upload of a charm or bundle.
+	AuditUpload = "upload"
+
+	// AuditDelete records the deletion of a charm or bundle.
+	AuditDelete = "delete"
+
+	// AuditSetPerm records a change to the permissions
+	// of a charm or bundle.
+	AuditSetPerm = "set-perm"
+
+	// AuditSetExtraInfo records a change to the extra-info
+	// of a charm or bundle.
+	AuditSetExtraInfo = "set-extra-info"
+
+	// AuditSetNamespacePerm records a change to the default
+	// permissions of a namespace.
+	AuditSetNamespacePerm = "set-namespace-perm"
+
+	// AuditSetNamespaceExtraInfo records a change to the default
+	// extra-info of a namespace.
+	AuditSetNamespaceExtraInfo = "set-namespace-extra-info"
+
+	// AuditSetNamespaceQuota records a change to the storage
+	// quota of a namespace.
+	AuditSetNamespaceQuota = "set-namespace-quota"
+
+	// AuditCreateOrg records the creation of an organisation.
+	AuditCreateOrg = "create-org"
+
+	// AuditSetOrgMember records the addition of a member to an
+	// organisation, or a change to the role of a member.
+	AuditSetOrgMember = "set-org-member"
+
+	// AuditRemoveOrgMember records the removal of a member
+	// from an organisation.
+	AuditRemoveOrgMember = "remove-org-member"
+
+	// AuditTransfer records the transfer of a charm or bundle
+	// and all its revisions to another namespace.
+	AuditTransfer = "transfer"
+
+	// AuditSetAliases records a change to the aliases
+	// of a charm or bundle.
+	AuditSetAliases = "set-aliases"
+
+	// AuditSetDeprecated records a change to the deprecated
+	// status of a charm or bundle.
+	AuditSetDeprecated = "set-deprecated"
+
+	// AuditPublish records the publication of a charm or
+	// bundle revision to channels.
+	AuditPublish = "publish"
+
+	// AuditAddAdvisory records the creation of a security
+	// advisory about a charm or bundle.
+	AuditAddAdvisory = "add-advisory"
+
+	// AuditSetNamespaceRetention records a change to the
+	// revision retention policy of a namespace.
+	AuditSetNamespaceRetention = "set-namespace-retention"
+
+	// AuditPrune records the deletion of a charm or bundle
+	// revision by the retention policy of its namespace.
+	AuditPrune = "prune"
+
+	// AuditPruneReport records the revisions that the retention
+	// policy of a namespace would delete, when the policy only
+	// reports them.
+	AuditPruneReport = "prune-report"
+
+	// AuditShare records the creation of a shared link
+	// to a charm or bundle revision.
+	AuditShare = "share"
+)
+
+// AuditEntry holds the record of a write operation performed on the
+// charm store. A slice of AuditEntry is used as response for audit
+// GET requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-audit
+type AuditEntry struct {
+	// Time holds the time of the operation.
+	Time time.Time
+
+	// User holds the name of the user performing the operation.
+	User string `json:",omitempty"`
+
+	// Admin holds whether the operation was performed with
+	// the administrator credentials.
+	Admin bool `json:",omitempty"`
+
+	// TokenId holds the identifier of the API token used
+	// to authenticate, if any.
+	TokenId string `json:",omitempty"`
+
+	// Operation holds the performed operation (for instance AuditSetPerm).
+	Operation string
+
+	// Entity holds the id of the affected charm or bundle, if any.
+	Entity *charm.Reference `json:",omitempty"`
+
+	// Namespace holds the affected namespace, if any.
+	Namespace string `json:",omitempty"`
+
+	// Old and New hold the changed values before and after
+	// the change, for permission and extra-info changes.
+	Old *json.RawMessage `json:",omitempty"`
+	New *json.RawMessage `json:",omitempty"`
+
+	// ClientAddr holds the network address of the client.
+	ClientAddr string
+}
+
+// Roles of the members of an organisation.
+const (
+	// OrgOwner is the role of the members who can manage the
+	// organisation members and the permissions of its charms and
+	// bundles, and delete or promulgate them.
+	OrgOwner = "owner"
+
+	// OrgMember is the role of the members who can upload charms
+	// and bundles to the organisation and change their metadata.
+	OrgMember = "member"
+
+	// OrgReader is the role of the members who can only read
+	// the charms and bundles of the organisation.
+	OrgReader = "reader"
+)
+
+// OrgGroup returns the name of the group, as used in permissions,
+// holding the members of the given organisation with the given role.
+// If role is empty, the group holds all the members. Organisation
+// groups are prefixed with "org:", which is not valid in user and
+// group names, so that they cannot be mistaken for groups declared
+// by the identity service.
+func OrgGroup(org, role string) string {
+	if role == "" {
+		return "org:" + org
+	}
+	return "org:" + org + "/" + role
+}
+
+// OrgRequest holds the request of an orgs POST request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#post-orgs
+type OrgRequest struct {
+	// Name holds the name of the new organisation.
+	Name string
+
+	// Owner holds the name of the first owner of the organisation.
+	Owner string
+}
+
+// OrgMember holds a member of an organisation. A slice of OrgMember
+// is used as response for ~org/meta/members GET requests.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#get-orgmetamembers
+type OrgMember struct {
+	// User holds the name of the member.
+	User string
+
+	// Role holds the role of the member (for instance OrgOwner).
+	Role string
+}
+
+// OrgMemberRequest holds the request of a ~org/meta/members/user
+// PUT request.
+// See https://github.com/juju/charmstore/blob/v4/docs/API.md#put-orgmetamembersuser
+type OrgMemberRequest struct {
+	// Role holds the role of the member (for instance OrgMember).
+	Role string
+}
@@ -9,6 +9,8 @@ const (
 	StatsArchiveDelete       = "archive-delete"
 	StatsArchiveFailedUpload = "archive-failed-upload"
 	StatsArchiveUpload       = "archive-upload"
+	StatsShareCreate         = "share-create"
+	StatsShareUse            = "share-use"
 	// The following kinds are in use in the legacy API.
 	StatsCharmInfo    = "charm-info"
 	StatsCharmMissing = "charm-missing"
@@ -5,8 +5,8 @@ package charmstore
 
 import (
 	"fmt"
-	"net/http"
 	"sort"
+	"time"
 
 	"gopkg.in/macaroon-bakery.v0/bakery"
 	"gopkg.in/mgo.v2"
@@ -15,6 +15,7 @@ import (
 	"gopkg.in/juju/charmstore.v4/internal/elasticsearch"
 	"gopkg.in/juju/charmstore.v4/internal/legacy"
 	"gopkg.in/juju/charmstore.v4/internal/v4"
+	"gopkg.in/juju/charmstore.v4/params"
 )
 
 // Versions of the API that can be served.
@@ -52,12 +53,64 @@ type ServerParams struct {
 	// PublicKeyLocator holds a public key store.
 	// It may be nil.
 	PublicKeyLocator bakery.PublicKeyLocator
+
+	// GroupsFile optionally holds the path of a YAML file mapping
+	// group names to their members, used to resolve user groups.
+	GroupsFile string
+
+	// IdentityAPIURL optionally holds the URL of the identity
+	// service API used to resolve user groups. It is ignored
+	// if GroupsFile is set.
+	IdentityAPIURL string
+
+	// IdentityAPITimeout holds the maximum duration of the
+	// requests to the identity service API. If zero, a default
+	// timeout is used.
+	IdentityAPITimeout time.Duration
+
+	// GroupsCacheTTL holds the duration for which user groups
+	// are cached. If zero, a default duration is used.
+	GroupsCacheTTL time.Duration
+
+	// ACLPruneInterval holds the interval between removals
+	// of expired time-limited permissions. If zero, expired
+	// permissions are not removed, although they are still
+	// ignored when checking access.
+	ACLPruneInterval time.Duration
+
+	// PublishScheduledInterval holds the interval between
+	// publications of the embargoed charms and bundles whose
+	// publication time has been reached. If zero, embargoed
+	// charms and bundles are only published explicitly.
+	PublishScheduledInterval time.Duration
+
+	// RetentionInterval holds the interval between applications
+	// of the namespace retention policies. If zero, revisions
+	// are never pruned.
+	RetentionInterval time.Duration
+
+	// RateLimits holds the maximum rate of the requests that
+	// each client can make to each class of endpoints, keyed
+	// by class (see params.RateLimitDownload and friends).
+	// Classes with no limit are not rate limited.
+	RateLimits map[string]params.RateLimit
+
+	// StorageQuota holds the default maximum total size in bytes
+	// of the archives in a user namespace. If zero, the size is
+	// not limited unless a quota is set for the namespace.
+	StorageQuota int64
 }
 
-// NewServer returns a new handler that handles charm store requests and stores
-// its data in the given database. The handler will serve the specified
+// Server handles charm store requests. Close must be called
+// to stop its background jobs when it is no longer used.
+type Server struct {
+	*charmstore.Server
+}
+
+// NewServer returns a new server that handles charm store requests and stores
+// its data in the given database. The server will serve the specified
 // versions of the API using the given configuration.
-func NewServer(db *mgo.Database, es *elasticsearch.Database, idx string, config ServerParams, serveVersions ...string) (http.Handler, error) {
+func NewServer(db *mgo.Database, es *elasticsearch.Database, idx string, config ServerParams, serveVersions ...string) (*Server, error) {
 	newAPIs := make(map[string]charmstore.NewAPIHandlerFunc)
 	for _, vers := range serveVersions {
 		newAPI := versions[vers]
@@ -73,5 +126,9 @@ func NewServer(db *mgo.Database, es *elasticsearch.Database, idx string, config
 			Index:    idx,
 		}
 	}
-	return charmstore.NewServer(db, si, charmstore.ServerParams(config), newAPIs)
+	srv, err := charmstore.NewServer(db, si, charmstore.ServerParams(config), newAPIs)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{srv}, nil
 }